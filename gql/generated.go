@@ -1483,6 +1483,92 @@ type FlyctlConfigCurrentReleaseResponse struct {
 // GetApp returns FlyctlConfigCurrentReleaseResponse.App, and is useful for accessing the field via an interface.
 func (v *FlyctlConfigCurrentReleaseResponse) GetApp() FlyctlConfigCurrentReleaseApp { return v.App }
 
+// FlyctlConfigReleasesApp includes the requested fields of the GraphQL type App.
+type FlyctlConfigReleasesApp struct {
+	// Individual releases for this application, without any config processing
+	ReleasesUnprocessed FlyctlConfigReleasesAppReleasesUnprocessedReleaseUnprocessedConnection `json:"releasesUnprocessed"`
+}
+
+// GetReleasesUnprocessed returns FlyctlConfigReleasesApp.ReleasesUnprocessed, and is useful for accessing the field via an interface.
+func (v *FlyctlConfigReleasesApp) GetReleasesUnprocessed() FlyctlConfigReleasesAppReleasesUnprocessedReleaseUnprocessedConnection {
+	return v.ReleasesUnprocessed
+}
+
+// FlyctlConfigReleasesAppReleasesUnprocessedReleaseUnprocessedConnection includes the requested fields of the GraphQL type ReleaseUnprocessedConnection.
+// The GraphQL type's documentation follows.
+//
+// The connection type for ReleaseUnprocessed.
+type FlyctlConfigReleasesAppReleasesUnprocessedReleaseUnprocessedConnection struct {
+	// A list of nodes.
+	Nodes []FlyctlConfigReleasesAppReleasesUnprocessedReleaseUnprocessedConnectionNodesReleaseUnprocessed `json:"nodes"`
+	// Information to aid in pagination.
+	PageInfo FlyctlConfigReleasesAppReleasesUnprocessedReleaseUnprocessedConnectionPageInfo `json:"pageInfo"`
+}
+
+// GetNodes returns FlyctlConfigReleasesAppReleasesUnprocessedReleaseUnprocessedConnection.Nodes, and is useful for accessing the field via an interface.
+func (v *FlyctlConfigReleasesAppReleasesUnprocessedReleaseUnprocessedConnection) GetNodes() []FlyctlConfigReleasesAppReleasesUnprocessedReleaseUnprocessedConnectionNodesReleaseUnprocessed {
+	return v.Nodes
+}
+
+// GetPageInfo returns FlyctlConfigReleasesAppReleasesUnprocessedReleaseUnprocessedConnection.PageInfo, and is useful for accessing the field via an interface.
+func (v *FlyctlConfigReleasesAppReleasesUnprocessedReleaseUnprocessedConnection) GetPageInfo() FlyctlConfigReleasesAppReleasesUnprocessedReleaseUnprocessedConnectionPageInfo {
+	return v.PageInfo
+}
+
+// FlyctlConfigReleasesAppReleasesUnprocessedReleaseUnprocessedConnectionNodesReleaseUnprocessed includes the requested fields of the GraphQL type ReleaseUnprocessed.
+type FlyctlConfigReleasesAppReleasesUnprocessedReleaseUnprocessedConnectionNodesReleaseUnprocessed struct {
+	// The version of the release
+	Version int `json:"version"`
+	// Docker image URI
+	ImageRef         string      `json:"imageRef"`
+	ConfigDefinition interface{} `json:"configDefinition"`
+}
+
+// GetVersion returns FlyctlConfigReleasesAppReleasesUnprocessedReleaseUnprocessedConnectionNodesReleaseUnprocessed.Version, and is useful for accessing the field via an interface.
+func (v *FlyctlConfigReleasesAppReleasesUnprocessedReleaseUnprocessedConnectionNodesReleaseUnprocessed) GetVersion() int {
+	return v.Version
+}
+
+// GetImageRef returns FlyctlConfigReleasesAppReleasesUnprocessedReleaseUnprocessedConnectionNodesReleaseUnprocessed.ImageRef, and is useful for accessing the field via an interface.
+func (v *FlyctlConfigReleasesAppReleasesUnprocessedReleaseUnprocessedConnectionNodesReleaseUnprocessed) GetImageRef() string {
+	return v.ImageRef
+}
+
+// GetConfigDefinition returns FlyctlConfigReleasesAppReleasesUnprocessedReleaseUnprocessedConnectionNodesReleaseUnprocessed.ConfigDefinition, and is useful for accessing the field via an interface.
+func (v *FlyctlConfigReleasesAppReleasesUnprocessedReleaseUnprocessedConnectionNodesReleaseUnprocessed) GetConfigDefinition() interface{} {
+	return v.ConfigDefinition
+}
+
+// FlyctlConfigReleasesAppReleasesUnprocessedReleaseUnprocessedConnectionPageInfo includes the requested fields of the GraphQL type PageInfo.
+// The GraphQL type's documentation follows.
+//
+// Information about pagination in a connection.
+type FlyctlConfigReleasesAppReleasesUnprocessedReleaseUnprocessedConnectionPageInfo struct {
+	// When paginating forwards, are there more items?
+	HasNextPage bool `json:"hasNextPage"`
+	// When paginating forwards, the cursor to continue.
+	EndCursor string `json:"endCursor"`
+}
+
+// GetHasNextPage returns FlyctlConfigReleasesAppReleasesUnprocessedReleaseUnprocessedConnectionPageInfo.HasNextPage, and is useful for accessing the field via an interface.
+func (v *FlyctlConfigReleasesAppReleasesUnprocessedReleaseUnprocessedConnectionPageInfo) GetHasNextPage() bool {
+	return v.HasNextPage
+}
+
+// GetEndCursor returns FlyctlConfigReleasesAppReleasesUnprocessedReleaseUnprocessedConnectionPageInfo.EndCursor, and is useful for accessing the field via an interface.
+func (v *FlyctlConfigReleasesAppReleasesUnprocessedReleaseUnprocessedConnectionPageInfo) GetEndCursor() string {
+	return v.EndCursor
+}
+
+// FlyctlConfigReleasesResponse is returned by FlyctlConfigReleases on success.
+type FlyctlConfigReleasesResponse struct {
+	// Find an app by name
+	App FlyctlConfigReleasesApp `json:"app"`
+}
+
+// GetApp returns FlyctlConfigReleasesResponse.App, and is useful for accessing the field via an interface.
+func (v *FlyctlConfigReleasesResponse) GetApp() FlyctlConfigReleasesApp { return v.App }
+
 // FlyctlDeployGetLatestImageApp includes the requested fields of the GraphQL type App.
 type FlyctlDeployGetLatestImageApp struct {
 	// The latest release of this application, without any config processing
@@ -3455,6 +3541,18 @@ type __FlyctlConfigCurrentReleaseInput struct {
 // GetAppName returns __FlyctlConfigCurrentReleaseInput.AppName, and is useful for accessing the field via an interface.
 func (v *__FlyctlConfigCurrentReleaseInput) GetAppName() string { return v.AppName }
 
+// __FlyctlConfigReleasesInput is used internally by genqlient
+type __FlyctlConfigReleasesInput struct {
+	AppName string `json:"appName"`
+	After   string `json:"after,omitempty"`
+}
+
+// GetAppName returns __FlyctlConfigReleasesInput.AppName, and is useful for accessing the field via an interface.
+func (v *__FlyctlConfigReleasesInput) GetAppName() string { return v.AppName }
+
+// GetAfter returns __FlyctlConfigReleasesInput.After, and is useful for accessing the field via an interface.
+func (v *__FlyctlConfigReleasesInput) GetAfter() string { return v.After }
+
 // __FlyctlDeployGetLatestImageInput is used internally by genqlient
 type __FlyctlDeployGetLatestImageInput struct {
 	AppName string `json:"appName"`
@@ -4051,6 +4149,53 @@ func FlyctlConfigCurrentRelease(
 	return &data, err
 }
 
+// The query or mutation executed by FlyctlConfigReleases.
+const FlyctlConfigReleases_Operation = `
+query FlyctlConfigReleases ($appName: String!, $after: String) {
+	app(name: $appName) {
+		releasesUnprocessed(first: 50, after: $after) {
+			nodes {
+				version
+				imageRef
+				configDefinition
+			}
+			pageInfo {
+				hasNextPage
+				endCursor
+			}
+		}
+	}
+}
+`
+
+func FlyctlConfigReleases(
+	ctx context.Context,
+	client graphql.Client,
+	appName string,
+	after string,
+) (*FlyctlConfigReleasesResponse, error) {
+	req := &graphql.Request{
+		OpName: "FlyctlConfigReleases",
+		Query:  FlyctlConfigReleases_Operation,
+		Variables: &__FlyctlConfigReleasesInput{
+			AppName: appName,
+			After:   after,
+		},
+	}
+	var err error
+
+	var data FlyctlConfigReleasesResponse
+	resp := &graphql.Response{Data: &data}
+
+	err = client.MakeRequest(
+		ctx,
+		req,
+		resp,
+	)
+
+	return &data, err
+}
+
 // The query or mutation executed by FlyctlDeployGetLatestImage.
 const FlyctlDeployGetLatestImage_Operation = `
 query FlyctlDeployGetLatestImage ($appName: String!) {
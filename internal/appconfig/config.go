@@ -63,9 +63,15 @@ type Config struct {
 	// Path to application configuration file, usually fly.toml.
 	configFilePath string
 
+	// Name of the environment overlay merged on top of configFilePath, if any.
+	configEnv string
+
 	// Set when it fails to unmarshal fly.toml into Config
 	v2UnmarshalError error
 
+	// ${VAR} references that couldn't be resolved while loading the file
+	unresolvedVars []*SourceError
+
 	// The default group name to refer to (used with flatten configs)
 	defaultGroupName string
 }
@@ -76,11 +82,24 @@ type Metrics struct {
 }
 
 type Deploy struct {
-	ReleaseCommand        string        `toml:"release_command,omitempty" json:"release_command,omitempty"`
-	ReleaseCommandTimeout *fly.Duration `toml:"release_command_timeout,omitempty" json:"release_command_timeout,omitempty"`
-	Strategy              string        `toml:"strategy,omitempty" json:"strategy,omitempty"`
-	MaxUnavailable        *float64      `toml:"max_unavailable,omitempty" json:"max_unavailable,omitempty"`
-	WaitTimeout           *fly.Duration `toml:"wait_timeout,omitempty" json:"wait_timeout,omitempty"`
+	ReleaseCommand         string          `toml:"release_command,omitempty" json:"release_command,omitempty"`
+	ReleaseCommandTimeout  *fly.Duration   `toml:"release_command_timeout,omitempty" json:"release_command_timeout,omitempty"`
+	Strategy               string          `toml:"strategy,omitempty" json:"strategy,omitempty"`
+	MaxUnavailable         *float64        `toml:"max_unavailable,omitempty" json:"max_unavailable,omitempty"`
+	WaitTimeout            *fly.Duration   `toml:"wait_timeout,omitempty" json:"wait_timeout,omitempty"`
+	CanaryPercentage       *float64        `toml:"canary_percentage,omitempty" json:"canary_percentage,omitempty"`
+	CanaryBakeTime         *fly.Duration   `toml:"canary_bake_time,omitempty" json:"canary_bake_time,omitempty"`
+	PreTrafficCommand      string          `toml:"pre_traffic_command,omitempty" json:"pre_traffic_command,omitempty"`
+	PreTrafficLocalCommand string          `toml:"pre_traffic_local_command,omitempty" json:"pre_traffic_local_command,omitempty"`
+	PostDeployCommand      string          `toml:"post_deploy_command,omitempty" json:"post_deploy_command,omitempty"`
+	PostDeployLocalCommand string          `toml:"post_deploy_local_command,omitempty" json:"post_deploy_local_command,omitempty"`
+	HookFailurePolicy      string          `toml:"hook_failure_policy,omitempty" json:"hook_failure_policy,omitempty"`
+	Verify                 []*DeployVerify `toml:"verify,omitempty" json:"verify,omitempty"`
+	Freeze                 []*DeployFreeze `toml:"freeze,omitempty" json:"freeze,omitempty"`
+	Waves                  [][]string      `toml:"waves,omitempty" json:"waves,omitempty"`
+	WavePause              *fly.Duration   `toml:"wave_pause,omitempty" json:"wave_pause,omitempty"`
+	WaveConfirm            bool            `toml:"wave_confirm,omitempty" json:"wave_confirm,omitempty"`
+	Notify                 *DeployNotify   `toml:"notify,omitempty" json:"notify,omitempty"`
 }
 
 type File struct {
@@ -160,6 +179,10 @@ func (c *Config) ConfigFilePath() string {
 	return c.configFilePath
 }
 
+func (c *Config) ConfigEnv() string {
+	return c.configEnv
+}
+
 func (c *Config) SetConfigFilePath(configFilePath string) {
 	c.configFilePath = configFilePath
 }
@@ -215,9 +215,51 @@ func TestToDefinition(t *testing.T) {
 		},
 
 		"deploy": map[string]any{
-			"release_command": "release command",
-			"strategy":        "rolling-eyes",
-			"max_unavailable": 0.2,
+			"release_command":           "release command",
+			"strategy":                  "rolling-eyes",
+			"max_unavailable":           0.2,
+			"canary_percentage":         float64(10),
+			"canary_bake_time":          "2m0s",
+			"pre_traffic_command":       "notify-traffic",
+			"pre_traffic_local_command": "./scripts/notify.sh",
+			"post_deploy_command":       "warm-cache",
+			"post_deploy_local_command": "./scripts/smoke.sh",
+			"hook_failure_policy":       "rollback",
+			"waves":                     []any{[]any{"ams"}, []any{"fra", "lhr"}, []any{"*"}},
+			"wave_pause":                "5m0s",
+			"wave_confirm":              true,
+			"verify": []any{
+				map[string]any{
+					"path":            "/status",
+					"port":            int64(8080),
+					"method":          "HEAD",
+					"expected_status": int64(204),
+					"body_regex":      "ok",
+					"timeout":         "3s",
+					"regions":         []any{"ord"},
+					"processes":       []any{"web"},
+					"headers":         map[string]any{"Host": "example.com"},
+				},
+			},
+			"freeze": []any{
+				map[string]any{
+					"schedule": "0 18 * * FRI",
+					"duration": "62h0m0s",
+					"timezone": "Europe/Paris",
+					"reason":   "weekend",
+				},
+				map[string]any{
+					"start": "2024-12-23",
+					"end":   "2025-01-02T09:00",
+				},
+			},
+			"notify": map[string]any{
+				"urls":     []any{"https://hooks.example.com/deploys"},
+				"events":   []any{"started", "failed"},
+				"template": `{"text": {{ json .Text }}}`,
+				"timeout":  "5s",
+				"headers":  map[string]any{"Authorization": "Bearer token"},
+			},
 		},
 		"env": map[string]any{
 			"FOO": "BAR",
@@ -0,0 +1,277 @@
+package appconfig
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	fly "github.com/superfly/fly-go"
+)
+
+// MaxDeployFreezeDuration bounds how long a recurring freeze window lasts
+const MaxDeployFreezeDuration = 31 * 24 * time.Hour
+
+// deployFreezeTimeLayouts are the accepted formats of the start and end of
+// an explicit freeze window. The ones without an offset are read in the
+// time zone of the window.
+var deployFreezeTimeLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// DeployFreeze is a change-freeze window during which deploys and scaling
+// are refused. It either recurs, starting on a cron schedule and lasting
+// Duration, or spans from Start to End.
+type DeployFreeze struct {
+	Schedule string        `json:"schedule,omitempty" toml:"schedule,omitempty"`
+	Duration *fly.Duration `json:"duration,omitempty" toml:"duration,omitempty"`
+	Start    string        `json:"start,omitempty" toml:"start,omitempty"`
+	End      string        `json:"end,omitempty" toml:"end,omitempty"`
+	Timezone string        `json:"timezone,omitempty" toml:"timezone,omitempty"`
+	Reason   string        `json:"reason,omitempty" toml:"reason,omitempty"`
+}
+
+func (f *DeployFreeze) String() string {
+	var s string
+	if f.Schedule != "" {
+		s = fmt.Sprintf("'%s' for %s", f.Schedule, f.Duration)
+	} else {
+		s = fmt.Sprintf("from %s to %s", f.Start, f.End)
+	}
+	if f.Timezone != "" {
+		s += " " + f.Timezone
+	}
+	if f.Reason != "" {
+		s += " (" + f.Reason + ")"
+	}
+	return s
+}
+
+func (f *DeployFreeze) location() (*time.Location, error) {
+	return time.LoadLocation(f.Timezone)
+}
+
+func parseDeployFreezeTime(value string, loc *time.Location) (t time.Time, err error) {
+	for _, layout := range deployFreezeTimeLayouts {
+		if t, err = time.ParseInLocation(layout, value, loc); err == nil {
+			return t, nil
+		}
+	}
+	return t, fmt.Errorf("can't parse '%s', use a format like 2006-01-02T15:04", value)
+}
+
+// ActiveAt reports whether t falls in the window.
+func (f *DeployFreeze) ActiveAt(t time.Time) (bool, error) {
+	loc, err := f.location()
+	if err != nil {
+		return false, err
+	}
+
+	if f.Schedule == "" {
+		start, err := parseDeployFreezeTime(f.Start, loc)
+		if err != nil {
+			return false, err
+		}
+		end, err := parseDeployFreezeTime(f.End, loc)
+		if err != nil {
+			return false, err
+		}
+		return !t.Before(start) && t.Before(end), nil
+	}
+
+	schedule, err := parseCronSchedule(f.Schedule)
+	if err != nil {
+		return false, err
+	}
+	if f.Duration == nil {
+		return false, nil
+	}
+
+	// Look for a start of the window in the last Duration
+	t = t.In(loc).Truncate(time.Minute)
+	since := t.Add(-f.Duration.Duration)
+	for start := t; start.After(since); start = start.Add(-time.Minute) {
+		if schedule.matches(start) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// ActiveDeployFreeze returns the first [[deploy.freeze]] window t falls in,
+// or nil.
+func (c *Config) ActiveDeployFreeze(t time.Time) (*DeployFreeze, error) {
+	if c.Deploy == nil {
+		return nil, nil
+	}
+	for _, f := range c.Deploy.Freeze {
+		active, err := f.ActiveAt(t)
+		if err != nil {
+			return nil, fmt.Errorf("invalid deploy freeze window %s: %w", f, err)
+		}
+		if active {
+			return f, nil
+		}
+	}
+	return nil, nil
+}
+
+func (cfg *Config) validateDeployFreeze(issues *validationIssues) {
+	if cfg.Deploy == nil {
+		return
+	}
+
+	for i, f := range cfg.Deploy.Freeze {
+		section := fmt.Sprintf("deploy.freeze[%d]", i)
+		loc, err := f.location()
+		if err != nil {
+			issues.errorf(section+".timezone", "Unknown freeze window time zone '%s'", f.Timezone)
+			loc = time.UTC
+		}
+
+		switch {
+		case f.Schedule != "" && (f.Start != "" || f.End != ""):
+			issues.errorf(section, "Freeze window must either have a schedule or a start and an end, not both")
+		case f.Schedule != "":
+			if _, err := parseCronSchedule(f.Schedule); err != nil {
+				issues.errorf(section+".schedule", "Can't parse freeze window schedule '%s': %s", f.Schedule, err)
+			}
+			if f.Duration == nil || f.Duration.Duration <= 0 || f.Duration.Duration > MaxDeployFreezeDuration {
+				issues.errorf(section+".duration", "Freeze window with a schedule needs a duration between 1m and %s", MaxDeployFreezeDuration)
+			}
+		case f.Start != "" && f.End != "":
+			start, err := parseDeployFreezeTime(f.Start, loc)
+			if err != nil {
+				issues.errorf(section+".start", "Invalid freeze window start: %s", err)
+			}
+			end, err := parseDeployFreezeTime(f.End, loc)
+			if err != nil {
+				issues.errorf(section+".end", "Invalid freeze window end: %s", err)
+			}
+			if !start.IsZero() && !end.IsZero() && !end.After(start) {
+				issues.errorf(section+".end", "Freeze window must end after it starts")
+			}
+		default:
+			issues.errorf(section, "Freeze window needs either a schedule and a duration or a start and an end")
+		}
+	}
+}
+
+var (
+	cronMonthNames = map[string]int{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}
+	cronDayNames = map[string]int{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}
+)
+
+// cronSchedule is a parsed five-field cron expression: minute, hour, day of
+// month, month and day of week. Each field is a bitset of the values it
+// matches.
+type cronSchedule struct {
+	minute, hour, dom, month, dow uint64
+	// Like cron, when both days are restricted either of them matches
+	domAny, dowAny bool
+}
+
+func parseCronSchedule(expr string) (*cronSchedule, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("expected 5 fields (minute hour day-of-month month day-of-week), got %d", len(fields))
+	}
+
+	var (
+		s   = &cronSchedule{}
+		err error
+	)
+	if s.minute, err = parseCronField(fields[0], 0, 59, nil); err != nil {
+		return nil, fmt.Errorf("minute: %w", err)
+	}
+	if s.hour, err = parseCronField(fields[1], 0, 23, nil); err != nil {
+		return nil, fmt.Errorf("hour: %w", err)
+	}
+	if s.dom, err = parseCronField(fields[2], 1, 31, nil); err != nil {
+		return nil, fmt.Errorf("day of month: %w", err)
+	}
+	if s.month, err = parseCronField(fields[3], 1, 12, cronMonthNames); err != nil {
+		return nil, fmt.Errorf("month: %w", err)
+	}
+	if s.dow, err = parseCronField(fields[4], 0, 7, cronDayNames); err != nil {
+		return nil, fmt.Errorf("day of week: %w", err)
+	}
+	// 7 is Sunday too
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1
+	}
+	s.domAny = strings.HasPrefix(fields[2], "*")
+	s.dowAny = strings.HasPrefix(fields[4], "*")
+	return s, nil
+}
+
+func parseCronField(field string, minValue, maxValue int, names map[string]int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rng, stepStr, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			var err error
+			if step, err = strconv.Atoi(stepStr); err != nil || step < 1 {
+				return 0, fmt.Errorf("invalid step '%s'", stepStr)
+			}
+		}
+
+		first, last := minValue, maxValue
+		if rng != "*" {
+			from, to, isRange := strings.Cut(rng, "-")
+			var err error
+			if first, err = parseCronValue(from, minValue, maxValue, names); err != nil {
+				return 0, err
+			}
+			switch {
+			case isRange:
+				if last, err = parseCronValue(to, minValue, maxValue, names); err != nil {
+					return 0, err
+				}
+			case !hasStep:
+				last = first
+			}
+			if first > last {
+				return 0, fmt.Errorf("invalid range '%s'", rng)
+			}
+		}
+
+		for v := first; v <= last; v += step {
+			bits |= 1 << v
+		}
+	}
+	return bits, nil
+}
+
+func parseCronValue(s string, minValue, maxValue int, names map[string]int) (int, error) {
+	if v, ok := names[strings.ToLower(s)]; ok {
+		return v, nil
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil || v < minValue || v > maxValue {
+		return 0, fmt.Errorf("invalid value '%s', expected %d-%d", s, minValue, maxValue)
+	}
+	return v, nil
+}
+
+func (s *cronSchedule) matches(t time.Time) bool {
+	if s.minute&(1<<t.Minute()) == 0 || s.hour&(1<<t.Hour()) == 0 || s.month&(1<<int(t.Month())) == 0 {
+		return false
+	}
+	domMatch := s.dom&(1<<t.Day()) != 0
+	dowMatch := s.dow&(1<<int(t.Weekday())) != 0
+	if s.domAny || s.dowAny {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
@@ -0,0 +1,96 @@
+package appconfig
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	fly "github.com/superfly/fly-go"
+)
+
+func TestParseCronSchedule(t *testing.T) {
+	s, err := parseCronSchedule("*/15 9-17 * * MON-FRI")
+	require.NoError(t, err)
+
+	// Wednesday
+	assert.True(t, s.matches(time.Date(2024, 3, 6, 9, 45, 0, 0, time.UTC)))
+	assert.False(t, s.matches(time.Date(2024, 3, 6, 9, 50, 0, 0, time.UTC)))
+	assert.False(t, s.matches(time.Date(2024, 3, 6, 18, 0, 0, 0, time.UTC)))
+	// Saturday
+	assert.False(t, s.matches(time.Date(2024, 3, 9, 10, 0, 0, 0, time.UTC)))
+
+	// Either day field matches when both are restricted, and 7 is Sunday
+	s, err = parseCronSchedule("0 0 1 jan,jul 7")
+	require.NoError(t, err)
+	assert.True(t, s.matches(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)))
+	assert.True(t, s.matches(time.Date(2024, 7, 7, 0, 0, 0, 0, time.UTC)))
+	assert.False(t, s.matches(time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)))
+
+	for _, expr := range []string{"* * * *", "60 * * * *", "* * * * FUN", "5-1 * * * *", "*/0 * * * *"} {
+		_, err := parseCronSchedule(expr)
+		assert.Error(t, err, expr)
+	}
+}
+
+func TestDeployFreezeActiveAt(t *testing.T) {
+	paris, err := time.LoadLocation("Europe/Paris")
+	require.NoError(t, err)
+
+	weekend := &DeployFreeze{Schedule: "0 18 * * FRI", Duration: fly.MustParseDuration("62h"), Timezone: "Europe/Paris"}
+	for at, want := range map[time.Time]bool{
+		time.Date(2024, 3, 8, 17, 59, 0, 0, paris):    false,
+		time.Date(2024, 3, 8, 18, 0, 0, 0, paris):     true,
+		time.Date(2024, 3, 10, 12, 0, 0, 0, paris):    true,
+		time.Date(2024, 3, 11, 7, 59, 0, 0, paris):    true,
+		time.Date(2024, 3, 11, 8, 0, 0, 0, paris):     false,
+		time.Date(2024, 3, 8, 17, 30, 0, 0, time.UTC): true,
+	} {
+		active, err := weekend.ActiveAt(at)
+		require.NoError(t, err)
+		assert.Equal(t, want, active, at.String())
+	}
+
+	holidays := &DeployFreeze{Start: "2024-12-23", End: "2025-01-02T09:00", Timezone: "America/New_York"}
+	active, err := holidays.ActiveAt(time.Date(2024, 12, 25, 0, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+	assert.True(t, active)
+	active, err = holidays.ActiveAt(time.Date(2025, 1, 2, 13, 59, 0, 0, time.UTC))
+	require.NoError(t, err)
+	assert.True(t, active)
+	active, err = holidays.ActiveAt(time.Date(2025, 1, 2, 14, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+	assert.False(t, active)
+
+	cfg := &Config{Deploy: &Deploy{Freeze: []*DeployFreeze{holidays, weekend}}}
+	freeze, err := cfg.ActiveDeployFreeze(time.Date(2024, 3, 9, 0, 0, 0, 0, paris))
+	require.NoError(t, err)
+	assert.Equal(t, weekend, freeze)
+	freeze, err = cfg.ActiveDeployFreeze(time.Date(2024, 3, 6, 0, 0, 0, 0, paris))
+	require.NoError(t, err)
+	assert.Nil(t, freeze)
+}
+
+func TestValidateDeployFreeze(t *testing.T) {
+	cfg := NewConfig()
+	cfg.Deploy = &Deploy{Freeze: []*DeployFreeze{
+		{Schedule: "0 18 * * FRI", Duration: fly.MustParseDuration("1h")},
+		{Schedule: "0 18 * *", Timezone: "Mars/Olympus"},
+		{Start: "2024-12-23", End: "2024-12-01"},
+		{Start: "2024-12-23"},
+		{Schedule: "@daily", Start: "2024-12-23", End: "2024-12-24"},
+	}}
+
+	issues := lo.Filter(cfg.ValidationIssues(), func(i *ValidationIssue, _ int) bool {
+		return i.Severity == SeverityError && strings.HasPrefix(i.Section, "deploy.freeze")
+	})
+	sections := lo.Map(issues, func(i *ValidationIssue, _ int) string { return i.Section })
+	assert.ElementsMatch(t, []string{
+		"deploy.freeze[1].timezone", "deploy.freeze[1].schedule", "deploy.freeze[1].duration",
+		"deploy.freeze[2].end",
+		"deploy.freeze[3]",
+		"deploy.freeze[4]",
+	}, sections)
+}
@@ -0,0 +1,69 @@
+package appconfig
+
+import (
+	"encoding/json"
+	"net/url"
+	"slices"
+	"strings"
+	"text/template"
+
+	fly "github.com/superfly/fly-go"
+)
+
+// Stages of a deployment that [deploy.notify] webhooks are told about
+const (
+	DeployNotifyStarted    = "started"
+	DeployNotifySucceeded  = "succeeded"
+	DeployNotifyFailed     = "failed"
+	DeployNotifyRolledBack = "rolled_back"
+)
+
+var DeployNotifyEvents = []string{DeployNotifyStarted, DeployNotifySucceeded, DeployNotifyFailed, DeployNotifyRolledBack}
+
+// DeployNotify lists the webhooks a JSON payload is posted to at each stage
+// of a deployment. Secret webhook URLs can stay out of fly.toml as ${NAME}
+// references to environment variables.
+type DeployNotify struct {
+	URLs     []string          `json:"urls,omitempty" toml:"urls,omitempty"`
+	Events   []string          `json:"events,omitempty" toml:"events,omitempty"`
+	Template string            `json:"template,omitempty" toml:"template,omitempty"`
+	Headers  map[string]string `json:"headers,omitempty" toml:"headers,omitempty"`
+	Timeout  *fly.Duration     `json:"timeout,omitempty" toml:"timeout,omitempty"`
+}
+
+// ParseDeployNotifyTemplate parses the template of the notify payload, which
+// can quote values with the json function.
+func ParseDeployNotifyTemplate(text string) (*template.Template, error) {
+	return template.New("notify").Funcs(template.FuncMap{
+		"json": func(v any) (string, error) {
+			b, err := json.Marshal(v)
+			return string(b), err
+		},
+	}).Parse(text)
+}
+
+func (cfg *Config) validateDeployNotify(issues *validationIssues) {
+	if cfg.Deploy == nil || cfg.Deploy.Notify == nil {
+		return
+	}
+	n := cfg.Deploy.Notify
+
+	for _, u := range n.URLs {
+		if parsed, err := url.Parse(u); err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			issues.errorf("deploy.notify.urls", "Notify URL '%s' must be an http or https URL", u)
+		}
+	}
+	for _, event := range n.Events {
+		if !slices.Contains(DeployNotifyEvents, event) {
+			issues.errorf("deploy.notify.events", "Unknown notify event '%s', use one of %s", event, strings.Join(DeployNotifyEvents, ", "))
+		}
+	}
+	if n.Template != "" {
+		if _, err := ParseDeployNotifyTemplate(n.Template); err != nil {
+			issues.errorf("deploy.notify.template", "Can't parse notify template: %s", err)
+		}
+	}
+	if t := n.Timeout; t != nil && t.Duration <= 0 {
+		issues.errorf("deploy.notify.timeout", "Notify timeout must be positive")
+	}
+}
@@ -0,0 +1,33 @@
+package appconfig
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateDeployNotify(t *testing.T) {
+	cfg := NewConfig()
+	cfg.Deploy = &Deploy{Notify: &DeployNotify{
+		URLs:     []string{"https://hooks.example.com", "hooks.example.com"},
+		Events:   []string{"started", "deployed"},
+		Template: "{{ .Text",
+	}}
+
+	issues := cfg.ValidationIssues()
+	sections := make([]string, 0, len(issues))
+	for _, issue := range issues {
+		sections = append(sections, issue.Section)
+	}
+	assert.Equal(t, []string{"deploy.notify.urls", "deploy.notify.events", "deploy.notify.template"}, sections)
+}
+
+func TestParseDeployNotifyTemplate(t *testing.T) {
+	tmpl, err := ParseDeployNotifyTemplate(`{"text": {{ json .text }}}`)
+	require.NoError(t, err)
+	var buf bytes.Buffer
+	require.NoError(t, tmpl.Execute(&buf, map[string]string{"text": `say "hi"`}))
+	assert.Equal(t, `{"text": "say \"hi\""}`, buf.String())
+}
@@ -0,0 +1,75 @@
+package appconfig
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	fly "github.com/superfly/fly-go"
+)
+
+// DeployVerify is an HTTP probe run against the private IP of every updated
+// machine before a deployment is declared successful.
+type DeployVerify struct {
+	Path           string            `json:"path,omitempty" toml:"path,omitempty"`
+	Port           *int              `json:"port,omitempty" toml:"port,omitempty"`
+	Method         string            `json:"method,omitempty" toml:"method,omitempty"`
+	ExpectedStatus *int              `json:"expected_status,omitempty" toml:"expected_status,omitempty"`
+	BodyRegex      string            `json:"body_regex,omitempty" toml:"body_regex,omitempty"`
+	Headers        map[string]string `json:"headers,omitempty" toml:"headers,omitempty"`
+	Timeout        *fly.Duration     `json:"timeout,omitempty" toml:"timeout,omitempty"`
+	Regions        []string          `json:"regions,omitempty" toml:"regions,omitempty"`
+	Processes      []string          `json:"processes,omitempty" toml:"processes,omitempty"`
+}
+
+// DeployVerifyPort is the port v probes, the internal port of [http_service]
+// unless set. Zero means there's no port to probe.
+func (c *Config) DeployVerifyPort(v *DeployVerify) int {
+	switch {
+	case v.Port != nil:
+		return *v.Port
+	case c.HTTPService != nil:
+		return c.HTTPService.InternalPort
+	default:
+		return 0
+	}
+}
+
+// DeployVerifyProcesses are the process groups whose machines v probes. It
+// defaults to the groups of [http_service] when the port isn't set, and to all
+// groups otherwise.
+func (c *Config) DeployVerifyProcesses(v *DeployVerify) []string {
+	switch {
+	case len(v.Processes) > 0:
+		return v.Processes
+	case v.Port == nil && c.HTTPService != nil:
+		return c.HTTPService.Processes
+	default:
+		return nil
+	}
+}
+
+func (cfg *Config) validateDeployVerify(issues *validationIssues) {
+	if cfg.Deploy == nil {
+		return
+	}
+
+	for i, v := range cfg.Deploy.Verify {
+		section := fmt.Sprintf("deploy.verify[%d]", i)
+		if !strings.HasPrefix(v.Path, "/") {
+			issues.errorf(section+".path", "Verify probe path must start with '/', got '%s'", v.Path)
+		}
+		switch port := cfg.DeployVerifyPort(v); {
+		case v.Port == nil && cfg.HTTPService == nil:
+			issues.errorf(section+".port", "Verify probe needs a port when there is no [http_service] section")
+		case port <= 0 || port > 65535:
+			issues.errorf(section+".port", "Verify probe port %d isn't a valid port", port)
+		}
+		if s := v.ExpectedStatus; s != nil && (*s < 100 || *s > 599) {
+			issues.errorf(section+".expected_status", "Verify probe expected status %d isn't a valid HTTP status", *s)
+		}
+		if _, err := regexp.Compile(v.BodyRegex); err != nil {
+			issues.errorf(section+".body_regex", "Can't compile verify probe body regex '%s': %s", v.BodyRegex, err)
+		}
+	}
+}
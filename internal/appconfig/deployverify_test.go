@@ -0,0 +1,45 @@
+package appconfig
+
+import (
+	"testing"
+
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	fly "github.com/superfly/fly-go"
+)
+
+func TestDeployVerifyDefaults(t *testing.T) {
+	cfg := &Config{HTTPService: &HTTPService{InternalPort: 8080, Processes: []string{"web"}}}
+
+	v := &DeployVerify{Path: "/"}
+	assert.Equal(t, 8080, cfg.DeployVerifyPort(v))
+	assert.Equal(t, []string{"web"}, cfg.DeployVerifyProcesses(v))
+
+	v = &DeployVerify{Path: "/", Port: fly.Pointer(9090)}
+	assert.Equal(t, 9090, cfg.DeployVerifyPort(v))
+	assert.Empty(t, cfg.DeployVerifyProcesses(v))
+
+	v.Processes = []string{"admin"}
+	assert.Equal(t, []string{"admin"}, cfg.DeployVerifyProcesses(v))
+
+	assert.Zero(t, (&Config{}).DeployVerifyPort(&DeployVerify{}))
+}
+
+func TestValidateDeployVerify(t *testing.T) {
+	cfg := NewConfig()
+	cfg.Deploy = &Deploy{Verify: []*DeployVerify{
+		{Path: "/ok", Port: fly.Pointer(8080)},
+		{Path: "status", ExpectedStatus: fly.Pointer(42), BodyRegex: "("},
+	}}
+
+	issues := lo.Filter(cfg.ValidationIssues(), func(i *ValidationIssue, _ int) bool {
+		return i.Severity == SeverityError && lo.Contains([]string{
+			"deploy.verify[0].path", "deploy.verify[0].port",
+			"deploy.verify[1].path", "deploy.verify[1].port", "deploy.verify[1].expected_status", "deploy.verify[1].body_regex",
+		}, i.Section)
+	})
+	sections := lo.Map(issues, func(i *ValidationIssue, _ int) string { return i.Section })
+	assert.ElementsMatch(t, []string{
+		"deploy.verify[1].path", "deploy.verify[1].port", "deploy.verify[1].expected_status", "deploy.verify[1].body_regex",
+	}, sections)
+}
@@ -0,0 +1,61 @@
+package appconfig
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DeployWaveOtherRegions stands in a deploy wave for the regions no other wave lists
+const DeployWaveOtherRegions = "*"
+
+// ParseDeployWaves reads waves given as comma separated lists of regions.
+func ParseDeployWaves(values []string) ([][]string, error) {
+	waves := make([][]string, 0, len(values))
+	for _, v := range values {
+		var wave []string
+		for _, region := range strings.Split(v, ",") {
+			if region = strings.TrimSpace(region); region != "" {
+				wave = append(wave, region)
+			}
+		}
+		waves = append(waves, wave)
+	}
+	return waves, CheckDeployWaves(waves)
+}
+
+// CheckDeployWaves makes sure every wave lists regions, that no region is in
+// two waves and that only the last wave has the other regions.
+func CheckDeployWaves(waves [][]string) error {
+	seen := make(map[string]int)
+	for i, wave := range waves {
+		if len(wave) == 0 {
+			return fmt.Errorf("wave %d has no regions", i+1)
+		}
+		for _, region := range wave {
+			if region == DeployWaveOtherRegions && (len(wave) > 1 || i != len(waves)-1) {
+				return fmt.Errorf("'%s' must be alone in the last wave", DeployWaveOtherRegions)
+			}
+			if prev, ok := seen[region]; ok {
+				return fmt.Errorf("region %s is in both wave %d and wave %d", region, prev+1, i+1)
+			}
+			seen[region] = i
+		}
+	}
+	return nil
+}
+
+func (cfg *Config) validateDeployWaves(issues *validationIssues) {
+	if cfg.Deploy == nil || len(cfg.Deploy.Waves) == 0 {
+		return
+	}
+
+	if err := CheckDeployWaves(cfg.Deploy.Waves); err != nil {
+		issues.errorf("deploy.waves", "Invalid deploy waves: %s", err)
+	}
+	if s := cfg.Deploy.Strategy; s != "" && s != "rolling" {
+		issues.errorf("deploy.waves", "Deploy waves only work with the rolling strategy, not '%s'", s)
+	}
+	if p := cfg.Deploy.WavePause; p != nil && p.Duration < 0 {
+		issues.errorf("deploy.wave_pause", "Wave pause can't be negative")
+	}
+}
@@ -0,0 +1,36 @@
+package appconfig
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseDeployWaves(t *testing.T) {
+	waves, err := ParseDeployWaves([]string{"ams", "fra, lhr", "*"})
+	require.NoError(t, err)
+	assert.Equal(t, [][]string{{"ams"}, {"fra", "lhr"}, {"*"}}, waves)
+
+	for _, values := range [][]string{
+		{"ams", ""},
+		{"ams", "*", "fra"},
+		{"ams,*"},
+		{"ams", "fra,ams"},
+	} {
+		_, err := ParseDeployWaves(values)
+		assert.Error(t, err, values)
+	}
+}
+
+func TestValidateDeployWaves(t *testing.T) {
+	cfg := NewConfig()
+	cfg.Deploy = &Deploy{Strategy: "canary", Waves: [][]string{{"ams"}, {"*"}}}
+
+	issues := cfg.ValidationIssues()
+	assert.Contains(t, issues, &ValidationIssue{
+		Severity: SeverityError,
+		Section:  "deploy.waves",
+		Message:  "Deploy waves only work with the rolling strategy, not 'canary'",
+	})
+}
@@ -0,0 +1,132 @@
+package appconfig
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/samber/lo"
+	fly "github.com/superfly/fly-go"
+	"github.com/superfly/flyctl/internal/machine"
+	"github.com/superfly/flyctl/iostreams"
+)
+
+// GroupDrift holds the differences for one process group between the local
+// config, the config of the latest release and the running machines.
+//
+// Each config is compared as the fly.toml that FromAppAndMachineSet would
+// reconstruct from its machines, so only settings machines carry show up.
+type GroupDrift struct {
+	Group string `json:"group"`
+	// ReleaseToMachines is what changed on machines since the latest release,
+	// e.g. with `fly machine update`. Deploying reverts these changes.
+	ReleaseToMachines string `json:"release_to_machines,omitempty"`
+	// ReleaseToLocal is what changed in the local config since the latest release.
+	ReleaseToLocal string `json:"release_to_local,omitempty"`
+	// MachinesToLocal is what deploying the local config would change on machines.
+	MachinesToLocal string `json:"machines_to_local,omitempty"`
+	// Warnings are reported when machines of the group differ among themselves.
+	Warnings string `json:"warnings,omitempty"`
+}
+
+// HasMachineDrift reports whether running machines no longer match the latest release.
+func (d *GroupDrift) HasMachineDrift() bool {
+	return d.ReleaseToMachines != ""
+}
+
+// DetectDrift compares local with the config of the latest release of the app
+// and the given machines, for every process group any of them defines.
+func DetectDrift(ctx context.Context, appName string, local *Config, machines []*fly.Machine) ([]*GroupDrift, error) {
+	release, err := getAppV2ConfigFromReleases(ctx, fly.ClientFromContext(ctx), appName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the config of the latest release: %w", err)
+	}
+	if release != nil {
+		if err := release.SetMachinesPlatform(); err != nil {
+			return nil, err
+		}
+		release.AppName = appName
+	}
+	return computeDrift(ctx, appName, local, release, machines)
+}
+
+func computeDrift(ctx context.Context, appName string, local, release *Config, machines []*fly.Machine) ([]*GroupDrift, error) {
+	machinesByGroup := lo.GroupBy(machines, func(m *fly.Machine) string {
+		return m.ProcessGroup()
+	})
+
+	groups := lo.Keys(machinesByGroup)
+	for _, cfg := range []*Config{local, release} {
+		if cfg != nil {
+			groups = append(groups, cfg.ProcessNames()...)
+		}
+	}
+	groups = lo.Uniq(groups)
+	slices.Sort(groups)
+
+	colorize := iostreams.FromContext(ctx).ColorScheme()
+	var drifts []*GroupDrift
+	for _, group := range groups {
+		localTOML, err := desiredGroupTOML(ctx, appName, local, group)
+		if err != nil {
+			return nil, fmt.Errorf("local config: %w", err)
+		}
+		releaseTOML, err := desiredGroupTOML(ctx, appName, release, group)
+		if err != nil {
+			return nil, fmt.Errorf("latest release config: %w", err)
+		}
+		machinesTOML, warnings, err := machinesGroupTOML(ctx, appName, machinesByGroup[group])
+		if err != nil {
+			return nil, fmt.Errorf("machines of process group '%s': %w", group, err)
+		}
+
+		drift := &GroupDrift{Group: group, Warnings: warnings}
+		if release != nil {
+			drift.ReleaseToMachines = configDiff(releaseTOML, machinesTOML, colorize)
+			drift.ReleaseToLocal = configDiff(releaseTOML, localTOML, colorize)
+		}
+		drift.MachinesToLocal = configDiff(machinesTOML, localTOML, colorize)
+		drifts = append(drifts, drift)
+	}
+	return drifts, nil
+}
+
+// desiredGroupTOML returns the fly.toml reconstructed from the machine config
+// cfg would generate for group, or an empty string if cfg lacks the group.
+func desiredGroupTOML(ctx context.Context, appName string, cfg *Config, group string) (string, error) {
+	if cfg == nil || !slices.Contains(cfg.ProcessNames(), group) {
+		return "", nil
+	}
+
+	mConfig, err := cfg.ToMachineConfig(group, nil)
+	if err != nil {
+		return "", err
+	}
+	desired := &fly.Machine{ID: group, Config: mConfig}
+	tomlString, _, err := machinesGroupTOML(ctx, appName, []*fly.Machine{desired})
+	return tomlString, err
+}
+
+func machinesGroupTOML(ctx context.Context, appName string, machines []*fly.Machine) (string, string, error) {
+	if len(machines) == 0 {
+		return "", "", nil
+	}
+
+	machineSet := machine.NewMachineSet(nil, iostreams.FromContext(ctx), machines)
+	cfg, warnings, err := FromAppAndMachineSet(ctx, appName, machineSet)
+	if err != nil {
+		return "", "", err
+	}
+	tomlString, err := cfg.marshalTOML()
+	if err != nil {
+		return "", "", err
+	}
+	return string(tomlString), warnings, nil
+}
+
+func configDiff(original, new string, colorize *iostreams.ColorScheme) string {
+	if original == new {
+		return ""
+	}
+	return prettyDiff(original, new, colorize)
+}
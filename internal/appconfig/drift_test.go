@@ -0,0 +1,61 @@
+package appconfig
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	fly "github.com/superfly/fly-go"
+	"github.com/superfly/flyctl/iostreams"
+)
+
+func TestComputeDrift(t *testing.T) {
+	ios, _, _, _ := iostreams.Test()
+	ctx := iostreams.NewContext(context.Background(), ios)
+
+	local, err := LoadConfig("./testdata/tomachine.toml")
+	require.NoError(t, err)
+	release, err := LoadConfig("./testdata/tomachine.toml")
+	require.NoError(t, err)
+
+	mConfig, err := release.ToMachineConfig("app", nil)
+	require.NoError(t, err)
+	machines := []*fly.Machine{{ID: "m1", Config: mConfig}}
+
+	drifts, err := computeDrift(ctx, "foo", local, release, machines)
+	require.NoError(t, err)
+	require.Len(t, drifts, 1)
+	assert.Equal(t, "app", drifts[0].Group)
+	assert.False(t, drifts[0].HasMachineDrift())
+	assert.Empty(t, drifts[0].ReleaseToLocal)
+	assert.Empty(t, drifts[0].MachinesToLocal)
+
+	// Simulate a `fly machine update --env FOO=BAZ` on the running machine
+	updated, err := release.ToMachineConfig("app", nil)
+	require.NoError(t, err)
+	updated.Env["FOO"] = "BAZ"
+	machines = []*fly.Machine{{ID: "m1", Config: updated}}
+
+	drifts, err = computeDrift(ctx, "foo", local, release, machines)
+	require.NoError(t, err)
+	require.Len(t, drifts, 1)
+	assert.True(t, drifts[0].HasMachineDrift())
+	assert.Contains(t, drifts[0].ReleaseToMachines, "BAZ")
+	assert.Contains(t, drifts[0].MachinesToLocal, "BAZ")
+	assert.Empty(t, drifts[0].ReleaseToLocal)
+}
+
+func TestComputeDriftWithoutRelease(t *testing.T) {
+	ios, _, _, _ := iostreams.Test()
+	ctx := iostreams.NewContext(context.Background(), ios)
+
+	local, err := LoadConfig("./testdata/tomachine.toml")
+	require.NoError(t, err)
+
+	drifts, err := computeDrift(ctx, "foo", local, nil, nil)
+	require.NoError(t, err)
+	require.Len(t, drifts, 1)
+	assert.False(t, drifts[0].HasMachineDrift())
+	assert.Contains(t, drifts[0].MachinesToLocal, "FOO")
+}
@@ -4,7 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"regexp"
+	"strconv"
 	"strings"
 	"unicode"
 
@@ -61,30 +61,46 @@ func FromAppAndMachineSet(ctx context.Context, appName string, machines machine.
 	return mostCommonConfig, strings.Join(finalWarningMsgs, "\n"), nil
 }
 
+// prettyDiff returns a line by line diff of original and new, with removed
+// lines prefixed by "-" and added ones by "+".
 func prettyDiff(original, new string, colorize *iostreams.ColorScheme) string {
-	diff := cmp.Diff(original, new)
-	diffSlice := strings.Split(diff, "\n")
-	var str string
-	additionReg := regexp.MustCompile(`^\+.*`)
-	deletionReg := regexp.MustCompile(`^\-.*`)
-	for _, val := range diffSlice {
-		vB := []byte(val)
+	// Diffing slices of lines keeps cmp from falling back to a byte level diff
+	// for small changes, which can't be presented as lines
+	diff := cmp.Diff(strings.Split(original, "\n"), strings.Split(new, "\n"))
+	var lines []string
+	for _, val := range strings.Split(diff, "\n") {
+		if val == "" {
+			continue
+		}
+		var marker string
+		if strings.HasPrefix(val, "+") || strings.HasPrefix(val, "-") {
+			marker, val = val[:1], val[1:]
+		}
+		// cmp randomly uses non-breaking spaces to indent its output
+		rest := strings.TrimLeft(val, " \t\u00a0")
+		switch {
+		case strings.HasPrefix(rest, "..."):
+			lines = append(lines, "  "+rest)
+			continue
+		case !strings.HasPrefix(rest, `"`):
+			// Opening and closing lines of the slice
+			continue
+		}
+		line, err := strconv.Unquote(strings.TrimSuffix(rest, ","))
+		if err != nil {
+			continue
+		}
 
-		if additionReg.Match(vB) {
-			str += colorize.Green(val) + "\n"
-		} else if deletionReg.Match(vB) {
-			str += colorize.Red(val) + "\n"
-		} else {
-			str += val + "\n"
+		switch marker {
+		case "+":
+			lines = append(lines, colorize.Green("+ "+line))
+		case "-":
+			lines = append(lines, colorize.Red("- "+line))
+		default:
+			lines = append(lines, "  "+line)
 		}
 	}
-	delim := "\"\"\""
-	rx := regexp.MustCompile(`(?s)` + regexp.QuoteMeta(delim) + `(.*?)` + regexp.QuoteMeta(delim))
-	match := rx.FindStringSubmatch(str)
-	if len(match) > 0 {
-		return strings.Trim(match[1], "\n")
-	}
-	return ""
+	return strings.Join(lines, "\n")
 }
 
 func fromAppAndOneMachine(ctx context.Context, appName string, m machine.LeasableMachine, processGroups *processGroupInfo) (*Config, string) {
@@ -4,6 +4,7 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/require"
+	"github.com/superfly/flyctl/iostreams"
 )
 
 func TestQuotePosixWords(t *testing.T) {
@@ -48,3 +49,15 @@ func TestQuotePosixWords(t *testing.T) {
 		require.EqualValues(t, tc.expected, result)
 	}
 }
+
+func TestPrettyDiff(t *testing.T) {
+	ios, _, _, _ := iostreams.Test()
+	original := "app = 'foo'\n\n[env]\n  FOO = 'BAR'\n  PRIMARY_REGION = 'mia'\n"
+	updated := "app = 'foo'\n\n[env]\n  FOO = 'BAZ'\n  PRIMARY_REGION = 'mia'\n"
+
+	diff := prettyDiff(original, updated, ios.ColorScheme())
+	require.Contains(t, diff, "-   FOO = 'BAR'")
+	require.Contains(t, diff, "+   FOO = 'BAZ'")
+	require.Contains(t, diff, "  [env]")
+	require.Empty(t, prettyDiff(original, original, ios.ColorScheme()))
+}
@@ -22,14 +22,37 @@ func (c *Config) ToMachineConfig(processGroup string, src *fly.MachineConfig) (*
 }
 
 func (c *Config) ToReleaseMachineConfig() (*fly.MachineConfig, error) {
-	releaseCmd, err := shlex.Split(c.Deploy.ReleaseCommand)
+	mConfig, err := c.toEphemeralCommandMachineConfig(c.Deploy.ReleaseCommand, fly.MachineProcessGroupFlyAppReleaseCommand)
+	if err != nil {
+		return nil, err
+	}
+	mConfig.Env["RELEASE_COMMAND"] = "1"
+	return mConfig, nil
+}
+
+// ToDeployHookMachineConfig returns the config of the ephemeral machine running
+// command for the named deploy hook, e.g. "post_deploy".
+func (c *Config) ToDeployHookMachineConfig(hook, command string) (*fly.MachineConfig, error) {
+	mConfig, err := c.toEphemeralCommandMachineConfig(command, machine.DeployHookProcessGroup)
+	if err != nil {
+		return nil, err
+	}
+	mConfig.Env["FLY_DEPLOY_HOOK"] = hook
+	return mConfig, nil
+}
+
+// toEphemeralCommandMachineConfig is shared by the release command and the
+// deploy hooks, they run once and destroy themselves afterwards. processGroup
+// tells them apart.
+func (c *Config) toEphemeralCommandMachineConfig(command, processGroup string) (*fly.MachineConfig, error) {
+	cmd, err := shlex.Split(command)
 	if err != nil {
 		return nil, err
 	}
 
 	mConfig := &fly.MachineConfig{
 		Init: fly.MachineInit{
-			Cmd:        releaseCmd,
+			Cmd:        cmd,
 			SwapSizeMB: c.SwapSizeMB,
 		},
 		Restart: fly.MachineRestart{
@@ -42,7 +65,7 @@ func (c *Config) ToReleaseMachineConfig() (*fly.MachineConfig, error) {
 		Metadata: map[string]string{
 			fly.MachineConfigMetadataKeyFlyctlVersion:      buildinfo.Version().String(),
 			fly.MachineConfigMetadataKeyFlyPlatformVersion: fly.MachineFlyPlatformVersion2,
-			fly.MachineConfigMetadataKeyFlyProcessGroup:    fly.MachineProcessGroupFlyAppReleaseCommand,
+			fly.MachineConfigMetadataKeyFlyProcessGroup:    processGroup,
 		},
 		Env: lo.Assign(c.Env),
 	}
@@ -51,8 +74,7 @@ func (c *Config) ToReleaseMachineConfig() (*fly.MachineConfig, error) {
 		mConfig.Init.Entrypoint = c.Experimental.Entrypoint
 	}
 
-	mConfig.Env["RELEASE_COMMAND"] = "1"
-	mConfig.Env["FLY_PROCESS_GROUP"] = fly.MachineProcessGroupFlyAppReleaseCommand
+	mConfig.Env["FLY_PROCESS_GROUP"] = processGroup
 	if c.PrimaryRegion != "" {
 		mConfig.Env["PRIMARY_REGION"] = c.PrimaryRegion
 	}
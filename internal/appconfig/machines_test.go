@@ -172,6 +172,19 @@ func TestToReleaseMachineConfig(t *testing.T) {
 	assert.Equal(t, want, got)
 }
 
+func TestToDeployHookMachineConfig(t *testing.T) {
+	cfg, err := LoadConfig("./testdata/tomachine.toml")
+	require.NoError(t, err)
+
+	got, err := cfg.ToDeployHookMachineConfig("post_deploy", "warm-cache --all")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"warm-cache", "--all"}, got.Init.Cmd)
+	assert.Equal(t, map[string]string{"FOO": "BAR", "PRIMARY_REGION": "mia", "FLY_DEPLOY_HOOK": "post_deploy", "FLY_PROCESS_GROUP": "fly_app_deploy_hook"}, got.Env)
+	assert.Equal(t, "fly_app_deploy_hook", got.Metadata["fly_process_group"])
+	assert.True(t, got.AutoDestroy)
+	assert.Equal(t, fly.MachineRestartPolicyNo, got.Restart.Policy)
+}
+
 func TestToConsoleMachineConfig(t *testing.T) {
 	cfg, err := LoadConfig("./testdata/tomachine.toml")
 	require.NoError(t, err)
@@ -0,0 +1,266 @@
+package appconfig
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+	"github.com/samber/lo"
+	"github.com/superfly/flyctl/iostreams"
+)
+
+var lineKeyRegexp = regexp.MustCompile(`^((?:[A-Za-z0-9_-]+|"[^"]*"|'[^']*')(?:\s*\.\s*(?:[A-Za-z0-9_-]+|"[^"]*"|'[^']*'))*)\s*=`)
+
+// PatchChange is what a legacy format patch changed in a config file.
+type PatchChange struct {
+	Section string
+	Diff    string
+}
+
+// Migration is the result of upgrading a config file to the current format.
+type Migration struct {
+	Path    string
+	Changes []*PatchChange
+	// Dropped lists keys unknown to the current format, they are not kept
+	// in the canonical form
+	Dropped []string
+	// LostComments lists the lines of the comments of the original file the
+	// canonical form has no place for, as what they were about is gone
+	LostComments []int
+	Original     []byte
+	Canonical    []byte
+}
+
+// IsLossless reports whether the canonical form keeps every key and comment
+// of the original file.
+func (m *Migration) IsLossless() bool {
+	return len(m.Dropped) == 0 && len(m.LostComments) == 0
+}
+
+// IsCanonical reports whether the file is already in canonical form.
+func (m *Migration) IsCanonical() bool {
+	return bytes.Equal(m.Original, m.Canonical)
+}
+
+// MigrateConfigFile runs the patch pipeline over the config file at path,
+// recording what each patch changed, and renders the result in canonical
+// form. Variables and includes are left unresolved so the file can be
+// rewritten as is. Comments are kept above or at the end of the table or key
+// they were about.
+func MigrateConfigFile(path string, colorize *iostreams.ColorScheme) (*Migration, error) {
+	original, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	cfgMap, err := decodeTOML(original)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := cfgMap["include"]; ok {
+		return nil, errors.New("config files with an [include] section can't be migrated yet")
+	}
+	if _, ok := cfgMap[InterpolateKey]; ok {
+		return nil, errors.New("config files with interpolated variables can't be migrated yet")
+	}
+
+	m := &Migration{Path: path, Original: original}
+	for _, patch := range configPatches {
+		before, err := marshalConfigMap(cfgMap)
+		if err != nil {
+			return nil, err
+		}
+		if cfgMap, err = patch.apply(cfgMap); err != nil {
+			return nil, fmt.Errorf("failed patching %s: %w", patch.section, err)
+		}
+		after, err := marshalConfigMap(cfgMap)
+		if err != nil {
+			return nil, err
+		}
+		if before != after {
+			m.Changes = append(m.Changes, &PatchChange{
+				Section: patch.section,
+				Diff:    prettyDiff(before, after, colorize),
+			})
+		}
+	}
+
+	for _, sErr := range JSONSchema().Validate(cfgMap) {
+		if errors.Is(sErr.Err, ErrUnknownKey) {
+			m.Dropped = append(m.Dropped, sErr.Path)
+		}
+	}
+
+	cfg, err := mapToConfig(cfgMap)
+	if err != nil {
+		return nil, err
+	}
+	body, err := cfg.marshalTOML()
+	if err != nil {
+		return nil, err
+	}
+	m.Canonical, m.LostComments = keepComments(original, body)
+	return m, nil
+}
+
+// marshalConfigMap renders cfgMap to compare it before and after a patch.
+// Empty lists some patches add are skipped as they change nothing.
+func marshalConfigMap(cfgMap map[string]any) (string, error) {
+	buf, err := toml.Marshal(lo.OmitBy(cfgMap, func(_ string, v any) bool {
+		return isEmptySlice(v)
+	}))
+	return string(buf), err
+}
+
+// tomlComments are the comments above and at the end of a line.
+type tomlComments struct {
+	above  []string
+	inline string
+	lines  []int
+	used   bool
+}
+
+// keepComments copies the comments of original over to body: the block at the
+// top of the file, the comments above and at the end of table headers and
+// keys, and those at the end of the file. It returns the lines of original
+// holding comments it found no place for in body.
+func keepComments(original, body []byte) ([]byte, []int) {
+	var (
+		out          bytes.Buffer
+		lines        = strings.Split(string(original), "\n")
+		comments     = map[string]*tomlComments{}
+		lost         []int
+		pending      []string
+		pendingLines []int
+		table        string
+		seen         = map[string]int{}
+	)
+
+	// Leading comments, up to the first line with a key or a table
+	idx := 0
+	for ; idx < len(lines); idx++ {
+		trimmed := strings.TrimSpace(lines[idx])
+		if trimmed != "" && !strings.HasPrefix(trimmed, "#") {
+			break
+		}
+	}
+	if header := strings.TrimSpace(strings.Join(lines[:idx], "\n")); header != "" {
+		out.WriteString(header + "\n\n")
+	}
+
+	for i, line := range lines[idx:] {
+		lineNum := idx + i + 1
+		trimmed := strings.TrimSpace(line)
+		id := ""
+		switch {
+		case trimmed == "":
+			continue
+		case strings.HasPrefix(trimmed, "#"):
+			pending = append(pending, trimmed)
+			pendingLines = append(pendingLines, lineNum)
+			continue
+		case strings.HasPrefix(trimmed, "["):
+			table = tableKey(trimmed, seen)
+			id = table
+		default:
+			if key := lineKey(trimmed); key != "" {
+				id = table + "/" + key
+			}
+		}
+
+		c := &tomlComments{above: pending, inline: inlineComment(trimmed), lines: pendingLines}
+		if c.inline != "" {
+			c.lines = append(c.lines, lineNum)
+		}
+		pending, pendingLines = nil, nil
+		if id == "" {
+			// Inside a value spanning several lines
+			lost = append(lost, c.lines...)
+			continue
+		}
+		comments[id] = c
+	}
+
+	table, seen = "", map[string]int{}
+	for _, line := range strings.SplitAfter(string(body), "\n") {
+		trimmed := strings.TrimSpace(line)
+		var c *tomlComments
+		switch {
+		case strings.HasPrefix(trimmed, "["):
+			table = tableKey(trimmed, seen)
+			c = comments[table]
+		case lineKey(trimmed) != "":
+			c = comments[table+"/"+lineKey(trimmed)]
+		}
+		if c == nil {
+			out.WriteString(line)
+			continue
+		}
+
+		c.used = true
+		indent := line[:len(line)-len(strings.TrimLeft(line, " "))]
+		for _, comment := range c.above {
+			out.WriteString(indent + comment + "\n")
+		}
+		if c.inline != "" {
+			line = strings.TrimSuffix(line, "\n") + " " + c.inline + "\n"
+		}
+		out.WriteString(line)
+	}
+
+	// Comments at the end of the file stay there
+	if len(pending) > 0 {
+		out.WriteString("\n" + strings.Join(pending, "\n") + "\n")
+	}
+
+	for _, c := range comments {
+		if !c.used {
+			lost = append(lost, c.lines...)
+		}
+	}
+	slices.Sort(lost)
+	return out.Bytes(), lost
+}
+
+// lineKey returns the key set on line, without quotes or spaces, or an empty
+// string if line doesn't set one.
+func lineKey(line string) string {
+	m := lineKeyRegexp.FindStringSubmatch(line)
+	if m == nil {
+		return ""
+	}
+	return strings.NewReplacer(`"`, "", "'", "", " ", "", "\t", "").Replace(m[1])
+}
+
+// inlineComment returns the comment at the end of line, if any.
+func inlineComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case quote == '"' && c == '\\':
+			i++
+		case quote != 0 && c == quote:
+			quote = 0
+		case quote == 0 && (c == '"' || c == '\''):
+			quote = c
+		case quote == 0 && c == '#':
+			return strings.TrimSpace(line[i:])
+		}
+	}
+	return ""
+}
+
+// tableKey identifies the nth occurrence of a table header, so comments of
+// arrays of tables go back to the same entry.
+func tableKey(header string, seen map[string]int) string {
+	header, _, _ = strings.Cut(header, "#")
+	// [mounts] becomes [[mounts]] once patched
+	header = strings.Trim(strings.Join(strings.Fields(header), ""), "[]")
+	seen[header]++
+	return fmt.Sprintf("%s#%d", header, seen[header])
+}
@@ -0,0 +1,70 @@
+package appconfig
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/superfly/flyctl/iostreams"
+)
+
+func TestMigrateConfigFile(t *testing.T) {
+	ios, _, _, _ := iostreams.Test()
+	m, err := MigrateConfigFile("./testdata/migrate/legacy.toml", ios.ColorScheme())
+	require.NoError(t, err)
+	assert.False(t, m.IsCanonical())
+	assert.Empty(t, m.Dropped)
+
+	sections := lo.Map(m.Changes, func(c *PatchChange, _ int) string { return c.Section })
+	assert.Equal(t, []string{"env", "services", "top level fields"}, sections)
+	assert.Contains(t, m.Changes[0].Diff, "+ PORT = '8080'")
+	assert.Contains(t, m.Changes[2].Diff, "+ kill_timeout = '10s'")
+
+	canonical := string(m.Canonical)
+	assert.Contains(t, canonical, "# Legacy fly.toml kept around since 2021\n\napp = 'foo'")
+	assert.Contains(t, canonical, "# Built with the builtin node builder\n[build]")
+	assert.Contains(t, canonical, "internal_port = 8080")
+
+	// Migrating the canonical form changes nothing
+	path := filepath.Join(t.TempDir(), "fly.toml")
+	require.NoError(t, os.WriteFile(path, m.Canonical, 0o644))
+	m, err = MigrateConfigFile(path, ios.ColorScheme())
+	require.NoError(t, err)
+	assert.True(t, m.IsCanonical())
+	assert.Empty(t, m.Changes)
+}
+
+func TestMigrateConfigFileDroppedKeys(t *testing.T) {
+	ios, _, _, _ := iostreams.Test()
+	m, err := MigrateConfigFile("./testdata/migrate/unknown-key.toml", ios.ColorScheme())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"deploy.stratgy"}, m.Dropped)
+	assert.False(t, m.IsLossless())
+}
+
+func TestMigrateConfigFileComments(t *testing.T) {
+	ios, _, _, _ := iostreams.Test()
+	m, err := MigrateConfigFile("./testdata/migrate/comments.toml", ios.ColorScheme())
+	require.NoError(t, err)
+	assert.Empty(t, m.Dropped)
+	assert.Equal(t, []int{15}, m.LostComments)
+	assert.False(t, m.IsLossless())
+
+	canonical := string(m.Canonical)
+	assert.Contains(t, canonical, "app = 'foo' # the app\n")
+	assert.Contains(t, canonical, "# Old style, in seconds\nkill_timeout = '10s'\n")
+	assert.Contains(t, canonical, "[env] # runtime env\n  # Port the server listens on\n  PORT = '8080'\n")
+	assert.True(t, strings.HasSuffix(canonical, "\n\n# TODO: add a volume\n"), canonical)
+
+	// Migrating the canonical form keeps the comments where they are
+	path := filepath.Join(t.TempDir(), "fly.toml")
+	require.NoError(t, os.WriteFile(path, m.Canonical, 0o644))
+	m, err = MigrateConfigFile(path, ios.ColorScheme())
+	require.NoError(t, err)
+	assert.True(t, m.IsCanonical())
+	assert.True(t, m.IsLossless())
+}
@@ -0,0 +1,182 @@
+package appconfig
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// OverlayFilePath returns the path of the overlay file for the given
+// environment, e.g. fly.production.toml for fly.toml and "production".
+func OverlayFilePath(path, env string) string {
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "." + env + ext
+}
+
+// LoadConfigWithEnv loads the app config at the given path and merges the
+// overlay file for env on top of it. An empty env is the same as LoadConfig.
+func LoadConfigWithEnv(path, env string) (*Config, error) {
+	if env == "" {
+		return LoadConfig(path)
+	}
+
+	cfgMap, p, err := loadWithEnv(path, env)
+	if err != nil {
+		return nil, err
+	}
+
+	var cfg *Config
+	err = p.patchErr
+	if err == nil {
+		cfg, err = mapToConfig(cfgMap)
+	}
+	// Like LoadConfig, configs that can't be patched or decoded are loaded
+	// bare for validation to report why
+	if err != nil {
+		cfg = unpatchedConfig(cfgMap, err)
+	}
+
+	cfg.configFilePath = path
+	cfg.configEnv = env
+	cfg.unresolvedVars = p.unresolved
+	return cfg, nil
+}
+
+// loadPatchedConfigMap returns the patched map of the config file at path,
+// merged with the overlay for env if one is given. Unlike loading a Config,
+// failing to patch a file is an error.
+func loadPatchedConfigMap(path, env string) (map[string]any, error) {
+	cfgMap, p, err := loadWithEnv(path, env)
+	if err != nil {
+		return nil, err
+	}
+	return cfgMap, p.patchErr
+}
+
+func loadWithEnv(path, env string) (map[string]any, *preprocessor, error) {
+	p := newPreprocessor(path)
+	base, err := p.loadPatched(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	if env == "" {
+		return base, p, nil
+	}
+
+	overlay, err := p.loadPatched(OverlayFilePath(path, env))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed loading %s overlay: %w", env, err)
+	}
+	return mergeConfigMaps(base, overlay), p, nil
+}
+
+func (p *preprocessor) loadPatched(path string) (map[string]any, error) {
+	cfgMap, err := p.load(path)
+	if err != nil {
+		return nil, err
+	}
+	return p.patch(cfgMap, path), nil
+}
+
+// mergeConfigMaps merges overlay on top of base. Both maps must have gone
+// through patchRoot already so every section is in its canonical shape.
+//
+// Tables are merged key by key, [[services]] are matched by internal_port and
+// [[vm]] by the process groups they apply to. Any other value in overlay
+// replaces the one in base, except for empty lists which are ignored.
+func mergeConfigMaps(base, overlay map[string]any) map[string]any {
+	for k, v := range overlay {
+		switch k {
+		case "services":
+			base[k] = mergeMapListsByKey(base[k], v, serviceMergeKey)
+		case "vm":
+			base[k] = mergeMapListsByKey(base[k], v, computeMergeKey)
+		default:
+			base[k] = mergeValues(base[k], v)
+		}
+	}
+	return base
+}
+
+func mergeValues(base, overlay any) any {
+	baseMap, baseOk := asAnyMap(base)
+	overlayMap, overlayOk := asAnyMap(overlay)
+	if baseOk && overlayOk {
+		for k, v := range overlayMap {
+			baseMap[k] = mergeValues(baseMap[k], v)
+		}
+		return baseMap
+	}
+
+	if isEmptySlice(overlay) && base != nil {
+		return base
+	}
+	return overlay
+}
+
+func mergeMapListsByKey(base, overlay any, keyFn func(map[string]any) string) any {
+	overlayList, err := ensureArrayOfMap(overlay)
+	if err != nil || len(overlayList) == 0 {
+		return mergeValues(base, overlay)
+	}
+	if base == nil {
+		return overlayList
+	}
+	baseList, err := ensureArrayOfMap(base)
+	if err != nil {
+		return overlayList
+	}
+
+	for _, item := range overlayList {
+		key := keyFn(item)
+		idx := slices.IndexFunc(baseList, func(m map[string]any) bool {
+			return key != "" && keyFn(m) == key
+		})
+		if idx == -1 {
+			baseList = append(baseList, item)
+			continue
+		}
+		baseList[idx] = mergeValues(baseList[idx], item).(map[string]any)
+	}
+	return baseList
+}
+
+func serviceMergeKey(service map[string]any) string {
+	if port, ok := service["internal_port"]; ok {
+		return castToString(port)
+	}
+	return ""
+}
+
+func computeMergeKey(compute map[string]any) string {
+	groups, err := stringOrSliceToSlice(compute["processes"], "processes")
+	if err != nil {
+		return ""
+	}
+	groups = slices.Clone(groups)
+	slices.Sort(groups)
+	// Sections without processes apply to all groups and share the "[]" key
+	return "[" + strings.Join(groups, ",") + "]"
+}
+
+func asAnyMap(v any) (map[string]any, bool) {
+	switch cast := v.(type) {
+	case map[string]any:
+		return cast, true
+	case map[string]string:
+		m := make(map[string]any, len(cast))
+		for k, v := range cast {
+			m[k] = v
+		}
+		return m, true
+	default:
+		return nil, false
+	}
+}
+
+func isEmptySlice(v any) bool {
+	rv := reflect.ValueOf(v)
+	return rv.Kind() == reflect.Slice && rv.Len() == 0
+}
@@ -10,17 +10,23 @@ import (
 
 type patchFuncType func(map[string]any) (map[string]any, error)
 
-var configPatches = []patchFuncType{
-	patchEnv,
-	patchServices,
-	patchProcesses,
-	patchExperimental,
-	patchTopLevelChecks,
-	patchCompute,
-	patchMounts,
-	patchMetrics,
-	patchTopFields,
-	patchBuild,
+// configPatch is a patch along with the name of the section it upgrades
+type configPatch struct {
+	section string
+	apply   patchFuncType
+}
+
+var configPatches = []configPatch{
+	{"env", patchEnv},
+	{"services", patchServices},
+	{"processes", patchProcesses},
+	{"experimental", patchExperimental},
+	{"checks", patchTopLevelChecks},
+	{"vm", patchCompute},
+	{"mounts", patchMounts},
+	{"metrics", patchMetrics},
+	{"top level fields", patchTopFields},
+	{"build", patchBuild},
 }
 
 func applyPatches(cfgMap map[string]any) (*Config, error) {
@@ -43,8 +49,8 @@ func mapToConfig(cfgMap map[string]any) (*Config, error) {
 // Migrate whatever we found in old fly.toml files to newish format
 func patchRoot(cfgMap map[string]any) (map[string]any, error) {
 	var err error
-	for _, patchFunc := range configPatches {
-		cfgMap, err = patchFunc(cfgMap)
+	for _, patch := range configPatches {
+		cfgMap, err = patch.apply(cfgMap)
 		if err != nil {
 			return cfgMap, err
 		}
@@ -0,0 +1,414 @@
+package appconfig
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+const (
+	// DotEnvFileName is the file next to fly.toml that provides values for
+	// ${VAR} references not set in the process environment.
+	DotEnvFileName = ".env"
+
+	// InterpolateKey is the top level key a config file sets to true to have
+	// its ${VAR} references resolved. Files without it are read as they are,
+	// so references meant for the shell of the machines are left alone.
+	InterpolateKey = "interpolate"
+)
+
+var (
+	// ${NAME} or ${NAME:-default}; $${ escapes a literal ${
+	interpolationRegexp = regexp.MustCompile(`^(?:\$\$\{|\$\{([A-Za-z_][A-Za-z0-9_]*)(?::-([^}]*))?\})`)
+	// interpolateRegexp finds InterpolateKey among the top level keys
+	interpolateRegexp = regexp.MustCompile(`^` + InterpolateKey + `\s*=\s*true\s*(#.*)?$`)
+	// bareValueRegexp matches the values that can replace a reference outside
+	// of a string as they are: numbers and booleans. Others are quoted.
+	bareValueRegexp = regexp.MustCompile(`^(true|false|[+-]?[0-9][0-9_]*(\.[0-9_]+)?([eE][+-]?[0-9_]+)?)$`)
+
+	dotEnvNameRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+	ErrIncludeCycle = errors.New("include cycle")
+)
+
+// SourceError is a problem found at a given position of a config file.
+type SourceError struct {
+	Path   string
+	Line   int
+	Column int
+	Err    error
+}
+
+func (e *SourceError) Error() string {
+	return fmt.Sprintf("%s: row %d column %d: %s", e.Path, e.Line, e.Column, e.Err)
+}
+
+func (e *SourceError) Unwrap() error {
+	return e.Err
+}
+
+// preprocessor resolves ${VAR} references and [include] directives of config
+// files before they are patched into a Config.
+type preprocessor struct {
+	path       string
+	dotEnvPath string
+	dotEnv     map[string]string
+	unresolved []*SourceError
+	stack      []string
+	// patchErr is the first failure to patch a file. Loading goes on and the
+	// config falls back to a bare one carrying it, see unpatchedConfig.
+	patchErr error
+}
+
+func newPreprocessor(path string) *preprocessor {
+	return &preprocessor{path: path, dotEnvPath: filepath.Join(filepath.Dir(path), DotEnvFileName)}
+}
+
+func (p *preprocessor) lookup(name string) (string, bool, error) {
+	if v, ok := os.LookupEnv(name); ok {
+		return v, true, nil
+	}
+	// .env is only read by the files that interpolate
+	if p.dotEnv == nil {
+		dotEnv, err := readDotEnv(p.dotEnvPath)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return "", false, fmt.Errorf("failed reading %s: %w", p.dotEnvPath, err)
+		}
+		p.dotEnv = dotEnv
+		if p.dotEnv == nil {
+			p.dotEnv = map[string]string{}
+		}
+	}
+	v, ok := p.dotEnv[name]
+	return v, ok, nil
+}
+
+// load reads the config file at path and returns its raw map with variables
+// interpolated and included files merged underneath it. Files with includes
+// are patched before they're merged, like overlays, so that every file can
+// use any shape fly.toml accepts.
+func (p *preprocessor) load(path string) (map[string]any, error) {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if interpolates(buf) {
+		if buf, err = p.interpolate(buf, path); err != nil {
+			return nil, err
+		}
+	}
+
+	cfgMap, err := decodeTOML(buf)
+	if err != nil {
+		if len(p.stack) > 0 {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		return nil, err
+	}
+	delete(cfgMap, InterpolateKey)
+
+	raw, ok := cfgMap["include"]
+	if !ok {
+		return cfgMap, nil
+	}
+	delete(cfgMap, "include")
+
+	includes, err := includeFiles(raw)
+	if err != nil {
+		return nil, p.sourceError(buf, path, "include", err)
+	}
+
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	p.stack = append(p.stack, absPath)
+	defer func() { p.stack = p.stack[:len(p.stack)-1] }()
+
+	merged := map[string]any{}
+	for _, include := range includes {
+		includePath := include
+		if !filepath.IsAbs(includePath) {
+			includePath = filepath.Join(filepath.Dir(path), include)
+		}
+		if err := p.checkCycle(includePath); err != nil {
+			return nil, p.sourceError(buf, path, include, err)
+		}
+
+		includeMap, err := p.load(includePath)
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil, p.sourceError(buf, path, include, err)
+			}
+			return nil, err
+		}
+		merged = mergeConfigMaps(merged, p.patch(includeMap, includePath))
+	}
+	return mergeConfigMaps(merged, p.patch(cfgMap, path)), nil
+}
+
+// patch brings cfgMap in its canonical shape. Failures are recorded rather
+// than returned, what's left of cfgMap is still merged so that the bare
+// config it falls back to keeps its app name.
+func (p *preprocessor) patch(cfgMap map[string]any, path string) map[string]any {
+	patched, err := patchRoot(cfgMap)
+	switch {
+	case err == nil:
+		return patched
+	case p.patchErr != nil:
+	case path == p.path:
+		p.patchErr = err
+	default:
+		p.patchErr = fmt.Errorf("%s: %w", path, err)
+	}
+	// Patches update cfgMap in-place
+	return cfgMap
+}
+
+func (p *preprocessor) checkCycle(path string) error {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	for idx, visited := range p.stack {
+		if visited == absPath {
+			chain := append(slices.Clone(p.stack[idx:]), absPath)
+			for i := range chain {
+				chain[i] = filepath.Base(chain[i])
+			}
+			return fmt.Errorf("%w: %s", ErrIncludeCycle, strings.Join(chain, " -> "))
+		}
+	}
+	return nil
+}
+
+// interpolates tells whether the config file buf opts in to interpolation
+// by setting InterpolateKey to true before its first table.
+func interpolates(buf []byte) bool {
+	for _, line := range strings.Split(string(buf), "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(line, "["):
+			return false
+		case interpolateRegexp.MatchString(line):
+			return true
+		}
+	}
+	return false
+}
+
+// tomlContext is where a ${VAR} reference is found in a TOML document, which
+// decides how its value must be written in its place.
+type tomlContext int
+
+const (
+	tomlBare tomlContext = iota
+	tomlComment
+	tomlBasicString
+	tomlLiteralString
+	tomlMultilineBasicString
+	tomlMultilineLiteralString
+)
+
+// interpolate replaces the ${VAR} references in buf, outside of comments.
+// Values are escaped for the string they're in, or quoted when they replace
+// a whole value and aren't a number or a boolean, so they can't change the
+// structure of the document. Unresolved references in strings are kept as
+// they are and recorded so `fly config validate` can warn about them.
+func (p *preprocessor) interpolate(buf []byte, path string) ([]byte, error) {
+	var (
+		out       bytes.Buffer
+		ctx       = tomlBare
+		line      = 1
+		lineStart = 0
+	)
+	sourceErr := func(offset int, err error) *SourceError {
+		return &SourceError{Path: path, Line: line, Column: offset - lineStart + 1, Err: err}
+	}
+
+	for i := 0; i < len(buf); {
+		rest := buf[i:]
+
+		if rest[0] == '$' && ctx != tomlComment {
+			if m := interpolationRegexp.FindSubmatchIndex(rest); m != nil {
+				ref := rest[:m[1]]
+				if m[2] == -1 {
+					out.WriteString("${")
+					i += len(ref)
+					continue
+				}
+
+				name := string(rest[m[2]:m[3]])
+				v, ok, err := p.lookup(name)
+				if err != nil {
+					return nil, err
+				}
+				if !ok && m[4] != -1 {
+					v, ok = string(rest[m[4]:m[5]]), true
+				}
+
+				switch {
+				case !ok && ctx == tomlBare:
+					return nil, sourceErr(i, fmt.Errorf("unresolved variable '%s'", name))
+				case !ok:
+					p.unresolved = append(p.unresolved, sourceErr(i, fmt.Errorf("unresolved variable '%s'", name)))
+					out.Write(ref)
+				default:
+					escaped, err := escapeTOMLValue(v, ctx)
+					if err != nil {
+						return nil, sourceErr(i, fmt.Errorf("variable '%s': %w", name, err))
+					}
+					out.WriteString(escaped)
+				}
+				i += len(ref)
+				continue
+			}
+		}
+
+		n := 1
+		switch c := rest[0]; {
+		case c == '\n':
+			line++
+			lineStart = i + 1
+			if ctx == tomlComment || ctx == tomlBasicString || ctx == tomlLiteralString {
+				ctx = tomlBare
+			}
+		case ctx == tomlBare && c == '#':
+			ctx = tomlComment
+		case ctx == tomlBare && bytes.HasPrefix(rest, []byte(`"""`)):
+			ctx, n = tomlMultilineBasicString, 3
+		case ctx == tomlBare && c == '"':
+			ctx = tomlBasicString
+		case ctx == tomlBare && bytes.HasPrefix(rest, []byte(`'''`)):
+			ctx, n = tomlMultilineLiteralString, 3
+		case ctx == tomlBare && c == '\'':
+			ctx = tomlLiteralString
+		case (ctx == tomlBasicString || ctx == tomlMultilineBasicString) && c == '\\' && len(rest) > 1 && rest[1] != '\n':
+			n = 2
+		case ctx == tomlBasicString && c == '"':
+			ctx = tomlBare
+		case ctx == tomlMultilineBasicString && bytes.HasPrefix(rest, []byte(`"""`)):
+			ctx, n = tomlBare, 3
+		case ctx == tomlLiteralString && c == '\'':
+			ctx = tomlBare
+		case ctx == tomlMultilineLiteralString && bytes.HasPrefix(rest, []byte(`'''`)):
+			ctx, n = tomlBare, 3
+		}
+		out.Write(rest[:n])
+		i += n
+	}
+	return out.Bytes(), nil
+}
+
+// escapeTOMLValue writes v so that it reads back as is where it's found.
+func escapeTOMLValue(v string, ctx tomlContext) (string, error) {
+	switch ctx {
+	case tomlBasicString, tomlMultilineBasicString:
+		return escapeTOMLString(v), nil
+	case tomlLiteralString, tomlMultilineLiteralString:
+		if strings.ContainsAny(v, "'\r\n") {
+			return "", errors.New("its value can't be written in a literal '...' string, use a \"...\" string instead")
+		}
+		return v, nil
+	default:
+		if bareValueRegexp.MatchString(v) {
+			return v, nil
+		}
+		return `"` + escapeTOMLString(v) + `"`, nil
+	}
+}
+
+func escapeTOMLString(v string) string {
+	var b strings.Builder
+	for _, r := range v {
+		switch {
+		case r == '"' || r == '\\':
+			b.WriteRune('\\')
+			b.WriteRune(r)
+		case r == '\n':
+			b.WriteString(`\n`)
+		case r == '\r':
+			b.WriteString(`\r`)
+		case r == '\t':
+			b.WriteString(`\t`)
+		case r < 0x20 || r == 0x7f:
+			fmt.Fprintf(&b, `\u%04X`, r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// sourceError locates the first quoted occurrence of needle in buf to point
+// the user at the directive that caused err.
+func (p *preprocessor) sourceError(buf []byte, path, needle string, err error) error {
+	offset := -1
+	for _, quote := range []string{`"`, `'`} {
+		if offset = bytes.Index(buf, []byte(quote+needle+quote)); offset != -1 {
+			break
+		}
+	}
+	if offset == -1 {
+		offset = max(bytes.Index(buf, []byte(needle)), 0)
+	}
+
+	lineStart := bytes.LastIndexByte(buf[:offset], '\n') + 1
+	return &SourceError{
+		Path:   path,
+		Line:   bytes.Count(buf[:offset], []byte("\n")) + 1,
+		Column: offset - lineStart + 1,
+		Err:    err,
+	}
+}
+
+// includeFiles accepts the [include] section, either as a table with a
+// "files" list or as a plain list or string of file names.
+func includeFiles(raw any) ([]string, error) {
+	if cast, ok := raw.(map[string]any); ok {
+		raw, ok = cast["files"]
+		if !ok {
+			return nil, errors.New("[include] section requires a 'files' list")
+		}
+	}
+	return stringOrSliceToSlice(raw, "include")
+}
+
+// readDotEnv parses a file of NAME=VALUE lines. Values can be quoted and
+// lines may start with "export". Lines that don't set a variable, like
+// comments, are skipped.
+func readDotEnv(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	vars := map[string]string{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if rest, ok := strings.CutPrefix(line, "export"); ok && rest != "" && (rest[0] == ' ' || rest[0] == '\t') {
+			line = strings.TrimSpace(rest)
+		}
+
+		name, value, ok := strings.Cut(line, "=")
+		name = strings.TrimSpace(name)
+		if !ok || !dotEnvNameRegexp.MatchString(name) {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		vars[name] = value
+	}
+	return vars, scanner.Err()
+}
@@ -0,0 +1,188 @@
+package appconfig
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	fly "github.com/superfly/fly-go"
+)
+
+func writeConfigFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644))
+	}
+	return filepath.Join(dir, "fly.toml")
+}
+
+func TestLoadConfig_InterpolationIsOptIn(t *testing.T) {
+	t.Setenv("HOME_DIR", "/home/me")
+	path := writeConfigFiles(t, map[string]string{
+		"fly.toml": `
+app = "no-interpolation"
+
+[env]
+  DATA = "${HOME_DIR}/data"
+
+[processes]
+  app = "sh -c 'exec server --port ${PORT}'"
+`,
+		// Not read by files that don't interpolate
+		".env": "not a dotenv file\n",
+	})
+
+	cfg, err := LoadConfig(path)
+	require.NoError(t, err)
+	assert.Equal(t, "${HOME_DIR}/data", cfg.Env["DATA"])
+	assert.Equal(t, "sh -c 'exec server --port ${PORT}'", cfg.Processes["app"])
+	assert.Empty(t, cfg.VariableIssues())
+}
+
+func TestLoadConfig_InterpolationEscapesValues(t *testing.T) {
+	t.Setenv("QUOTED", `say "hi" \o/`)
+	t.Setenv("MULTILINE", "a\nb = 1\n[evil]")
+	t.Setenv("PORT", "8080")
+	t.Setenv("REGION", "fra")
+	path := writeConfigFiles(t, map[string]string{
+		"fly.toml": `
+app = "interpolation" # a comment with ${UNSET}
+interpolate = true
+primary_region = ${REGION}
+
+[env]
+  QUOTED = "${QUOTED}"
+  MULTILINE = "${MULTILINE}"
+  LITERAL = '${REGION}'
+  SHELL = "${SHELL_ONLY}"
+
+[http_service]
+  internal_port = ${PORT}
+`,
+	})
+
+	cfg, err := LoadConfig(path)
+	require.NoError(t, err)
+	assert.Equal(t, "fra", cfg.PrimaryRegion)
+	assert.Equal(t, map[string]string{
+		"QUOTED":    `say "hi" \o/`,
+		"MULTILINE": "a\nb = 1\n[evil]",
+		"LITERAL":   "fra",
+		"SHELL":     "${SHELL_ONLY}",
+	}, cfg.Env)
+	assert.Equal(t, 8080, cfg.HTTPService.InternalPort)
+
+	issues := cfg.VariableIssues()
+	require.Len(t, issues, 1)
+	assert.Contains(t, issues[0].Message, "row 10 column 12: unresolved variable 'SHELL_ONLY'")
+}
+
+func TestLoadConfig_InterpolationErrors(t *testing.T) {
+	t.Setenv("QUOTE", "it's")
+	path := writeConfigFiles(t, map[string]string{
+		"fly.toml": "interpolate = true\napp = '${QUOTE}'\n",
+	})
+	_, err := LoadConfig(path)
+	var serr *SourceError
+	require.ErrorAs(t, err, &serr)
+	assert.Equal(t, 2, serr.Line)
+	assert.Equal(t, 8, serr.Column)
+	assert.ErrorContains(t, err, "literal '...' string")
+
+	path = writeConfigFiles(t, map[string]string{
+		"fly.toml": "interpolate = true\n[http_service]\n  internal_port = ${NO_PORT}\n",
+	})
+	_, err = LoadConfig(path)
+	require.ErrorAs(t, err, &serr)
+	assert.Equal(t, 3, serr.Line)
+	assert.ErrorContains(t, err, "unresolved variable 'NO_PORT'")
+}
+
+func TestLoadConfig_LegacyIncludes(t *testing.T) {
+	path := writeConfigFiles(t, map[string]string{
+		"fly.toml": `
+app = "legacy-includes"
+kill_timeout = 10
+
+[include]
+  files = ["services.toml"]
+
+[env]
+  LOG_LEVEL = "info"
+
+[[services]]
+  internal_port = 8080
+  protocol = "tcp"
+  auto_stop_machines = false
+
+[[services]]
+  internal_port = 9090
+  protocol = "udp"
+`,
+		"services.toml": `
+kill_timeout = 5
+
+[include]
+  files = ["env.toml"]
+
+[services]
+  internal_port = 8080
+  protocol = "tcp"
+  concurrency = "20,25"
+`,
+		"env.toml": `
+env = [{ SHARED = "yes" }]
+`,
+	})
+	require.NoError(t, os.WriteFile(OverlayFilePath(path, "production"), []byte("[env]\n  ENV = \"production\"\n"), 0o644))
+
+	// Included files are patched before they're merged, overlays or not
+	for _, load := range []func(string) (*Config, error){
+		LoadConfig,
+		func(path string) (*Config, error) {
+			return LoadConfigWithEnv(path, "production")
+		},
+	} {
+		cfg, err := load(path)
+		require.NoError(t, err)
+		require.NoError(t, cfg.v2UnmarshalError)
+
+		assert.Equal(t, "yes", cfg.Env["SHARED"])
+		assert.Equal(t, "info", cfg.Env["LOG_LEVEL"])
+		assert.Equal(t, 10*time.Second, cfg.KillTimeout.Duration)
+		require.Len(t, cfg.Services, 2)
+		assert.Equal(t, 8080, cfg.Services[0].InternalPort)
+		assert.Equal(t, fly.Pointer(false), cfg.Services[0].AutoStopMachines)
+		require.NotNil(t, cfg.Services[0].Concurrency)
+		assert.Equal(t, 20, cfg.Services[0].Concurrency.SoftLimit)
+		assert.Equal(t, 25, cfg.Services[0].Concurrency.HardLimit)
+		assert.Equal(t, 9090, cfg.Services[1].InternalPort)
+	}
+}
+
+func TestReadDotEnv(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".env")
+	require.NoError(t, os.WriteFile(path, []byte(`
+# comment
+PLAIN=1
+export EXPORTED = "two"
+export	TABBED='three'
+export ONLY_EXPORTED
+not a variable
+1BAD=x
+EMPTY=
+`), 0o644))
+
+	vars, err := readDotEnv(path)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"PLAIN":    "1",
+		"EXPORTED": "two",
+		"TABBED":   "three",
+		"EMPTY":    "",
+	}, vars)
+}
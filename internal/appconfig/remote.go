@@ -62,7 +62,79 @@ func getAppV2ConfigFromReleases(ctx context.Context, apiClient *fly.Client, appN
 		return nil, err
 	}
 
-	configDefinition := resp.App.CurrentReleaseUnprocessed.ConfigDefinition
+	return configFromDefinition(resp.App.CurrentReleaseUnprocessed.ConfigDefinition)
+}
+
+// ReleaseConfig is what a release of an app was deployed with.
+type ReleaseConfig struct {
+	Version  int
+	ImageRef string
+	Config   *Config
+}
+
+// FromRelease rebuilds the config the given release version of the app was
+// deployed with, as FromRemoteApp does for the current release.
+func FromRelease(ctx context.Context, appName string, version int) (*ReleaseConfig, error) {
+	_ = `# @genqlient
+	query FlyctlConfigReleases(
+		$appName: String!,
+		# @genqlient(omitempty: true)
+		$after: String,
+	) {
+		app(name:$appName) {
+			releasesUnprocessed(first: 50, after: $after) {
+				nodes {
+					version
+					imageRef
+					configDefinition
+				}
+				pageInfo {
+					hasNextPage
+					endCursor
+				}
+			}
+		}
+	}
+	`
+	apiClient := fly.ClientFromContext(ctx)
+
+	var after string
+	for {
+		resp, err := gql.FlyctlConfigReleases(ctx, apiClient.GenqClient, appName, after)
+		if err != nil {
+			return nil, err
+		}
+
+		releases := resp.App.ReleasesUnprocessed
+		for _, release := range releases.Nodes {
+			if release.Version != version {
+				continue
+			}
+
+			cfg, err := configFromDefinition(release.ConfigDefinition)
+			switch {
+			case err != nil:
+				return nil, err
+			case cfg == nil:
+				return nil, fmt.Errorf("release v%d has no config to roll back to", version)
+			case release.ImageRef == "":
+				return nil, fmt.Errorf("release v%d has no image to roll back to", version)
+			}
+			if err := cfg.SetMachinesPlatform(); err != nil {
+				return nil, err
+			}
+			cfg.AppName = appName
+			return &ReleaseConfig{Version: version, ImageRef: release.ImageRef, Config: cfg}, nil
+		}
+
+		if !releases.PageInfo.HasNextPage {
+			return nil, fmt.Errorf("release v%d of app %s not found", version, appName)
+		}
+		after = releases.PageInfo.EndCursor
+	}
+}
+
+func configFromDefinition(configDefinition any) (*Config, error) {
 	if configDefinition == nil {
 		return nil, nil
 	}
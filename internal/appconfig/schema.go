@@ -0,0 +1,268 @@
+package appconfig
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+
+	fly "github.com/superfly/fly-go"
+)
+
+const jsonSchemaDraft = "https://json-schema.org/draft/2020-12/schema"
+
+var ErrUnknownKey = errors.New("unknown key")
+
+// Schema is the subset of JSON Schema needed to describe fly.toml.
+type Schema struct {
+	Schema               string             `json:"$schema,omitempty"`
+	Title                string             `json:"title,omitempty"`
+	Type                 any                `json:"type,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties any                `json:"additionalProperties,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+}
+
+// SchemaError is a value that doesn't match the schema at the given path.
+type SchemaError struct {
+	Path string
+	Err  error
+}
+
+func (e *SchemaError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Path, e.Err)
+}
+
+func (e *SchemaError) Unwrap() error {
+	return e.Err
+}
+
+var durationType = reflect.TypeOf(fly.Duration{})
+
+// JSONSchema returns the JSON Schema of fly.toml generated from the struct
+// tags of Config and the sections it is made of, plus the keys handled
+// before the file is decoded into a Config.
+func JSONSchema() *Schema {
+	s := schemaFor(reflect.TypeOf(Config{}))
+	s.Schema = jsonSchemaDraft
+	s.Title = "fly.toml"
+
+	// [include] is a table with a "files" list, or a plain list or string
+	files := &Schema{Type: "array", Items: &Schema{Type: "string"}}
+	s.Properties["include"] = &Schema{
+		Type:                 []string{"string", "array", "object"},
+		Items:                files.Items,
+		Properties:           map[string]*Schema{"files": files},
+		Required:             []string{"files"},
+		AdditionalProperties: false,
+	}
+	s.Properties[InterpolateKey] = &Schema{Type: "boolean"}
+	return s
+}
+
+func schemaFor(t reflect.Type) *Schema {
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == durationType {
+		// Durations are strings like "10s" but legacy configs use integers
+		return &Schema{Type: []string{"string", "integer"}}
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.Slice, reflect.Array:
+		return &Schema{Type: "array", Items: schemaFor(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: schemaFor(t.Elem())}
+	case reflect.Struct:
+		s := &Schema{Type: "object", Properties: map[string]*Schema{}, AdditionalProperties: false}
+		addStructProperties(s, t)
+		return s
+	default:
+		// interface values accept anything
+		return &Schema{}
+	}
+}
+
+func addStructProperties(s *Schema, t reflect.Type) {
+	for _, field := range reflect.VisibleFields(t) {
+		if !field.IsExported() || len(field.Index) > 1 {
+			continue
+		}
+
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if field.Anonymous && name == "" {
+			ft := field.Type
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			addStructProperties(s, ft)
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		s.Properties[name] = schemaFor(field.Type)
+		if slices.Contains(strings.Split(field.Tag.Get("validate"), ","), "required") {
+			s.Required = append(s.Required, name)
+		}
+	}
+}
+
+// Validate checks v, as decoded from TOML, against the schema. Keys not
+// described by the schema are reported wrapping ErrUnknownKey.
+func (s *Schema) Validate(v any) []*SchemaError {
+	return s.validate("", reflect.ValueOf(v))
+}
+
+func (s *Schema) validate(path string, v reflect.Value) (errs []*SchemaError) {
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	if !v.IsValid() || s.Type == nil {
+		return nil
+	}
+
+	if actual := jsonType(v); !s.allows(actual) {
+		return []*SchemaError{{
+			Path: pathOrRoot(path),
+			Err:  fmt.Errorf("expected %s but got %s", s.typeString(), actual),
+		}}
+	}
+
+	switch v.Kind() {
+	case reflect.Map:
+		keys := make([]string, 0, v.Len())
+		for _, k := range v.MapKeys() {
+			keys = append(keys, fmt.Sprint(k.Interface()))
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			child := v.MapIndex(reflect.ValueOf(key).Convert(v.Type().Key()))
+			childPath := joinSchemaPath(path, key)
+			if prop, ok := s.Properties[key]; ok {
+				errs = append(errs, prop.validate(childPath, child)...)
+				continue
+			}
+			switch additional := s.AdditionalProperties.(type) {
+			case *Schema:
+				errs = append(errs, additional.validate(childPath, child)...)
+			case bool:
+				if !additional {
+					errs = append(errs, &SchemaError{Path: childPath, Err: ErrUnknownKey})
+				}
+			}
+		}
+		for _, key := range s.Required {
+			if !v.MapIndex(reflect.ValueOf(key).Convert(v.Type().Key())).IsValid() {
+				errs = append(errs, &SchemaError{Path: pathOrRoot(path), Err: fmt.Errorf("missing required key '%s'", key)})
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		if s.Items == nil {
+			return errs
+		}
+		for idx := 0; idx < v.Len(); idx++ {
+			errs = append(errs, s.Items.validate(fmt.Sprintf("%s[%d]", path, idx), v.Index(idx))...)
+		}
+	}
+	return errs
+}
+
+func (s *Schema) types() []string {
+	switch cast := s.Type.(type) {
+	case string:
+		return []string{cast}
+	case []string:
+		return cast
+	}
+	return nil
+}
+
+func (s *Schema) typeString() string {
+	return strings.Join(s.types(), " or ")
+}
+
+func (s *Schema) allows(actual string) bool {
+	types := s.types()
+	if actual == "integer" && slices.Contains(types, "number") {
+		return true
+	}
+	return slices.Contains(types, actual)
+}
+
+func jsonType(v reflect.Value) string {
+	switch v.Kind() {
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "integer"
+	case reflect.Float32, reflect.Float64:
+		if f := v.Float(); f == float64(int64(f)) {
+			return "integer"
+		}
+		return "number"
+	case reflect.Slice, reflect.Array:
+		return "array"
+	case reflect.Map, reflect.Struct:
+		return "object"
+	}
+	return v.Kind().String()
+}
+
+func joinSchemaPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+func pathOrRoot(path string) string {
+	if path == "" {
+		return "(root)"
+	}
+	return path
+}
+
+// ValidateSchema validates the file the config was loaded from, after legacy
+// formats have been patched, against JSONSchema.
+func (c *Config) ValidateSchema() ([]*SchemaError, error) {
+	cfgMap, err := loadPatchedConfigMap(c.configFilePath, c.configEnv)
+	if err != nil {
+		return nil, err
+	}
+	return JSONSchema().Validate(cfgMap), nil
+}
+
+// Issue returns e as a validation issue. Unknown keys are only warnings as
+// patched legacy configs may still carry keys the schema doesn't describe.
+func (e *SchemaError) Issue() *ValidationIssue {
+	severity := SeverityError
+	if errors.Is(e.Err, ErrUnknownKey) {
+		severity = SeverityWarning
+	}
+	return &ValidationIssue{Severity: severity, Section: e.Path, Message: e.Err.Error()}
+}
@@ -0,0 +1,94 @@
+package appconfig
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJSONSchema(t *testing.T) {
+	s := JSONSchema()
+	assert.Equal(t, jsonSchemaDraft, s.Schema)
+	assert.Equal(t, "object", s.Type)
+	assert.Equal(t, false, s.AdditionalProperties)
+
+	for _, key := range []string{"app", "build", "deploy", "env", "processes", "mounts", "http_service", "services", "checks", "files", "vm", "statics", "metrics"} {
+		assert.Contains(t, s.Properties, key)
+	}
+	assert.NotContains(t, s.Properties, "MergedFiles")
+
+	// Embedded fly.MachineGuest fields are inlined in [[vm]]
+	vm := s.Properties["vm"].Items
+	assert.Contains(t, vm.Properties, "memory")
+	assert.Contains(t, vm.Properties, "memory_mb")
+	assert.Contains(t, vm.Properties, "cpu_kind")
+
+	assert.Equal(t, []string{"guest_path", "url_prefix"}, s.Properties["statics"].Items.Required)
+	assert.Equal(t, []string{"string", "integer"}, s.Properties["kill_timeout"].Type)
+	assert.Equal(t, "string", s.Properties["env"].AdditionalProperties.(*Schema).Type)
+}
+
+func TestJSONSchemaPreprocessorKeys(t *testing.T) {
+	s := JSONSchema()
+
+	buf, err := os.ReadFile("./testdata/include/fly.toml")
+	require.NoError(t, err)
+	cfgMap, err := decodeTOML(buf)
+	require.NoError(t, err)
+	assert.Empty(t, s.Validate(cfgMap))
+
+	for _, include := range []any{"shared.toml", []any{"shared.toml", "more.toml"}} {
+		assert.Empty(t, s.Validate(map[string]any{"include": include, "interpolate": false}))
+	}
+
+	var messages []string
+	for _, sErr := range s.Validate(map[string]any{"include": map[string]any{"file": "shared.toml"}, "interpolate": "yes"}) {
+		messages = append(messages, sErr.Error())
+	}
+	assert.Equal(t, []string{
+		"include.file: unknown key",
+		"include: missing required key 'files'",
+		"interpolate: expected boolean but got string",
+	}, messages)
+}
+
+func TestValidateSchemaReferenceFormat(t *testing.T) {
+	cfg, err := LoadConfig("./testdata/full-reference.toml")
+	require.NoError(t, err)
+
+	errs, err := cfg.ValidateSchema()
+	require.NoError(t, err)
+	assert.Empty(t, errs)
+}
+
+func TestValidateSchemaInvalid(t *testing.T) {
+	cfg, err := LoadConfig("./testdata/schema-invalid.toml")
+	require.NoError(t, err)
+
+	errs, err := cfg.ValidateSchema()
+	require.NoError(t, err)
+
+	var messages []string
+	for _, sErr := range errs {
+		messages = append(messages, sErr.Error())
+	}
+	assert.Equal(t, []string{
+		"deploy.stratgy: unknown key",
+		"primary_region: expected string but got integer",
+		"services[0].auto_stop_machines: expected boolean but got string",
+		"statics[0]: missing required key 'url_prefix'",
+		"swap_size_mb: expected integer but got string",
+	}, messages)
+	assert.True(t, errors.Is(errs[0], ErrUnknownKey))
+}
+
+func TestSchemaErrorIssue(t *testing.T) {
+	issue := (&SchemaError{Path: "deploy.stratgy", Err: ErrUnknownKey}).Issue()
+	assert.Equal(t, &ValidationIssue{Severity: SeverityWarning, Section: "deploy.stratgy", Message: "unknown key"}, issue)
+
+	issue = (&SchemaError{Path: "primary_region", Err: errors.New("expected string but got integer")}).Issue()
+	assert.Equal(t, SeverityError, issue.Severity)
+}
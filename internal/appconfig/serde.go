@@ -22,19 +22,23 @@ const flytomlHeader = `# fly.toml app configuration file generated for %s on %s
 
 `
 
-// LoadConfig loads the app config at the given path.
+// LoadConfig loads the app config at the given path, resolving [include]
+// directives, and ${VAR} references if the file sets interpolate = true.
 func LoadConfig(path string) (cfg *Config, err error) {
-	buf, err := os.ReadFile(path)
+	p := newPreprocessor(path)
+	cfgMap, err := p.load(path)
 	if err != nil {
 		return nil, err
 	}
 
-	cfg, err = unmarshalTOML(buf)
-	if err != nil {
+	if p.patchErr != nil {
+		cfg = unpatchedConfig(cfgMap, p.patchErr)
+	} else if cfg, err = patchedConfig(cfgMap); err != nil {
 		return nil, err
 	}
 
 	cfg.configFilePath = path
+	cfg.unresolvedVars = p.unresolved
 	// cfg.WriteToFile("patched-fly.toml")
 	return cfg, nil
 }
@@ -106,29 +110,44 @@ func (c *Config) marshalTOML() ([]byte, error) {
 }
 
 func unmarshalTOML(buf []byte) (*Config, error) {
-	cfgMap := map[string]any{}
-	if err := toml.Unmarshal(buf, &cfgMap); err != nil {
-		var derr *toml.DecodeError
-		if errors.As(err, &derr) {
-			row, col := derr.Position()
-			return nil, fmt.Errorf("row %d column %d\n%s", row, col, derr.String())
-		}
+	cfgMap, err := decodeTOML(buf)
+	if err != nil {
 		return nil, err
 	}
+	return patchedConfig(cfgMap)
+}
+
+func patchedConfig(cfgMap map[string]any) (*Config, error) {
+	// Keep the app name around as patches update cfgMap in-place
+	appName, _ := cfgMap["app"].(string)
+
 	cfg, err := applyPatches(cfgMap)
 
 	// In case of parsing error fallback to bare compatibility
 	if err != nil {
-		// Unmarshal twice due to in-place cfgMap updates performed by patches
-		raw := map[string]any{}
-		if err := toml.Unmarshal(buf, &raw); err != nil {
-			return nil, err
-		}
-		cfg = &Config{v2UnmarshalError: err}
-		if name, ok := (raw["app"]).(string); ok {
-			cfg.AppName = name
-		}
+		cfg = &Config{v2UnmarshalError: err, AppName: appName}
 	}
 
 	return cfg, nil
 }
+
+// unpatchedConfig is the bare Config patchedConfig falls back to, for the
+// configs merged from several files that can't be patched or decoded.
+func unpatchedConfig(cfgMap map[string]any, err error) *Config {
+	appName, _ := cfgMap["app"].(string)
+	return &Config{v2UnmarshalError: err, AppName: appName}
+}
+
+// decodeTOML decodes buf into a raw map, reporting the position of syntax errors.
+func decodeTOML(buf []byte) (map[string]any, error) {
+	cfgMap := map[string]any{}
+	if err := toml.Unmarshal(buf, &cfgMap); err != nil {
+		var derr *toml.DecodeError
+		if errors.As(err, &derr) {
+			row, col := derr.Position()
+			return nil, fmt.Errorf("row %d column %d\n%s", row, col, derr.String())
+		}
+		return nil, err
+	}
+	return cfgMap, nil
+}
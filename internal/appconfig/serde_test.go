@@ -1,7 +1,10 @@
 package appconfig
 
 import (
+	"bytes"
 	"fmt"
+	"io/fs"
+	"os"
 	"path/filepath"
 	"testing"
 
@@ -137,6 +140,34 @@ func TestLoadTOMLAppConfigInvalidV2(t *testing.T) {
 	}, cfg)
 }
 
+func TestLoadTOMLAppConfigInvalidV2WithEnv(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "fly.toml")
+	buf, err := os.ReadFile("./testdata/always-invalid-v2.toml")
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path, buf, 0o644))
+	require.NoError(t, os.WriteFile(OverlayFilePath(path, "production"), []byte("primary_region = \"fra\"\n"), 0o644))
+
+	cfg, err := LoadConfigWithEnv(path, "production")
+	require.NoError(t, err)
+	assert.Equal(t, &Config{
+		configFilePath:   path,
+		configEnv:        "production",
+		v2UnmarshalError: fmt.Errorf("Unknown type for service concurrency: int64"),
+		AppName:          "unsupported-format",
+	}, cfg)
+
+	// Overlays that can't be patched are reported as such
+	require.NoError(t, os.WriteFile(path, []byte("app = \"overlay-invalid\"\n"), 0o644))
+	require.NoError(t, os.WriteFile(OverlayFilePath(path, "production"), buf[bytes.Index(buf, []byte("[[services]]")):], 0o644))
+
+	cfg, err = LoadConfigWithEnv(path, "production")
+	require.NoError(t, err)
+	assert.Equal(t, "overlay-invalid", cfg.AppName)
+	assert.EqualError(t, cfg.v2UnmarshalError, OverlayFilePath(path, "production")+": Unknown type for service concurrency: int64")
+	assert.NotEmpty(t, cfg.ValidationIssues())
+}
+
 func TestLoadTOMLAppConfigExperimental(t *testing.T) {
 	const path = "./testdata/experimental-alt.toml"
 	cfg, err := LoadConfig(path)
@@ -377,9 +408,41 @@ func TestLoadTOMLAppConfigReferenceFormat(t *testing.T) {
 		},
 
 		Deploy: &Deploy{
-			ReleaseCommand: "release command",
-			Strategy:       "rolling-eyes",
-			MaxUnavailable: fly.Pointer(0.2),
+			ReleaseCommand:         "release command",
+			Strategy:               "rolling-eyes",
+			MaxUnavailable:         fly.Pointer(0.2),
+			CanaryPercentage:       fly.Pointer(10.0),
+			CanaryBakeTime:         fly.MustParseDuration("2m"),
+			PreTrafficCommand:      "notify-traffic",
+			PreTrafficLocalCommand: "./scripts/notify.sh",
+			PostDeployCommand:      "warm-cache",
+			PostDeployLocalCommand: "./scripts/smoke.sh",
+			HookFailurePolicy:      "rollback",
+			Waves:                  [][]string{{"ams"}, {"fra", "lhr"}, {"*"}},
+			WavePause:              fly.MustParseDuration("5m"),
+			WaveConfirm:            true,
+			Verify: []*DeployVerify{{
+				Path:           "/status",
+				Port:           fly.Pointer(8080),
+				Method:         "HEAD",
+				ExpectedStatus: fly.Pointer(204),
+				BodyRegex:      "ok",
+				Headers:        map[string]string{"Host": "example.com"},
+				Timeout:        fly.MustParseDuration("3s"),
+				Regions:        []string{"ord"},
+				Processes:      []string{"web"},
+			}},
+			Freeze: []*DeployFreeze{
+				{Schedule: "0 18 * * FRI", Duration: fly.MustParseDuration("62h"), Timezone: "Europe/Paris", Reason: "weekend"},
+				{Start: "2024-12-23", End: "2025-01-02T09:00"},
+			},
+			Notify: &DeployNotify{
+				URLs:     []string{"https://hooks.example.com/deploys"},
+				Events:   []string{"started", "failed"},
+				Template: `{"text": {{ json .Text }}}`,
+				Headers:  map[string]string{"Authorization": "Bearer token"},
+				Timeout:  fly.MustParseDuration("5s"),
+			},
 		},
 
 		Env: map[string]string{
@@ -574,3 +637,110 @@ func TestIsSameTOMLAppConfigReferenceFormat(t *testing.T) {
 	actual.configFilePath = ""
 	require.Equal(t, cfg, actual)
 }
+
+func TestLoadTOMLAppConfigWithEnvOverlay(t *testing.T) {
+	const path = "./testdata/overlay.toml"
+
+	cfg, err := LoadConfigWithEnv(path, "production")
+	require.NoError(t, err)
+
+	assert.Equal(t, "overlay-app-production", cfg.AppName)
+	assert.Equal(t, "ord", cfg.PrimaryRegion)
+	assert.Equal(t, "production", cfg.ConfigEnv())
+	assert.Equal(t, path, cfg.ConfigFilePath())
+
+	assert.Equal(t, map[string]string{
+		"LOG_LEVEL": "info",
+		"FOO":       "foo",
+		"BAR":       "2",
+	}, cfg.Env)
+
+	assert.Equal(t, map[string]string{
+		"app":    "run-app",
+		"worker": "run-worker --concurrency 8",
+	}, cfg.Processes)
+
+	assert.Equal(t, []Service{
+		{
+			Protocol:         "tcp",
+			InternalPort:     8080,
+			AutoStopMachines: fly.Pointer(false),
+			Ports: []fly.MachinePort{{
+				Port:     fly.Pointer(80),
+				Handlers: []string{"http"},
+			}},
+		},
+		{
+			Protocol:     "tcp",
+			InternalPort: 9090,
+		},
+		{
+			Protocol:     "udp",
+			InternalPort: 7070,
+		},
+	}, cfg.Services)
+
+	assert.Equal(t, []*Compute{
+		{Memory: "256mb", Processes: []string{"app"}},
+		{Memory: "2gb", Processes: []string{"worker"}},
+	}, cfg.Compute)
+}
+
+func TestLoadTOMLAppConfigWithoutEnvOverlay(t *testing.T) {
+	const path = "./testdata/overlay.toml"
+
+	cfg, err := LoadConfigWithEnv(path, "")
+	require.NoError(t, err)
+	assert.Equal(t, "overlay-app", cfg.AppName)
+	assert.Equal(t, "", cfg.ConfigEnv())
+
+	_, err = LoadConfigWithEnv(path, "staging")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+}
+
+func TestOverlayFilePath(t *testing.T) {
+	assert.Equal(t, "fly.production.toml", OverlayFilePath("fly.toml", "production"))
+	assert.Equal(t, "/app/fly.staging.toml", OverlayFilePath("/app/fly.toml", "staging"))
+	assert.Equal(t, "config/my-app.staging.toml", OverlayFilePath("config/my-app.toml", "staging"))
+}
+
+func TestLoadTOMLAppConfigWithInterpolationAndIncludes(t *testing.T) {
+	const path = "./testdata/include/fly.toml"
+	t.Setenv("LOG_LEVEL", "info")
+
+	cfg, err := LoadConfig(path)
+	require.NoError(t, err)
+
+	assert.Equal(t, "include-app", cfg.AppName)
+	assert.Equal(t, "fra", cfg.PrimaryRegion)
+	assert.Equal(t, "registry.fly.io/include-app:latest", cfg.Build.Image)
+	assert.Equal(t, map[string]string{
+		"LOG_LEVEL": "info",
+		"SHARED":    "yes",
+		"LITERAL":   "${NOT_A_VAR}",
+		"MISSING":   "${MISSING_VAR}",
+	}, cfg.Env)
+	assert.Equal(t, []Service{{Protocol: "tcp", InternalPort: 8080}}, cfg.Services)
+
+	require.Len(t, cfg.unresolvedVars, 1)
+	assert.Equal(t, SourceError{
+		Path:   path,
+		Line:   14,
+		Column: 14,
+		Err:    fmt.Errorf("unresolved variable 'MISSING_VAR'"),
+	}, *cfg.unresolvedVars[0])
+}
+
+func TestLoadTOMLAppConfigWithIncludeCycle(t *testing.T) {
+	const path = "./testdata/include/cycle-a.toml"
+
+	_, err := LoadConfig(path)
+	require.ErrorIs(t, err, ErrIncludeCycle)
+
+	var serr *SourceError
+	require.ErrorAs(t, err, &serr)
+	assert.Equal(t, "testdata/include/cycle-b.toml", serr.Path)
+	assert.Equal(t, 2, serr.Line)
+	assert.Equal(t, 12, serr.Column)
+	assert.Contains(t, err.Error(), "cycle-a.toml -> cycle-b.toml -> cycle-a.toml")
+}
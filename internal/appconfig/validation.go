@@ -2,6 +2,7 @@ package appconfig
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"slices"
@@ -11,6 +12,7 @@ import (
 	"github.com/docker/go-units"
 	"github.com/google/shlex"
 	"github.com/logrusorgru/aurora"
+	"github.com/samber/lo"
 	fly "github.com/superfly/fly-go"
 	"github.com/superfly/flyctl/helpers"
 	"github.com/superfly/flyctl/internal/sentry"
@@ -19,31 +21,61 @@ import (
 var (
 	ValidationError          = errors.New("invalid app configuration")
 	MachinesDeployStrategies = []string{"canary", "rolling", "immediate", "bluegreen"}
+	HookFailurePolicies      = []string{HookFailurePolicyAbort, HookFailurePolicyRollback, HookFailurePolicyIgnore}
 )
 
+const (
+	// HookFailurePolicyAbort fails the deployment when a hook fails
+	HookFailurePolicyAbort = "abort"
+	// HookFailurePolicyRollback also restores the machines updated so far and
+	// destroys those launched for new process groups. The bluegreen strategy
+	// doesn't update machines in place, so it can't be used with it: failing
+	// hooks destroy the green machines anyway.
+	HookFailurePolicyRollback = "rollback"
+	// HookFailurePolicyIgnore only warns about failed hooks
+	HookFailurePolicyIgnore = "ignore"
+)
+
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+)
+
+// ValidationIssue is a single problem found in a section of the config.
+type ValidationIssue struct {
+	Severity string `json:"severity"`
+	Section  string `json:"section,omitempty"`
+	Message  string `json:"message"`
+}
+
+func (i *ValidationIssue) String() string {
+	if i.Severity == SeverityWarning {
+		return fmt.Sprintf("%s %s", aurora.Yellow("WARN"), i.Message)
+	}
+	return i.Message
+}
+
+type validationIssues []*ValidationIssue
+
+func (v *validationIssues) errorf(section, format string, a ...any) {
+	*v = append(*v, &ValidationIssue{Severity: SeverityError, Section: section, Message: fmt.Sprintf(format, a...)})
+}
+
+func (v *validationIssues) warnf(section, format string, a ...any) {
+	*v = append(*v, &ValidationIssue{Severity: SeverityWarning, Section: section, Message: fmt.Sprintf(format, a...)})
+}
+
 func (cfg *Config) Validate(ctx context.Context) (err error, extra_info string) {
 	if cfg == nil {
 		return errors.New("App config file not found"), ""
 	}
 
-	validators := []func() (string, error){
-		cfg.validateBuildStrategies,
-		cfg.validateDeploySection,
-		cfg.validateChecksSection,
-		cfg.validateServicesSection,
-		cfg.validateProcessesSection,
-		cfg.validateMachineConversion,
-		cfg.validateConsoleCommand,
-		cfg.validateMounts,
-	}
-
 	extra_info = fmt.Sprintf("Validating %s\n", cfg.ConfigFilePath())
 
-	for _, vFunc := range validators {
-		info, vErr := vFunc()
-		extra_info += info
-		if vErr != nil {
-			err = vErr
+	for _, issue := range cfg.runValidators() {
+		extra_info += issue.String() + "\n"
+		if issue.Severity == SeverityError {
+			err = ValidationError
 		}
 	}
 
@@ -60,6 +92,51 @@ func (cfg *Config) Validate(ctx context.Context) (err error, extra_info string)
 	return nil, extra_info
 }
 
+// ValidationIssues runs the local validations of the config and returns every
+// problem found. It doesn't need to talk to the Fly API.
+func (cfg *Config) ValidationIssues() []*ValidationIssue {
+	var issues validationIssues
+	if cfg.v2UnmarshalError != nil {
+		issues = append(issues, conversionIssue(cfg.v2UnmarshalError))
+	}
+	return append(issues, cfg.runValidators()...)
+}
+
+// conversionIssue reports why the config file couldn't be read into a Config,
+// in the section where it happened when that's known.
+func conversionIssue(err error) *ValidationIssue {
+	var section string
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		section = typeErr.Field
+	}
+	return &ValidationIssue{Severity: SeverityError, Section: section, Message: err.Error()}
+}
+
+func (cfg *Config) runValidators() validationIssues {
+	var issues validationIssues
+
+	validators := []func(*validationIssues){
+		cfg.validateBuildStrategies,
+		cfg.validateDeploySection,
+		cfg.validateDeployVerify,
+		cfg.validateDeployFreeze,
+		cfg.validateDeployWaves,
+		cfg.validateDeployNotify,
+		cfg.validateChecksSection,
+		cfg.validateServicesSection,
+		cfg.validateProcessesSection,
+		cfg.validateMachineConversion,
+		cfg.validateConsoleCommand,
+		cfg.validateMounts,
+	}
+	for _, vFunc := range validators {
+		vFunc(&issues)
+	}
+
+	return issues
+}
+
 func (cfg *Config) ValidateGroups(ctx context.Context, groups []string) (err error, extra_info string) {
 	if len(groups) == 0 {
 		return cfg.Validate(ctx)
@@ -78,90 +155,113 @@ func (cfg *Config) ValidateGroups(ctx context.Context, groups []string) (err err
 	return
 }
 
-func (cfg *Config) validateBuildStrategies() (extraInfo string, err error) {
+func (cfg *Config) validateBuildStrategies(issues *validationIssues) {
 	buildStrats := cfg.BuildStrategies()
 	if len(buildStrats) > 1 {
 		// TODO: validate that most users are not affected by this and/or fixing this, then make it fail validation
-		msg := fmt.Sprintf("%s more than one build configuration found: [%s]", aurora.Yellow("WARN"), strings.Join(buildStrats, ", "))
-		extraInfo += msg + "\n"
+		msg := fmt.Sprintf("more than one build configuration found: [%s]", strings.Join(buildStrats, ", "))
+		issues.warnf("build", "%s", msg)
 		sentry.CaptureException(errors.New(msg))
 	}
-	return
 }
 
-func (cfg *Config) validateDeploySection() (extraInfo string, err error) {
+func (cfg *Config) validateDeploySection(issues *validationIssues) {
 	if cfg.Deploy == nil {
 		return
 	}
 
 	if _, vErr := shlex.Split(cfg.Deploy.ReleaseCommand); vErr != nil {
-		extraInfo += fmt.Sprintf("Can't shell split release command: '%s'\n", cfg.Deploy.ReleaseCommand)
-		err = ValidationError
+		issues.errorf("deploy.release_command", "Can't shell split release command: '%s'", cfg.Deploy.ReleaseCommand)
 	}
 
 	if s := cfg.Deploy.Strategy; s != "" {
 		if !slices.Contains(MachinesDeployStrategies, s) {
-			extraInfo += fmt.Sprintf(
+			issues.errorf("deploy.strategy",
 				"unsupported deployment strategy '%s'; Apps v2 supports the following strategies: %s", s,
 				strings.Join(MachinesDeployStrategies, ", "),
 			)
-			err = ValidationError
 		}
 
 		if s == "canary" && len(cfg.Mounts) > 0 {
-			extraInfo += "error canary deployment strategy is not supported when using mounted volumes"
-			err = ValidationError
+			issues.errorf("deploy.strategy", "error canary deployment strategy is not supported when using mounted volumes")
 		}
 	}
 
-	return
+	if p := cfg.Deploy.CanaryPercentage; p != nil && (*p <= 0 || *p > 100) {
+		issues.errorf("deploy.canary_percentage", "canary percentage must be greater than 0 and at most 100, got %v", *p)
+	}
+
+	hookCommands := []struct{ key, cmd string }{
+		{"pre_traffic_command", cfg.Deploy.PreTrafficCommand},
+		{"pre_traffic_local_command", cfg.Deploy.PreTrafficLocalCommand},
+		{"post_deploy_command", cfg.Deploy.PostDeployCommand},
+		{"post_deploy_local_command", cfg.Deploy.PostDeployLocalCommand},
+	}
+	for _, hc := range hookCommands {
+		if _, vErr := shlex.Split(hc.cmd); vErr != nil {
+			issues.errorf("deploy."+hc.key, "Can't shell split %s: '%s'", hc.key, hc.cmd)
+		}
+	}
+
+	if p := cfg.Deploy.HookFailurePolicy; p != "" && !slices.Contains(HookFailurePolicies, p) {
+		issues.errorf("deploy.hook_failure_policy",
+			"unsupported hook failure policy '%s'; supported policies are: %s", p,
+			strings.Join(HookFailurePolicies, ", "),
+		)
+	}
+	if cfg.Deploy.HookFailurePolicy == HookFailurePolicyRollback && cfg.Deploy.Strategy == "bluegreen" {
+		issues.errorf("deploy.hook_failure_policy",
+			"hook failure policy '%s' isn't supported by the bluegreen strategy, use '%s' to leave the blue machines serving",
+			HookFailurePolicyRollback, HookFailurePolicyAbort,
+		)
+	}
 }
 
-func (cfg *Config) validateChecksSection() (extraInfo string, err error) {
+func (cfg *Config) validateChecksSection(issues *validationIssues) {
 	for name, check := range cfg.Checks {
+		section := "checks." + name
 		if _, vErr := check.toMachineCheck(); vErr != nil {
-			extraInfo += fmt.Sprintf("Can't process top level check '%s': %s\n", name, vErr)
-			err = ValidationError
+			issues.errorf(section, "Can't process top level check '%s': %s", name, vErr)
 		}
 		// minimum interval in flaps is set to 2 seconds.
 		if check.Interval != nil && check.Interval.Duration.Seconds() < 2 {
-			extraInfo += fmt.Sprintf("Check '%s' interval is too short: %s, minimum is 2 seconds\n", name, check.Interval.Duration)
-			err = ValidationError
+			issues.errorf(section+".interval", "Check '%s' interval is too short: %s, minimum is 2 seconds", name, check.Interval.Duration)
 		}
 
 		// max timeout in flaps in set to 60s
 		if check.Timeout != nil && check.Timeout.Duration.Seconds() > 60 {
-			extraInfo += fmt.Sprintf("Check '%s' timeout is too long: %s, maximum is 60 seconds\n", name, check.Timeout.Duration)
-			err = ValidationError
+			issues.errorf(section+".timeout", "Check '%s' timeout is too long: %s, maximum is 60 seconds", name, check.Timeout.Duration)
 		}
 	}
-
-	return
 }
 
-func (cfg *Config) validateServicesSection() (extraInfo string, err error) {
+func (cfg *Config) validateServicesSection(issues *validationIssues) {
 	validGroupNames := cfg.ProcessNames()
 	// The following is different than len(validGroupNames) because
 	// it can be zero when there is no [processes] section
 	processCount := len(cfg.Processes)
 
-	for _, service := range cfg.AllServices() {
+	for idx, service := range cfg.AllServices() {
+		section := fmt.Sprintf("services[%d]", idx)
+		if cfg.HTTPService != nil {
+			// AllServices puts [http_service] first
+			section = lo.Ternary(idx == 0, "http_service", fmt.Sprintf("services[%d]", idx-1))
+		}
+
 		switch {
 		case len(service.Processes) == 0 && processCount > 0:
-			extraInfo += fmt.Sprintf(
-				"Service has no processes set but app has %d processes defined; update fly.toml to set processes for each service\n",
+			issues.errorf(section,
+				"Service has no processes set but app has %d processes defined; update fly.toml to set processes for each service",
 				processCount,
 			)
-			err = ValidationError
 		default:
 			for _, processName := range service.Processes {
 				if !slices.Contains(validGroupNames, processName) {
-					extraInfo += fmt.Sprintf(
+					issues.errorf(section+".processes",
 						"Service specifies '%s' as one of its processes, but no processes are defined with that name; "+
-							"update fly.toml [processes] to add '%s' process or remove it from service's processes list\n",
+							"update fly.toml [processes] to add '%s' process or remove it from service's processes list",
 						processName, processName,
 					)
-					err = ValidationError
 				}
 			}
 		}
@@ -169,56 +269,52 @@ func (cfg *Config) validateServicesSection() (extraInfo string, err error) {
 		if len(service.Ports) == 0 {
 			// XXX: Warn about services without ports instead of hard failing so users have time to
 			//      fix fly.toml configuration -- 2024-01-15
-			extraInfo += fmt.Sprintf(
-				"WARNING: Service must expose at least one port. Add a [[services.ports]] section to fly.toml; " +
-					"Check docs at https://fly.io/docs/reference/configuration/#services-ports \n " +
+			issues.warnf(section+".ports",
+				"Service must expose at least one port. Add a [[services.ports]] section to fly.toml; "+
+					"Check docs at https://fly.io/docs/reference/configuration/#services-ports \n "+
 					"Validation for _services without ports_ will hard fail after February 15, 2024.",
 			)
-			//err = ValidationError
 		}
 
 		for _, check := range service.TCPChecks {
-			extraInfo += validateServiceCheckDurations(check.Interval, check.Timeout, check.GracePeriod, "TCP")
+			validateServiceCheckDurations(issues, section+".tcp_checks", check.Interval, check.Timeout, check.GracePeriod, "TCP")
 		}
 
 		for _, check := range service.HTTPChecks {
-			extraInfo += validateServiceCheckDurations(check.Interval, check.Timeout, check.GracePeriod, "HTTP")
+			validateServiceCheckDurations(issues, section+".http_checks", check.Interval, check.Timeout, check.GracePeriod, "HTTP")
 		}
 	}
-	return extraInfo, err
 }
 
-func validateServiceCheckDurations(interval, timeout, gracePeriod *fly.Duration, proto string) (extraInfo string) {
-	extraInfo += validateSingleServiceCheckDuration(interval, false, proto, "an interval")
-	extraInfo += validateSingleServiceCheckDuration(timeout, false, proto, "a timeout")
-	extraInfo += validateSingleServiceCheckDuration(gracePeriod, true, proto, "a grace period")
-	return
+func validateServiceCheckDurations(issues *validationIssues, section string, interval, timeout, gracePeriod *fly.Duration, proto string) {
+	validateSingleServiceCheckDuration(issues, section+".interval", interval, false, proto, "an interval")
+	validateSingleServiceCheckDuration(issues, section+".timeout", timeout, false, proto, "a timeout")
+	validateSingleServiceCheckDuration(issues, section+".grace_period", gracePeriod, true, proto, "a grace period")
 }
 
-func validateSingleServiceCheckDuration(d *fly.Duration, zeroOK bool, proto, description string) (extraInfo string) {
+func validateSingleServiceCheckDuration(issues *validationIssues, section string, d *fly.Duration, zeroOK bool, proto, description string) {
 	switch {
 	case d == nil:
 		// Do nothing.
 	case zeroOK && d.Duration != 0 && d.Duration < time.Second:
-		extraInfo += fmt.Sprintf(
-			"%s Service %s check has %s that is non-zero and less than 1 second (%v); this will be raised to 1 second\n",
-			aurora.Yellow("WARN"), proto, description, d.Duration,
+		issues.warnf(section,
+			"Service %s check has %s that is non-zero and less than 1 second (%v); this will be raised to 1 second",
+			proto, description, d.Duration,
 		)
 	case !zeroOK && d.Duration < time.Second:
-		extraInfo += fmt.Sprintf(
-			"%s Service %s check has %s less than 1 second (%v); this will be raised to 1 second\n",
-			aurora.Yellow("WARN"), proto, description, d.Duration,
+		issues.warnf(section,
+			"Service %s check has %s less than 1 second (%v); this will be raised to 1 second",
+			proto, description, d.Duration,
 		)
 	case d.Duration > time.Minute:
-		extraInfo += fmt.Sprintf(
-			"%s Service %s check has %s greater than 1 minute (%v); this will be lowered to 1 minute\n",
-			aurora.Yellow("WARN"), proto, description, d.Duration,
+		issues.warnf(section,
+			"Service %s check has %s greater than 1 minute (%v); this will be lowered to 1 minute",
+			proto, description, d.Duration,
 		)
 	}
-	return
 }
 
-func (cfg *Config) validateProcessesSection() (extraInfo string, err error) {
+func (cfg *Config) validateProcessesSection(issues *validationIssues) {
 	for processName, cmdStr := range cfg.Processes {
 		if cmdStr == "" {
 			continue
@@ -226,51 +322,42 @@ func (cfg *Config) validateProcessesSection() (extraInfo string, err error) {
 
 		_, vErr := shlex.Split(cmdStr)
 		if vErr != nil {
-			extraInfo += fmt.Sprintf(
-				"Could not parse command for '%s' process group; check [processes] section: %s\n",
+			issues.errorf("processes."+processName,
+				"Could not parse command for '%s' process group; check [processes] section: %s",
 				processName, vErr,
 			)
-			err = ValidationError
 		}
 	}
-
-	return extraInfo, err
 }
 
-func (cfg *Config) validateMachineConversion() (extraInfo string, err error) {
+func (cfg *Config) validateMachineConversion(issues *validationIssues) {
 	for _, name := range cfg.ProcessNames() {
-		if _, vErr := cfg.ToMachineConfig(name, nil); err != nil {
-			extraInfo += fmt.Sprintf("Converting to machine in process group '%s' will fail because of: %s", name, vErr)
-			err = ValidationError
+		if _, vErr := cfg.ToMachineConfig(name, nil); vErr != nil {
+			issues.errorf("processes."+name, "Converting to machine in process group '%s' will fail because of: %s", name, vErr)
 		}
 	}
-	return
 }
 
-func (cfg *Config) validateConsoleCommand() (extraInfo string, err error) {
+func (cfg *Config) validateConsoleCommand(issues *validationIssues) {
 	if _, vErr := shlex.Split(cfg.ConsoleCommand); vErr != nil {
-		extraInfo += fmt.Sprintf("Can't shell split console command: '%s'\n", cfg.ConsoleCommand)
-		err = ValidationError
+		issues.errorf("console_command", "Can't shell split console command: '%s'", cfg.ConsoleCommand)
 	}
-	return
 }
 
-func (cfg *Config) validateMounts() (extraInfo string, err error) {
+func (cfg *Config) validateMounts(issues *validationIssues) {
 	if cfg.configFilePath == "--flatten--" && len(cfg.Mounts) > 1 {
-		extraInfo += fmt.Sprintf("group '%s' has more than one [[mounts]] section defined\n", cfg.defaultGroupName)
-		err = ValidationError
+		issues.errorf("mounts", "group '%s' has more than one [[mounts]] section defined", cfg.defaultGroupName)
 	}
 
-	for _, m := range cfg.Mounts {
+	for idx, m := range cfg.Mounts {
+		section := fmt.Sprintf("mounts[%d]", idx)
 		if m.InitialSize != "" {
 			v, vErr := helpers.ParseSize(m.InitialSize, units.FromHumanSize, units.GB)
 			switch {
 			case vErr != nil:
-				extraInfo += fmt.Sprintf("mount '%s' with initial_size '%s' will fail because of: %s\n", m.Source, m.InitialSize, vErr)
-				err = ValidationError
+				issues.errorf(section+".initial_size", "mount '%s' with initial_size '%s' will fail because of: %s", m.Source, m.InitialSize, vErr)
 			case v < 1:
-				extraInfo += fmt.Sprintf("mount '%s' has an initial_size '%s' value which is smaller than 1GB\n", m.Source, m.InitialSize)
-				err = ValidationError
+				issues.errorf(section+".initial_size", "mount '%s' has an initial_size '%s' value which is smaller than 1GB", m.Source, m.InitialSize)
 			}
 		}
 
@@ -280,43 +367,45 @@ func (cfg *Config) validateMounts() (extraInfo string, err error) {
 			autoExtendSizeIncrement, vErr = helpers.ParseSize(m.AutoExtendSizeIncrement, units.FromHumanSize, units.GB)
 			switch {
 			case vErr != nil:
-				extraInfo += fmt.Sprintf("mount '%s' with auto_extend_size_increment '%s' will fail because of: %s\n", m.Source, m.AutoExtendSizeIncrement, vErr)
-				err = ValidationError
+				issues.errorf(section+".auto_extend_size_increment", "mount '%s' with auto_extend_size_increment '%s' will fail because of: %s", m.Source, m.AutoExtendSizeIncrement, vErr)
 			case autoExtendSizeIncrement < 1:
-				extraInfo += fmt.Sprintf("mount '%s' has an auto_extend_size_increment '%s' value which is smaller than 1GB\n", m.Source, m.AutoExtendSizeIncrement)
-				err = ValidationError
+				issues.errorf(section+".auto_extend_size_increment", "mount '%s' has an auto_extend_size_increment '%s' value which is smaller than 1GB", m.Source, m.AutoExtendSizeIncrement)
 			}
 		}
 		if m.AutoExtendSizeLimit != "" {
 			autoExtendSizeLimit, vErr = helpers.ParseSize(m.AutoExtendSizeLimit, units.FromHumanSize, units.GB)
 			switch {
 			case vErr != nil:
-				extraInfo += fmt.Sprintf("mount '%s' with auto_extend_size_limit '%s' will fail because of: %s\n", m.Source, m.AutoExtendSizeLimit, vErr)
-				err = ValidationError
+				issues.errorf(section+".auto_extend_size_limit", "mount '%s' with auto_extend_size_limit '%s' will fail because of: %s", m.Source, m.AutoExtendSizeLimit, vErr)
 			case autoExtendSizeLimit < 1:
-				extraInfo += fmt.Sprintf("mount '%s' has an auto_extend_size_limit '%s' value which is smaller than 1GB\n", m.Source, m.AutoExtendSizeLimit)
-				err = ValidationError
+				issues.errorf(section+".auto_extend_size_limit", "mount '%s' has an auto_extend_size_limit '%s' value which is smaller than 1GB", m.Source, m.AutoExtendSizeLimit)
 			}
 		}
 
 		if m.AutoExtendSizeThreshold != 0 || autoExtendSizeIncrement != 0 || autoExtendSizeLimit != 0 {
 			if m.AutoExtendSizeThreshold != 0 && autoExtendSizeIncrement == 0 && autoExtendSizeLimit == 0 {
-				extraInfo += fmt.Sprintf("mount '%s' auto_extend_size_threshold, auto_extend_size_increment and auto_extend_size_limit must be all defined or none\n", m.Source)
-				err = ValidationError
+				issues.errorf(section, "mount '%s' auto_extend_size_threshold, auto_extend_size_increment and auto_extend_size_limit must be all defined or none", m.Source)
 			}
 			if m.AutoExtendSizeThreshold < 50 || m.AutoExtendSizeThreshold > 99 {
-				extraInfo += fmt.Sprintf("mount '%s' auto_extend_size_threshold must be between 50 and 99\n", m.Source)
-				err = ValidationError
+				issues.errorf(section+".auto_extend_size_threshold", "mount '%s' auto_extend_size_threshold must be between 50 and 99", m.Source)
 			}
 			if autoExtendSizeIncrement < 1 || autoExtendSizeIncrement > 100 {
-				extraInfo += fmt.Sprintf("mount '%s' auto_extend_size_increment must be between 1GB and 100GB\n", m.Source)
-				err = ValidationError
+				issues.errorf(section+".auto_extend_size_increment", "mount '%s' auto_extend_size_increment must be between 1GB and 100GB", m.Source)
 			}
 			if autoExtendSizeLimit != 0 && (autoExtendSizeLimit < 1 || autoExtendSizeLimit > 500) {
-				extraInfo += fmt.Sprintf("mount '%s' auto_extend_size_limit must be between 1GB and 500GB\n", m.Source)
-				err = ValidationError
+				issues.errorf(section+".auto_extend_size_limit", "mount '%s' auto_extend_size_limit must be between 1GB and 500GB", m.Source)
 			}
 		}
 	}
-	return
+}
+
+// VariableIssues warns about the ${VAR} references of the config file that
+// were left unresolved. They're not errors: the strings they're in may well
+// be meant for the shell of the machines.
+func (cfg *Config) VariableIssues() []*ValidationIssue {
+	var issues validationIssues
+	for _, vErr := range cfg.unresolvedVars {
+		issues.warnf("", "%s", vErr)
+	}
+	return issues
 }
@@ -3,10 +3,14 @@ package appconfig
 import (
 	"context"
 	"os"
+	"strings"
 	"testing"
 
+	"github.com/samber/lo"
 	"github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	fly "github.com/superfly/fly-go"
 	"github.com/superfly/flyctl/internal/cmdutil/preparers"
 	"github.com/superfly/flyctl/internal/flag"
 	"github.com/superfly/flyctl/internal/logger"
@@ -71,3 +75,92 @@ func TestConfig_ValidateServices(t *testing.T) {
 	err, x = cfg.ValidateGroups(ctx, []string{"success"})
 	require.NoErrorf(t, err, x)
 }
+
+func TestConfig_ValidateVariables(t *testing.T) {
+	cfg, err := LoadConfig("./testdata/include/fly.toml")
+	require.NoError(t, err)
+	require.NoError(t, cfg.SetMachinesPlatform())
+
+	// Unresolved variables may be meant for the shell of the machines
+	ctx := _getValidationContext(t)
+	err, x := cfg.Validate(ctx)
+	require.NoError(t, err, x)
+
+	issues := cfg.VariableIssues()
+	require.Len(t, issues, 1)
+	assert.Equal(t, SeverityWarning, issues[0].Severity)
+	assert.Equal(t, "./testdata/include/fly.toml: row 14 column 14: unresolved variable 'MISSING_VAR'", issues[0].Message)
+}
+
+func TestConfig_ValidationIssues(t *testing.T) {
+	cfg, err := LoadConfig("./testdata/validate-mounts.toml")
+	require.NoError(t, err)
+	require.NoError(t, cfg.SetMachinesPlatform())
+
+	issues := cfg.ValidationIssues()
+	require.NotEmpty(t, issues)
+	issue, ok := lo.Find(issues, func(i *ValidationIssue) bool { return i.Section == "mounts[0].initial_size" })
+	require.True(t, ok, issues)
+	assert.Equal(t, SeverityError, issue.Severity)
+	assert.Contains(t, issue.Message, "smaller than 1GB")
+
+	cfg, err = LoadConfig("./testdata/full-reference.toml")
+	require.NoError(t, err)
+	require.NoError(t, cfg.SetMachinesPlatform())
+	issue, ok = lo.Find(cfg.ValidationIssues(), func(i *ValidationIssue) bool { return i.Section == "deploy.strategy" })
+	require.True(t, ok)
+	assert.Equal(t, SeverityError, issue.Severity)
+	assert.Contains(t, issue.Message, "unsupported deployment strategy 'rolling-eyes'")
+	_, ok = lo.Find(cfg.ValidationIssues(), func(i *ValidationIssue) bool { return i.Section == "deploy.canary_percentage" })
+	assert.False(t, ok)
+
+	cfg.Deploy.CanaryPercentage = fly.Pointer(150.0)
+	issue, ok = lo.Find(cfg.ValidationIssues(), func(i *ValidationIssue) bool { return i.Section == "deploy.canary_percentage" })
+	require.True(t, ok)
+	assert.Equal(t, SeverityError, issue.Severity)
+
+	_, ok = lo.Find(cfg.ValidationIssues(), func(i *ValidationIssue) bool { return i.Section == "deploy.hook_failure_policy" })
+	assert.False(t, ok)
+
+	cfg.Deploy.HookFailurePolicy = "retry"
+	cfg.Deploy.PostDeployCommand = "warm-cache 'unterminated"
+	issue, ok = lo.Find(cfg.ValidationIssues(), func(i *ValidationIssue) bool { return i.Section == "deploy.hook_failure_policy" })
+	require.True(t, ok)
+	assert.Contains(t, issue.Message, "unsupported hook failure policy 'retry'")
+	_, ok = lo.Find(cfg.ValidationIssues(), func(i *ValidationIssue) bool { return i.Section == "deploy.post_deploy_command" })
+	assert.True(t, ok)
+
+	cfg.Deploy.Strategy = "bluegreen"
+	cfg.Deploy.HookFailurePolicy = HookFailurePolicyRollback
+	issue, ok = lo.Find(cfg.ValidationIssues(), func(i *ValidationIssue) bool { return i.Section == "deploy.hook_failure_policy" })
+	require.True(t, ok)
+	assert.Contains(t, issue.Message, "isn't supported by the bluegreen strategy")
+}
+
+func TestConfig_ValidateDeployVerify(t *testing.T) {
+	cfg := &Config{Deploy: &Deploy{Verify: []*DeployVerify{
+		{Path: "/health"},
+		{Path: "/health", Port: fly.Pointer(70000)},
+	}}}
+	issues := cfg.ValidationIssues()
+	port := lo.Filter(issues, func(i *ValidationIssue, _ int) bool { return strings.HasSuffix(i.Section, ".port") })
+	require.Len(t, port, 2, issues)
+	assert.Equal(t, "deploy.verify[0].port", port[0].Section)
+	assert.Contains(t, port[0].Message, "needs a port when there is no [http_service] section")
+	assert.Equal(t, "deploy.verify[1].port", port[1].Section)
+	assert.Contains(t, port[1].Message, "port 70000 isn't a valid port")
+}
+
+func TestConfig_ValidationIssuesConversion(t *testing.T) {
+	path := writeConfigFiles(t, map[string]string{
+		"fly.toml": "app = \"broken\"\n\n[http_service]\n  internal_port = \"eighty\"\n",
+	})
+	cfg, err := LoadConfig(path)
+	require.NoError(t, err)
+	require.Error(t, cfg.SetMachinesPlatform())
+
+	issue, ok := lo.Find(cfg.ValidationIssues(), func(i *ValidationIssue) bool { return i.Section == "http_service.internal_port" })
+	require.True(t, ok, cfg.ValidationIssues())
+	assert.Equal(t, SeverityError, issue.Severity)
+	assert.Contains(t, issue.Message, "cannot unmarshal string")
+}
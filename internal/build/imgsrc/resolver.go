@@ -21,6 +21,7 @@ import (
 	"github.com/superfly/flyctl/gql"
 	"github.com/superfly/flyctl/internal/buildinfo"
 	"github.com/superfly/flyctl/internal/config"
+	"github.com/superfly/flyctl/internal/deployevents"
 	"github.com/superfly/flyctl/internal/sentry"
 	"github.com/superfly/flyctl/internal/tracing"
 	"github.com/superfly/flyctl/iostreams"
@@ -168,6 +169,7 @@ func (r *Resolver) ResolveReference(ctx context.Context, streams *iostreams.IOSt
 		span.AddEvent(fmt.Sprintf("failed to create image build. err=%s", err.Error()))
 		terminal.Warnf("failed to create build in graphql: %v\n", err)
 	}
+	deployevents.Emit(ctx, deployevents.Event{Type: deployevents.BuildStarted, Image: opts.ImageRef})
 
 	for _, s := range strategies {
 		terminal.Debugf("Trying '%s' strategy\n", s.Name())
@@ -240,6 +242,8 @@ func (r *Resolver) BuildImage(ctx context.Context, streams *iostreams.IOStreams,
 	if err != nil {
 		terminal.Warnf("failed to create build in graphql: %v\n", err)
 	}
+	deployevents.Emit(ctx, deployevents.Event{Type: deployevents.BuildStarted, Image: opts.Tag})
+
 	for _, s := range strategies {
 		terminal.Debugf("Trying '%s' strategy\n", s.Name())
 		bld.ResetTimings()
@@ -506,7 +510,37 @@ type buildResult struct {
 	wallclockTimeMs int
 }
 
+// emitBuildEvents reports the outcome of a build from the same timings that
+// finishBuild sends to the API.
+func emitBuildEvents(ctx context.Context, build *build, failed bool, logs string, img *DeploymentImage) {
+	ev := deployevents.Event{
+		Type:       deployevents.BuildFinished,
+		Status:     "success",
+		DurationMs: max(0, build.Timings.BuildAndPushMs),
+	}
+	if n := len(build.StrategyResults); n > 0 {
+		ev.Strategy = build.StrategyResults[n-1].Strategy
+	}
+	if failed {
+		ev.Status = "failed"
+		ev.Error = logs
+	}
+	if img != nil {
+		ev.Image = img.Tag
+		if !failed && build.Timings.PushMs >= 0 {
+			deployevents.Emit(ctx, deployevents.Event{
+				Type:       deployevents.ImagePushed,
+				Image:      img.Tag,
+				DurationMs: build.Timings.PushMs,
+			})
+		}
+	}
+	deployevents.Emit(ctx, ev)
+}
+
 func (r *Resolver) finishBuild(ctx context.Context, build *build, failed bool, logs string, img *DeploymentImage) (*buildResult, error) {
+	emitBuildEvents(ctx, build, failed, logs, img)
+
 	if build.CreateApiFailed {
 		terminal.Debug("Skipping FinishBuild() gql call, because CreateBuild() failed.\n")
 		return nil, nil
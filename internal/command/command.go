@@ -557,8 +557,9 @@ func LoadAppConfigIfPresent(ctx context.Context) (context.Context, error) {
 	}
 
 	logger := logger.FromContext(ctx)
+	configEnv := appConfigEnv(ctx)
 	for _, path := range appConfigFilePaths(ctx) {
-		switch cfg, err := appconfig.LoadConfig(path); {
+		switch cfg, err := appconfig.LoadConfigWithEnv(path, configEnv); {
 		case err == nil:
 			logger.Debugf("app config loaded from %s", path)
 			if err := cfg.SetMachinesPlatform(); err != nil {
@@ -593,6 +594,15 @@ func appConfigFilePaths(ctx context.Context) (paths []string) {
 	return
 }
 
+// appConfigEnv returns the name of the fly.toml overlay selected via the
+// command line or the FLY_CONFIG_ENV environment variable, if any.
+func appConfigEnv(ctx context.Context) string {
+	if name := flag.GetAppConfigEnv(ctx); name != "" {
+		return name
+	}
+	return env.First("FLY_CONFIG_ENV")
+}
+
 var ErrRequireAppName = fmt.Errorf("the config for your app is missing an app name, add an app field to the fly.toml file or specify with the -a flag")
 
 // RequireAppName is a Preparer which makes sure the user has selected an
@@ -19,6 +19,9 @@ func New() (cmd *cobra.Command) {
 		newSave(),
 		newValidate(),
 		newEnv(),
+		newSchema(),
+		newDiff(),
+		newMigrate(),
 	)
 	return
 }
@@ -0,0 +1,106 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/superfly/fly-go/flaps"
+	"github.com/superfly/flyctl/internal/appconfig"
+	"github.com/superfly/flyctl/internal/command"
+	"github.com/superfly/flyctl/internal/config"
+	"github.com/superfly/flyctl/internal/flag"
+	"github.com/superfly/flyctl/internal/flapsutil"
+	"github.com/superfly/flyctl/internal/machine"
+	"github.com/superfly/flyctl/internal/render"
+	"github.com/superfly/flyctl/iostreams"
+)
+
+func newDiff() (cmd *cobra.Command) {
+	const (
+		short = "Show differences between fly.toml, the latest release and running machines"
+		long  = `Compare the local fly.toml, the config of the app's latest release and
+the config reconstructed from its running machines, for each process group.
+
+Machines that drifted from the latest release, for instance after a
+'fly machine update', get their changes reverted by the next 'fly deploy'.`
+	)
+	cmd = command.New("diff", short, long, runDiff,
+		command.RequireSession,
+		command.RequireAppName,
+		command.LoadAppConfigIfPresent,
+	)
+	cmd.Args = cobra.NoArgs
+	flag.Add(cmd, flag.App(), flag.AppConfig(), flag.AppConfigEnv(), flag.JSONOutput())
+	return
+}
+
+func runDiff(ctx context.Context) error {
+	io := iostreams.FromContext(ctx)
+	appName := appconfig.NameFromContext(ctx)
+
+	localCfg := appconfig.ConfigFromContext(ctx)
+	if localCfg == nil {
+		return errors.New("No local fly.toml found")
+	}
+	if err := localCfg.SetMachinesPlatform(); err != nil {
+		return err
+	}
+
+	flapsClient, err := flapsutil.NewClientWithOptions(ctx, flaps.NewClientOpts{
+		AppName: appName,
+	})
+	if err != nil {
+		return err
+	}
+	ctx = flaps.NewContext(ctx, flapsClient)
+
+	machines, err := machine.ListActive(ctx)
+	if err != nil {
+		return fmt.Errorf("error listing active machines for %s app: %w", appName, err)
+	}
+
+	drifts, err := appconfig.DetectDrift(ctx, appName, localCfg, machines)
+	if err != nil {
+		return err
+	}
+
+	if config.FromContext(ctx).JSONOutput {
+		return render.JSON(io.Out, drifts)
+	}
+
+	found := false
+	for _, drift := range drifts {
+		sections := []struct{ title, diff string }{
+			{"Running machines differ from the latest release, deploying will revert:", drift.ReleaseToMachines},
+			{"fly.toml differs from the latest release:", drift.ReleaseToLocal},
+			{"Deploying fly.toml will change running machines:", drift.MachinesToLocal},
+		}
+		header := false
+		for _, section := range sections {
+			if section.diff == "" {
+				continue
+			}
+			if !header {
+				fmt.Fprintf(io.Out, "Process group '%s'\n", drift.Group)
+				header = true
+			}
+			fmt.Fprintf(io.Out, "  %s\n%s\n\n", section.title, indent(section.diff, "    "))
+		}
+		if drift.Warnings != "" {
+			fmt.Fprintf(io.ErrOut, "%s\n", drift.Warnings)
+		}
+		found = found || header
+	}
+
+	if !found {
+		fmt.Fprintln(io.Out, "No differences between fly.toml, the latest release and running machines")
+	}
+	return nil
+}
+
+func indent(s, prefix string) string {
+	return prefix + strings.ReplaceAll(s, "\n", "\n"+prefix)
+}
@@ -0,0 +1,91 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/logrusorgru/aurora"
+	"github.com/spf13/cobra"
+	"github.com/superfly/flyctl/helpers"
+	"github.com/superfly/flyctl/internal/appconfig"
+	"github.com/superfly/flyctl/internal/command"
+	"github.com/superfly/flyctl/internal/flag"
+	"github.com/superfly/flyctl/internal/state"
+	"github.com/superfly/flyctl/iostreams"
+)
+
+func newMigrate() (cmd *cobra.Command) {
+	const (
+		short = "Upgrade a config file to the current format"
+		long  = `Upgrade legacy settings of the local config file, such as old check
+formats or non-string env values, show what each upgrade changed and rewrite
+the file in canonical form. Comments are kept above or at the end of the
+table or key they were about.
+
+The file is left untouched when the canonical form would lose something: keys
+unknown to the current format, or comments about keys the upgrade removed or
+that sit inside values spanning several lines. Fix those and run it again.
+
+Use --check to exit with an error instead when the file isn't canonical.`
+	)
+	cmd = command.New("migrate", short, long, runMigrate)
+	cmd.Args = cobra.NoArgs
+	flag.Add(cmd,
+		flag.AppConfig(),
+		flag.Bool{
+			Name:        "check",
+			Description: "Don't rewrite the file, exit with an error if it isn't in canonical form",
+		},
+	)
+	return
+}
+
+func runMigrate(ctx context.Context) error {
+	io := iostreams.FromContext(ctx)
+
+	path := state.WorkingDirectory(ctx)
+	if flag.IsSpecified(ctx, "config") {
+		path = flag.GetString(ctx, "config")
+	}
+	path, err := appconfig.ResolveConfigFileFromPath(path)
+	if err != nil {
+		return err
+	}
+
+	migration, err := appconfig.MigrateConfigFile(path, io.ColorScheme())
+	if err != nil {
+		return err
+	}
+	relPath := helpers.PathRelativeToCWD(path)
+
+	for _, change := range migration.Changes {
+		fmt.Fprintf(io.Out, "Upgraded %s:\n%s\n\n", change.Section, change.Diff)
+	}
+	for _, key := range migration.Dropped {
+		fmt.Fprintf(io.ErrOut, "%s unknown key %s can't be kept\n", aurora.Red("ERROR"), key)
+	}
+	for _, line := range migration.LostComments {
+		fmt.Fprintf(io.ErrOut, "%s comment on line %d can't be kept\n", aurora.Red("ERROR"), line)
+	}
+
+	switch {
+	case !migration.IsLossless():
+		return fmt.Errorf("%s can't be rewritten without losing keys or comments, remove or move them and run again", relPath)
+	case migration.IsCanonical():
+		fmt.Fprintf(io.Out, "%s is already in canonical form\n", relPath)
+		return nil
+	case flag.GetBool(ctx, "check"):
+		return fmt.Errorf("%s is not in canonical form, run 'fly config migrate' to rewrite it", relPath)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, migration.Canonical, info.Mode()); err != nil {
+		return err
+	}
+	fmt.Fprintf(io.Out, "Wrote config file %s\n", relPath)
+	return nil
+}
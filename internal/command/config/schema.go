@@ -0,0 +1,34 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/superfly/flyctl/internal/appconfig"
+	"github.com/superfly/flyctl/internal/command"
+	"github.com/superfly/flyctl/iostreams"
+)
+
+func newSchema() (cmd *cobra.Command) {
+	const (
+		short = "Print the JSON Schema of fly.toml"
+		long  = `Print a JSON Schema describing the app configuration file. Point your
+editor or CI linter at it to check fly.toml files without flyctl.`
+	)
+	cmd = command.New("schema", short, long, runSchema)
+	cmd.Args = cobra.NoArgs
+	return
+}
+
+func runSchema(ctx context.Context) error {
+	io := iostreams.FromContext(ctx)
+
+	b, err := json.MarshalIndent(appconfig.JSONSchema(), "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(io.Out, string(b))
+	return nil
+}
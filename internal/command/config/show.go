@@ -18,7 +18,10 @@ func newShow() (cmd *cobra.Command) {
 	const (
 		short = "Show an app's configuration"
 		long  = `Show an application's configuration. The configuration is presented
-in JSON format. The configuration data is retrieved from the Fly service.`
+in JSON format. The configuration data is retrieved from the Fly service.
+
+Use --env to show the local fly.toml merged with the overlay of the given
+environment, e.g. --env production merges fly.production.toml.`
 	)
 	cmd = command.New("show", short, long, runShow,
 		command.RequireSession,
@@ -32,6 +35,10 @@ in JSON format. The configuration data is retrieved from the Fly service.`
 			Name:        "local",
 			Description: "Parse and show local fly.toml as JSON",
 		},
+		flag.String{
+			Name:        "env",
+			Description: "Merge the overlay for this environment into the local fly.toml and show the result. Implies --local",
+		},
 	)
 	return
 }
@@ -42,7 +49,18 @@ func runShow(ctx context.Context) error {
 
 	var cfg *appconfig.Config
 
-	if !flag.GetBool(ctx, "local") {
+	switch env := flag.GetString(ctx, "env"); {
+	case env != "":
+		localCfg := appconfig.ConfigFromContext(ctx)
+		if localCfg == nil {
+			return fmt.Errorf("No local fly.toml found")
+		}
+		var err error
+		cfg, err = appconfig.LoadConfigWithEnv(localCfg.ConfigFilePath(), env)
+		if err != nil {
+			return err
+		}
+	case !flag.GetBool(ctx, "local"):
 		flapsClient, err := flapsutil.NewClientWithOptions(ctx, flaps.NewClientOpts{
 			AppName: appName,
 		})
@@ -55,7 +73,7 @@ func runShow(ctx context.Context) error {
 		if err != nil {
 			return err
 		}
-	} else {
+	default:
 		cfg = appconfig.ConfigFromContext(ctx)
 		if cfg == nil {
 			return fmt.Errorf("No local fly.toml found")
@@ -2,12 +2,15 @@ package config
 
 import (
 	"context"
+	"errors"
 	"fmt"
 
 	"github.com/spf13/cobra"
 	"github.com/superfly/flyctl/internal/appconfig"
 	"github.com/superfly/flyctl/internal/command"
+	"github.com/superfly/flyctl/internal/config"
 	"github.com/superfly/flyctl/internal/flag"
+	"github.com/superfly/flyctl/internal/render"
 	"github.com/superfly/flyctl/iostreams"
 )
 
@@ -15,25 +18,109 @@ func newValidate() (cmd *cobra.Command) {
 	const (
 		short = "Validate an app's config file"
 		long  = `Validates an application's config file against the Fly platform to
-ensure it is correct and meaningful to the platform.`
+ensure it is correct and meaningful to the platform.
+
+In config files setting interpolate = true, unresolved ${VAR} references are
+reported as warnings with the file and position where they occur, as they may
+be meant for the shell of the machines. [include] cycles are errors.
+
+With --offline, the config file is checked against the fly.toml JSON Schema
+and the local validation rules only, so no Fly session is needed. Use --json
+to get every problem found with its severity and section.`
 	)
 	cmd = command.New("validate", short, long, runValidate,
-		command.RequireSession,
-		command.RequireAppName,
+		command.LoadAppConfigIfPresent,
+		requireSessionUnlessOffline,
 	)
 	cmd.Args = cobra.NoArgs
-	flag.Add(cmd, flag.App(), flag.AppConfig())
+	flag.Add(cmd, flag.App(), flag.AppConfig(), flag.AppConfigEnv(), flag.JSONOutput(),
+		flag.Bool{
+			Name:        "offline",
+			Description: "Validate the config file locally without requiring a Fly session",
+		},
+	)
 	return
 }
 
+// requireSessionUnlessOffline is a Preparer which requires a session and an
+// app name unless validation runs with --offline.
+func requireSessionUnlessOffline(ctx context.Context) (context.Context, error) {
+	if flag.GetBool(ctx, "offline") {
+		return ctx, nil
+	}
+
+	ctx, err := command.RequireSession(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return command.RequireAppName(ctx)
+}
+
+type validationResult struct {
+	Path   string                       `json:"path"`
+	Valid  bool                         `json:"valid"`
+	Issues []*appconfig.ValidationIssue `json:"issues"`
+}
+
 func runValidate(ctx context.Context) error {
 	io := iostreams.FromContext(ctx)
 	cfg := appconfig.ConfigFromContext(ctx)
+	if cfg == nil {
+		return errors.New("App config file not found")
+	}
 
-	if err := cfg.SetMachinesPlatform(); err != nil {
-		return err
+	schemaErrs, err := cfg.ValidateSchema()
+	schemaIssues := make([]*appconfig.ValidationIssue, 0, len(schemaErrs))
+	if err != nil {
+		schemaIssues = append(schemaIssues, &appconfig.ValidationIssue{
+			Severity: appconfig.SeverityError,
+			Message:  fmt.Sprintf("failed checking the config file against the schema: %s", err),
+		})
+	}
+	for _, sErr := range schemaErrs {
+		schemaIssues = append(schemaIssues, sErr.Issue())
 	}
+
+	// Configs that can't be converted to machines are reported as issues, by
+	// ValidationIssues with --json and by Validate otherwise
+	if config.FromContext(ctx).JSONOutput {
+		result := validationResult{
+			Path:   cfg.ConfigFilePath(),
+			Valid:  true,
+			Issues: append(append(schemaIssues, cfg.VariableIssues()...), cfg.ValidationIssues()...),
+		}
+		for _, issue := range result.Issues {
+			if issue.Severity == appconfig.SeverityError {
+				result.Valid = false
+			}
+		}
+		if err := render.JSON(io.Out, result); err != nil {
+			return err
+		}
+		if !result.Valid {
+			return errors.New("App configuration is not valid")
+		}
+		return nil
+	}
+
+	schemaValid := true
+	for _, issue := range schemaIssues {
+		if issue.Section != "" {
+			fmt.Fprintf(io.Out, "%s: ", issue.Section)
+		}
+		fmt.Fprintln(io.Out, issue)
+		if issue.Severity == appconfig.SeverityError {
+			schemaValid = false
+		}
+	}
+	for _, issue := range cfg.VariableIssues() {
+		fmt.Fprintln(io.Out, issue)
+	}
+
 	err, extra_info := cfg.Validate(ctx)
 	fmt.Fprintln(io.Out, extra_info)
+	if err == nil && !schemaValid {
+		err = errors.New("App configuration does not match the fly.toml schema")
+	}
 	return err
 }
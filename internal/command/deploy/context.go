@@ -0,0 +1,41 @@
+package deploy
+
+import "context"
+
+type contextKeyType int
+
+const (
+	_ contextKeyType = iota
+	rollbackOfContextKey
+	freezeOverrideContextKey
+)
+
+// WithRollbackOf derives a context from ctx for a deployment that rolls the
+// app back to the given release version.
+func WithRollbackOf(ctx context.Context, version int) context.Context {
+	return context.WithValue(ctx, rollbackOfContextKey, version)
+}
+
+// rollbackOfFromContext returns the release version the deployment ctx
+// carries rolls back to, or 0.
+func rollbackOfFromContext(ctx context.Context) int {
+	if version, ok := ctx.Value(rollbackOfContextKey).(int); ok {
+		return version
+	}
+	return 0
+}
+
+// withFreezeOverride derives a context from ctx for a deployment that goes
+// ahead during a [[deploy.freeze]] window for the given reason.
+func withFreezeOverride(ctx context.Context, reason string) context.Context {
+	return context.WithValue(ctx, freezeOverrideContextKey, reason)
+}
+
+// freezeOverrideFromContext returns the reason the deployment ctx carries
+// overrides a freeze window for, or "".
+func freezeOverrideFromContext(ctx context.Context) string {
+	if reason, ok := ctx.Value(freezeOverrideContextKey).(string); ok {
+		return reason
+	}
+	return ""
+}
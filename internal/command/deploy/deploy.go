@@ -3,6 +3,7 @@ package deploy
 import (
 	"context"
 	"fmt"
+	"os"
 	"strconv"
 	"strings"
 	"time"
@@ -17,11 +18,14 @@ import (
 	"github.com/superfly/flyctl/internal/command"
 	"github.com/superfly/flyctl/internal/config"
 	"github.com/superfly/flyctl/internal/ctrlc"
+	"github.com/superfly/flyctl/internal/deployevents"
+	"github.com/superfly/flyctl/internal/deploynotify"
 	"github.com/superfly/flyctl/internal/flag"
 	"github.com/superfly/flyctl/internal/flapsutil"
 	"github.com/superfly/flyctl/internal/metrics"
 	"github.com/superfly/flyctl/internal/render"
 	"github.com/superfly/flyctl/internal/sentry"
+	"github.com/superfly/flyctl/internal/state"
 	"github.com/superfly/flyctl/internal/tracing"
 	"github.com/superfly/flyctl/iostreams"
 	"go.opentelemetry.io/otel/attribute"
@@ -35,8 +39,6 @@ var CommonFlags = flag.Set{
 	flag.LocalOnly(),
 	flag.Push(),
 	flag.Wireguard(),
-	flag.Detach(),
-	flag.Strategy(),
 	flag.Dockerfile(),
 	flag.Ignorefile(),
 	flag.ImageLabel(),
@@ -52,12 +54,71 @@ var CommonFlags = flag.Set{
 		Name:        "provision-extensions",
 		Description: "Provision any extensions assigned as a default to first deployments",
 	},
+	flag.Yes(),
+	flag.OverrideFreeze(),
+	flag.Bool{
+		Name:        "force-machines",
+		Description: "Use the Apps v2 platform built with Machines",
+		Default:     false,
+		Hidden:      true,
+	},
+	flag.StringArray{
+		Name:        "label",
+		Description: "Add custom metadata to an image via docker labels",
+	},
+	MachineFlags,
+}
+
+// MachineFlags shape the machines of a deployment, they apply to any
+// deployment whether the image is built or not. machineDeploymentArgs reads
+// all of them, so commands deploying through DeployWithConfig must have them.
+var MachineFlags = flag.Set{
 	flag.StringArray{
 		Name:        "env",
 		Shorthand:   "e",
 		Description: "Set of environment variables in the form of NAME=VALUE pairs. Can be specified multiple times.",
 	},
+	flag.Bool{
+		Name:        "ha",
+		Description: "Create spare machines that increases app availability",
+		Default:     true,
+	},
+	flag.Bool{
+		Name:        "no-public-ips",
+		Description: "Do not allocate any new public IP addresses",
+	},
+	flag.StringArray{
+		Name:        "file-local",
+		Description: "Set of files in the form of /path/inside/machine=<local/path> pairs. Can be specified multiple times.",
+	},
+	flag.StringArray{
+		Name:        "file-literal",
+		Description: "Set of literals in the form of /path/inside/machine=VALUE pairs where VALUE is the content. Can be specified multiple times.",
+	},
+	flag.StringArray{
+		Name:        "file-secret",
+		Description: "Set of secrets in the form of /path/inside/machine=SECRET pairs where SECRET is the name of the secret. Can be specified multiple times.",
+	},
+	flag.Int{
+		Name:        "volume-initial-size",
+		Description: "The initial size in GB for volumes created on first deploy",
+	},
+	flag.VMSizeFlags,
+	StrategyFlags,
+}
+
+// RollbackFlags are the flags of fly releases rollback, which redeploys the
+// image of a release as is.
+var RollbackFlags = flag.Set{
 	flag.Yes(),
+	MachineFlags,
+}
+
+// StrategyFlags control how machines are updated, they apply to any deployment
+// whether the image is built or not.
+var StrategyFlags = flag.Set{
+	flag.Detach(),
+	flag.Strategy(),
 	flag.String{
 		Name:        "wait-timeout",
 		Description: "Time duration to wait for individual machines to transition states and become healthy.",
@@ -76,17 +137,6 @@ var CommonFlags = flag.Set{
 			"flyctl releases leases in most cases.",
 		Default: DefaultLeaseTtl.String(),
 	},
-	flag.Bool{
-		Name:        "force-machines",
-		Description: "Use the Apps v2 platform built with Machines",
-		Default:     false,
-		Hidden:      true,
-	},
-	flag.Bool{
-		Name:        "ha",
-		Description: "Create spare machines that increases app availability",
-		Default:     true,
-	},
 	flag.Bool{
 		Name:        "smoke-checks",
 		Description: "Perform smoke checks during deployment",
@@ -102,21 +152,38 @@ var CommonFlags = flag.Set{
 		Description: "Max number of unavailable machines during rolling updates. A number between 0 and 1 means percent of total machines",
 		Default:     DefaultMaxUnavailable,
 	},
+	flag.Float64{
+		Name:        "canary-percentage",
+		Description: "Percent of machines of each process group to update first with the canary strategy. Defaults to a single machine",
+	},
+	flag.String{
+		Name:        "canary-bake-time",
+		Description: "Time duration to watch canary machines for failing health checks and restarts before updating the other machines",
+		Default:     DefaultCanaryBakeTime.String(),
+	},
 	flag.Bool{
-		Name:        "no-public-ips",
-		Description: "Do not allocate any new public IP addresses",
+		Name:        "auto-rollback",
+		Description: "Restore the machines already updated to their previous config when a rolling or immediate deployment fails. Machines failing [[deploy.verify]] probes are always restored",
 	},
 	flag.StringArray{
-		Name:        "file-local",
-		Description: "Set of files in the form of /path/inside/machine=<local/path> pairs. Can be specified multiple times.",
+		Name:        "waves",
+		Description: "Update the machines region by region with the rolling strategy, one comma separated list of regions per wave. Can be specified multiple times, '*' standing for the other regions. Overrides the waves of fly.toml. Machines of new process groups don't replace any and are launched in the primary region before the first wave",
 	},
-	flag.StringArray{
-		Name:        "file-literal",
-		Description: "Set of literals in the form of /path/inside/machine=VALUE pairs where VALUE is the content. Can be specified multiple times.",
+	flag.String{
+		Name:        "wave-pause",
+		Description: "Time duration to wait between waves, before checking the health of the machines of the last one",
+	},
+	flag.Bool{
+		Name:        "wave-confirm",
+		Description: "Ask for confirmation before starting each wave after the first",
+	},
+	flag.Float64{
+		Name:        "max-cost-increase",
+		Description: "Abort the deployment when it raises the estimated monthly cost of the app by more than this many US dollars",
 	},
 	flag.StringArray{
-		Name:        "file-secret",
-		Description: "Set of secrets in the form of /path/inside/machine=SECRET pairs where SECRET is the name of the secret. Can be specified multiple times.",
+		Name:        "notify",
+		Description: "Post the start, success, failure and rollback of the deployment as JSON to this URL, in addition to those of [deploy.notify]. Can be given multiple times",
 	},
 	flag.StringSlice{
 		Name:        "exclude-regions",
@@ -126,20 +193,11 @@ var CommonFlags = flag.Set{
 		Name:        "only-regions",
 		Description: "Deploy to machines only in these regions. Multiple regions can be specified with comma separated values or by providing the flag multiple times. --only-regions iad,sea --only-regions syd will deploy to all three iad, sea, and syd regions. Applied before --exclude-regions. V2 machines platform only.",
 	},
-	flag.StringArray{
-		Name:        "label",
-		Description: "Add custom metadata to an image via docker labels",
-	},
 	flag.Int{
 		Name:        "immediate-max-concurrent",
 		Description: "Maximum number of machines to update concurrently when using the immediate deployment strategy.",
 		Default:     16,
 	},
-	flag.Int{
-		Name:        "volume-initial-size",
-		Description: "The initial size in GB for volumes created on first deploy",
-	},
-	flag.VMSizeFlags,
 	flag.StringSlice{
 		Name:        "process-groups",
 		Description: "Deploy to machines only in these process groups",
@@ -156,6 +214,17 @@ func New() (cmd *cobra.Command) {
 		long = `Deploy Fly applications from source or an image using a local or remote builder.
 
 		To disable colorized output and show full Docker build output, set the environment variable NO_COLOR=1.
+
+		With --all, or from a directory with a fly.workspace.toml and no fly.toml, deploy every
+		app of a monorepo: the images are built concurrently, then the apps are deployed in the
+		order given by the depends_on lists of fly.workspace.toml.
+
+		When a deployment is interrupted, --resume rolls out the same image and configuration
+		again, skipping the machines that were already updated.
+
+		Deployments are refused during the [[deploy.freeze]] windows of fly.toml, unless
+		--override-freeze gives a reason. That reason is recorded in the fly_freeze_override
+		metadata of the deployed machines only, not in the release.
 	`
 		short = "Deploy Fly applications"
 	)
@@ -163,21 +232,45 @@ func New() (cmd *cobra.Command) {
 	cmd = command.New("deploy [WORKING_DIRECTORY]", short, long, run,
 		command.RequireSession,
 		command.ChangeWorkingDirectoryToFirstArgIfPresent,
-		command.RequireAppName,
+		requireAppNameUnlessWorkspace,
 	)
 
 	cmd.Args = cobra.MaximumNArgs(1)
+	cmd.AddCommand(newLock(), newUnlock(), newLockStatus())
 
 	flag.Add(cmd,
 		CommonFlags,
 		flag.App(),
 		flag.AppConfig(),
+		flag.AppConfigEnv(),
 		// Not in CommonFlags because it's not relevant to a first deploy
 		flag.Bool{
 			Name:        "update-only",
 			Description: "Do not create Machines for new process groups",
 			Default:     false,
 		},
+		flag.Bool{
+			Name:        "all",
+			Description: "Deploy every app of the working directory, as listed in " + WorkspaceFileName + " or found in its subdirectories",
+		},
+		flag.Bool{
+			Name:        "dry-run",
+			Description: "Show what the deployment would do to each machine without building the image or changing anything",
+		},
+		flag.Bool{
+			Name:        "resume",
+			Description: "Continue the interrupted deployment of the app, skipping the machines it already updated",
+		},
+		flag.JSONOutput(),
+		flag.String{
+			Name:        "output",
+			Description: "Format of the deployment progress: 'text' or 'jsonl' to write events as JSON lines to stdout, with the regular output on stderr",
+			Default:     "text",
+		},
+		flag.String{
+			Name:        "output-file",
+			Description: "Write the deployment events as JSON lines to this file",
+		},
 	)
 
 	return
@@ -190,6 +283,10 @@ func run(ctx context.Context) error {
 
 	defer hook.Done()
 
+	if isWorkspaceDeploy(ctx) {
+		return deployWorkspace(ctx)
+	}
+
 	appName := appconfig.NameFromContext(ctx)
 	flapsClient, err := flapsutil.NewClientWithOptions(ctx, flaps.NewClientOpts{
 		AppName: appName,
@@ -234,8 +331,19 @@ func run(ctx context.Context) error {
 }
 
 func DeployWithConfig(ctx context.Context, appConfig *appconfig.Config, forceYes bool) (err error) {
-	io := iostreams.FromContext(ctx)
 	appName := appconfig.NameFromContext(ctx)
+	ctx, closeEvents, err := withDeployEvents(ctx, appName)
+	if err != nil {
+		return err
+	}
+	defer closeEvents()
+	// Deployments failing before their machines are deployed, like failed
+	// builds or freezes, didn't end the event stream yet
+	defer func() {
+		deployevents.EmitFailure(ctx, err)
+	}()
+
+	io := iostreams.FromContext(ctx)
 	apiClient := fly.ClientFromContext(ctx)
 	appCompact, err := apiClient.GetAppCompact(ctx, appName)
 	if err != nil {
@@ -251,10 +359,46 @@ func DeployWithConfig(ctx context.Context, appConfig *appconfig.Config, forceYes
 		}
 	}
 
-	// Fetch an image ref or build from source to get the final image reference to deploy
-	img, err := determineImage(ctx, appConfig)
+	if flag.GetBool(ctx, "dry-run") {
+		return planDeployment(ctx, appConfig, appCompact)
+	}
+
+	// Rollbacks are how incidents get fixed, they go ahead during freezes
+	if rollbackOfFromContext(ctx) == 0 {
+		reason, err := command.CheckDeployFreeze(ctx, appConfig, time.Now())
+		if err != nil {
+			return err
+		}
+		ctx = withFreezeOverride(ctx, reason)
+	}
+
+	ctx, err = withDeployNotify(ctx, appConfig)
 	if err != nil {
-		return fmt.Errorf("failed to fetch an image or build from source: %w", err)
+		return err
+	}
+	// Deployments failing before their machines are deployed, like failed
+	// builds, didn't notify their failure yet
+	defer func() {
+		deploynotify.NotifyFailure(ctx, err)
+	}()
+
+	var img *imgsrc.DeploymentImage
+	if flag.GetBool(ctx, "resume") {
+		// Roll out the image of the interrupted deployment rather than building a new one
+		progress, err := loadDeployProgress(state.ConfigDirectory(ctx), appName)
+		switch {
+		case err != nil:
+			return err
+		case progress == nil:
+			return fmt.Errorf("there's no interrupted deployment of %s to resume", appName)
+		}
+		img = &imgsrc.DeploymentImage{Tag: progress.Image}
+	} else {
+		// Fetch an image ref or build from source to get the final image reference to deploy
+		img, err = determineImage(ctx, appConfig)
+		if err != nil {
+			return fmt.Errorf("failed to fetch an image or build from source: %w", err)
+		}
 	}
 
 	if flag.GetBuildOnly(ctx) {
@@ -273,6 +417,67 @@ func DeployWithConfig(ctx context.Context, appConfig *appconfig.Config, forceYes
 	return err
 }
 
+// withDeployNotify sets up the webhooks of [deploy.notify] and --notify.
+func withDeployNotify(ctx context.Context, appConfig *appconfig.Config) (context.Context, error) {
+	var cfg *appconfig.DeployNotify
+	if appConfig.Deploy != nil {
+		cfg = appConfig.Deploy.Notify
+	}
+	urls := flag.GetStringArray(ctx, "notify")
+	if (cfg == nil || len(cfg.URLs) == 0) && len(urls) == 0 {
+		return ctx, nil
+	}
+
+	base := deploynotify.Payload{
+		App:        appConfig.AppName,
+		GitSHA:     deploynotify.GitSHA(ctx, state.WorkingDirectory(ctx)),
+		RollbackOf: rollbackOfFromContext(ctx),
+	}
+	// Who deployed is nice to have, not worth failing for
+	if user, err := fly.ClientFromContext(ctx).GetCurrentUser(ctx); err == nil {
+		base.User = user.Email
+	}
+
+	n, err := deploynotify.New(cfg, urls, base, iostreams.FromContext(ctx).ErrOut)
+	if err != nil {
+		return nil, err
+	}
+	return deploynotify.NewContext(ctx, n), nil
+}
+
+// withDeployEvents sets up the event stream asked for with --output and
+// --output-file. The regular output moves to stderr when events go to stdout.
+func withDeployEvents(ctx context.Context, appName string) (context.Context, func(), error) {
+	output := flag.GetString(ctx, "output")
+	outputFile := flag.GetString(ctx, "output-file")
+
+	switch output {
+	case "", "text":
+		if outputFile == "" {
+			return ctx, func() {}, nil
+		}
+	case "jsonl":
+	default:
+		return nil, nil, fmt.Errorf("unsupported output format '%s', use 'text' or 'jsonl'", output)
+	}
+
+	if outputFile != "" {
+		f, err := os.Create(outputFile)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to create events file: %w", err)
+		}
+		ctx = deployevents.NewContext(ctx, deployevents.NewWriter(f, appName))
+		return ctx, func() { f.Close() }, nil
+	}
+
+	io := iostreams.FromContext(ctx)
+	events := deployevents.NewWriter(io.Out, appName)
+	human := *io
+	human.Out = io.ErrOut
+	ctx = iostreams.NewContext(ctx, &human)
+	return deployevents.NewContext(ctx, events), func() {}, nil
+}
+
 func parseDurationFlag(ctx context.Context, flagName string) (*time.Duration, error) {
 	if !flag.IsSpecified(ctx, flagName) {
 		return nil, nil
@@ -315,31 +520,88 @@ func deployToMachines(
 		metrics.Status(ctx, "deploy_machines", err == nil)
 	}()
 
-	releaseCmdTimeout, err := parseDurationFlag(ctx, "release-command-timeout")
+	args, err := machineDeploymentArgs(ctx, appConfig, appCompact, img)
 	if err != nil {
 		return err
 	}
 
-	waitTimeout, err := parseDurationFlag(ctx, "wait-timeout")
+	unlock, err := acquireDeployLock(ctx, appConfig, args)
 	if err != nil {
 		return err
 	}
+	defer unlock()
 
-	leaseTimeout, err := parseDurationFlag(ctx, "lease-timeout")
+	md, err := NewMachineDeployment(ctx, *args)
 	if err != nil {
+		sentry.CaptureExceptionWithAppInfo(ctx, err, "deploy", appCompact)
 		return err
 	}
 
-	files, err := command.FilesFromCommand(ctx)
+	err = md.DeployMachinesApp(ctx)
+	if err != nil {
+		sentry.CaptureExceptionWithAppInfo(ctx, err, "deploy", appCompact)
+	}
+	return err
+}
+
+// planDeployment prints what deploying appConfig would do to every machine of
+// the app without building the image or changing anything.
+func planDeployment(ctx context.Context, appConfig *appconfig.Config, appCompact *fly.AppCompact) error {
+	io := iostreams.FromContext(ctx)
+	// It's important to push appConfig into context because MachineDeployment will fetch it from there
+	ctx = appconfig.WithConfig(ctx, appConfig)
+
+	img, toBuild, err := determineDryRunImage(ctx, appConfig)
+	if err != nil {
+		return fmt.Errorf("failed to resolve the image reference: %w", err)
+	}
+
+	args, err := machineDeploymentArgs(ctx, appConfig, appCompact, img)
 	if err != nil {
 		return err
 	}
+	args.DryRun = true
 
-	guest, err := flag.GetMachineGuest(ctx, nil)
+	md, err := NewMachineDeployment(ctx, *args)
 	if err != nil {
 		return err
 	}
 
+	plan, err := md.Plan(ctx)
+	if err != nil {
+		return err
+	}
+	plan.ImageToBuild = toBuild
+	return renderPlan(io.Out, plan, config.FromContext(ctx).JSONOutput)
+}
+
+// machineDeploymentArgs builds the arguments of a machines deployment from the command flags
+func machineDeploymentArgs(ctx context.Context, appConfig *appconfig.Config, appCompact *fly.AppCompact, img *imgsrc.DeploymentImage) (*MachineDeploymentArgs, error) {
+	releaseCmdTimeout, err := parseDurationFlag(ctx, "release-command-timeout")
+	if err != nil {
+		return nil, err
+	}
+
+	waitTimeout, err := parseDurationFlag(ctx, "wait-timeout")
+	if err != nil {
+		return nil, err
+	}
+
+	leaseTimeout, err := parseDurationFlag(ctx, "lease-timeout")
+	if err != nil {
+		return nil, err
+	}
+
+	files, err := command.FilesFromCommand(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	guest, err := flag.GetMachineGuest(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
 	excludeRegions := make(map[string]interface{})
 	for _, r := range flag.GetStringSlice(ctx, "exclude-regions") {
 		reg := strings.TrimSpace(r)
@@ -363,10 +625,43 @@ func deployToMachines(
 		maxUnavailable = fly.Pointer(flag.GetFloat64(ctx, "max-unavailable"))
 		// Validation to ensure that 0.0 is *purely* the "unspecified" value
 		if *maxUnavailable <= 0 {
-			return fmt.Errorf("the value for --max-unavailable must be > 0")
+			return nil, fmt.Errorf("the value for --max-unavailable must be > 0")
+		}
+	}
+
+	var canaryPercentage *float64
+	if flag.IsSpecified(ctx, "canary-percentage") {
+		canaryPercentage = fly.Pointer(flag.GetFloat64(ctx, "canary-percentage"))
+		if *canaryPercentage <= 0 || *canaryPercentage > 100 {
+			return nil, fmt.Errorf("the value for --canary-percentage must be > 0 and <= 100")
 		}
 	}
 
+	var maxCostIncrease *float64
+	if flag.IsSpecified(ctx, "max-cost-increase") {
+		maxCostIncrease = fly.Pointer(flag.GetFloat64(ctx, "max-cost-increase"))
+		if *maxCostIncrease < 0 {
+			return nil, fmt.Errorf("the value for --max-cost-increase must be >= 0")
+		}
+	}
+
+	canaryBakeTime, err := parseDurationFlag(ctx, "canary-bake-time")
+	if err != nil {
+		return nil, err
+	}
+
+	var waves [][]string
+	if values := flag.GetStringArray(ctx, "waves"); len(values) > 0 {
+		if waves, err = appconfig.ParseDeployWaves(values); err != nil {
+			return nil, fmt.Errorf("invalid --waves: %w", err)
+		}
+	}
+
+	wavePause, err := parseDurationFlag(ctx, "wave-pause")
+	if err != nil {
+		return nil, err
+	}
+
 	processGroups := make(map[string]interface{})
 	for _, r := range flag.GetStringSlice(ctx, "process-groups") {
 		reg := strings.TrimSpace(r)
@@ -375,7 +670,7 @@ func deployToMachines(
 		}
 	}
 
-	md, err := NewMachineDeployment(ctx, MachineDeploymentArgs{
+	return &MachineDeploymentArgs{
 		AppCompact:             appCompact,
 		DeploymentImage:        img.Tag,
 		Strategy:               flag.GetString(ctx, "strategy"),
@@ -399,17 +694,17 @@ func deployToMachines(
 		ImmediateMaxConcurrent: flag.GetInt(ctx, "immediate-max-concurrent"),
 		VolumeInitialSize:      flag.GetInt(ctx, "volume-initial-size"),
 		ProcessGroups:          processGroups,
-	})
-	if err != nil {
-		sentry.CaptureExceptionWithAppInfo(ctx, err, "deploy", appCompact)
-		return err
-	}
-
-	err = md.DeployMachinesApp(ctx)
-	if err != nil {
-		sentry.CaptureExceptionWithAppInfo(ctx, err, "deploy", appCompact)
-	}
-	return err
+		CanaryPercentage:       canaryPercentage,
+		CanaryBakeTime:         canaryBakeTime,
+		AutoRollback:           flag.GetBool(ctx, "auto-rollback"),
+		RollbackOf:             rollbackOfFromContext(ctx),
+		FreezeOverride:         freezeOverrideFromContext(ctx),
+		MaxCostIncrease:        maxCostIncrease,
+		Waves:                  waves,
+		WavePause:              wavePause,
+		WaveConfirm:            flag.GetBool(ctx, "wave-confirm"),
+		Resume:                 flag.GetBool(ctx, "resume"),
+	}, nil
 }
 
 // determineAppConfig fetches the app config from a local file, or in its absence, from the API
@@ -447,18 +742,24 @@ func determineAppConfig(ctx context.Context) (cfg *appconfig.Config, err error)
 		cfg.AppName = appName
 	}
 
+	// Keep stdout clean for JSON output
+	out := io.Out
+	if config.FromContext(ctx).JSONOutput {
+		out = io.ErrOut
+	}
+
 	err, extraInfo := cfg.Validate(ctx)
 	if extraInfo != "" {
-		fmt.Fprintf(io.Out, extraInfo)
+		fmt.Fprintf(out, extraInfo)
 	}
 	if err != nil {
 		tracing.RecordError(span, err, "validate config")
 		return nil, err
 	}
 
-	if cfg.Deploy != nil && cfg.Deploy.Strategy != "rolling" && cfg.Deploy.MaxUnavailable != nil {
+	if cfg.Deploy != nil && cfg.Deploy.Strategy != "rolling" && cfg.Deploy.Strategy != "canary" && cfg.Deploy.MaxUnavailable != nil {
 		if !config.FromContext(ctx).JSONOutput {
-			fmt.Fprintf(io.Out, "Warning: max-unavailable set for non-rolling strategy '%s', ignoring\n", cfg.Deploy.Strategy)
+			fmt.Fprintf(out, "Warning: max-unavailable set for non-rolling strategy '%s', ignoring\n", cfg.Deploy.Strategy)
 		}
 	}
 
@@ -197,6 +197,32 @@ func determineImage(ctx context.Context, appConfig *appconfig.Config) (img *imgs
 	return
 }
 
+// determineDryRunImage resolves the image reference to deploy without building
+// or pushing anything. When the image would be built from source, it returns
+// the tag the image would be pushed with and true.
+func determineDryRunImage(ctx context.Context, appConfig *appconfig.Config) (*imgsrc.DeploymentImage, bool, error) {
+	imageRef, err := fetchImageRef(ctx, appConfig)
+	if err != nil {
+		return nil, false, err
+	}
+	if imageRef == "" {
+		tag := imgsrc.NewDeploymentTag(appConfig.AppName, flag.GetString(ctx, "image-label"))
+		return &imgsrc.DeploymentImage{Tag: tag}, true, nil
+	}
+
+	daemonType := imgsrc.NewDockerDaemonType(!flag.GetRemoteOnly(ctx), !flag.GetLocalOnly(ctx), env.IsCI(), flag.GetBool(ctx, "nixpacks"))
+	io := iostreams.FromContext(ctx)
+	resolver := imgsrc.NewResolver(daemonType, fly.ClientFromContext(ctx), appConfig.AppName, io, flag.GetWireguard(ctx))
+	img, err := resolver.ResolveReference(ctx, io, imgsrc.RefOptions{
+		AppName:    appConfig.AppName,
+		WorkingDir: state.WorkingDirectory(ctx),
+		Publish:    false,
+		ImageRef:   imageRef,
+		ImageLabel: flag.GetString(ctx, "image-label"),
+	})
+	return img, false, err
+}
+
 // resolveDockerfilePath returns the absolute path to the Dockerfile
 // if one was specified in the app config or a command line argument
 func resolveDockerfilePath(ctx context.Context, appConfig *appconfig.Config) (path string, err error) {
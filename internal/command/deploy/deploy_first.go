@@ -86,9 +86,40 @@ func (md *machineDeployment) provisionIpsOnFirstDeploy(ctx context.Context, allo
 }
 
 func (md *machineDeployment) provisionVolumesOnFirstDeploy(ctx context.Context) error {
+	seeds, err := md.seedVolumes()
+	if err != nil {
+		return err
+	}
+
+	for _, seed := range seeds {
+		fmt.Fprintf(
+			md.io.Out,
+			"Creating a %d GB volume named '%s' for process group '%s'. "+
+				"Use 'fly vol extend' to increase its size\n",
+			*seed.input.SizeGb, seed.input.Name, seed.group,
+		)
+
+		vol, err := md.flapsClient.CreateVolume(ctx, seed.input)
+		if err != nil {
+			return err
+		}
+
+		md.volumes[seed.input.Name] = append(md.volumes[seed.input.Name], *vol)
+	}
+	return nil
+}
+
+// seedVolume is a volume the first deploy creates for a process group
+type seedVolume struct {
+	group string
+	input fly.CreateVolumeRequest
+}
+
+// seedVolumes returns the volumes provisionVolumesOnFirstDeploy creates
+func (md *machineDeployment) seedVolumes() ([]seedVolume, error) {
 	// Provision only if the app hasn't been deployed and have mounts defined
 	if !md.isFirstDeploy || len(md.appConfig.Mounts) == 0 {
-		return nil
+		return nil, nil
 	}
 
 	// md.setVolumes already queried for existent unattached volumes, do not create more
@@ -97,15 +128,16 @@ func (md *machineDeployment) provisionVolumesOnFirstDeploy(ctx context.Context)
 	})
 
 	// The logic here is to provision one volume per process group that needs it only on the primary region
+	var seeds []seedVolume
 	for _, groupName := range md.appConfig.ProcessNames() {
 		groupConfig, err := md.appConfig.Flatten(groupName)
 		if err != nil {
-			return err
+			return nil, err
 		}
 
 		mConfig, err := md.appConfig.ToMachineConfig(groupName, nil)
 		if err != nil {
-			return err
+			return nil, err
 		}
 		guest := md.machineGuest
 		if mConfig.Guest != nil {
@@ -131,28 +163,17 @@ func (md *machineDeployment) provisionVolumesOnFirstDeploy(ctx context.Context)
 				initialSize = DefaultVolumeInitialSizeGB
 			}
 
-			fmt.Fprintf(
-				md.io.Out,
-				"Creating a %d GB volume named '%s' for process group '%s'. "+
-					"Use 'fly vol extend' to increase its size\n",
-				initialSize, m.Source, groupName,
-			)
-
-			input := fly.CreateVolumeRequest{
-				Name:                m.Source,
-				Region:              groupConfig.PrimaryRegion,
-				SizeGb:              fly.Pointer(initialSize),
-				Encrypted:           fly.Pointer(true),
-				ComputeRequirements: guest,
-			}
-
-			vol, err := md.flapsClient.CreateVolume(ctx, input)
-			if err != nil {
-				return err
-			}
-
-			md.volumes[m.Source] = append(md.volumes[m.Source], *vol)
+			seeds = append(seeds, seedVolume{
+				group: groupName,
+				input: fly.CreateVolumeRequest{
+					Name:                m.Source,
+					Region:              groupConfig.PrimaryRegion,
+					SizeGb:              fly.Pointer(initialSize),
+					Encrypted:           fly.Pointer(true),
+					ComputeRequirements: guest,
+				},
+			})
 		}
 	}
-	return nil
+	return seeds, nil
 }
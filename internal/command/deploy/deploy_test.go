@@ -0,0 +1,37 @@
+package deploy
+
+import (
+	"context"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	fly "github.com/superfly/fly-go"
+	"github.com/superfly/flyctl/internal/appconfig"
+	"github.com/superfly/flyctl/internal/build/imgsrc"
+	"github.com/superfly/flyctl/internal/flag"
+)
+
+// fly releases rollback deploys through DeployWithConfig with RollbackFlags
+// only, machineDeploymentArgs must not read any flag it doesn't have.
+func Test_machineDeploymentArgs_RollbackFlags(t *testing.T) {
+	cmd := &cobra.Command{}
+	flag.Add(cmd, flag.App(), flag.AppConfig(), RollbackFlags)
+	require.NoError(t, cmd.ParseFlags([]string{"--strategy", "immediate", "--yes"}))
+
+	ctx := flag.NewContext(context.Background(), cmd.Flags())
+	ctx = WithRollbackOf(ctx, 3)
+
+	var args *MachineDeploymentArgs
+	require.NotPanics(t, func() {
+		var err error
+		args, err = machineDeploymentArgs(ctx, &appconfig.Config{PrimaryRegion: "fra"}, &fly.AppCompact{Name: "my-app"}, &imgsrc.DeploymentImage{Tag: "registry.fly.io/my-app:v3"})
+		require.NoError(t, err)
+	})
+	assert.Equal(t, "immediate", args.Strategy)
+	assert.Equal(t, 3, args.RollbackOf)
+	assert.True(t, args.IncreasedAvailability)
+	assert.True(t, args.AllocPublicIP)
+	assert.Equal(t, "registry.fly.io/my-app:v3", args.DeploymentImage)
+}
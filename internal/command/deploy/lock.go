@@ -0,0 +1,227 @@
+package deploy
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+	fly "github.com/superfly/fly-go"
+	"github.com/superfly/fly-go/flaps"
+	"github.com/superfly/flyctl/internal/appconfig"
+	"github.com/superfly/flyctl/internal/command"
+	"github.com/superfly/flyctl/internal/config"
+	"github.com/superfly/flyctl/internal/flag"
+	"github.com/superfly/flyctl/internal/flapsutil"
+	"github.com/superfly/flyctl/internal/machine"
+	"github.com/superfly/flyctl/internal/render"
+	"github.com/superfly/flyctl/iostreams"
+)
+
+func newLock() *cobra.Command {
+	const (
+		long = `Lock the deploys of the app, for instance to freeze them during an incident.
+Deployments fail while the lock is held, until it's released with 'fly deploy unlock'.
+
+Deployments take the same lock for their length, so that two of them don't
+run at the same time.
+`
+		short = "Lock the deploys of the app"
+	)
+
+	cmd := command.New("lock", short, long, runLock,
+		command.RequireSession,
+		command.RequireAppName,
+	)
+	cmd.Args = cobra.NoArgs
+
+	flag.Add(cmd,
+		flag.App(),
+		flag.AppConfig(),
+		flag.String{
+			Name:        "reason",
+			Description: "Why deploys are locked, shown to whoever tries to deploy",
+		},
+	)
+
+	return cmd
+}
+
+func newUnlock() *cobra.Command {
+	const (
+		long = `Release the deploy lock taken with 'fly deploy lock'.
+`
+		short = "Unlock the deploys of the app"
+	)
+
+	cmd := command.New("unlock", short, long, runUnlock,
+		command.RequireSession,
+		command.RequireAppName,
+	)
+	cmd.Args = cobra.NoArgs
+
+	flag.Add(cmd,
+		flag.App(),
+		flag.AppConfig(),
+	)
+
+	return cmd
+}
+
+func newLockStatus() *cobra.Command {
+	const (
+		long = `Show whether the deploys of the app are locked, by whom and since when.
+`
+		short = "Show the deploy lock of the app"
+	)
+
+	cmd := command.New("status", short, long, runLockStatus,
+		command.RequireSession,
+		command.RequireAppName,
+	)
+	cmd.Args = cobra.NoArgs
+
+	flag.Add(cmd,
+		flag.App(),
+		flag.AppConfig(),
+		flag.JSONOutput(),
+	)
+
+	return cmd
+}
+
+func deployLockContext(ctx context.Context) (context.Context, error) {
+	flapsClient, err := flapsutil.NewClientWithOptions(ctx, flaps.NewClientOpts{
+		AppName: appconfig.NameFromContext(ctx),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not create flaps client: %w", err)
+	}
+	return flaps.NewContext(ctx, flapsClient), nil
+}
+
+func runLock(ctx context.Context) error {
+	var (
+		appName  = appconfig.NameFromContext(ctx)
+		io       = iostreams.FromContext(ctx)
+		colorize = io.ColorScheme()
+	)
+
+	ctx, err := deployLockContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	user, err := fly.ClientFromContext(ctx).GetCurrentUser(ctx)
+	if err != nil {
+		return fmt.Errorf("failed retrieving current user: %w", err)
+	}
+
+	// The sentinel holding the lock is created from a machine of the app
+	machines, _, err := flaps.FromContext(ctx).ListFlyAppsMachines(ctx)
+	if err != nil {
+		return err
+	}
+	if len(machines) == 0 {
+		return fmt.Errorf("%s has no machines, there's no deploy to lock", appName)
+	}
+
+	lock := &machine.DeployLock{
+		Holder: user.Email,
+		Reason: flag.GetString(ctx, "reason"),
+		Since:  time.Now(),
+	}
+	if err := machine.LockDeploys(ctx, lock, machines[0].FullImageRef(), machines[0].Region); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(io.Out, "Deploys of %s are %s, run 'fly deploy unlock' to resume them\n", colorize.Bold(appName), colorize.Yellow("locked"))
+	return nil
+}
+
+func runUnlock(ctx context.Context) error {
+	var (
+		appName  = appconfig.NameFromContext(ctx)
+		io       = iostreams.FromContext(ctx)
+		colorize = io.ColorScheme()
+	)
+
+	ctx, err := deployLockContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	lock, err := machine.UnlockDeploys(ctx)
+	if err != nil {
+		return err
+	}
+	if lock == nil {
+		fmt.Fprintf(io.Out, "Deploys of %s weren't locked\n", colorize.Bold(appName))
+		return nil
+	}
+
+	fmt.Fprintf(io.Out, "Deploys of %s are %s, the lock was %s\n", colorize.Bold(appName), colorize.Green("unlocked"), lock)
+	return nil
+}
+
+func runLockStatus(ctx context.Context) error {
+	var (
+		appName  = appconfig.NameFromContext(ctx)
+		io       = iostreams.FromContext(ctx)
+		colorize = io.ColorScheme()
+	)
+
+	ctx, err := deployLockContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	lock, err := machine.GetDeployLock(ctx, flaps.FromContext(ctx))
+	if err != nil {
+		return fmt.Errorf("failed to get the deploy lock of %s: %w", appName, err)
+	}
+
+	if config.FromContext(ctx).JSONOutput {
+		return render.JSON(io.Out, map[string]any{
+			"locked": lock != nil,
+			"lock":   lock,
+		})
+	}
+
+	if lock == nil {
+		fmt.Fprintf(io.Out, "Deploys of %s are %s\n", colorize.Bold(appName), colorize.Green("unlocked"))
+		return nil
+	}
+	fmt.Fprintf(io.Out, "Deploys of %s are %s, %s\n", colorize.Bold(appName), colorize.Yellow("locked"), lock)
+	return nil
+}
+
+// acquireDeployLock takes the deploy lock of the app for the length of the
+// deployment, so that concurrent deployments don't fight over machine leases.
+func acquireDeployLock(ctx context.Context, appConfig *appconfig.Config, args *MachineDeploymentArgs) (func(), error) {
+	user, err := fly.ClientFromContext(ctx).GetCurrentUser(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed retrieving current user: %w", err)
+	}
+
+	flapsClient, err := flapsutil.NewClientWithOptions(ctx, flaps.NewClientOpts{
+		AppCompact: args.AppCompact,
+		AppName:    args.AppCompact.Name,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not create flaps client: %w", err)
+	}
+	ctx = flaps.NewContext(ctx, flapsClient)
+
+	leaseTimeout := DefaultLeaseTtl
+	if args.LeaseTimeout != nil {
+		leaseTimeout = *args.LeaseTimeout
+	}
+
+	lock := &machine.DeployLock{
+		Holder: user.Email,
+		Reason: "deploying " + args.DeploymentImage,
+		Since:  time.Now(),
+	}
+	return machine.AcquireDeployLock(ctx, lock, args.DeploymentImage, appConfig.PrimaryRegion, leaseTimeout)
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"net/http"
 	"strings"
 	"sync"
 	"time"
@@ -21,6 +22,7 @@ import (
 	"github.com/superfly/flyctl/internal/cmdutil"
 	"github.com/superfly/flyctl/internal/flapsutil"
 	"github.com/superfly/flyctl/internal/machine"
+	"github.com/superfly/flyctl/internal/state"
 	"github.com/superfly/flyctl/internal/tracing"
 	"github.com/superfly/flyctl/iostreams"
 	"github.com/superfly/flyctl/terminal"
@@ -33,12 +35,19 @@ const (
 	DefaultReleaseCommandTimeout  = 5 * time.Minute
 	DefaultLeaseTtl               = 13 * time.Second
 	DefaultMaxUnavailable         = 0.33
+	DefaultCanaryBakeTime         = 1 * time.Minute
 	DefaultVolumeInitialSizeGB    = 3
 	DefaultGPUVolumeInitialSizeGB = 100
 )
 
+// MachineConfigMetadataKeyFlyRollbackOf is set on machines deployed by a
+// rollback to the release version they were rolled back to. The releases API
+// takes no metadata, so the machines are where rollbacks are recorded.
+const MachineConfigMetadataKeyFlyRollbackOf = "fly_rollback_of_version"
+
 type MachineDeployment interface {
 	DeployMachinesApp(context.Context) error
+	Plan(context.Context) (*Plan, error)
 }
 
 type MachineDeploymentArgs struct {
@@ -66,6 +75,26 @@ type MachineDeploymentArgs struct {
 	ImmediateMaxConcurrent int
 	VolumeInitialSize      int
 	ProcessGroups          map[string]interface{}
+	CanaryPercentage       *float64
+	CanaryBakeTime         *time.Duration
+	AutoRollback           bool
+	// RollbackOf is the release version a rollback deployment restores
+	RollbackOf int
+	// FreezeOverride is the reason the deployment goes ahead during a
+	// [[deploy.freeze]] window
+	FreezeOverride string
+	// MaxCostIncrease aborts the deployment when the estimated monthly cost
+	// of the app grows by more than this many US dollars
+	MaxCostIncrease *float64
+	// Waves are the lists of regions updated one after the other, overriding
+	// those of fly.toml
+	Waves       [][]string
+	WavePause   *time.Duration
+	WaveConfirm bool
+	// Resume continues the interrupted deployment of the same image and config
+	Resume bool
+	// DryRun skips provisioning and creating a release so only Plan can be used
+	DryRun bool
 }
 
 type machineDeployment struct {
@@ -80,6 +109,7 @@ type machineDeployment struct {
 	machineSet             machine.MachineSet
 	releaseCommandMachine  machine.MachineSet
 	volumes                map[string][]fly.Volume
+	volumeSizes            map[string]int
 	strategy               string
 	releaseId              string
 	releaseVersion         int
@@ -103,6 +133,32 @@ type machineDeployment struct {
 	immediateMaxConcurrent int
 	volumeInitialSize      int
 	processGroups          map[string]interface{}
+	canaryPercentage       float64
+	canaryBakeTime         time.Duration
+	autoRollback           bool
+	rollbackOf             int
+	freezeOverride         string
+	waves                  [][]string
+	wavePause              time.Duration
+	waveConfirm            bool
+	hookFailurePolicy      string
+	verifyProbes           []*verifyProbe
+	verifyHTTPClient       *http.Client
+	stateDir               string
+	configHash             string
+	// resume is the progress of the interrupted deployment --resume continues
+	resume *deployProgress
+	// progress is persisted while updating the existing machines
+	progress *deployProgress
+	// upToDateMachines are left out of machineSet by --resume
+	upToDateMachines []*fly.Machine
+	// updatedMachines records the machines updated by updateExistingMachines
+	updatedMachines *updatedMachines
+	// newGroupMachines are the machines launched for new process groups
+	newGroupMachines []machine.LeasableMachine
+	// quiet silences the warnings about updated machines while reviewing
+	// the resource changes ahead of the deployment
+	quiet bool
 }
 
 func NewMachineDeployment(ctx context.Context, args MachineDeploymentArgs) (MachineDeployment, error) {
@@ -131,6 +187,21 @@ func NewMachineDeployment(ctx context.Context, args MachineDeploymentArgs) (Mach
 	if args.AppCompact == nil {
 		return nil, fmt.Errorf("BUG: args.AppCompact should be set when calling this method")
 	}
+
+	stateDir := state.ConfigDirectory(ctx)
+	configHash, err := appConfigHash(appConfig)
+	if err != nil {
+		tracing.RecordError(span, err, "failed to hash app config")
+		return nil, err
+	}
+	var resume *deployProgress
+	if args.Resume {
+		resume, err = loadResumableDeployment(stateDir, args.AppCompact.Name, args.DeploymentImage, configHash)
+		if err != nil {
+			tracing.RecordError(span, err, "failed to load deployment progress")
+			return nil, err
+		}
+	}
 	flapsClient, err := flapsutil.NewClientWithOptions(ctx, flaps.NewClientOpts{
 		AppCompact: args.AppCompact,
 		AppName:    args.AppCompact.Name,
@@ -189,6 +260,48 @@ func NewMachineDeployment(ctx context.Context, args MachineDeploymentArgs) (Mach
 		maxUnavailable = *appConfig.Deploy.MaxUnavailable
 	}
 
+	var canaryPercentage float64
+	switch {
+	case args.CanaryPercentage != nil:
+		canaryPercentage = *args.CanaryPercentage
+	case appConfig.Deploy != nil && appConfig.Deploy.CanaryPercentage != nil:
+		canaryPercentage = *appConfig.Deploy.CanaryPercentage
+	}
+
+	var canaryBakeTime time.Duration
+	switch {
+	case args.CanaryBakeTime != nil:
+		canaryBakeTime = *args.CanaryBakeTime
+	case appConfig.Deploy != nil && appConfig.Deploy.CanaryBakeTime != nil:
+		canaryBakeTime = appConfig.Deploy.CanaryBakeTime.Duration
+	default:
+		canaryBakeTime = DefaultCanaryBakeTime
+	}
+
+	waves := args.Waves
+	if len(waves) == 0 && appConfig.Deploy != nil {
+		waves = appConfig.Deploy.Waves
+	}
+
+	var wavePause time.Duration
+	switch {
+	case args.WavePause != nil:
+		wavePause = *args.WavePause
+	case appConfig.Deploy != nil && appConfig.Deploy.WavePause != nil:
+		wavePause = appConfig.Deploy.WavePause.Duration
+	}
+
+	hookFailurePolicy := appconfig.HookFailurePolicyAbort
+	if appConfig.Deploy != nil && appConfig.Deploy.HookFailurePolicy != "" {
+		hookFailurePolicy = appConfig.Deploy.HookFailurePolicy
+	}
+
+	verifyProbes, err := newVerifyProbes(appConfig)
+	if err != nil {
+		tracing.RecordError(span, err, "failed to parse verify probes")
+		return nil, err
+	}
+
 	immedateMaxConcurrent := args.ImmediateMaxConcurrent
 	if immedateMaxConcurrent < 1 {
 		immedateMaxConcurrent = 1
@@ -221,6 +334,20 @@ func NewMachineDeployment(ctx context.Context, args MachineDeploymentArgs) (Mach
 		immediateMaxConcurrent: immedateMaxConcurrent,
 		volumeInitialSize:      args.VolumeInitialSize,
 		processGroups:          args.ProcessGroups,
+		canaryPercentage:       canaryPercentage,
+		canaryBakeTime:         canaryBakeTime,
+		autoRollback:           args.AutoRollback,
+		rollbackOf:             args.RollbackOf,
+		freezeOverride:         args.FreezeOverride,
+		waves:                  waves,
+		wavePause:              wavePause,
+		waveConfirm:            args.WaveConfirm || (appConfig.Deploy != nil && appConfig.Deploy.WaveConfirm),
+		hookFailurePolicy:      hookFailurePolicy,
+		verifyProbes:           verifyProbes,
+		stateDir:               stateDir,
+		configHash:             configHash,
+		resume:                 resume,
+		updatedMachines:        &updatedMachines{},
 	}
 	if err := md.setStrategy(); err != nil {
 		tracing.RecordError(span, err, "failed to set strategy")
@@ -230,6 +357,7 @@ func NewMachineDeployment(ctx context.Context, args MachineDeploymentArgs) (Mach
 		tracing.RecordError(span, err, "failed to set machines for first deployemt")
 		return nil, err
 	}
+	md.warnAboutDrift(ctx)
 	if err := md.setVolumes(ctx); err != nil {
 		tracing.RecordError(span, err, "failed to set volumes")
 		return nil, err
@@ -243,10 +371,20 @@ func NewMachineDeployment(ctx context.Context, args MachineDeploymentArgs) (Mach
 		return nil, err
 	}
 
+	// The review must come before anything is provisioned or released
+	if !args.DryRun && !args.RestartOnly {
+		if err := md.reviewResourceChanges(ctx, args.MaxCostIncrease); err != nil {
+			tracing.RecordError(span, err, "failed to review resource changes")
+			return nil, err
+		}
+	}
+
 	// Provisioning must come after setVolumes
-	if err := md.provisionFirstDeploy(ctx, args.AllocPublicIP); err != nil {
-		tracing.RecordError(span, err, "failed to provision first depoloy")
-		return nil, err
+	if !args.DryRun {
+		if err := md.provisionFirstDeploy(ctx, args.AllocPublicIP); err != nil {
+			tracing.RecordError(span, err, "failed to provision first depoloy")
+			return nil, err
+		}
 	}
 
 	// validations must happen after every else
@@ -254,6 +392,9 @@ func NewMachineDeployment(ctx context.Context, args MachineDeploymentArgs) (Mach
 		tracing.RecordError(span, err, "failed to validate volume config")
 		return nil, err
 	}
+	if args.DryRun {
+		return md, nil
+	}
 	if err = md.createReleaseInBackend(ctx); err != nil {
 		tracing.RecordError(span, err, "failed to create release in backend")
 		return nil, err
@@ -281,6 +422,10 @@ func (md *machineDeployment) setMachinesForDeployment(ctx context.Context) error
 		tracing.RecordError(span, err, "failed to list machines")
 		return err
 	}
+	// Deploy hook machines still running aren't part of any process group
+	machines = lo.Reject(machines, func(m *fly.Machine, _ int) bool {
+		return machine.IsDeployHookMachine(m)
+	})
 
 	if len(machines) == 0 {
 		terminal.Debug("Found no machines that are part of Fly Apps Platform. Checking for active machines...")
@@ -289,6 +434,9 @@ func (md *machineDeployment) setMachinesForDeployment(ctx context.Context) error
 			tracing.RecordError(span, err, "failed to list machines")
 			return err
 		}
+		activeMachines = lo.Reject(activeMachines, func(m *fly.Machine, _ int) bool {
+			return machine.IsDeployLockMachine(m)
+		})
 		if len(activeMachines) > 0 {
 			fmt.Fprintf(md.io.ErrOut, "%s Your app doesn't have any Fly Launch machines, so we'll create one now. Learn more at \nhttps://fly.io/docs/apps/deploy/#machines-not-managed-by-fly-launch\n\n", aurora.Yellow("[WARNING]"))
 			md.isFirstDeploy = true
@@ -354,6 +502,10 @@ func (md *machineDeployment) setVolumes(ctx context.Context) error {
 		return fmt.Errorf("Error fetching application volumes: %w", err)
 	}
 
+	md.volumeSizes = lo.SliceToMap(volumes, func(v fly.Volume) (string, int) {
+		return v.ID, v.SizeGb
+	})
+
 	unattached := lo.Filter(volumes, func(v fly.Volume, _ int) bool {
 		return v.AttachedAllocation == nil && v.AttachedMachine == nil
 	})
@@ -508,6 +660,12 @@ func (md *machineDeployment) setStrategy() error {
 	if md.appConfig.Deploy != nil && md.appConfig.Deploy.Strategy != "" {
 		md.strategy = md.appConfig.Deploy.Strategy
 	}
+	if len(md.waves) > 0 && md.strategy != "rolling" {
+		return fmt.Errorf("deploy waves only work with the rolling strategy, not %s", md.strategy)
+	}
+	if md.hookFailurePolicy == appconfig.HookFailurePolicyRollback && md.strategy == "bluegreen" {
+		return fmt.Errorf("hook_failure_policy %s doesn't work with the bluegreen strategy", md.hookFailurePolicy)
+	}
 	return nil
 }
 
@@ -653,6 +811,9 @@ func (md *machineDeployment) ToSpanAttributes() []attribute.KeyValue {
 		attribute.Bool("deployment.update_only", md.updateOnly),
 		attribute.Int("deployment.immediate_max_concurrency", md.immediateMaxConcurrent),
 		attribute.Int("deployment.volume_initial_size", md.volumeInitialSize),
+		attribute.Int("deployment.rollback_of", md.rollbackOf),
+		attribute.String("deployment.freeze_override", md.freezeOverride),
+		attribute.Bool("deployment.resume", md.resume != nil),
 	}
 
 	b, err := json.Marshal(md.excludeRegions)
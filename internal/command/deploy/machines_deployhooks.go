@@ -0,0 +1,237 @@
+package deploy
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/google/shlex"
+	fly "github.com/superfly/fly-go"
+	"github.com/superfly/flyctl/internal/appconfig"
+	machcmd "github.com/superfly/flyctl/internal/command/machine"
+	"github.com/superfly/flyctl/internal/machine"
+	"github.com/superfly/flyctl/internal/statuslogger"
+	"github.com/superfly/flyctl/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// deployHookPreTraffic runs once the new machines are up, see
+	// deployMachinesApp for when exactly
+	deployHookPreTraffic = "pre_traffic"
+	// deployHookPostDeploy runs once all the machines are updated
+	deployHookPostDeploy = "post_deploy"
+)
+
+// deployHook is a command run at some point of a deployment, either locally
+// by flyctl or in an ephemeral machine of the app, or both.
+type deployHook struct {
+	name         string
+	command      string
+	localCommand string
+}
+
+func (md *machineDeployment) deployHook(name string) deployHook {
+	hook := deployHook{name: name}
+	d := md.appConfig.Deploy
+	if d == nil {
+		return hook
+	}
+	switch name {
+	case deployHookPreTraffic:
+		hook.command, hook.localCommand = d.PreTrafficCommand, d.PreTrafficLocalCommand
+	case deployHookPostDeploy:
+		hook.command, hook.localCommand = d.PostDeployCommand, d.PostDeployLocalCommand
+	}
+	return hook
+}
+
+// runDeployHook runs the local command of the hook first and then the one in a
+// machine. Failures are handled according to the hook failure policy.
+func (md *machineDeployment) runDeployHook(ctx context.Context, name string) (err error) {
+	hook := md.deployHook(name)
+	if hook.command == "" && hook.localCommand == "" {
+		return nil
+	}
+
+	ctx, span := tracing.GetTracer().Start(ctx, "run_deploy_hook", trace.WithAttributes(
+		attribute.String("hook", name),
+		attribute.String("failure_policy", md.hookFailurePolicy),
+	))
+	defer func() {
+		if err != nil {
+			tracing.RecordError(span, err, "failed to run deploy hook")
+		}
+		span.End()
+	}()
+
+	if hook.localCommand != "" {
+		if err := md.runLocalDeployHook(ctx, hook); err != nil {
+			return md.handleDeployHookFailure(ctx, hook, err)
+		}
+	}
+	if hook.command != "" {
+		if err := md.runDeployHookMachine(ctx, hook); err != nil {
+			return md.handleDeployHookFailure(ctx, hook, err)
+		}
+	}
+	return nil
+}
+
+// runLocalDeployHook runs the local command of the hook next to fly.toml,
+// with the details of the deployment in its environment.
+func (md *machineDeployment) runLocalDeployHook(ctx context.Context, hook deployHook) error {
+	label := hook.name + "_local_command"
+	args, err := shlex.Split(hook.localCommand)
+	if err != nil {
+		return fmt.Errorf("error splitting %s: %w", label, err)
+	}
+	if len(args) == 0 {
+		return nil
+	}
+
+	fmt.Fprintf(md.io.ErrOut, "Running %s %s: %s\n", md.colorize.Bold(md.app.Name), label, hook.localCommand)
+
+	ctx, cancel := context.WithTimeout(ctx, md.releaseCmdTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Stdout = md.io.ErrOut
+	cmd.Stderr = md.io.ErrOut
+	cmd.Env = append(os.Environ(),
+		"FLY_APP_NAME="+md.app.Name,
+		"FLY_IMAGE_REF="+md.img,
+		"FLY_RELEASE_VERSION="+strconv.Itoa(md.releaseVersion),
+		"FLY_DEPLOY_HOOK="+hook.name,
+	)
+	if path := md.appConfig.ConfigFilePath(); path != "" {
+		cmd.Dir = filepath.Dir(path)
+	}
+
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return fmt.Errorf("%s timed out after %s, you can increase the timeout with the --release-command-timeout flag", label, md.releaseCmdTimeout)
+		}
+		return fmt.Errorf("error running %s: %w", label, err)
+	}
+	return nil
+}
+
+// runDeployHookMachine runs the command of the hook the same way as the
+// release command, except that a new machine is launched every time.
+func (md *machineDeployment) runDeployHookMachine(ctx context.Context, hook deployHook) (err error) {
+	label := hook.name + "_command"
+	fmt.Fprintf(md.io.ErrOut, "Running %s %s: %s\n", md.colorize.Bold(md.app.Name), label, hook.command)
+
+	ctx, loggerCleanup := statuslogger.SingleLine(ctx, true)
+	defer func() {
+		if err != nil {
+			statuslogger.Failed(ctx, err)
+		}
+		loggerCleanup(false)
+	}()
+
+	launchInput, err := md.launchInputForDeployHook(hook)
+	if err != nil {
+		return err
+	}
+	m, err := md.flapsClient.Launch(ctx, *launchInput)
+	if err != nil {
+		return fmt.Errorf("error creating a %s machine: %w", label, err)
+	}
+	statuslogger.Logf(ctx, "Created %s machine %s", label, md.colorize.Bold(m.ID))
+
+	lm := machine.NewLeasableMachine(md.flapsClient, md.io, m)
+	if err := md.waitForEphemeralMachineToFinish(ctx, lm, label); err != nil {
+		return err
+	}
+	lastExitEvent, err := lm.WaitForEventTypeAfterType(ctx, "exit", "start", md.releaseCmdTimeout, true)
+	if err != nil {
+		return fmt.Errorf("error finding the %s machine %s exit event: %w", label, m.ID, err)
+	}
+	exitCode, err := lastExitEvent.Request.GetExitCode()
+	if err != nil {
+		return fmt.Errorf("error get %s machine %s exit code: %w", label, m.ID, err)
+	}
+
+	if exitCode != 0 {
+		statuslogger.LogfStatus(ctx, statuslogger.StatusFailure, "%s failed", label)
+		// Preemptive cleanup of the logger so that the logs have a clean place to write to
+		loggerCleanup(false)
+
+		time.Sleep(2 * time.Second) // Wait 2 secs to be sure logs have reached OpenSearch
+		fmt.Fprintf(md.io.ErrOut, "Error %s failed running on machine %s with exit code %s.\n",
+			label, md.colorize.Bold(m.ID), md.colorize.Red(strconv.Itoa(exitCode)))
+		if err := md.showEphemeralMachineLogs(ctx, m.ID, label); err != nil {
+			return err
+		}
+		return fmt.Errorf("error %s machine %s exited with non-zero status of %d", label, m.ID, exitCode)
+	}
+	statuslogger.LogfStatus(ctx,
+		statuslogger.StatusSuccess,
+		"%s %s completed successfully",
+		label,
+		md.colorize.Bold(m.ID),
+	)
+	return nil
+}
+
+func (md *machineDeployment) launchInputForDeployHook(hook deployHook) (*fly.LaunchMachineInput, error) {
+	mConfig, err := md.appConfig.ToDeployHookMachineConfig(hook.name, hook.command)
+	if err != nil {
+		return nil, err
+	}
+	md.setEphemeralMachineConfig(mConfig)
+
+	return &fly.LaunchMachineInput{
+		Config: mConfig,
+		Region: md.appConfig.PrimaryRegion,
+	}, nil
+}
+
+// handleDeployHookFailure applies the hook failure policy to err: ignore it,
+// abort the deployment or also roll back the machines updated so far and
+// destroy the ones launched for new process groups.
+func (md *machineDeployment) handleDeployHookFailure(ctx context.Context, hook deployHook, err error) error {
+	switch md.hookFailurePolicy {
+	case appconfig.HookFailurePolicyIgnore:
+		fmt.Fprintf(md.io.ErrOut, "%s hook failed, continuing as hook_failure_policy is %s: %s\n",
+			hook.name, md.colorize.Bold(md.hookFailurePolicy), err)
+		return nil
+	case appconfig.HookFailurePolicyRollback:
+		reverts := md.updatedMachines.list()
+		if len(reverts) == 0 && len(md.newGroupMachines) == 0 {
+			break
+		}
+		fmt.Fprintf(md.io.ErrOut, "%s hook failed: %s\n", hook.name, err)
+		rolledBack := false
+		if len(reverts) > 0 {
+			fmt.Fprintf(md.io.ErrOut, "\nRolling back %d updated machine(s) to their previous config\n", len(reverts))
+			report := md.revertMachines(ctx, reverts)
+			report.render(md.io.ErrOut, md.colorize)
+			rolledBack = len(report.Reverted) > 0
+			if len(report.Failed) > 0 {
+				fmt.Fprintf(md.io.ErrOut, "\n%d machine(s) could not be rolled back and still run the new config\n", len(report.Failed))
+			}
+		}
+		if len(md.newGroupMachines) > 0 {
+			fmt.Fprintf(md.io.ErrOut, "\nDestroying %d machine(s) launched for new process groups\n", len(md.newGroupMachines))
+			for _, lm := range md.newGroupMachines {
+				if err := machcmd.Destroy(ctx, md.app, lm.Machine(), true); err != nil {
+					fmt.Fprintf(md.io.ErrOut, "  Machine %s could not be destroyed: %s\n", md.colorize.Bold(lm.FormattedMachineId()), err)
+					continue
+				}
+				rolledBack = true
+			}
+		}
+		if rolledBack {
+			md.notifyRolledBack(ctx, err)
+		}
+	}
+	return fmt.Errorf("%s hook failed - aborting deployment. %w", hook.name, err)
+}
@@ -0,0 +1,125 @@
+package deploy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	fly "github.com/superfly/fly-go"
+	"github.com/superfly/fly-go/flaps"
+	"github.com/superfly/flyctl/internal/appconfig"
+	"github.com/superfly/flyctl/internal/deploynotify"
+	"github.com/superfly/flyctl/internal/machine"
+	"github.com/superfly/flyctl/iostreams"
+)
+
+func Test_launchInputForDeployHook(t *testing.T) {
+	md, err := stabMachineDeployment(&appconfig.Config{
+		AppName:       "my-cool-app",
+		PrimaryRegion: "scl",
+		Deploy: &appconfig.Deploy{
+			PreTrafficCommand:      "notify --traffic",
+			PostDeployLocalCommand: "./smoke.sh",
+		},
+	})
+	require.NoError(t, err)
+
+	hook := md.deployHook(deployHookPreTraffic)
+	assert.Equal(t, deployHook{name: "pre_traffic", command: "notify --traffic"}, hook)
+	assert.Equal(t, deployHook{name: "post_deploy", localCommand: "./smoke.sh"}, md.deployHook(deployHookPostDeploy))
+
+	li, err := md.launchInputForDeployHook(hook)
+	require.NoError(t, err)
+	assert.Equal(t, "scl", li.Region)
+	assert.Equal(t, "super/balloon", li.Config.Image)
+	assert.Equal(t, []string{"notify", "--traffic"}, li.Config.Init.Cmd)
+	assert.Equal(t, "pre_traffic", li.Config.Env["FLY_DEPLOY_HOOK"])
+	assert.Equal(t, machine.DeployHookProcessGroup, li.Config.ProcessGroup())
+	assert.True(t, li.Config.AutoDestroy)
+}
+
+func Test_handleDeployHookFailure(t *testing.T) {
+	ios, _, _, errOut := iostreams.Test()
+	md := &machineDeployment{
+		io:              ios,
+		colorize:        ios.ColorScheme(),
+		updatedMachines: &updatedMachines{},
+	}
+	hook := deployHook{name: deployHookPostDeploy}
+	hookErr := errors.New("boom")
+
+	md.hookFailurePolicy = appconfig.HookFailurePolicyIgnore
+	assert.NoError(t, md.handleDeployHookFailure(context.Background(), hook, hookErr))
+	assert.Contains(t, errOut.String(), "post_deploy hook failed, continuing")
+
+	for _, policy := range []string{appconfig.HookFailurePolicyAbort, appconfig.HookFailurePolicyRollback} {
+		md.hookFailurePolicy = policy
+		err := md.handleDeployHookFailure(context.Background(), hook, hookErr)
+		assert.ErrorIs(t, err, hookErr)
+		assert.ErrorContains(t, err, "post_deploy hook failed - aborting deployment")
+	}
+}
+
+func Test_handleDeployHookFailure_DestroysNewGroupMachines(t *testing.T) {
+	md, emulator := emulatedMachineDeployment(t, &appconfig.Config{AppName: "my-cool-app"})
+	md.app = &fly.AppCompact{Name: "my-cool-app"}
+	md.colorize = md.io.ColorScheme()
+	md.updatedMachines = &updatedMachines{}
+	md.hookFailurePolicy = appconfig.HookFailurePolicyRollback
+
+	existing := emulator.AddMachine("my-cool-app", flyLaunchMachine("fra", "app"))
+	launched := emulator.AddMachine("my-cool-app", flyLaunchMachine("fra", "worker"))
+	md.newGroupMachines = []machine.LeasableMachine{machine.NewLeasableMachine(md.flapsClient, md.io, launched)}
+
+	var stages []string
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var p deploynotify.Payload
+		_ = json.NewDecoder(r.Body).Decode(&p)
+		stages = append(stages, p.Stage)
+	}))
+	t.Cleanup(webhook.Close)
+	notifier, err := deploynotify.New(nil, []string{webhook.URL}, deploynotify.Payload{App: "my-cool-app"}, io.Discard)
+	require.NoError(t, err)
+
+	ctx := iostreams.NewContext(context.Background(), md.io)
+	ctx = flaps.NewContext(ctx, md.flapsClient)
+	ctx = deploynotify.NewContext(ctx, notifier)
+	err = md.handleDeployHookFailure(ctx, deployHook{name: deployHookPreTraffic}, errors.New("boom"))
+	assert.ErrorContains(t, err, "pre_traffic hook failed - aborting deployment")
+
+	active := lo.Filter(emulator.Machines("my-cool-app"), func(m *fly.Machine, _ int) bool { return m.IsActive() })
+	assert.Equal(t, []string{existing.ID}, lo.Map(active, func(m *fly.Machine, _ int) string { return m.ID }))
+	assert.Equal(t, []string{appconfig.DeployNotifyRolledBack}, stages)
+}
+
+func Test_runLocalDeployHook(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("local hooks are tested with sh")
+	}
+
+	ios, _, _, errOut := iostreams.Test()
+	md := &machineDeployment{
+		io:                ios,
+		colorize:          ios.ColorScheme(),
+		app:               &fly.AppCompact{Name: "my-cool-app"},
+		appConfig:         &appconfig.Config{},
+		img:               "super/balloon",
+		releaseCmdTimeout: time.Minute,
+	}
+
+	hook := deployHook{name: deployHookPreTraffic, localCommand: `sh -c 'echo $FLY_APP_NAME $FLY_IMAGE_REF $FLY_DEPLOY_HOOK'`}
+	require.NoError(t, md.runLocalDeployHook(context.Background(), hook))
+	assert.Contains(t, errOut.String(), "my-cool-app super/balloon pre_traffic\n")
+
+	hook.localCommand = "sh -c 'exit 3'"
+	assert.ErrorContains(t, md.runLocalDeployHook(context.Background(), hook), "error running pre_traffic_local_command: exit status 3")
+}
@@ -19,7 +19,10 @@ import (
 	fly "github.com/superfly/fly-go"
 	"github.com/superfly/fly-go/flaps"
 	"github.com/superfly/flyctl/helpers"
+	"github.com/superfly/flyctl/internal/appconfig"
 	machcmd "github.com/superfly/flyctl/internal/command/machine"
+	"github.com/superfly/flyctl/internal/deployevents"
+	"github.com/superfly/flyctl/internal/deploynotify"
 	"github.com/superfly/flyctl/internal/flyerr"
 	"github.com/superfly/flyctl/internal/machine"
 	"github.com/superfly/flyctl/internal/statuslogger"
@@ -49,6 +52,11 @@ func (md *machineDeployment) DeployMachinesApp(ctx context.Context) error {
 		tracing.RecordError(span, err, "failed to update release")
 		return fmt.Errorf("failed to set release status to 'running': %w", err)
 	}
+	deploynotify.Notify(ctx, deploynotify.Payload{
+		Stage:   appconfig.DeployNotifyStarted,
+		Version: md.releaseVersion,
+		Image:   md.img,
+	})
 
 	var err error
 	if md.restartOnly {
@@ -61,6 +69,9 @@ func (md *machineDeployment) DeployMachinesApp(ctx context.Context) error {
 	switch {
 	case err == nil:
 		status = "complete"
+		if rmErr := md.clearProgress(); rmErr != nil {
+			terminal.Warnf("failed to remove deployment progress: %v\n", rmErr)
+		}
 	case errors.Is(err, context.Canceled):
 		// Provide an extra second to try to update the release status.
 		status = "interrupted"
@@ -78,6 +89,19 @@ func (md *machineDeployment) DeployMachinesApp(ctx context.Context) error {
 			terminal.Warnf("failed to set final release status after deployment failure: %v\n", updateErr)
 		}
 	}
+	deployevents.Emit(ctx, deployevents.Event{
+		Type:    deployevents.DeployFinished,
+		Image:   md.img,
+		Version: md.releaseVersion,
+		Status:  status,
+		Error:   deployevents.ErrorString(err),
+	})
+	deploynotify.Notify(ctx, deploynotify.Payload{
+		Stage:   lo.Ternary(err == nil, appconfig.DeployNotifySucceeded, appconfig.DeployNotifyFailed),
+		Version: md.releaseVersion,
+		Image:   md.img,
+		Error:   deployevents.ErrorString(err),
+	})
 
 	if !md.skipDNSChecks {
 		if err := md.checkDNS(ctx); err != nil {
@@ -87,6 +111,9 @@ func (md *machineDeployment) DeployMachinesApp(ctx context.Context) error {
 
 	if err != nil {
 		tracing.RecordError(span, err, "failed to deploy machines")
+		if md.progress != nil && len(md.progress.Pending) > 0 {
+			fmt.Fprintf(md.io.ErrOut, "Run 'fly deploy --resume' to continue with the %d machine(s) left to update\n", len(md.progress.Pending))
+		}
 	}
 	return err
 }
@@ -110,66 +137,6 @@ func (md *machineDeployment) restartMachinesApp(ctx context.Context) error {
 	return md.updateExistingMachines(ctx, machineUpdateEntries)
 }
 
-func (md *machineDeployment) inferCanaryGuest(name string) *fly.MachineGuest {
-	canaryGuest := md.machineGuest
-	for _, lm := range md.machineSet.GetMachines() {
-		machine := lm.Machine()
-		machineGuest := machine.Config.Guest
-		switch {
-		case machine.ProcessGroup() != name:
-			continue
-		case machineGuest == nil: // shouldn't be possible but just in case
-			continue
-		case machineGuest.CPUKind != canaryGuest.CPUKind,
-			machineGuest.CPUs != canaryGuest.CPUs,
-			machineGuest.MemoryMB != canaryGuest.MemoryMB:
-			return machineGuest
-		}
-	}
-
-	return canaryGuest
-}
-
-func (md *machineDeployment) deployCanaryMachines(ctx context.Context) (err error) {
-	ctx, span := tracing.GetTracer().Start(ctx, "deploy_canary")
-	defer span.End()
-
-	canaryMachines := []machine.LeasableMachine{}
-	groupsInConfig := md.ProcessNames()
-	total := len(groupsInConfig)
-	sl := statuslogger.Create(ctx, total, true)
-	defer sl.Destroy(false)
-
-	for idx, name := range groupsInConfig {
-		ctx := statuslogger.NewContext(ctx, sl.Line(idx))
-		statuslogger.LogfStatus(ctx,
-			statuslogger.StatusRunning,
-			"Creating canary machine for group %s",
-			md.colorize.Bold(name),
-		)
-		machine, err := md.spawnMachineInGroup(ctx, name, nil,
-			withMeta(metadata{key: "fly_canary", value: "true"}),
-			withGuest(md.inferCanaryGuest(name)),
-			withDns(&fly.DNSConfig{SkipRegistration: true}),
-		)
-		if err != nil {
-			tracing.RecordError(span, err, "failed to provision canary machine")
-			firstLine, _, _ := strings.Cut(err.Error(), "\n")
-			statuslogger.LogfStatus(ctx, statuslogger.StatusFailure, "Failed to create canary machine: %s", firstLine)
-			return err
-		}
-		canaryMachines = append(canaryMachines, machine)
-	}
-
-	fmt.Fprintf(md.io.Out, "Canary machines successfully created and healthy, destroying before continuing\n")
-	for _, mach := range canaryMachines {
-		if err := machcmd.Destroy(ctx, md.app, mach.Machine(), true); err != nil {
-			return err
-		}
-	}
-	return nil
-}
-
 // Create machines for new process groups
 func (md *machineDeployment) deployCreateMachinesForGroups(ctx context.Context, processGroupMachineDiff ProcessGroupsDiff) (err error) {
 	groupsWithAutostopEnabled := make(map[string]bool)
@@ -177,6 +144,10 @@ func (md *machineDeployment) deployCreateMachinesForGroups(ctx context.Context,
 	total := len(groups)
 	slices.Sort(groups)
 
+	if total > 0 && len(md.waves) > 0 {
+		fmt.Fprintf(md.io.ErrOut, "Launching the machines of new process groups in %s before the deploy waves\n", md.appConfig.PrimaryRegion)
+	}
+
 	sl := statuslogger.Create(ctx, total, true)
 	defer sl.Destroy(false)
 
@@ -189,6 +160,7 @@ func (md *machineDeployment) deployCreateMachinesForGroups(ctx context.Context,
 			statuslogger.Failed(ctx, err)
 			return err
 		}
+		md.newGroupMachines = append(md.newGroupMachines, leasableMachine)
 
 		groupConfig, err := md.appConfig.Flatten(name)
 		if err != nil {
@@ -219,17 +191,21 @@ func (md *machineDeployment) deployCreateMachinesForGroups(ctx context.Context,
 			continue
 		case len(services) > 0:
 			fmt.Fprintf(md.io.Out, "Creating a second machine to increase service availability\n")
-			if _, err := md.spawnMachineInGroup(ctx, name, nil); err != nil {
+			lm, err := md.spawnMachineInGroup(ctx, name, nil)
+			if err != nil {
 				statuslogger.Failed(ctx, err)
 				return err
 			}
+			md.newGroupMachines = append(md.newGroupMachines, lm)
 		default:
 			fmt.Fprintf(md.io.Out, "Creating a standby machine for %s\n", md.colorize.Bold(leasableMachine.Machine().ID))
 			standbyFor := []string{leasableMachine.Machine().ID}
-			if _, err := md.spawnMachineInGroup(ctx, name, standbyFor); err != nil {
+			lm, err := md.spawnMachineInGroup(ctx, name, standbyFor)
+			if err != nil {
 				statuslogger.Failed(ctx, err)
 				return err
 			}
+			md.newGroupMachines = append(md.newGroupMachines, lm)
 		}
 	}
 
@@ -253,12 +229,26 @@ func (md *machineDeployment) deployCreateMachinesForGroups(ctx context.Context,
 //   - Run release command
 //   - Remove spare machines from removed groups
 //   - Launch new machines on new groups
+//   - Run pre_traffic hooks, except with bluegreen
 //   - Update existing machines
+//   - Run post_deploy hooks
+//
+// The bluegreen strategy runs the pre_traffic hooks once the green machines
+// are healthy, before they are marked as ready for traffic. The other
+// strategies update machines in place, which take traffic as soon as they
+// start, so the hooks run once the machines of new groups are up and before
+// any existing machine is updated.
 func (md *machineDeployment) deployMachinesApp(ctx context.Context) error {
 	ctx, span := tracing.GetTracer().Start(ctx, "deploy_new_machines")
 	defer span.End()
 
-	if err := md.runReleaseCommand(ctx); err != nil {
+	if md.resume != nil {
+		// The interrupted deployment ran the release command before updating any machine
+		fmt.Fprintf(md.io.ErrOut, "Resuming the deployment started at %s, skipping the release command\n", md.resume.StartedAt.Format(time.RFC3339))
+		if err := md.skipUpToDateMachines(ctx); err != nil {
+			return err
+		}
+	} else if err := md.runReleaseCommand(ctx); err != nil {
 		return fmt.Errorf("release command failed - aborting deployment. %w", err)
 	}
 
@@ -271,12 +261,6 @@ func (md *machineDeployment) deployMachinesApp(ctx context.Context) error {
 	processGroupMachineDiff := md.resolveProcessGroupChanges()
 	md.warnAboutProcessGroupChanges(ctx, processGroupMachineDiff)
 
-	if md.strategy == "canary" && !md.isFirstDeploy {
-		if err := md.deployCanaryMachines(ctx); err != nil {
-			return err
-		}
-	}
-
 	// Destroy machines that don't fit the current process groups
 	if err := md.machineSet.RemoveMachines(ctx, processGroupMachineDiff.machinesToRemove); err != nil {
 		return err
@@ -302,7 +286,15 @@ func (md *machineDeployment) deployMachinesApp(ctx context.Context) error {
 		machineUpdateEntries = append(machineUpdateEntries, &machineUpdateEntry{leasableMachine: lm, launchInput: li})
 	}
 
-	return md.updateExistingMachines(ctx, machineUpdateEntries)
+	if md.strategy != "bluegreen" || len(machineUpdateEntries) == 0 {
+		if err := md.runDeployHook(ctx, deployHookPreTraffic); err != nil {
+			return err
+		}
+	}
+	if err := md.updateExistingMachines(ctx, machineUpdateEntries); err != nil {
+		return err
+	}
+	return md.runDeployHook(ctx, deployHookPostDeploy)
 }
 
 type machineUpdateEntry struct {
@@ -377,18 +369,35 @@ func suggestChangeWaitTimeout(err error, flagName string) error {
 	return err
 }
 
-func (md *machineDeployment) waitForMachine(ctx context.Context, e *machineUpdateEntry) error {
+func emitMachineEvent(ctx context.Context, eventType string, lm machine.LeasableMachine, err error) {
+	m := lm.Machine()
+	deployevents.Emit(ctx, deployevents.Event{
+		Type:      eventType,
+		MachineID: m.ID,
+		Region:    m.Region,
+		Error:     deployevents.ErrorString(err),
+	})
+}
+
+func (md *machineDeployment) waitForMachine(ctx context.Context, e *machineUpdateEntry) (err error) {
 	lm := e.leasableMachine
 	// Don't wait for SkipLaunch machines, they are updated but not started
 	if e.launchInput.SkipLaunch {
 		return nil
 	}
 
+	defer func() {
+		if err != nil {
+			emitMachineEvent(ctx, deployevents.MachineFailed, lm, err)
+		}
+	}()
+
 	if !md.skipHealthChecks {
 		if err := lm.WaitForState(ctx, fly.MachineStateStarted, md.waitTimeout, false); err != nil {
 			err = suggestChangeWaitTimeout(err, "wait-timeout")
 			return err
 		}
+		emitMachineEvent(ctx, deployevents.MachineStarted, lm, nil)
 	}
 
 	if err := md.doSmokeChecks(ctx, lm); err != nil {
@@ -402,6 +411,7 @@ func (md *machineDeployment) waitForMachine(ctx context.Context, e *machineUpdat
 			err = suggestChangeWaitTimeout(err, "wait-timeout")
 			return err
 		}
+		emitMachineEvent(ctx, deployevents.MachineHealthy, lm, nil)
 	}
 
 	md.warnAboutIncorrectListenAddress(ctx, lm)
@@ -423,17 +433,26 @@ func (md *machineDeployment) updateExistingMachines(ctx context.Context, updateE
 		return nil
 	}
 
+	if err := md.trackProgress(updateEntries); err != nil {
+		return err
+	}
+
 	fmt.Fprintf(md.io.Out, "Updating existing machines in '%s' with %s strategy\n", md.colorize.Bold(md.app.Name), md.strategy)
 
 	switch md.strategy {
 	case "bluegreen":
 		return md.updateUsingBlueGreenStrategy(ctx, updateEntries)
 	case "immediate":
-		return md.updateUsingImmediateStrategy(ctx, updateEntries)
-	case "canary", "rolling":
+		return md.rollbackOnError(ctx, md.verifyUpdated(ctx, updateEntries, md.updateUsingImmediateStrategy(ctx, updateEntries)))
+	case "canary":
+		return md.updateUsingCanaryStrategy(ctx, updateEntries)
+	case "rolling":
 		fallthrough
 	default:
-		return md.updateUsingRollingStrategy(ctx, updateEntries)
+		if len(md.waves) > 0 {
+			return md.rollbackOnError(ctx, md.updateUsingWaves(ctx, updateEntries))
+		}
+		return md.rollbackOnError(ctx, md.verifyUpdated(ctx, updateEntries, md.updateUsingRollingStrategy(ctx, updateEntries)))
 	}
 }
 
@@ -445,6 +464,26 @@ func (md *machineDeployment) updateUsingBlueGreenStrategy(ctx context.Context, u
 			fmt.Fprintf(md.io.ErrOut, "Error in rollback: %s\n", rollbackErr)
 			return rollbackErr
 		}
+		md.notifyRolledBack(ctx, err)
+		return suggestChangeWaitTimeout(err, "wait-timeout")
+	}
+	return nil
+}
+
+func (md *machineDeployment) updateUsingCanaryStrategy(ctx context.Context, updateEntries []*machineUpdateEntry) error {
+	c := CanaryStrategy(md, updateEntries)
+	if err := c.Deploy(ctx); err != nil {
+		if c.promoted {
+			// Canaries baked fine, the other machines are only rolled back with
+			// --auto-rollback or when they fail verify probes
+			return md.rollbackOnError(ctx, err)
+		}
+		fmt.Fprintf(md.io.ErrOut, "Deployment failed after error: %s\n", err)
+		if rollbackErr := c.Rollback(ctx, err); rollbackErr != nil {
+			fmt.Fprintf(md.io.ErrOut, "Error in rollback: %s\n", rollbackErr)
+			return rollbackErr
+		}
+		md.notifyRolledBack(ctx, err)
 		return suggestChangeWaitTimeout(err, "wait-timeout")
 	}
 	return nil
@@ -502,11 +541,13 @@ func (md *machineDeployment) updateUsingImmediateStrategy(parentCtx context.Cont
 
 		updatesPool.Go(func(_ context.Context) error {
 			statusRunning()
+			revert := newMachineRevert(e)
 			if err := md.updateMachine(eCtx, e); err != nil {
 				tracing.RecordError(span, err, "failed to update machine")
 				statusFailure(err)
 				return err
 			}
+			md.updatedMachines.add(revert)
 			statusSuccess()
 			return nil
 		})
@@ -638,11 +679,13 @@ func (md *machineDeployment) updateEntriesGroup(parentCtx context.Context, group
 				statusRunning()
 			}
 
+			revert := newMachineRevert(e)
 			if err := md.updateMachine(ctx, e); err != nil {
 				statusFailure(err)
 				tracing.RecordError(span, err, "failed to update machine")
 				return err
 			}
+			md.updatedMachines.add(revert)
 			if err := md.waitForMachine(ctx, e); err != nil {
 				tracing.RecordError(span, err, "failed to wait for machine")
 				statusFailure(err)
@@ -666,13 +709,23 @@ func (md *machineDeployment) updateEntriesGroup(parentCtx context.Context, group
 	return updatePool.Wait()
 }
 
-func (md *machineDeployment) updateMachine(ctx context.Context, e *machineUpdateEntry) error {
+func (md *machineDeployment) updateMachine(ctx context.Context, e *machineUpdateEntry) (err error) {
 	ctx, span := tracing.GetTracer().Start(ctx, "update_machine", trace.WithAttributes(
 		attribute.String("id", e.launchInput.ID),
 		attribute.Bool("requires_replacement", e.launchInput.RequiresReplacement),
 	))
 	defer span.End()
 
+	defer func() {
+		// e.leasableMachine is the new machine when it was replaced
+		emitMachineEvent(ctx, lo.Ternary(err != nil, deployevents.MachineFailed, deployevents.MachineUpdated), e.leasableMachine, err)
+		if err == nil {
+			if saveErr := md.progress.markDone(e.launchInput.ID); saveErr != nil {
+				terminal.Warnf("failed to save deployment progress: %v\n", saveErr)
+			}
+		}
+	}()
+
 	fmtID := e.leasableMachine.FormattedMachineId()
 
 	replaceMachine := func() error {
@@ -735,59 +788,12 @@ func (md *machineDeployment) updateMachineInPlace(ctx context.Context, e *machin
 	return lm.Update(ctx, *e.launchInput)
 }
 
-type spawnOptions struct {
-	meta  []metadata
-	guest *fly.MachineGuest
-	dns   *fly.DNSConfig
-}
-
-type spawnOptionsFn func(*spawnOptions)
-
-func withMeta(m metadata) spawnOptionsFn {
-	return func(o *spawnOptions) {
-		o.meta = append(o.meta, m)
-	}
-}
-
-func withGuest(guest *fly.MachineGuest) spawnOptionsFn {
-	return func(o *spawnOptions) {
-		o.guest = guest
-	}
-}
-
-func withDns(dns *fly.DNSConfig) spawnOptionsFn {
-	return func(o *spawnOptions) {
-		o.dns = dns
-	}
-}
-
-type metadata struct {
-	key   string
-	value string
-}
-
-func (md *machineDeployment) spawnMachineInGroup(ctx context.Context, groupName string, standbyFor []string, opts ...spawnOptionsFn) (machine.LeasableMachine, error) {
-	options := spawnOptions{
-		meta:  []metadata{},
-		guest: md.machineGuest,
-	}
-	for _, opt := range opts {
-		opt(&options)
-	}
-
-	launchInput, err := md.launchInputForLaunch(groupName, options.guest, standbyFor)
+func (md *machineDeployment) spawnMachineInGroup(ctx context.Context, groupName string, standbyFor []string) (machine.LeasableMachine, error) {
+	launchInput, err := md.launchInputForLaunch(groupName, md.machineGuest, standbyFor)
 	if err != nil {
 		return nil, fmt.Errorf("error creating machine configuration: %w", err)
 	}
 
-	for _, m := range options.meta {
-		launchInput.Config.Metadata[m.key] = m.value
-	}
-
-	if options.dns != nil {
-		launchInput.Config.DNS = options.dns
-	}
-
 	// Acquire a lease on the new machine to ensure external factors can't stop or update it
 	// while we wait for its state and/or health checks
 	launchInput.LeaseTTL = int(md.waitTimeout.Seconds())
@@ -866,6 +872,11 @@ func (md *machineDeployment) resolveProcessGroupChanges() ProcessGroupsDiff {
 		}
 	}
 
+	// Machines skipped by --resume still count for their group
+	for _, m := range md.upToDateMachines {
+		groupHasMachine[m.ProcessGroup()] = true
+	}
+
 	for _, name := range groupsInConfig {
 		if ok := groupHasMachine[name]; !ok {
 			output.groupsNeedingMachines[name] = true
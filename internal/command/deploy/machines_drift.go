@@ -0,0 +1,39 @@
+package deploy
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/logrusorgru/aurora"
+	"github.com/samber/lo"
+	fly "github.com/superfly/fly-go"
+	"github.com/superfly/flyctl/internal/appconfig"
+	"github.com/superfly/flyctl/internal/machine"
+	"github.com/superfly/flyctl/terminal"
+)
+
+// warnAboutDrift lets the user know when running machines were changed after
+// the latest release, as deploying reverts those changes.
+// Failing to compare configs must not fail the deploy.
+func (md *machineDeployment) warnAboutDrift(ctx context.Context) {
+	if md.machineSet.IsEmpty() {
+		return
+	}
+
+	machines := lo.Map(md.machineSet.GetMachines(), func(lm machine.LeasableMachine, _ int) *fly.Machine {
+		return lm.Machine()
+	})
+	drifts, err := appconfig.DetectDrift(ctx, md.app.Name, md.appConfig, machines)
+	if err != nil {
+		terminal.Debugf("failed to check machines for config drift: %v\n", err)
+		return
+	}
+
+	for _, drift := range drifts {
+		if !drift.HasMachineDrift() {
+			continue
+		}
+		fmt.Fprintf(md.io.ErrOut, "%s Machines in process group '%s' were changed since the latest release. This deploy will revert:\n%s\n\n",
+			aurora.Yellow("[WARNING]"), drift.Group, drift.ReleaseToMachines)
+	}
+}
@@ -0,0 +1,86 @@
+package deploy
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	fly "github.com/superfly/fly-go"
+	"github.com/superfly/flyctl/internal/appconfig"
+	"github.com/superfly/flyctl/internal/flapsemulator"
+	"github.com/superfly/flyctl/iostreams"
+)
+
+// emulatedMachineDeployment returns a deployment whose flaps client talks to
+// a local Machines API emulator.
+func emulatedMachineDeployment(t *testing.T, appConfig *appconfig.Config) (*machineDeployment, *flapsemulator.Server) {
+	t.Helper()
+
+	emulator, flapsClient := flapsemulator.NewTestClient(t, appConfig.AppName)
+
+	md, err := stabMachineDeployment(appConfig)
+	require.NoError(t, err)
+	md.io, _, _, _ = iostreams.Test()
+	md.flapsClient = flapsClient
+	return md, emulator
+}
+
+func flyLaunchMachine(region, processGroup string) *fly.Machine {
+	return &fly.Machine{
+		Region: region,
+		Config: &fly.MachineConfig{
+			Image: "registry.fly.io/my-cool-app:deployment-1",
+			Metadata: map[string]string{
+				fly.MachineConfigMetadataKeyFlyPlatformVersion: fly.MachineFlyPlatformVersion2,
+				fly.MachineConfigMetadataKeyFlyProcessGroup:    processGroup,
+			},
+		},
+	}
+}
+
+func Test_setMachinesForDeployment_Emulated(t *testing.T) {
+	ctx := context.Background()
+	md, emulator := emulatedMachineDeployment(t, &appconfig.Config{AppName: "my-cool-app"})
+
+	web := emulator.AddMachine("my-cool-app", flyLaunchMachine("fra", "app"))
+	emulator.AddMachine("my-cool-app", flyLaunchMachine("ams", "app"))
+	emulator.AddMachine("my-cool-app", flyLaunchMachine("fra", "worker"))
+	emulator.AddMachine("my-cool-app", &fly.Machine{Config: &fly.MachineConfig{Image: "nginx"}})
+
+	md.onlyRegions = map[string]interface{}{"fra": nil}
+	md.processGroups = map[string]interface{}{"app": nil}
+	require.NoError(t, md.setMachinesForDeployment(ctx))
+
+	machines := md.machineSet.GetMachines()
+	require.Len(t, machines, 1)
+	assert.Equal(t, web.ID, machines[0].Machine().ID)
+	assert.True(t, md.releaseCommandMachine.IsEmpty())
+
+	require.NoError(t, md.machineSet.AcquireLeases(ctx, time.Minute))
+	_, err := md.flapsClient.AcquireLease(ctx, web.ID, nil)
+	assert.ErrorContains(t, err, "lease currently held")
+	require.NoError(t, md.machineSet.ReleaseLeases(ctx))
+	_, err = md.flapsClient.AcquireLease(ctx, web.ID, nil)
+	assert.NoError(t, err)
+}
+
+func Test_setVolumes_Emulated(t *testing.T) {
+	ctx := context.Background()
+	md, emulator := emulatedMachineDeployment(t, &appconfig.Config{
+		AppName: "my-cool-app",
+		Mounts:  []appconfig.Mount{{Source: "data", Destination: "/data"}},
+	})
+
+	m := emulator.AddMachine("my-cool-app", flyLaunchMachine("fra", "app"))
+	attached := emulator.AddVolume("my-cool-app", fly.Volume{Name: "data", Region: "fra", AttachedMachine: lo.ToPtr(m.ID)})
+	free := emulator.AddVolume("my-cool-app", fly.Volume{Name: "data", Region: "ams", SizeGb: 10})
+
+	require.NoError(t, md.setVolumes(ctx))
+	assert.Equal(t, map[string]int{attached.ID: 1, free.ID: 10}, md.volumeSizes)
+	assert.Equal(t, []string{free.ID}, lo.Map(md.volumes["data"], func(v fly.Volume, _ int) string {
+		return v.ID
+	}))
+}
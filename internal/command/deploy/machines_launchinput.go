@@ -7,6 +7,7 @@ import (
 	"github.com/samber/lo"
 	fly "github.com/superfly/fly-go"
 	"github.com/superfly/flyctl/internal/buildinfo"
+	"github.com/superfly/flyctl/internal/command"
 	"github.com/superfly/flyctl/internal/machine"
 	"github.com/superfly/flyctl/terminal"
 )
@@ -95,7 +96,7 @@ func (md *machineDeployment) launchInputForUpdate(origMachineRaw *fly.Machine) (
 		case len(mMounts) == 0:
 			// The mounts section was removed from fly.toml
 			machineShouldBeReplaced = true
-			terminal.Warnf("Machine %s has a volume attached but fly.toml doesn't have a [mounts] section\n", mID)
+			md.warnf("Machine %s has a volume attached but fly.toml doesn't have a [mounts] section\n", mID)
 		case oMounts[0].Name == "":
 			// It's rare but can happen, we don't know the mounted volume name
 			// so can't be sure it matches the mounts defined in fly.toml, in this
@@ -106,7 +107,7 @@ func (md *machineDeployment) launchInputForUpdate(origMachineRaw *fly.Machine) (
 			// As we can't change the volume for a running machine, the only
 			// way is to destroy the current machine and launch a new one with the new volume attached
 			mount0 := &mMounts[0]
-			terminal.Warnf("Machine %s has volume '%s' attached but fly.toml have a different name: '%s'\n", mID, oMounts[0].Name, mount0.Name)
+			md.warnf("Machine %s has volume '%s' attached but fly.toml have a different name: '%s'\n", mID, oMounts[0].Name, mount0.Name)
 			vol := md.popVolumeFor(mount0.Name, origMachineRaw.Region)
 			if vol == nil {
 				return nil, fmt.Errorf("machine in group '%s' needs an unattached volume named '%s' in region '%s'", processGroup, mount0.Name, origMachineRaw.Region)
@@ -115,7 +116,7 @@ func (md *machineDeployment) launchInputForUpdate(origMachineRaw *fly.Machine) (
 			machineShouldBeReplaced = true
 		case mMounts[0].Path != oMounts[0].Path:
 			// The volume is the same but its mount path changed. Not a big deal.
-			terminal.Warnf(
+			md.warnf(
 				"Updating the mount path for volume %s on machine %s from %s to %s due to fly.toml [mounts] destination value\n",
 				oMounts[0].Volume, mID, oMounts[0].Path, mMounts[0].Path,
 			)
@@ -180,6 +181,18 @@ func (md *machineDeployment) setMachineReleaseData(mConfig *fly.MachineConfig) {
 		fly.MachineConfigMetadataKeyFlyctlVersion:     buildinfo.Version().String(),
 	})
 
+	if md.rollbackOf > 0 {
+		mConfig.Metadata[MachineConfigMetadataKeyFlyRollbackOf] = strconv.Itoa(md.rollbackOf)
+	} else {
+		delete(mConfig.Metadata, MachineConfigMetadataKeyFlyRollbackOf)
+	}
+
+	if md.freezeOverride != "" {
+		mConfig.Metadata[command.MachineConfigMetadataKeyFlyFreezeOverride] = md.freezeOverride
+	} else {
+		delete(mConfig.Metadata, command.MachineConfigMetadataKeyFlyFreezeOverride)
+	}
+
 	// These defaults should come from appConfig.ToMachineConfig() and set on launch;
 	// leave them here for the moment becase very old machines may not have them
 	// and we want to set in case of simple app restarts
@@ -217,3 +230,11 @@ func skipLaunch(origMachineRaw *fly.Machine, mConfig *fly.MachineConfig) bool {
 	}
 	return false
 }
+
+// warnf prints a warning about a machine, unless the deployment is quiet
+func (md *machineDeployment) warnf(format string, args ...any) {
+	if md.quiet {
+		return
+	}
+	terminal.Warnf(format, args...)
+}
@@ -393,6 +393,33 @@ func Test_launchInputForUpdate_clearStandbysWithServices(t *testing.T) {
 	assert.Equal(t, 0, len(li.Config.Standbys))
 }
 
+func Test_launchInputForUpdate_rollbackOf(t *testing.T) {
+	md, err := stabMachineDeployment(&appconfig.Config{
+		AppName:       "my-cool-app",
+		PrimaryRegion: "scl",
+	})
+	require.NoError(t, err)
+
+	md.rollbackOf = 12
+	li, err := md.launchInputForUpdate(&fly.Machine{
+		ID:     "ab1234567890",
+		Region: "scl",
+		Config: &fly.MachineConfig{},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "12", li.Config.Metadata[MachineConfigMetadataKeyFlyRollbackOf])
+
+	// The next regular deployment drops it
+	md.rollbackOf = 0
+	li, err = md.launchInputForUpdate(&fly.Machine{
+		ID:     "ab1234567890",
+		Region: "scl",
+		Config: li.Config,
+	})
+	require.NoError(t, err)
+	assert.NotContains(t, li.Config.Metadata, MachineConfigMetadataKeyFlyRollbackOf)
+}
+
 func Test_launchInputForLaunch_Files(t *testing.T) {
 	md, err := stabMachineDeployment(&appconfig.Config{
 		AppName:       "my-files-app",
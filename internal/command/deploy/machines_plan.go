@@ -0,0 +1,347 @@
+package deploy
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/samber/lo"
+	fly "github.com/superfly/fly-go"
+	"github.com/superfly/flyctl/internal/flyerr"
+	"github.com/superfly/flyctl/internal/machine"
+	"github.com/superfly/flyctl/internal/pricing"
+	"github.com/superfly/flyctl/internal/render"
+	"golang.org/x/exp/maps"
+)
+
+const (
+	PlanActionCreate  = "create"
+	PlanActionUpdate  = "update"
+	PlanActionReplace = "replace"
+	PlanActionDestroy = "destroy"
+	// PlanActionSkip is used for machines with no changes besides release metadata
+	PlanActionSkip = "skip"
+)
+
+// Plan is what a deployment would do to the machines of an app.
+type Plan struct {
+	App            string            `json:"app"`
+	Image          string            `json:"image"`
+	ImageToBuild   bool              `json:"image_to_build"`
+	Strategy       string            `json:"strategy"`
+	ReleaseCommand string            `json:"release_command,omitempty"`
+	Machines       []*PlannedMachine `json:"machines"`
+	// Resources is the usage of each process group before and after
+	Resources        []*pricing.Change `json:"resources"`
+	MonthlyCostDelta float64           `json:"monthly_cost_delta"`
+
+	estimate *pricing.Estimate
+}
+
+// PlannedMachine is the action a deployment would take on one machine.
+type PlannedMachine struct {
+	ID           string `json:"id,omitempty"`
+	Action       string `json:"action"`
+	ProcessGroup string `json:"process_group"`
+	Region       string `json:"region"`
+	Volume       string `json:"volume,omitempty"`
+	Standby      bool   `json:"standby,omitempty"`
+	Diff         string `json:"diff,omitempty"`
+
+	guest    *fly.MachineGuest
+	volumeGB int
+}
+
+// Plan computes the same changes as DeployMachinesApp without acquiring
+// leases or touching any machine. It counts on the volumes of a first deploy
+// not being provisioned yet.
+func (md *machineDeployment) Plan(ctx context.Context) (*Plan, error) {
+	plan := &Plan{
+		App:      md.app.Name,
+		Image:    md.img,
+		Strategy: md.strategy,
+	}
+	if md.appConfig.Deploy != nil {
+		plan.ReleaseCommand = md.appConfig.Deploy.ReleaseCommand
+	}
+
+	// Launch inputs take unattached volumes, give them back for the deployment
+	defer func(volumes map[string][]fly.Volume) {
+		md.volumes = volumes
+	}(md.volumes)
+	md.volumes = lo.MapValues(md.volumes, func(vs []fly.Volume, _ string) []fly.Volume { return slices.Clone(vs) })
+
+	// New machines of a first deploy get the volumes provisioned for them
+	seedSizes := map[string]int{}
+	if !md.restartOnly {
+		seeds, err := md.seedVolumes()
+		if err != nil {
+			return nil, err
+		}
+		for _, seed := range seeds {
+			md.volumes[seed.input.Name] = append(md.volumes[seed.input.Name], fly.Volume{
+				Name:   seed.input.Name,
+				Region: seed.input.Region,
+				SizeGb: *seed.input.SizeGb,
+			})
+			seedSizes[seed.input.Name] = *seed.input.SizeGb
+		}
+	}
+
+	processGroupMachineDiff := md.resolveProcessGroupChanges()
+	for _, lm := range processGroupMachineDiff.machinesToRemove {
+		m := lm.Machine()
+		plan.Machines = append(plan.Machines, &PlannedMachine{
+			ID:           m.ID,
+			Action:       PlanActionDestroy,
+			ProcessGroup: m.ProcessGroup(),
+			Region:       m.Region,
+			Volume:       plannedVolume(m.Config),
+		})
+	}
+
+	if !md.updateOnly {
+		created, err := md.planCreateMachinesForGroups(processGroupMachineDiff, seedSizes)
+		if err != nil {
+			return nil, err
+		}
+		plan.Machines = append(plan.Machines, created...)
+	}
+
+	for _, lm := range md.machineSet.GetMachines() {
+		if slices.Contains(processGroupMachineDiff.machinesToRemove, lm) {
+			continue
+		}
+
+		m := lm.Machine()
+		li, err := md.launchInputForUpdate(m)
+		if err != nil {
+			return nil, fmt.Errorf("failed to update machine configuration for %s: %w", lm.FormattedMachineId(), err)
+		}
+
+		// Release metadata changes on every deploy, leave it out of the diff
+		original := machine.CloneConfig(m.Config)
+		md.setMachineReleaseData(original)
+		diff := machine.ConfigCompare(ctx, *original, *li.Config)
+
+		action := PlanActionUpdate
+		switch {
+		case li.RequiresReplacement:
+			action = PlanActionReplace
+		case diff == "":
+			action = PlanActionSkip
+		}
+
+		plan.Machines = append(plan.Machines, &PlannedMachine{
+			ID:           m.ID,
+			Action:       action,
+			ProcessGroup: li.Config.ProcessGroup(),
+			Region:       li.Region,
+			Volume:       plannedVolume(li.Config),
+			Diff:         diff,
+			guest:        li.Config.Guest,
+			volumeGB:     md.mountedVolumeSize(li.Config),
+		})
+	}
+
+	plan.estimate = md.estimateResources(plan)
+	plan.Resources = plan.estimate.Changes()
+	plan.MonthlyCostDelta = plan.estimate.MonthlyDelta()
+	return plan, nil
+}
+
+// estimateResources compares what the machines of the app use before and
+// after the plan.
+func (md *machineDeployment) estimateResources(plan *Plan) *pricing.Estimate {
+	estimate := pricing.NewEstimate()
+	for _, lm := range md.machineSet.GetMachines() {
+		m := lm.Machine()
+		usage := estimate.Before(m.ProcessGroup())
+		usage.AddMachine(m.Config.Guest)
+		if size := md.mountedVolumeSize(m.Config); size > 0 {
+			usage.AddVolume(size)
+		}
+	}
+	for _, m := range plan.Machines {
+		if m.Action == PlanActionDestroy {
+			continue
+		}
+		usage := estimate.After(m.ProcessGroup)
+		usage.AddMachine(m.guest)
+		if m.volumeGB > 0 {
+			usage.AddVolume(m.volumeGB)
+		}
+	}
+	return estimate
+}
+
+// mountedVolumeSize returns the size in GB of the volume mConfig mounts, or 0.
+func (md *machineDeployment) mountedVolumeSize(mConfig *fly.MachineConfig) int {
+	if mConfig == nil || len(mConfig.Mounts) == 0 {
+		return 0
+	}
+	mount := mConfig.Mounts[0]
+	if size, ok := md.volumeSizes[mount.Volume]; ok {
+		return size
+	}
+	return mount.SizeGb
+}
+
+// planCreateMachinesForGroups mirrors deployCreateMachinesForGroups.
+// seedSizes are the sizes of the volumes to provision, by name.
+func (md *machineDeployment) planCreateMachinesForGroups(processGroupMachineDiff ProcessGroupsDiff, seedSizes map[string]int) ([]*PlannedMachine, error) {
+	var planned []*PlannedMachine
+
+	groups := maps.Keys(processGroupMachineDiff.groupsNeedingMachines)
+	slices.Sort(groups)
+
+	for _, name := range groups {
+		li, err := md.launchInputForLaunch(name, md.machineGuest, nil)
+		if err != nil {
+			return nil, fmt.Errorf("error creating machine configuration: %w", err)
+		}
+		newMachine := &PlannedMachine{
+			Action:       PlanActionCreate,
+			ProcessGroup: li.Config.ProcessGroup(),
+			Region:       li.Region,
+			Volume:       plannedVolume(li.Config),
+			guest:        li.Config.Guest,
+			volumeGB:     md.mountedVolumeSize(li.Config),
+		}
+		if mounts := li.Config.Mounts; len(mounts) > 0 && mounts[0].Volume == "" {
+			newMachine.volumeGB = seedSizes[mounts[0].Name]
+		}
+		planned = append(planned, newMachine)
+
+		if !md.increasedAvailability {
+			continue
+		}
+
+		groupConfig, err := md.appConfig.Flatten(name)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case len(groupConfig.Mounts) > 0:
+			continue
+		case len(groupConfig.AllServices()) > 0:
+			planned = append(planned, &PlannedMachine{
+				Action:       PlanActionCreate,
+				ProcessGroup: newMachine.ProcessGroup,
+				Region:       newMachine.Region,
+				guest:        newMachine.guest,
+			})
+		default:
+			planned = append(planned, &PlannedMachine{
+				Action:       PlanActionCreate,
+				ProcessGroup: newMachine.ProcessGroup,
+				Region:       newMachine.Region,
+				Standby:      true,
+				guest:        newMachine.guest,
+			})
+		}
+	}
+	return planned, nil
+}
+
+// reviewResourceChanges prints how the deployment changes the resources of
+// the app, and aborts it when the estimated monthly cost grows by more than
+// maxCostIncrease. It runs before anything is provisioned or released so that
+// aborting leaves nothing behind.
+func (md *machineDeployment) reviewResourceChanges(ctx context.Context, maxCostIncrease *float64) error {
+	// The deployment warns about the machines it updates, don't do it twice
+	md.quiet = true
+	plan, err := md.Plan(ctx)
+	md.quiet = false
+	switch {
+	case err != nil && maxCostIncrease != nil:
+		return fmt.Errorf("failed to estimate the cost of the deployment: %w", err)
+	case err != nil:
+		// The deployment itself reports the problem
+		return nil
+	case !plan.estimate.Changed():
+		return nil
+	}
+
+	if err := plan.estimate.Render(md.io.Out); err != nil {
+		return err
+	}
+	fmt.Fprintln(md.io.Out)
+
+	if maxCostIncrease != nil && plan.MonthlyCostDelta > *maxCostIncrease {
+		return flyerr.GenericErr{
+			Err: fmt.Sprintf("the deployment raises the estimated monthly cost by %s, over the --max-cost-increase of %s",
+				pricing.FormatCost(plan.MonthlyCostDelta), pricing.FormatCost(*maxCostIncrease)),
+			Suggest: "Review the [[vm]] and process group changes of fly.toml, or raise --max-cost-increase",
+		}
+	}
+	return nil
+}
+
+func plannedVolume(mConfig *fly.MachineConfig) string {
+	if mConfig == nil || len(mConfig.Mounts) == 0 {
+		return ""
+	}
+	mount := mConfig.Mounts[0]
+	return fmt.Sprintf("%s (%s) at %s", lo.Ternary(mount.Volume != "", mount.Volume, "new"), mount.Name, mount.Path)
+}
+
+// Summary counts the planned machines for each action.
+func (p *Plan) Summary() map[string]int {
+	return lo.CountValuesBy(p.Machines, func(m *PlannedMachine) string { return m.Action })
+}
+
+func renderPlan(w io.Writer, plan *Plan, jsonOutput bool) error {
+	if jsonOutput {
+		return render.JSON(w, plan)
+	}
+
+	image := plan.Image
+	if plan.ImageToBuild {
+		image += " (to be built)"
+	}
+	fmt.Fprintf(w, "Deployment plan for %s\n", plan.App)
+	fmt.Fprintf(w, "  image: %s\n  strategy: %s\n", image, plan.Strategy)
+	if plan.ReleaseCommand != "" {
+		fmt.Fprintf(w, "  release command: %s\n", plan.ReleaseCommand)
+	}
+	fmt.Fprintln(w)
+
+	rows := lo.Map(plan.Machines, func(m *PlannedMachine, _ int) []string {
+		id := lo.Ternary(m.ID != "", m.ID, "(new)")
+		if m.Standby {
+			id += " standby"
+		}
+		return []string{m.Action, id, m.ProcessGroup, m.Region, m.Volume}
+	})
+	if err := render.Table(w, "", rows, "Action", "Machine", "Process Group", "Region", "Volume"); err != nil {
+		return err
+	}
+
+	for _, m := range plan.Machines {
+		if m.Diff == "" || m.Action == PlanActionSkip {
+			continue
+		}
+		fmt.Fprintf(w, "Changes to machine %s (%s):\n%s\n\n", m.ID, m.Action, m.Diff)
+	}
+
+	summary := plan.Summary()
+	var counts []string
+	for _, action := range []string{PlanActionCreate, PlanActionUpdate, PlanActionReplace, PlanActionDestroy, PlanActionSkip} {
+		if summary[action] > 0 {
+			counts = append(counts, fmt.Sprintf("%d to %s", summary[action], action))
+		}
+	}
+	if len(counts) == 0 {
+		counts = []string{"no machine changes"}
+	}
+	fmt.Fprintf(w, "Plan: %s\n", strings.Join(counts, ", "))
+
+	if plan.estimate != nil && plan.estimate.Changed() {
+		fmt.Fprintln(w)
+		return plan.estimate.Render(w)
+	}
+	return nil
+}
@@ -0,0 +1,223 @@
+package deploy
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/samber/lo"
+	fly "github.com/superfly/fly-go"
+	"github.com/superfly/flyctl/internal/appconfig"
+	"github.com/superfly/flyctl/internal/machine"
+)
+
+// deployProgressDir is where deployments keep their progress, under the state directory
+const deployProgressDir = "deploys"
+
+// deployProgress is what a deployment persists in the state directory while
+// it updates the existing machines, so that `fly deploy --resume` can pick an
+// interrupted rollout back up.
+type deployProgress struct {
+	App        string    `json:"app"`
+	Image      string    `json:"image"`
+	ConfigHash string    `json:"config_hash"`
+	Strategy   string    `json:"strategy"`
+	StartedAt  time.Time `json:"started_at"`
+	Done       []string  `json:"done"`
+	Pending    []string  `json:"pending"`
+
+	path string
+	mu   sync.Mutex
+}
+
+func deployProgressPath(stateDir, appName string) string {
+	return filepath.Join(stateDir, deployProgressDir, appName+".json")
+}
+
+// loadDeployProgress returns the progress of the interrupted deployment of
+// appName, or nil when there's none.
+func loadDeployProgress(stateDir, appName string) (*deployProgress, error) {
+	path := deployProgressPath(stateDir, appName)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read deployment progress: %w", err)
+	}
+
+	p := &deployProgress{path: path}
+	if err := json.Unmarshal(data, p); err != nil {
+		return nil, fmt.Errorf("failed to parse deployment progress %s: %w", path, err)
+	}
+	return p, nil
+}
+
+// save writes the progress atomically so that an interruption can't leave
+// half of it behind.
+func (p *deployProgress) save() error {
+	data, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p.path), 0o700); err != nil {
+		return err
+	}
+	tmp := p.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, p.path)
+}
+
+// markDone moves the machine from the pending ones to the done ones.
+func (p *deployProgress) markDone(machineID string) error {
+	if p == nil {
+		return nil
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	idx := slices.Index(p.Pending, machineID)
+	if idx < 0 {
+		return nil
+	}
+	p.Pending = slices.Delete(p.Pending, idx, idx+1)
+	p.Done = append(p.Done, machineID)
+	return p.save()
+}
+
+// loadResumableDeployment returns the progress of the deployment --resume
+// continues, as long as it rolls out the same image and config.
+func loadResumableDeployment(stateDir, appName, image, configHash string) (*deployProgress, error) {
+	p, err := loadDeployProgress(stateDir, appName)
+	switch {
+	case err != nil:
+		return nil, err
+	case p == nil:
+		return nil, fmt.Errorf("there's no interrupted deployment of %s to resume", appName)
+	case p.Image != image:
+		return nil, fmt.Errorf("the interrupted deployment of %s rolled out %s, not %s", appName, p.Image, image)
+	case p.ConfigHash != configHash:
+		return nil, fmt.Errorf("the configuration of %s changed since its deployment was interrupted, deploy again without --resume", appName)
+	}
+	return p, nil
+}
+
+// appConfigHash identifies the config a deployment rolls out, to only resume
+// it with the same one.
+func appConfigHash(cfg *appconfig.Config) (string, error) {
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// trackProgress starts persisting which of the entries are updated. The
+// machines skipped by --resume count as done already.
+func (md *machineDeployment) trackProgress(entries []*machineUpdateEntry) error {
+	// Blue-green deployments replace every machine at once, there's nothing to pick back up
+	if md.stateDir == "" || md.restartOnly || md.strategy == "bluegreen" {
+		return nil
+	}
+
+	p := &deployProgress{
+		App:        md.app.Name,
+		Image:      md.img,
+		ConfigHash: md.configHash,
+		Strategy:   md.strategy,
+		StartedAt:  time.Now(),
+		Pending: lo.Map(entries, func(e *machineUpdateEntry, _ int) string {
+			return e.launchInput.ID
+		}),
+		path: deployProgressPath(md.stateDir, md.app.Name),
+	}
+	if md.resume != nil {
+		p.StartedAt = md.resume.StartedAt
+		p.Done = md.resume.Done
+	}
+	for _, m := range md.upToDateMachines {
+		if !slices.Contains(p.Done, m.ID) {
+			p.Done = append(p.Done, m.ID)
+		}
+	}
+
+	if err := p.save(); err != nil {
+		return fmt.Errorf("failed to save deployment progress: %w", err)
+	}
+	md.progress = p
+	return nil
+}
+
+// skipUpToDateMachines leaves the machines whose config already matches the
+// deployment out of the machine set, so that --resume only leases and
+// updates the remaining ones.
+func (md *machineDeployment) skipUpToDateMachines(ctx context.Context) error {
+	// Launch inputs take unattached volumes, give them back for the update
+	defer func(volumes map[string][]fly.Volume) {
+		md.volumes = volumes
+	}(md.volumes)
+	md.volumes = lo.MapValues(md.volumes, func(vs []fly.Volume, _ string) []fly.Volume { return slices.Clone(vs) })
+
+	var remaining []*fly.Machine
+	for _, lm := range md.machineSet.GetMachines() {
+		m := lm.Machine()
+		upToDate, err := md.machineUpToDate(ctx, m)
+		if err != nil {
+			return fmt.Errorf("failed to compare the configuration of %s: %w", lm.FormattedMachineId(), err)
+		}
+		if upToDate {
+			md.upToDateMachines = append(md.upToDateMachines, m)
+		} else {
+			remaining = append(remaining, m)
+		}
+	}
+
+	fmt.Fprintf(md.io.ErrOut, "Skipping %d machine(s) already updated, %d left to update\n", len(md.upToDateMachines), len(remaining))
+	md.machineSet = machine.NewMachineSet(md.flapsClient, md.io, remaining)
+	return nil
+}
+
+// machineUpToDate tells whether updating m would leave its config as it is,
+// apart from the release it belongs to.
+func (md *machineDeployment) machineUpToDate(ctx context.Context, m *fly.Machine) (bool, error) {
+	if !slices.Contains(md.ProcessNames(), m.ProcessGroup()) {
+		return false, nil
+	}
+
+	li, err := md.launchInputForUpdate(m)
+	if err != nil {
+		return false, err
+	}
+	if li.RequiresReplacement {
+		return false, nil
+	}
+
+	current := machine.CloneConfig(m.Config)
+	md.setMachineReleaseData(current)
+	return machine.ConfigCompare(ctx, *current, *li.Config) == "", nil
+}
+
+// clearProgress forgets the progress once the deployment completed, including
+// the one --resume continued when it had nothing left to update.
+func (md *machineDeployment) clearProgress() error {
+	if md.stateDir == "" || md.restartOnly {
+		return nil
+	}
+	err := os.Remove(deployProgressPath(md.stateDir, md.app.Name))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
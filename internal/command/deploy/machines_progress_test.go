@@ -0,0 +1,82 @@
+package deploy
+
+import (
+	"context"
+	"testing"
+
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	fly "github.com/superfly/fly-go"
+	"github.com/superfly/flyctl/internal/appconfig"
+	"github.com/superfly/flyctl/internal/machine"
+	"github.com/superfly/flyctl/iostreams"
+)
+
+func TestDeployProgress(t *testing.T) {
+	md, err := stabMachineDeployment(&appconfig.Config{AppName: "my-cool-app"})
+	require.NoError(t, err)
+	md.app.Name = "my-cool-app"
+	md.stateDir = t.TempDir()
+	md.strategy = "rolling"
+	md.configHash = "hash"
+	md.upToDateMachines = []*fly.Machine{{ID: "m1"}}
+
+	entries := lo.Map([]string{"m2", "m3"}, func(id string, _ int) *machineUpdateEntry {
+		return &machineUpdateEntry{launchInput: &fly.LaunchMachineInput{ID: id}}
+	})
+	require.NoError(t, md.trackProgress(entries))
+	require.NoError(t, md.progress.markDone("m2"))
+
+	p, err := loadResumableDeployment(md.stateDir, "my-cool-app", "super/balloon", "hash")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"m1", "m2"}, p.Done)
+	assert.Equal(t, []string{"m3"}, p.Pending)
+
+	_, err = loadResumableDeployment(md.stateDir, "my-cool-app", "super/other", "hash")
+	assert.ErrorContains(t, err, "rolled out super/balloon")
+	_, err = loadResumableDeployment(md.stateDir, "my-cool-app", "super/balloon", "changed")
+	assert.ErrorContains(t, err, "configuration of my-cool-app changed")
+
+	require.NoError(t, md.clearProgress())
+	_, err = loadResumableDeployment(md.stateDir, "my-cool-app", "super/balloon", "hash")
+	assert.ErrorContains(t, err, "no interrupted deployment")
+}
+
+func Test_skipUpToDateMachines(t *testing.T) {
+	ios, _, _, _ := iostreams.Test()
+	ctx := iostreams.NewContext(context.Background(), ios)
+
+	md, err := stabMachineDeployment(&appconfig.Config{
+		AppName:       "my-cool-app",
+		PrimaryRegion: "scl",
+		Processes: map[string]string{
+			"app":    "run-app",
+			"worker": "run-worker",
+		},
+	})
+	require.NoError(t, err)
+	md.io = ios
+
+	// Updated by the interrupted deployment, under its own release
+	md.releaseId = "interrupted"
+	li, err := md.launchInputForLaunch("worker", nil, nil)
+	require.NoError(t, err)
+	updated := &fly.Machine{ID: "updated", Region: "scl", Config: li.Config}
+
+	li, err = md.launchInputForLaunch("app", nil, nil)
+	require.NoError(t, err)
+	li.Config.Image = "super/old-balloon"
+	outdated := &fly.Machine{ID: "outdated", Region: "scl", Config: li.Config}
+
+	md.releaseId = "resumed"
+	md.machineSet = machine.NewMachineSet(nil, ios, []*fly.Machine{updated, outdated})
+	require.NoError(t, md.skipUpToDateMachines(ctx))
+
+	assert.Equal(t, []*fly.Machine{updated}, md.upToDateMachines)
+	assert.Equal(t, []string{"outdated"}, lo.Map(md.machineSet.GetMachines(), func(lm machine.LeasableMachine, _ int) string {
+		return lm.Machine().ID
+	}))
+	// The worker group keeps its machine rather than getting a new one
+	assert.Empty(t, md.resolveProcessGroupChanges().groupsNeedingMachines)
+}
@@ -14,6 +14,7 @@ import (
 	"github.com/superfly/fly-go/flaps"
 	"github.com/superfly/flyctl/helpers"
 	"github.com/superfly/flyctl/internal/appconfig"
+	"github.com/superfly/flyctl/internal/deployevents"
 	"github.com/superfly/flyctl/internal/machine"
 	"github.com/superfly/flyctl/internal/statuslogger"
 	"github.com/superfly/flyctl/internal/tracing"
@@ -52,8 +53,13 @@ func (md *machineDeployment) runReleaseCommand(ctx context.Context) (err error)
 		return fmt.Errorf("error running release_command machine: %w", err)
 	}
 	releaseCmdMachine := md.releaseCommandMachine.GetMachines()[0]
+	deployevents.Emit(ctx, deployevents.Event{
+		Type:      deployevents.ReleaseCommandStarted,
+		MachineID: releaseCmdMachine.Machine().ID,
+		Region:    releaseCmdMachine.Machine().Region,
+	})
 	// FIXME: consolidate this wait stuff with deploy waits? Especially once we improve the outpu
-	err = md.waitForReleaseCommandToFinish(ctx, releaseCmdMachine)
+	err = md.waitForEphemeralMachineToFinish(ctx, releaseCmdMachine, "release_command")
 	if err != nil {
 		tracing.RecordError(span, err, "failed to wait for release cmd machine")
 
@@ -67,6 +73,12 @@ func (md *machineDeployment) runReleaseCommand(ctx context.Context) (err error)
 	if err != nil {
 		return fmt.Errorf("error get release_command machine %s exit code: %w", releaseCmdMachine.Machine().ID, err)
 	}
+	deployevents.Emit(ctx, deployevents.Event{
+		Type:      deployevents.ReleaseCommandExited,
+		MachineID: releaseCmdMachine.Machine().ID,
+		Region:    releaseCmdMachine.Machine().Region,
+		ExitCode:  &exitCode,
+	})
 
 	if exitCode != 0 {
 		statuslogger.LogStatus(ctx, statuslogger.StatusFailure, "release_command failed")
@@ -76,18 +88,8 @@ func (md *machineDeployment) runReleaseCommand(ctx context.Context) (err error)
 		time.Sleep(2 * time.Second) // Wait 2 secs to be sure logs have reached OpenSearch
 		fmt.Fprintf(md.io.ErrOut, "Error release_command failed running on machine %s with exit code %s.\n",
 			md.colorize.Bold(releaseCmdMachine.Machine().ID), md.colorize.Red(strconv.Itoa(exitCode)))
-		fmt.Fprintf(md.io.ErrOut, "Check its logs: here's the last 100 lines below, or run 'fly logs -i %s':\n",
-			releaseCmdMachine.Machine().ID)
-		releaseCmdLogs, _, err := md.apiClient.GetAppLogs(ctx, md.app.Name, "", md.appConfig.PrimaryRegion, releaseCmdMachine.Machine().ID)
-		if fly.IsNotAuthenticatedError(err) {
-			fmt.Fprintf(md.io.ErrOut, "Warn: not authorized to retrieve app logs (this can happen when using deploy tokens), so we can't show you what failed. Use `fly logs -i %s` or open the monitoring dashboard to see them: https://fly.io/apps/%s/monitoring?region=&instance=%s\n", releaseCmdMachine.Machine().ID, md.appConfig.AppName, releaseCmdMachine.Machine().ID)
-		} else {
-			if err != nil {
-				return fmt.Errorf("error getting release_command logs: %w", err)
-			}
-			for _, l := range releaseCmdLogs {
-				fmt.Fprintf(md.io.ErrOut, "  %s\n", l.Message)
-			}
+		if err := md.showEphemeralMachineLogs(ctx, releaseCmdMachine.Machine().ID, "release_command"); err != nil {
+			return err
 		}
 		return fmt.Errorf("error release_command machine %s exited with non-zero status of %d", releaseCmdMachine.Machine().ID, exitCode)
 	}
@@ -177,6 +179,17 @@ func (md *machineDeployment) launchInputForReleaseCommand(origMachineRaw *fly.Ma
 	// We can ignore the error because ToReleaseMachineConfig fails only
 	// if it can't split the command and we test that at initialization
 	mConfig, _ := md.appConfig.ToReleaseMachineConfig()
+	md.setEphemeralMachineConfig(mConfig)
+
+	return &fly.LaunchMachineInput{
+		Config: mConfig,
+		Region: origMachineRaw.Region,
+	}
+}
+
+// setEphemeralMachineConfig sets what the release command and deploy hook
+// machines share with the machines of the deployment.
+func (md *machineDeployment) setEphemeralMachineConfig(mConfig *fly.MachineConfig) {
 	mConfig.Guest = md.inferReleaseCommandGuest()
 	mConfig.Image = md.img
 	md.setMachineReleaseData(mConfig)
@@ -184,11 +197,6 @@ func (md *machineDeployment) launchInputForReleaseCommand(origMachineRaw *fly.Ma
 	if hdid := md.appConfig.HostDedicationID; hdid != "" {
 		mConfig.Guest.HostDedicationID = hdid
 	}
-
-	return &fly.LaunchMachineInput{
-		Config: mConfig,
-		Region: origMachineRaw.Region,
-	}
 }
 
 func (md *machineDeployment) inferReleaseCommandGuest() *fly.MachineGuest {
@@ -220,8 +228,10 @@ func (md *machineDeployment) inferReleaseCommandGuest() *fly.MachineGuest {
 	return helpers.Clone(desiredGuest)
 }
 
-func (md *machineDeployment) waitForReleaseCommandToFinish(ctx context.Context, releaseCmdMachine machine.LeasableMachine) error {
-	err := releaseCmdMachine.WaitForState(ctx, fly.MachineStateStarted, md.waitTimeout, false)
+// waitForEphemeralMachineToFinish waits for the machine running the release
+// command or a deploy hook, named by label, to run and destroy itself.
+func (md *machineDeployment) waitForEphemeralMachineToFinish(ctx context.Context, lm machine.LeasableMachine, label string) error {
+	err := lm.WaitForState(ctx, fly.MachineStateStarted, md.waitTimeout, false)
 	if err != nil {
 		var flapsErr *flaps.FlapsError
 		if errors.As(err, &flapsErr) && flapsErr.ResponseStatusCode == http.StatusNotFound {
@@ -229,12 +239,30 @@ func (md *machineDeployment) waitForReleaseCommandToFinish(ctx context.Context,
 			return nil
 		}
 		err = suggestChangeWaitTimeout(err, "wait-timeout")
-		return fmt.Errorf("error waiting for release_command machine %s to start: %w", releaseCmdMachine.Machine().ID, err)
+		return fmt.Errorf("error waiting for %s machine %s to start: %w", label, lm.Machine().ID, err)
 	}
-	err = releaseCmdMachine.WaitForState(ctx, fly.MachineStateDestroyed, md.releaseCmdTimeout, true)
+	err = lm.WaitForState(ctx, fly.MachineStateDestroyed, md.releaseCmdTimeout, true)
 	if err != nil {
 		err = suggestChangeWaitTimeout(err, "release-command-timeout")
-		return fmt.Errorf("error waiting for release_command machine %s to finish running: %w", releaseCmdMachine.Machine().ID, err)
+		return fmt.Errorf("error waiting for %s machine %s to finish running: %w", label, lm.Machine().ID, err)
+	}
+	return nil
+}
+
+// showEphemeralMachineLogs prints the last logs of a failed release command or
+// deploy hook machine.
+func (md *machineDeployment) showEphemeralMachineLogs(ctx context.Context, machineID, label string) error {
+	fmt.Fprintf(md.io.ErrOut, "Check its logs: here's the last 100 lines below, or run 'fly logs -i %s':\n", machineID)
+	logs, _, err := md.apiClient.GetAppLogs(ctx, md.app.Name, "", md.appConfig.PrimaryRegion, machineID)
+	if fly.IsNotAuthenticatedError(err) {
+		fmt.Fprintf(md.io.ErrOut, "Warn: not authorized to retrieve app logs (this can happen when using deploy tokens), so we can't show you what failed. Use `fly logs -i %s` or open the monitoring dashboard to see them: https://fly.io/apps/%s/monitoring?region=&instance=%s\n", machineID, md.appConfig.AppName, machineID)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error getting %s logs: %w", label, err)
+	}
+	for _, l := range logs {
+		fmt.Fprintf(md.io.ErrOut, "  %s\n", l.Message)
 	}
 	return nil
 }
@@ -0,0 +1,160 @@
+package deploy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"sync"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/samber/lo"
+	fly "github.com/superfly/fly-go"
+	"github.com/superfly/flyctl/internal/appconfig"
+	"github.com/superfly/flyctl/internal/deployevents"
+	"github.com/superfly/flyctl/internal/deploynotify"
+	"github.com/superfly/flyctl/internal/machine"
+	"github.com/superfly/flyctl/internal/tracing"
+	"github.com/superfly/flyctl/iostreams"
+)
+
+// machineRevert restores the machine of an update entry to its config from
+// before the update.
+type machineRevert struct {
+	entry    *machineUpdateEntry
+	previous *fly.LaunchMachineInput
+}
+
+// newMachineRevert must be called before e is updated.
+func newMachineRevert(e *machineUpdateEntry) *machineRevert {
+	previous := *e.launchInput
+	previous.Config = machine.CloneConfig(e.leasableMachine.Machine().Config)
+	return &machineRevert{entry: e, previous: &previous}
+}
+
+// updatedMachines records the machines a deployment updated so far.
+type updatedMachines struct {
+	mu      sync.Mutex
+	reverts []*machineRevert
+}
+
+func (u *updatedMachines) add(r *machineRevert) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.reverts = append(u.reverts, r)
+}
+
+func (u *updatedMachines) list() []*machineRevert {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return append([]*machineRevert{}, u.reverts...)
+}
+
+// RollbackReport lists the machines restored to their previous config and the
+// ones that couldn't be.
+type RollbackReport struct {
+	Reverted []string
+	Failed   map[string]error
+}
+
+func (r *RollbackReport) failedIDs() []string {
+	ids := lo.Keys(r.Failed)
+	slices.Sort(ids)
+	return ids
+}
+
+func (r *RollbackReport) Err() error {
+	var merr *multierror.Error
+	for _, id := range r.failedIDs() {
+		merr = multierror.Append(merr, fmt.Errorf("failed to roll back %s: %w", id, r.Failed[id]))
+	}
+	return merr.ErrorOrNil()
+}
+
+func (r *RollbackReport) render(w io.Writer, colorize *iostreams.ColorScheme) {
+	for _, id := range r.Reverted {
+		fmt.Fprintf(w, "  Machine %s %s\n", colorize.Bold(id), colorize.Green("rolled back"))
+	}
+	for _, id := range r.failedIDs() {
+		fmt.Fprintf(w, "  Machine %s %s: %s\n", colorize.Bold(id), colorize.Red("could not be rolled back"), r.Failed[id])
+	}
+}
+
+// revertMachines updates every machine back to its previous config, one at a
+// time, and waits for it like any other update.
+func (md *machineDeployment) revertMachines(ctx context.Context, reverts []*machineRevert) *RollbackReport {
+	ctx, span := tracing.GetTracer().Start(ctx, "revert_machines")
+	defer span.End()
+
+	report := &RollbackReport{Failed: map[string]error{}}
+	for _, r := range reverts {
+		id := r.entry.leasableMachine.FormattedMachineId()
+		if err := md.revertMachine(ctx, r); err != nil {
+			tracing.RecordError(span, err, "failed to revert machine")
+			report.Failed[id] = err
+			continue
+		}
+		report.Reverted = append(report.Reverted, id)
+	}
+	return report
+}
+
+// revertMachine updates the machine of r back to its previous config. The
+// lease it takes is released once the machine is reverted rather than held
+// while the next machines are, the leases of the deployment are refreshed by
+// the machine set.
+func (md *machineDeployment) revertMachine(ctx context.Context, r *machineRevert) error {
+	lm := r.entry.leasableMachine
+	// Replaced machines released their lease once started
+	if !lm.HasLease() {
+		if err := lm.AcquireLease(ctx, md.leaseTimeout); err != nil {
+			return fmt.Errorf("failed to acquire lease: %w", err)
+		}
+		defer lm.ReleaseLease(ctx) // skipcq: GO-S2307
+	}
+
+	e := &machineUpdateEntry{leasableMachine: lm, launchInput: r.previous}
+	if err := md.updateMachine(ctx, e); err != nil {
+		return err
+	}
+	return md.waitForMachine(ctx, e)
+}
+
+// rollbackOnError restores the machines updated so far when err is set and
+// --auto-rollback was given. Failed verify probes always roll back, as they
+// do for canaries. err is returned either way.
+func (md *machineDeployment) rollbackOnError(ctx context.Context, err error) error {
+	if err == nil || (!md.autoRollback && !errors.Is(err, ErrVerify)) {
+		return err
+	}
+
+	reverts := md.updatedMachines.list()
+	if len(reverts) == 0 {
+		return err
+	}
+
+	fmt.Fprintf(md.io.ErrOut, "Deployment failed after error: %s\n", err)
+	fmt.Fprintf(md.io.ErrOut, "\nRolling back %d updated machine(s) to their previous config\n", len(reverts))
+	report := md.revertMachines(ctx, reverts)
+	report.render(md.io.ErrOut, md.colorize)
+	if len(report.Reverted) > 0 {
+		md.notifyRolledBack(ctx, err)
+	}
+	if len(report.Failed) > 0 {
+		fmt.Fprintf(md.io.ErrOut, "\n%d machine(s) could not be rolled back and still run the new config\n", len(report.Failed))
+	}
+	return err
+}
+
+// notifyRolledBack tells the deploy webhooks the machines went back to their
+// previous config after err. Failed deploy hooks also destroy the machines
+// launched for new process groups when rolling back.
+func (md *machineDeployment) notifyRolledBack(ctx context.Context, err error) {
+	deploynotify.Notify(ctx, deploynotify.Payload{
+		Stage:   appconfig.DeployNotifyRolledBack,
+		Version: md.releaseVersion,
+		Image:   md.img,
+		Error:   deployevents.ErrorString(err),
+	})
+}
@@ -0,0 +1,50 @@
+package deploy
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	fly "github.com/superfly/fly-go"
+	"github.com/superfly/flyctl/internal/machine"
+	"github.com/superfly/flyctl/iostreams"
+)
+
+func Test_newMachineRevert(t *testing.T) {
+	ios, _, _, _ := iostreams.Test()
+	mConfig := &fly.MachineConfig{Image: "old", Env: map[string]string{"A": "1"}}
+	e := &machineUpdateEntry{
+		leasableMachine: machine.NewLeasableMachine(nil, ios, &fly.Machine{ID: "m1", Config: mConfig}),
+		launchInput:     &fly.LaunchMachineInput{ID: "m1", Region: "ord", Config: &fly.MachineConfig{Image: "new"}},
+	}
+
+	r := newMachineRevert(e)
+	mConfig.Env["A"] = "2"
+
+	assert.Same(t, e, r.entry)
+	assert.Equal(t, "ord", r.previous.Region)
+	assert.Equal(t, "old", r.previous.Config.Image)
+	assert.Equal(t, "1", r.previous.Config.Env["A"])
+	assert.Equal(t, "new", e.launchInput.Config.Image)
+}
+
+func Test_RollbackReport(t *testing.T) {
+	ios, _, _, _ := iostreams.Test()
+	report := &RollbackReport{
+		Reverted: []string{"m1"},
+		Failed: map[string]error{
+			"m3": errors.New("boom"),
+			"m2": errors.New("timeout"),
+		},
+	}
+
+	var buf bytes.Buffer
+	report.render(&buf, ios.ColorScheme())
+	assert.Equal(t, "  Machine m1 rolled back\n"+
+		"  Machine m2 could not be rolled back: timeout\n"+
+		"  Machine m3 could not be rolled back: boom\n", buf.String())
+
+	assert.ErrorContains(t, report.Err(), "failed to roll back m2: timeout")
+	assert.NoError(t, (&RollbackReport{}).Err())
+}
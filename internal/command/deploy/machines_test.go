@@ -1,14 +1,18 @@
 package deploy
 
 import (
+	"context"
 	"testing"
 
+	"github.com/samber/lo"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	fly "github.com/superfly/fly-go"
 	"github.com/superfly/flyctl/internal/appconfig"
 	"github.com/superfly/flyctl/internal/buildinfo"
 	"github.com/superfly/flyctl/internal/machine"
+	"github.com/superfly/flyctl/internal/pricing"
+	"github.com/superfly/flyctl/iostreams"
 )
 
 func stabMachineDeployment(appConfig *appconfig.Config) (*machineDeployment, error) {
@@ -382,3 +386,73 @@ func Test_resolveUpdatedMachineConfig_restartOnlyProcessGroup(t *testing.T) {
 		},
 	}, got)
 }
+
+func Test_Plan(t *testing.T) {
+	ios, _, _, _ := iostreams.Test()
+	ctx := iostreams.NewContext(context.Background(), ios)
+
+	md, err := stabMachineDeployment(&appconfig.Config{
+		AppName:       "my-cool-app",
+		PrimaryRegion: "scl",
+		Processes: map[string]string{
+			"app":    "run-app",
+			"worker": "run-worker",
+		},
+	})
+	require.NoError(t, err)
+
+	li, err := md.launchInputForLaunch("app", nil, nil)
+	require.NoError(t, err)
+	current := &fly.Machine{ID: "unchanged", Region: "scl", Config: li.Config}
+
+	li, err = md.launchInputForLaunch("app", nil, nil)
+	require.NoError(t, err)
+	li.Config.Init.Cmd = []string{"run-old-app"}
+	outdated := &fly.Machine{ID: "outdated", Region: "ord", Config: li.Config}
+
+	removed := &fly.Machine{ID: "removed", Region: "scl", Config: &fly.MachineConfig{
+		Metadata: map[string]string{fly.MachineConfigMetadataKeyFlyProcessGroup: "gone"},
+	}}
+	md.machineSet = machine.NewMachineSet(nil, ios, []*fly.Machine{current, outdated, removed})
+
+	plan, err := md.Plan(ctx)
+	require.NoError(t, err)
+	actions := lo.Map(plan.Machines, func(m *PlannedMachine, _ int) []string {
+		return []string{m.ID, m.Action, m.ProcessGroup, m.Region}
+	})
+	assert.Equal(t, [][]string{
+		{"removed", PlanActionDestroy, "gone", "scl"},
+		{"", PlanActionCreate, "worker", "scl"},
+		{"unchanged", PlanActionSkip, "app", "scl"},
+		{"outdated", PlanActionUpdate, "app", "ord"},
+	}, actions)
+	assert.Contains(t, plan.Machines[3].Diff, "run-old-app")
+	assert.Equal(t, map[string]int{"destroy": 1, "create": 1, "skip": 1, "update": 1}, plan.Summary())
+
+	usage := lo.Map(plan.Resources, func(c *pricing.Change, _ int) []any {
+		return []any{c.ProcessGroup, c.Before.Machines, c.After.Machines}
+	})
+	assert.Equal(t, [][]any{{"app", 2, 2}, {"gone", 1, 0}, {"worker", 0, 1}}, usage)
+	assert.InDelta(t, 0, plan.MonthlyCostDelta, 0.001)
+}
+
+func Test_Plan_FirstDeployVolumes(t *testing.T) {
+	ios, _, _, _ := iostreams.Test()
+	ctx := iostreams.NewContext(context.Background(), ios)
+
+	md, err := stabMachineDeployment(&appconfig.Config{
+		AppName:       "my-cool-app",
+		PrimaryRegion: "scl",
+		Mounts:        []appconfig.Mount{{Source: "data", Destination: "/data", InitialSize: "5gb"}},
+	})
+	require.NoError(t, err)
+	md.isFirstDeploy = true
+
+	plan, err := md.Plan(ctx)
+	require.NoError(t, err)
+	require.Len(t, plan.Machines, 1)
+	assert.Equal(t, "new (data) at /data", plan.Machines[0].Volume)
+	assert.Equal(t, 5, plan.Machines[0].volumeGB)
+	// The seed volumes are only planned, nothing is left for the deployment
+	assert.Empty(t, md.volumes)
+}
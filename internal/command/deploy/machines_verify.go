@@ -0,0 +1,252 @@
+package deploy
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/pkg/errors"
+	"github.com/samber/lo"
+	fly "github.com/superfly/fly-go"
+	"github.com/superfly/flyctl/agent"
+	"github.com/superfly/flyctl/internal/appconfig"
+	"github.com/superfly/flyctl/internal/deployevents"
+	"github.com/superfly/flyctl/internal/machine"
+	"github.com/superfly/flyctl/internal/tracing"
+)
+
+const (
+	// DefaultVerifyTimeout is how long a single verify request may take
+	DefaultVerifyTimeout = 5 * time.Second
+	// verifyAttempts is how many times a verify probe is tried on a machine
+	verifyAttempts = 3
+	// verifyRetryInterval is the delay between two attempts of a probe
+	verifyRetryInterval = 2 * time.Second
+	// verifyMaxBody is how much of a response is matched against body_regex
+	verifyMaxBody = 1 << 20
+)
+
+var ErrVerify = errors.New("deployment verification failed")
+
+// verifyProbe is a [[deploy.verify]] entry with its defaults applied.
+type verifyProbe struct {
+	method         string
+	path           string
+	port           int
+	expectedStatus int
+	bodyRegex      *regexp.Regexp
+	headers        map[string]string
+	timeout        time.Duration
+	regions        []string
+	processes      []string
+}
+
+func newVerifyProbes(appConfig *appconfig.Config) ([]*verifyProbe, error) {
+	if appConfig.Deploy == nil {
+		return nil, nil
+	}
+
+	var probes []*verifyProbe
+	for _, v := range appConfig.Deploy.Verify {
+		p := &verifyProbe{
+			method:         lo.Ternary(v.Method != "", v.Method, http.MethodGet),
+			path:           v.Path,
+			port:           appConfig.DeployVerifyPort(v),
+			expectedStatus: http.StatusOK,
+			headers:        v.Headers,
+			timeout:        DefaultVerifyTimeout,
+			regions:        v.Regions,
+			processes:      appConfig.DeployVerifyProcesses(v),
+		}
+		if v.ExpectedStatus != nil {
+			p.expectedStatus = *v.ExpectedStatus
+		}
+		if v.Timeout != nil {
+			p.timeout = v.Timeout.Duration
+		}
+		if v.BodyRegex != "" {
+			re, err := regexp.Compile(v.BodyRegex)
+			if err != nil {
+				return nil, fmt.Errorf("invalid body_regex for verify probe %s: %w", v.Path, err)
+			}
+			p.bodyRegex = re
+		}
+		probes = append(probes, p)
+	}
+	return probes, nil
+}
+
+func (p *verifyProbe) String() string {
+	return fmt.Sprintf("%s :%d%s", p.method, p.port, p.path)
+}
+
+func (p *verifyProbe) appliesTo(m *fly.Machine) bool {
+	if len(p.regions) > 0 && !slices.Contains(p.regions, m.Region) {
+		return false
+	}
+	if len(p.processes) > 0 && !slices.Contains(p.processes, m.ProcessGroup()) {
+		return false
+	}
+	return true
+}
+
+func (p *verifyProbe) newRequest(ctx context.Context, m *fly.Machine) (*http.Request, error) {
+	url := fmt.Sprintf("http://%s%s", net.JoinHostPort(m.PrivateIP, strconv.Itoa(p.port)), p.path)
+	req, err := http.NewRequestWithContext(ctx, p.method, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	for name, value := range p.headers {
+		req.Header.Set(name, value)
+	}
+	if host := req.Header.Get("Host"); host != "" {
+		req.Host = host
+	}
+	return req, nil
+}
+
+// check sends the probe once and compares the response to the expectations.
+func (p *verifyProbe) check(ctx context.Context, client *http.Client, m *fly.Machine) error {
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	req, err := p.newRequest(ctx, m)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close() // skipcq: GO-S2307
+
+	if resp.StatusCode != p.expectedStatus {
+		return fmt.Errorf("got status %d, expected %d", resp.StatusCode, p.expectedStatus)
+	}
+	if p.bodyRegex != nil {
+		body, err := io.ReadAll(io.LimitReader(resp.Body, verifyMaxBody))
+		if err != nil {
+			return fmt.Errorf("failed to read the response body: %w", err)
+		}
+		if !p.bodyRegex.Match(body) {
+			return fmt.Errorf("response body doesn't match %q", p.bodyRegex.String())
+		}
+	}
+	return nil
+}
+
+// checkWithRetries sends the probe until it passes, up to verifyAttempts
+// times, and returns the error of the last attempt.
+func (p *verifyProbe) checkWithRetries(ctx context.Context, client *http.Client, m *fly.Machine) error {
+	var err error
+	for attempt := 0; attempt < verifyAttempts; attempt++ {
+		if attempt > 0 {
+			timer := time.NewTimer(verifyRetryInterval)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return ctx.Err()
+			case <-timer.C:
+			}
+		}
+		if err = p.check(ctx, client, m); err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// verifyClient sends the probes through the WireGuard tunnel of the org.
+func (md *machineDeployment) verifyClient(ctx context.Context) (*http.Client, error) {
+	if md.verifyHTTPClient != nil {
+		return md.verifyHTTPClient, nil
+	}
+
+	agentclient, err := agent.Establish(ctx, md.apiClient)
+	if err != nil {
+		return nil, fmt.Errorf("can't establish agent: %w", err)
+	}
+	orgSlug := md.app.Organization.Slug
+	dialer, err := agentclient.Dialer(ctx, orgSlug)
+	if err != nil {
+		return nil, fmt.Errorf("can't build tunnel for %s: %w", orgSlug, err)
+	}
+	if err := agentclient.WaitForTunnel(ctx, orgSlug); err != nil {
+		return nil, fmt.Errorf("tunnel unavailable: %w", err)
+	}
+
+	md.verifyHTTPClient = &http.Client{
+		Transport: &http.Transport{DialContext: dialer.DialContext},
+		// The probes check the responses of the machines, not the ones redirected to
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	return md.verifyHTTPClient, nil
+}
+
+// verifyMachines runs the [[deploy.verify]] probes against every machine and
+// fails with ErrVerify if any of them doesn't pass after a few attempts.
+func (md *machineDeployment) verifyMachines(ctx context.Context, lms []machine.LeasableMachine) error {
+	if len(md.verifyProbes) == 0 || len(lms) == 0 {
+		return nil
+	}
+
+	ctx, span := tracing.GetTracer().Start(ctx, "verify_machines")
+	defer span.End()
+
+	client, err := md.verifyClient(ctx)
+	if err != nil {
+		tracing.RecordError(span, err, "failed to connect to the org network")
+		return fmt.Errorf("failed to connect to the private network to verify the deployment: %w", err)
+	}
+
+	fmt.Fprintf(md.io.ErrOut, "\nVerifying %d machine(s) with %d probe(s)\n", len(lms), len(md.verifyProbes))
+
+	var merr *multierror.Error
+	for _, lm := range lms {
+		m := lm.Machine()
+		for _, p := range md.verifyProbes {
+			if !p.appliesTo(m) {
+				continue
+			}
+
+			if err := p.checkWithRetries(ctx, client, m); err != nil {
+				err = fmt.Errorf("machine %s failed verify probe %s: %w", m.ID, p, err)
+				tracing.RecordError(span, err, "verify probe failed")
+				emitMachineEvent(ctx, deployevents.MachineFailed, lm, err)
+				fmt.Fprintf(md.io.ErrOut, "  Machine %s %s %s: %s\n", md.colorize.Bold(lm.FormattedMachineId()), md.colorize.Red("failed"), p, err)
+				merr = multierror.Append(merr, err)
+				continue
+			}
+			fmt.Fprintf(md.io.ErrOut, "  Machine %s %s %s\n", md.colorize.Bold(lm.FormattedMachineId()), md.colorize.Green("passed"), p)
+		}
+	}
+
+	if err := merr.ErrorOrNil(); err != nil {
+		return fmt.Errorf("%w: %w", ErrVerify, err)
+	}
+	return nil
+}
+
+// verifyUpdated verifies the machines of entries once their update succeeded.
+func (md *machineDeployment) verifyUpdated(ctx context.Context, entries []*machineUpdateEntry, updateErr error) error {
+	if updateErr != nil {
+		return updateErr
+	}
+	return md.verifyMachines(ctx, launchedMachines(entries))
+}
+
+// launchedMachines skips the machines updated without being started.
+func launchedMachines(entries []*machineUpdateEntry) []machine.LeasableMachine {
+	return lo.FilterMap(entries, func(e *machineUpdateEntry, _ int) (machine.LeasableMachine, bool) {
+		return e.leasableMachine, !e.launchInput.SkipLaunch
+	})
+}
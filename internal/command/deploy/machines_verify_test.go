@@ -0,0 +1,88 @@
+package deploy
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	fly "github.com/superfly/fly-go"
+	"github.com/superfly/flyctl/internal/appconfig"
+)
+
+func Test_newVerifyProbes(t *testing.T) {
+	probes, err := newVerifyProbes(&appconfig.Config{
+		HTTPService: &appconfig.HTTPService{InternalPort: 8080, Processes: []string{"web"}},
+		Deploy: &appconfig.Deploy{Verify: []*appconfig.DeployVerify{
+			{Path: "/health"},
+			{Path: "/admin", Port: fly.Pointer(9000), Method: "HEAD", ExpectedStatus: fly.Pointer(204), Regions: []string{"ord"}},
+		}},
+	})
+	require.NoError(t, err)
+	require.Len(t, probes, 2)
+
+	assert.Equal(t, "GET :8080/health", probes[0].String())
+	assert.Equal(t, http.StatusOK, probes[0].expectedStatus)
+	assert.Equal(t, DefaultVerifyTimeout, probes[0].timeout)
+	assert.True(t, probes[0].appliesTo(&fly.Machine{Region: "ams", Config: &fly.MachineConfig{Metadata: map[string]string{"fly_process_group": "web"}}}))
+	assert.False(t, probes[0].appliesTo(&fly.Machine{Region: "ams", Config: &fly.MachineConfig{Metadata: map[string]string{"fly_process_group": "worker"}}}))
+
+	assert.Equal(t, "HEAD :9000/admin", probes[1].String())
+	assert.Equal(t, 204, probes[1].expectedStatus)
+	assert.True(t, probes[1].appliesTo(&fly.Machine{Region: "ord", Config: &fly.MachineConfig{}}))
+	assert.False(t, probes[1].appliesTo(&fly.Machine{Region: "ams", Config: &fly.MachineConfig{}}))
+}
+
+func Test_verifyProbe_check(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Host != "example.com" {
+			w.WriteHeader(http.StatusMisdirectedRequest)
+			return
+		}
+		fmt.Fprint(w, `{"status":"ok"}`)
+	}))
+	defer srv.Close()
+
+	host, port, err := net.SplitHostPort(srv.Listener.Addr().String())
+	require.NoError(t, err)
+	portNum, err := strconv.Atoi(port)
+	require.NoError(t, err)
+	m := &fly.Machine{ID: "m1", PrivateIP: host}
+
+	probes, err := newVerifyProbes(&appconfig.Config{Deploy: &appconfig.Deploy{Verify: []*appconfig.DeployVerify{{
+		Path:      "/health",
+		Port:      fly.Pointer(portNum),
+		BodyRegex: `"status":"ok"`,
+		Headers:   map[string]string{"Host": "example.com"},
+	}}}})
+	require.NoError(t, err)
+	p := probes[0]
+
+	assert.NoError(t, p.check(context.Background(), srv.Client(), m))
+
+	p.headers = nil
+	assert.ErrorContains(t, p.check(context.Background(), srv.Client(), m), "got status 421, expected 200")
+
+	p.headers = map[string]string{"Host": "example.com"}
+	p.bodyRegex = nil
+	p.expectedStatus = http.StatusNoContent
+	assert.ErrorContains(t, p.check(context.Background(), srv.Client(), m), "got status 200, expected 204")
+
+	// Retries stop as soon as the deployment is canceled
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.ErrorIs(t, p.checkWithRetries(ctx, srv.Client(), m), context.Canceled)
+}
+
+func Test_launchedMachines(t *testing.T) {
+	entries := []*machineUpdateEntry{
+		{launchInput: &fly.LaunchMachineInput{}},
+		{launchInput: &fly.LaunchMachineInput{SkipLaunch: true}},
+	}
+	assert.Len(t, launchedMachines(entries), 1)
+}
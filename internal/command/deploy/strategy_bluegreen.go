@@ -59,6 +59,10 @@ type blueGreen struct {
 	appConfig           *appconfig.Config
 	hangingBlueMachines []string
 	timestamp           string
+	// verify runs the [[deploy.verify]] probes against green machines
+	verify func(context.Context, []machine.LeasableMachine) error
+	// preTraffic runs the pre_traffic hooks before green machines take traffic
+	preTraffic func(context.Context) error
 }
 
 func BlueGreenStrategy(md *machineDeployment, blueMachines []*machineUpdateEntry) *blueGreen {
@@ -78,6 +82,10 @@ func BlueGreenStrategy(md *machineDeployment, blueMachines []*machineUpdateEntry
 		stateLock:           sync.RWMutex{},
 		hangingBlueMachines: []string{},
 		timestamp:           fmt.Sprintf("%d", time.Now().Unix()),
+		verify:              md.verifyMachines,
+		preTraffic: func(ctx context.Context) error {
+			return md.runDeployHook(ctx, deployHookPreTraffic)
+		},
 	}
 
 	// Hook into Ctrl+C so that we can rollback the deployment when it's aborted.
@@ -658,6 +666,24 @@ func (bg *blueGreen) Deploy(ctx context.Context) error {
 		return ErrAborted
 	}
 
+	if err := bg.verify(ctx, launchedMachines(bg.greenMachines)); err != nil {
+		tracing.RecordError(span, err, "failed to verify green machines")
+		return err
+	}
+
+	if bg.isAborted() {
+		return ErrAborted
+	}
+
+	if err := bg.preTraffic(ctx); err != nil {
+		tracing.RecordError(span, err, "failed to run pre_traffic hooks")
+		return err
+	}
+
+	if bg.isAborted() {
+		return ErrAborted
+	}
+
 	fmt.Fprintf(bg.io.ErrOut, "\nMarking green machines as ready\n")
 	if err := bg.MarkGreenMachinesAsReadyForTraffic(ctx); err != nil {
 		tracing.RecordError(span, err, "failed to mark as ready for traffic")
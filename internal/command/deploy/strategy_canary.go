@@ -0,0 +1,281 @@
+package deploy
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"math"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/samber/lo"
+	"go.opentelemetry.io/otel/attribute"
+
+	fly "github.com/superfly/fly-go"
+	"github.com/superfly/flyctl/internal/ctrlc"
+	"github.com/superfly/flyctl/internal/statuslogger"
+	"github.com/superfly/flyctl/internal/tracing"
+	"github.com/superfly/flyctl/iostreams"
+)
+
+const (
+	// canaryBakeInterval is how often canaries are checked during the bake period
+	canaryBakeInterval = 10 * time.Second
+	// canaryHealthTimeout is how long a canary may fail its health checks during the bake period
+	canaryHealthTimeout = 30 * time.Second
+)
+
+var (
+	ErrUpdateCanaryMachines = errors.New("failed to update canary machines")
+	ErrCanaryBake           = errors.New("canary machines failed during the bake period")
+)
+
+type canary struct {
+	md        *machineDeployment
+	canaries  []*machineRevert
+	rest      machineUpdateEntries
+	bakeTime  time.Duration
+	io        *iostreams.IOStreams
+	colorize  *iostreams.ColorScheme
+	aborted   chan struct{}
+	ctrlcHook ctrlc.Handle
+	// updated are the canaries updated so far
+	updated []*machineRevert
+	// promoted is set once the canaries baked successfully, they aren't rolled
+	// back from then on
+	promoted bool
+}
+
+// CanaryStrategy updates a share of the machines of every process group first,
+// watches them for the bake period and only then updates the other machines.
+func CanaryStrategy(md *machineDeployment, entries []*machineUpdateEntry) *canary {
+	c := &canary{
+		md:       md,
+		bakeTime: md.canaryBakeTime,
+		io:       md.io,
+		colorize: md.colorize,
+		aborted:  make(chan struct{}),
+	}
+
+	entriesByGroup := lo.GroupBy(entries, func(e *machineUpdateEntry) string {
+		return e.launchInput.Config.ProcessGroup()
+	})
+	groups := lo.Keys(entriesByGroup)
+	slices.Sort(groups)
+
+	for _, group := range groups {
+		groupEntries := entriesByGroup[group]
+		slices.SortFunc(groupEntries, func(a, b *machineUpdateEntry) int {
+			return cmp.Compare(a.leasableMachine.Machine().ID, b.leasableMachine.Machine().ID)
+		})
+
+		n := canaryCount(len(groupEntries), md.canaryPercentage)
+		for _, e := range groupEntries[:n] {
+			c.canaries = append(c.canaries, newMachineRevert(e))
+		}
+		c.rest = append(c.rest, groupEntries[n:]...)
+	}
+
+	// Hook into Ctrl+C so that we can rollback the canaries when it's aborted.
+	ctrlc.ClearHandlers()
+	c.ctrlcHook = ctrlc.Hook(sync.OnceFunc(func() {
+		close(c.aborted)
+	}))
+
+	return c
+}
+
+// canaryCount is how many out of total machines are canaries, a percentage of
+// zero meaning a single machine.
+func canaryCount(total int, percentage float64) int {
+	if total == 0 {
+		return 0
+	}
+	if percentage <= 0 {
+		return 1
+	}
+	n := int(math.Ceil(float64(total) * percentage / 100))
+	return max(1, min(n, total))
+}
+
+// restartsSince counts the exits of m after since that weren't requested.
+func restartsSince(m *fly.Machine, since time.Time) int {
+	return lo.CountBy(m.Events, func(ev *fly.MachineEvent) bool {
+		return ev.Type == "exit" &&
+			!ev.Time().Before(since) &&
+			ev.Request != nil &&
+			ev.Request.ExitEvent != nil &&
+			!ev.Request.ExitEvent.RequestedStop
+	})
+}
+
+func (c *canary) isAborted() bool {
+	select {
+	case <-c.aborted:
+		return true
+	default:
+		return false
+	}
+}
+
+func (c *canary) sleepAbortable(d time.Duration) bool {
+	select {
+	case <-time.After(d):
+		return false
+	case <-c.aborted:
+		return true
+	}
+}
+
+func (c *canary) UpdateCanaryMachines(ctx context.Context) error {
+	ctx, span := tracing.GetTracer().Start(ctx, "canary_machines_update")
+	defer span.End()
+
+	sl := statuslogger.Create(ctx, len(c.canaries), true)
+	defer sl.Destroy(false)
+
+	for idx, ce := range c.canaries {
+		eCtx := statuslogger.NewContext(ctx, sl.Line(idx))
+		fmtID := ce.entry.leasableMachine.FormattedMachineId()
+
+		statuslogger.LogfStatus(eCtx, statuslogger.StatusRunning, "Updating canary %s", c.colorize.Bold(fmtID))
+		if err := c.md.updateMachine(eCtx, ce.entry); err != nil {
+			tracing.RecordError(span, err, "failed to update canary")
+			statuslogger.LogfStatus(eCtx, statuslogger.StatusFailure, "Canary %s update %s: %s", c.colorize.Bold(fmtID), c.colorize.Red("failed"), err)
+			return err
+		}
+		c.updated = append(c.updated, ce)
+		c.md.updatedMachines.add(ce)
+		if err := c.md.waitForMachine(eCtx, ce.entry); err != nil {
+			tracing.RecordError(span, err, "failed to wait for canary")
+			statuslogger.LogfStatus(eCtx, statuslogger.StatusFailure, "Canary %s update %s: %s", c.colorize.Bold(fmtID), c.colorize.Red("failed"), err)
+			return err
+		}
+		statuslogger.LogfStatus(eCtx, statuslogger.StatusSuccess, "Canary %s update %s", c.colorize.Bold(fmtID), c.colorize.Green("succeeded"))
+
+		if c.isAborted() {
+			return ErrAborted
+		}
+	}
+	return nil
+}
+
+// Bake watches the health checks and restarts of the canaries until the bake
+// time is over. It fails as soon as a canary stays unhealthy or restarts.
+func (c *canary) Bake(ctx context.Context) error {
+	ctx, span := tracing.GetTracer().Start(ctx, "canary_bake")
+	defer span.End()
+
+	since := time.Now()
+	deadline := since.Add(c.bakeTime)
+	for {
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return nil
+		}
+		if c.sleepAbortable(min(canaryBakeInterval, remaining)) {
+			return ErrAborted
+		}
+
+		for _, ce := range c.canaries {
+			if err := c.checkCanary(ctx, ce.entry, since); err != nil {
+				tracing.RecordError(span, err, "canary failed")
+				return err
+			}
+			if c.isAborted() {
+				return ErrAborted
+			}
+		}
+	}
+}
+
+func (c *canary) checkCanary(ctx context.Context, e *machineUpdateEntry, since time.Time) error {
+	// Machines that weren't started aren't running anything to watch
+	if e.launchInput.SkipLaunch {
+		return nil
+	}
+
+	lm := e.leasableMachine
+	if !c.md.skipHealthChecks {
+		if err := lm.WaitForHealthchecksToPass(ctx, canaryHealthTimeout); err != nil {
+			return fmt.Errorf("canary %s: %w", lm.FormattedMachineId(), err)
+		}
+	}
+
+	m, err := c.md.flapsClient.Get(ctx, lm.Machine().ID)
+	if err != nil {
+		return fmt.Errorf("error getting machine %s from api: %w", lm.Machine().ID, err)
+	}
+	if restarts := restartsSince(m, since); restarts > 0 {
+		return fmt.Errorf("canary %s restarted %d time(s) during the bake period", lm.FormattedMachineId(), restarts)
+	}
+	return nil
+}
+
+func (c *canary) Deploy(ctx context.Context) error {
+	ctx, span := tracing.GetTracer().Start(ctx, "canary")
+	defer span.End()
+
+	defer c.ctrlcHook.Done()
+
+	span.SetAttributes(
+		attribute.Int("canaries", len(c.canaries)),
+		attribute.Int("rest", len(c.rest)),
+		attribute.String("bake_time", c.bakeTime.String()),
+	)
+
+	if c.isAborted() {
+		return ErrAborted
+	}
+
+	fmt.Fprintf(c.io.ErrOut, "\nUpdating %d canary machine(s)\n", len(c.canaries))
+	if err := c.UpdateCanaryMachines(ctx); err != nil {
+		if c.isAborted() {
+			return ErrAborted
+		}
+		return errors.Wrap(err, ErrUpdateCanaryMachines.Error())
+	}
+
+	canaryEntries := lo.Map(c.canaries, func(ce *machineRevert, _ int) *machineUpdateEntry { return ce.entry })
+	if err := c.md.verifyMachines(ctx, launchedMachines(canaryEntries)); err != nil {
+		return err
+	}
+
+	if c.bakeTime > 0 {
+		fmt.Fprintf(c.io.ErrOut, "\nWatching canary machines for %s\n", c.bakeTime)
+		if err := c.Bake(ctx); err != nil {
+			if c.isAborted() {
+				return ErrAborted
+			}
+			return errors.Wrap(err, ErrCanaryBake.Error())
+		}
+	}
+
+	// From here on Ctrl+C no longer rolls back the canaries
+	c.promoted = true
+	c.ctrlcHook.Done()
+
+	if len(c.rest) == 0 {
+		return nil
+	}
+	fmt.Fprintf(c.io.ErrOut, "\nCanary machines are healthy, updating the remaining %d machine(s)\n", len(c.rest))
+	return c.md.verifyUpdated(ctx, c.rest, c.md.updateUsingRollingStrategy(ctx, c.rest))
+}
+
+// Rollback restores the canaries to their previous config, unless they were
+// already promoted.
+func (c *canary) Rollback(ctx context.Context, err error) error {
+	ctx, span := tracing.GetTracer().Start(ctx, "rollback")
+	defer span.End()
+
+	if c.promoted || len(c.updated) == 0 {
+		return nil
+	}
+
+	fmt.Fprintf(c.io.ErrOut, "\nRolling back canary machines to their previous config\n")
+	report := c.md.revertMachines(ctx, c.updated)
+	report.render(c.io.ErrOut, c.colorize)
+	return report.Err()
+}
@@ -0,0 +1,75 @@
+package deploy
+
+import (
+	"testing"
+	"time"
+
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	fly "github.com/superfly/fly-go"
+	"github.com/superfly/flyctl/internal/machine"
+	"github.com/superfly/flyctl/iostreams"
+)
+
+func Test_canaryCount(t *testing.T) {
+	assert.Equal(t, 0, canaryCount(0, 0))
+	assert.Equal(t, 1, canaryCount(5, 0))
+	assert.Equal(t, 1, canaryCount(5, 10))
+	assert.Equal(t, 2, canaryCount(10, 15))
+	assert.Equal(t, 5, canaryCount(5, 100))
+}
+
+func Test_restartsSince(t *testing.T) {
+	since := time.Now()
+	exit := func(at time.Time, requested bool) *fly.MachineEvent {
+		return &fly.MachineEvent{
+			Type:      "exit",
+			Timestamp: at.UnixMilli(),
+			Request:   &fly.MachineRequest{ExitEvent: &fly.MachineExitEvent{RequestedStop: requested}},
+		}
+	}
+
+	m := &fly.Machine{Events: []*fly.MachineEvent{
+		exit(since.Add(2*time.Second), false),
+		{Type: "start", Timestamp: since.Add(time.Second).UnixMilli()},
+		exit(since.Add(time.Second), true),
+		exit(since.Add(-time.Minute), false),
+	}}
+	assert.Equal(t, 1, restartsSince(m, since))
+}
+
+func Test_CanaryStrategy(t *testing.T) {
+	ios, _, _, _ := iostreams.Test()
+	entry := func(id, group string) *machineUpdateEntry {
+		mConfig := &fly.MachineConfig{
+			Image:    "old",
+			Metadata: map[string]string{fly.MachineConfigMetadataKeyFlyProcessGroup: group},
+		}
+		newConfig := machine.CloneConfig(mConfig)
+		newConfig.Image = "new"
+		return &machineUpdateEntry{
+			leasableMachine: machine.NewLeasableMachine(nil, ios, &fly.Machine{ID: id, Config: mConfig}),
+			launchInput:     &fly.LaunchMachineInput{ID: id, Config: newConfig},
+		}
+	}
+	entries := []*machineUpdateEntry{
+		entry("web3", "web"), entry("web1", "web"), entry("web2", "web"),
+		entry("worker1", "worker"),
+	}
+
+	md := &machineDeployment{io: ios, colorize: ios.ColorScheme(), canaryBakeTime: time.Minute}
+	c := CanaryStrategy(md, entries)
+	c.ctrlcHook.Done()
+
+	ids := func(entries machineUpdateEntries) []string {
+		return lo.Map(entries, func(e *machineUpdateEntry, _ int) string { return e.leasableMachine.Machine().ID })
+	}
+	canaries := lo.Map(c.canaries, func(r *machineRevert, _ int) *machineUpdateEntry { return r.entry })
+	assert.Equal(t, []string{"web1", "worker1"}, ids(canaries))
+	assert.Equal(t, []string{"web2", "web3"}, ids(c.rest))
+
+	// Rolling back restores the config from before the update
+	assert.Equal(t, "old", c.canaries[0].previous.Config.Image)
+	assert.Equal(t, "new", c.canaries[0].entry.launchInput.Config.Image)
+	assert.Equal(t, time.Minute, c.bakeTime)
+}
@@ -0,0 +1,152 @@
+package deploy
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/samber/lo"
+	"github.com/superfly/flyctl/internal/appconfig"
+	"github.com/superfly/flyctl/internal/prompt"
+	"github.com/superfly/flyctl/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// waveHealthTimeout is how long the machines of a wave may fail their health
+// checks once the pause after it is over
+const waveHealthTimeout = 30 * time.Second
+
+var ErrWavesStopped = errors.New("deployment stopped between waves")
+
+// splitIntoWaves assigns each entry to the wave listing the region of its
+// machine, or to the wave of the other regions. Regions no wave covers are
+// an error rather than silently left on the previous release.
+func splitIntoWaves(waves [][]string, entries []*machineUpdateEntry) ([][]*machineUpdateEntry, error) {
+	split := make([][]*machineUpdateEntry, len(waves))
+	var uncovered []string
+	for _, e := range entries {
+		region := e.leasableMachine.Machine().Region
+		idx := slices.IndexFunc(waves, func(wave []string) bool {
+			return slices.Contains(wave, region)
+		})
+		if idx < 0 {
+			idx = slices.IndexFunc(waves, func(wave []string) bool {
+				return slices.Contains(wave, appconfig.DeployWaveOtherRegions)
+			})
+		}
+		if idx < 0 {
+			uncovered = append(uncovered, region)
+			continue
+		}
+		split[idx] = append(split[idx], e)
+	}
+
+	if len(uncovered) > 0 {
+		uncovered = lo.Uniq(uncovered)
+		slices.Sort(uncovered)
+		return nil, fmt.Errorf("machines in %s aren't part of any deploy wave, add [\"%s\"] as the last wave to update them too",
+			strings.Join(uncovered, ", "), appconfig.DeployWaveOtherRegions)
+	}
+	return split, nil
+}
+
+// updateUsingWaves updates the machines wave after wave with the rolling
+// strategy, and only moves to the next wave once the machines of the current
+// one are healthy and verified.
+//
+// Only existing machines go through the waves: the machines of new process
+// groups don't replace machines running the previous release, so they're
+// launched in the primary region before the waves start.
+func (md *machineDeployment) updateUsingWaves(ctx context.Context, entries []*machineUpdateEntry) error {
+	ctx, span := tracing.GetTracer().Start(ctx, "waves")
+	defer span.End()
+
+	waves, err := splitIntoWaves(md.waves, entries)
+	if err != nil {
+		return err
+	}
+	span.SetAttributes(attribute.Int("waves", len(waves)))
+
+	// Waves without machines to update are skipped
+	var pending []int
+	for idx, wave := range waves {
+		if len(wave) > 0 {
+			pending = append(pending, idx)
+		}
+	}
+
+	for i, idx := range pending {
+		wave := waves[idx]
+		regions := strings.Join(md.waves[idx], ", ")
+		fmt.Fprintf(md.io.ErrOut, "\nWave %d/%d: updating %d machine(s) in %s\n", idx+1, len(waves), len(wave), regions)
+		if err := md.verifyUpdated(ctx, wave, md.updateUsingRollingStrategy(ctx, wave)); err != nil {
+			return fmt.Errorf("wave %d (%s): %w", idx+1, regions, err)
+		}
+
+		if i == len(pending)-1 {
+			break
+		}
+		if err := md.waitBetweenWaves(ctx, wave); err != nil {
+			return fmt.Errorf("wave %d (%s): %w", idx+1, regions, err)
+		}
+		if err := md.confirmNextWave(ctx, waves, pending[i+1]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// waitBetweenWaves pauses after a wave, then makes sure its machines are
+// still healthy and didn't restart in the meantime.
+func (md *machineDeployment) waitBetweenWaves(ctx context.Context, wave []*machineUpdateEntry) error {
+	if md.wavePause <= 0 {
+		return nil
+	}
+
+	fmt.Fprintf(md.io.ErrOut, "Waiting %s before the next wave\n", md.wavePause)
+	since := time.Now()
+	select {
+	case <-time.After(md.wavePause):
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	for _, lm := range launchedMachines(wave) {
+		if !md.skipHealthChecks {
+			if err := lm.WaitForHealthchecksToPass(ctx, waveHealthTimeout); err != nil {
+				return fmt.Errorf("machine %s: %w", lm.FormattedMachineId(), err)
+			}
+		}
+
+		m, err := md.flapsClient.Get(ctx, lm.Machine().ID)
+		if err != nil {
+			return fmt.Errorf("error getting machine %s from api: %w", lm.Machine().ID, err)
+		}
+		if restarts := restartsSince(m, since); restarts > 0 {
+			return fmt.Errorf("machine %s restarted %d time(s) during the pause", lm.FormattedMachineId(), restarts)
+		}
+	}
+	return nil
+}
+
+// confirmNextWave asks whether to go on with the wave at next, when asked to.
+func (md *machineDeployment) confirmNextWave(ctx context.Context, waves [][]*machineUpdateEntry, next int) error {
+	if !md.waveConfirm {
+		return nil
+	}
+
+	remaining := lo.SumBy(waves[next:], func(wave []*machineUpdateEntry) int { return len(wave) })
+	confirmed, err := prompt.Confirmf(ctx, "Continue with wave %d (%s), %d machine(s) left?", next+1, strings.Join(md.waves[next], ", "), remaining)
+	switch {
+	case prompt.IsNonInteractive(err):
+		return prompt.NonInteractiveError("--wave-confirm needs a terminal to ask for confirmation")
+	case err != nil:
+		return err
+	case !confirmed:
+		return ErrWavesStopped
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package deploy
+
+import (
+	"testing"
+
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	fly "github.com/superfly/fly-go"
+	"github.com/superfly/flyctl/internal/machine"
+	"github.com/superfly/flyctl/iostreams"
+)
+
+func Test_splitIntoWaves(t *testing.T) {
+	ios, _, _, _ := iostreams.Test()
+	entry := func(id, region string) *machineUpdateEntry {
+		m := &fly.Machine{ID: id, Region: region, Config: &fly.MachineConfig{}}
+		return &machineUpdateEntry{
+			leasableMachine: machine.NewLeasableMachine(nil, ios, m),
+			launchInput:     &fly.LaunchMachineInput{ID: id, Config: m.Config},
+		}
+	}
+	entries := []*machineUpdateEntry{
+		entry("ams1", "ams"), entry("fra1", "fra"), entry("ord1", "ord"),
+		entry("ams2", "ams"), entry("syd1", "syd"),
+	}
+	ids := func(waves [][]*machineUpdateEntry) [][]string {
+		return lo.Map(waves, func(wave []*machineUpdateEntry, _ int) []string {
+			return lo.Map(wave, func(e *machineUpdateEntry, _ int) string { return e.leasableMachine.Machine().ID })
+		})
+	}
+
+	waves, err := splitIntoWaves([][]string{{"ams"}, {"fra", "lhr"}, {"*"}}, entries)
+	require.NoError(t, err)
+	assert.Equal(t, [][]string{{"ams1", "ams2"}, {"fra1"}, {"ord1", "syd1"}}, ids(waves))
+
+	waves, err = splitIntoWaves([][]string{{"lhr"}, {"*"}}, entries)
+	require.NoError(t, err)
+	assert.Equal(t, [][]string{{}, {"ams1", "fra1", "ord1", "ams2", "syd1"}}, ids(waves))
+
+	_, err = splitIntoWaves([][]string{{"ams"}, {"fra"}}, entries)
+	assert.ErrorContains(t, err, "machines in ord, syd aren't part of any deploy wave")
+}
@@ -0,0 +1,476 @@
+package deploy
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+	"github.com/samber/lo"
+	fly "github.com/superfly/fly-go"
+	"github.com/superfly/fly-go/flaps"
+	"github.com/superfly/flyctl/internal/appconfig"
+	"github.com/superfly/flyctl/internal/build/imgsrc"
+	"github.com/superfly/flyctl/internal/command"
+	"github.com/superfly/flyctl/internal/deploynotify"
+	"github.com/superfly/flyctl/internal/env"
+	"github.com/superfly/flyctl/internal/flag"
+	"github.com/superfly/flyctl/internal/flapsutil"
+	"github.com/superfly/flyctl/internal/render"
+	"github.com/superfly/flyctl/internal/state"
+	"github.com/superfly/flyctl/internal/statuslogger"
+	"github.com/superfly/flyctl/iostreams"
+	"golang.org/x/sync/errgroup"
+)
+
+const (
+	// WorkspaceFileName is the file declaring the apps of a monorepo and
+	// the order to deploy them in.
+	WorkspaceFileName = "fly.workspace.toml"
+	// workspaceBuildConcurrency is how many images of a workspace build at once
+	workspaceBuildConcurrency = 4
+	// workspaceLogTail is how many lines of output are shown for a failed app
+	workspaceLogTail = 40
+)
+
+// workspaceFile is the content of fly.workspace.toml:
+//
+//	[[apps]]
+//	path = "services/api"
+//	depends_on = ["my-db-migrator"]
+type workspaceFile struct {
+	Apps []workspaceFileApp `toml:"apps"`
+}
+
+type workspaceFileApp struct {
+	// Path is the directory of the app, relative to the workspace file
+	Path string `toml:"path"`
+	// Config is the name of the app config in Path, fly.toml by default
+	Config string `toml:"config,omitempty"`
+	// DependsOn lists the names of the apps to deploy before this one
+	DependsOn []string `toml:"depends_on,omitempty"`
+}
+
+// workspaceApp is an app of a workspace along with the progress of its
+// deployment.
+type workspaceApp struct {
+	dir        string
+	configPath string
+	dependsOn  []string
+	config     *appconfig.Config
+
+	ctx  context.Context
+	log  *workspaceLog
+	line statuslogger.StatusLine
+
+	img          *imgsrc.DeploymentImage
+	buildStatus  string
+	deployStatus string
+	err          error
+}
+
+func (app *workspaceApp) name() string {
+	return app.config.AppName
+}
+
+func (app *workspaceApp) fail(status string, err error) {
+	app.err = err
+	app.deployStatus = status
+	app.line.LogfStatus(statuslogger.StatusFailure, "%s: %s", app.name(), firstLine(err.Error()))
+}
+
+// workspaceLog collects the output of an app so that the concurrent builds
+// don't interleave on the terminal.
+type workspaceLog struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (l *workspaceLog) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.buf.Write(p)
+}
+
+// tail returns the last n lines written to l.
+func (l *workspaceLog) tail(n int) string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	lines := strings.Split(strings.TrimRight(l.buf.String(), "\n"), "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return strings.Join(lines, "\n")
+}
+
+func firstLine(s string) string {
+	line, _, _ := strings.Cut(s, "\n")
+	return line
+}
+
+// isWorkspaceDeploy reports whether the deploy command deploys every app of
+// the working directory: with --all, or when there's a fly.workspace.toml
+// but no app to deploy otherwise.
+func isWorkspaceDeploy(ctx context.Context) bool {
+	if flag.GetBool(ctx, "all") {
+		return true
+	}
+	if flag.GetApp(ctx) != "" || flag.GetAppConfigFilePath(ctx) != "" {
+		return false
+	}
+
+	wd := state.WorkingDirectory(ctx)
+	if _, err := os.Stat(filepath.Join(wd, appconfig.DefaultConfigFileName)); err == nil {
+		return false
+	}
+	_, err := os.Stat(filepath.Join(wd, WorkspaceFileName))
+	return err == nil
+}
+
+// requireAppNameUnlessWorkspace is a Preparer which makes sure the user has
+// selected an application, unless the apps come from the workspace.
+func requireAppNameUnlessWorkspace(ctx context.Context) (context.Context, error) {
+	if isWorkspaceDeploy(ctx) {
+		return ctx, nil
+	}
+	return command.RequireAppName(ctx)
+}
+
+func validateWorkspaceFlags(ctx context.Context) error {
+	for _, name := range []string{"app", "config", "image", "dry-run", "resume", "output-file"} {
+		if flag.IsSpecified(ctx, name) {
+			return fmt.Errorf("--%s can't be used to deploy all the apps of a workspace", name)
+		}
+	}
+	if flag.GetString(ctx, "output") == "jsonl" {
+		return errors.New("--output=jsonl can't be used to deploy all the apps of a workspace")
+	}
+	return nil
+}
+
+// loadWorkspace returns the apps declared in the fly.workspace.toml of root,
+// or the ones found in its subdirectories when there's none, in the order to
+// deploy them in.
+func loadWorkspace(root, configEnv string) ([]*workspaceApp, error) {
+	apps, err := readWorkspaceFile(root)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		if apps, err = discoverWorkspaceApps(root); err != nil {
+			return nil, err
+		}
+	case err != nil:
+		return nil, err
+	}
+
+	if len(apps) == 0 {
+		return nil, fmt.Errorf("no app config found in %s", root)
+	}
+
+	for _, app := range apps {
+		cfg, err := appconfig.LoadConfigWithEnv(app.configPath, configEnv)
+		if err != nil {
+			return nil, fmt.Errorf("failed loading app config from %s: %w", app.configPath, err)
+		}
+		if cfg.AppName == "" {
+			return nil, fmt.Errorf("the app config at %s is missing an app name", app.configPath)
+		}
+		if err := cfg.SetMachinesPlatform(); err != nil {
+			return nil, fmt.Errorf("the app config at %s is not valid: %w", app.configPath, err)
+		}
+		app.config = cfg
+	}
+
+	return orderWorkspaceApps(apps)
+}
+
+func readWorkspaceFile(root string) ([]*workspaceApp, error) {
+	path := filepath.Join(root, WorkspaceFileName)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var file workspaceFile
+	if err := toml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed parsing %s: %w", path, err)
+	}
+
+	apps := make([]*workspaceApp, 0, len(file.Apps))
+	for i, entry := range file.Apps {
+		if entry.Path == "" {
+			return nil, fmt.Errorf("apps[%d] of %s is missing a path", i, path)
+		}
+		dir := filepath.Join(root, entry.Path)
+		apps = append(apps, &workspaceApp{
+			dir:        dir,
+			configPath: filepath.Join(dir, lo.Ternary(entry.Config != "", entry.Config, appconfig.DefaultConfigFileName)),
+			dependsOn:  entry.DependsOn,
+		})
+	}
+	return apps, nil
+}
+
+// discoverWorkspaceApps finds the fly.toml files under root, skipping hidden
+// and dependency directories.
+func discoverWorkspaceApps(root string) ([]*workspaceApp, error) {
+	var apps []*workspaceApp
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path != root && (strings.HasPrefix(d.Name(), ".") || d.Name() == "node_modules" || d.Name() == "vendor") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.Name() == appconfig.DefaultConfigFileName {
+			apps = append(apps, &workspaceApp{dir: filepath.Dir(path), configPath: path})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed looking for app configs in %s: %w", root, err)
+	}
+	return apps, nil
+}
+
+// orderWorkspaceApps sorts apps so that every app comes after the ones it
+// depends on, keeping the declared order otherwise.
+func orderWorkspaceApps(apps []*workspaceApp) ([]*workspaceApp, error) {
+	byName := make(map[string]*workspaceApp, len(apps))
+	for _, app := range apps {
+		if other, ok := byName[app.name()]; ok {
+			return nil, fmt.Errorf("app %s is configured by both %s and %s", app.name(), other.configPath, app.configPath)
+		}
+		byName[app.name()] = app
+	}
+	for _, app := range apps {
+		for _, dep := range app.dependsOn {
+			if _, ok := byName[dep]; !ok {
+				return nil, fmt.Errorf("app %s depends on %s, which isn't part of the workspace", app.name(), dep)
+			}
+		}
+	}
+
+	ordered := make([]*workspaceApp, 0, len(apps))
+	placed := make(map[string]bool, len(apps))
+	for len(ordered) < len(apps) {
+		progressed := false
+		for _, app := range apps {
+			if placed[app.name()] || !lo.EveryBy(app.dependsOn, func(dep string) bool { return placed[dep] }) {
+				continue
+			}
+			ordered = append(ordered, app)
+			placed[app.name()] = true
+			progressed = true
+		}
+		if !progressed {
+			cycle := lo.FilterMap(apps, func(app *workspaceApp, _ int) (string, bool) {
+				return app.name(), !placed[app.name()]
+			})
+			return nil, fmt.Errorf("the dependencies between %s form a cycle", strings.Join(cycle, ", "))
+		}
+	}
+	return ordered, nil
+}
+
+// deployWorkspace builds the images of every app of the workspace at once,
+// then deploys the apps one after the other in dependency order. The apps
+// depending on one that failed are skipped.
+func deployWorkspace(ctx context.Context) error {
+	if err := validateWorkspaceFlags(ctx); err != nil {
+		return err
+	}
+
+	io := iostreams.FromContext(ctx)
+	root := state.WorkingDirectory(ctx)
+	configEnv := flag.GetAppConfigEnv(ctx)
+	if configEnv == "" {
+		configEnv = env.First("FLY_CONFIG_ENV")
+	}
+
+	apps, err := loadWorkspace(root, configEnv)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(io.Out, "Deploying %d apps in this order: %s\n\n", len(apps), strings.Join(lo.Map(apps, func(app *workspaceApp, _ int) string {
+		return app.name()
+	}), ", "))
+
+	progress := statuslogger.Create(ctx, len(apps), true)
+	for i, app := range apps {
+		app.line = progress.Line(i)
+		app.log = &workspaceLog{}
+		app.ctx, err = workspaceAppContext(ctx, app)
+		if err != nil {
+			progress.Destroy(false)
+			return err
+		}
+		app.line.LogfStatus(statuslogger.StatusNone, "%s: waiting to build", app.name())
+	}
+
+	var builds errgroup.Group
+	builds.SetLimit(workspaceBuildConcurrency)
+	for _, app := range apps {
+		app := app
+		builds.Go(func() error {
+			buildWorkspaceApp(app)
+			return nil
+		})
+	}
+	_ = builds.Wait()
+
+	if !flag.GetBuildOnly(ctx) {
+		deployed := make(map[string]bool, len(apps))
+		for _, app := range apps {
+			deployed[app.name()] = deployWorkspaceApp(app, deployed)
+		}
+	}
+	progress.Destroy(false)
+
+	var failed []*workspaceApp
+	for _, app := range apps {
+		if app.err != nil {
+			failed = append(failed, app)
+		}
+	}
+	for _, app := range failed {
+		fmt.Fprintf(io.ErrOut, "\n==> %s: %s\n", app.name(), app.err)
+		if tail := app.log.tail(workspaceLogTail); tail != "" {
+			fmt.Fprintln(io.ErrOut, tail)
+		}
+	}
+
+	fmt.Fprintln(io.Out)
+	renderWorkspaceSummary(io.Out, root, apps)
+
+	if len(failed) > 0 {
+		return fmt.Errorf("%d of %d apps failed to deploy", len(failed), len(apps))
+	}
+	return nil
+}
+
+// workspaceAppContext derives the context an app is built and deployed
+// with. Its output goes to the log of the app rather than the terminal.
+func workspaceAppContext(ctx context.Context, app *workspaceApp) (context.Context, error) {
+	appIO := *iostreams.FromContext(ctx)
+	appIO.Out = app.log
+	appIO.ErrOut = app.log
+	appIO.SetStdoutTTY(false)
+	appIO.SetStderrTTY(false)
+	appIO.SetNeverPrompt(true)
+
+	ctx = iostreams.NewContext(ctx, &appIO)
+	ctx = state.WithWorkingDirectory(ctx, app.dir)
+	ctx = appconfig.WithName(ctx, app.name())
+	ctx = appconfig.WithConfig(ctx, app.config)
+
+	flapsClient, err := flapsutil.NewClientWithOptions(ctx, flaps.NewClientOpts{
+		AppName: app.name(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not create flaps client for %s: %w", app.name(), err)
+	}
+	return flaps.NewContext(ctx, flapsClient), nil
+}
+
+func buildWorkspaceApp(app *workspaceApp) {
+	app.line.LogfStatus(statuslogger.StatusRunning, "%s: building image", app.name())
+
+	cfg, err := determineAppConfig(app.ctx)
+	if err != nil {
+		app.buildStatus = "failed"
+		app.fail("not started", err)
+		return
+	}
+	app.config = cfg
+
+	reason, err := command.CheckDeployFreeze(app.ctx, cfg, time.Now())
+	if err != nil {
+		app.buildStatus = "frozen"
+		app.fail("not started", err)
+		return
+	}
+	app.ctx = withFreezeOverride(app.ctx, reason)
+
+	// Failed builds are notified too
+	ctx, err := withDeployNotify(app.ctx, cfg)
+	if err != nil {
+		app.buildStatus = "failed"
+		app.fail("not started", err)
+		return
+	}
+	app.ctx = ctx
+
+	img, err := determineImage(app.ctx, cfg)
+	if err != nil {
+		err = fmt.Errorf("failed to fetch an image or build from source: %w", err)
+		deploynotify.NotifyFailure(app.ctx, err)
+		app.buildStatus = "failed"
+		app.fail("not started", err)
+		return
+	}
+
+	app.img = img
+	app.buildStatus = "built"
+	app.deployStatus = "-"
+	app.line.LogfStatus(statuslogger.StatusSuccess, "%s: built %s", app.name(), img.Tag)
+}
+
+// deployWorkspaceApp deploys app once its dependencies are deployed, and
+// reports whether it succeeded.
+func deployWorkspaceApp(app *workspaceApp, deployed map[string]bool) bool {
+	if app.err != nil {
+		return false
+	}
+
+	if failedDeps := lo.Reject(app.dependsOn, func(dep string, _ int) bool { return deployed[dep] }); len(failedDeps) > 0 {
+		app.deployStatus = "skipped"
+		app.line.LogfStatus(statuslogger.StatusFailure, "%s: skipped, %s didn't deploy", app.name(), strings.Join(failedDeps, ", "))
+		return false
+	}
+
+	app.line.LogfStatus(statuslogger.StatusRunning, "%s: deploying", app.name())
+
+	appCompact, err := fly.ClientFromContext(app.ctx).GetAppCompact(app.ctx, app.name())
+	if err != nil {
+		deploynotify.NotifyFailure(app.ctx, err)
+		app.fail("failed", err)
+		return false
+	}
+	if err := deployToMachines(app.ctx, app.config, appCompact, app.img); err != nil {
+		deploynotify.NotifyFailure(app.ctx, err)
+		app.fail("failed", err)
+		return false
+	}
+
+	app.deployStatus = "deployed"
+	app.line.LogfStatus(statuslogger.StatusSuccess, "%s: deployed", app.name())
+	return true
+}
+
+func renderWorkspaceSummary(w io.Writer, root string, apps []*workspaceApp) {
+	rows := make([][]string, 0, len(apps))
+	for _, app := range apps {
+		dir, err := filepath.Rel(root, app.dir)
+		if err != nil {
+			dir = app.dir
+		}
+		image := ""
+		if app.img != nil {
+			image = app.img.Tag
+		}
+		rows = append(rows, []string{app.name(), dir, app.buildStatus, app.deployStatus, image})
+	}
+	_ = render.Table(w, "", rows, "App", "Directory", "Build", "Deploy", "Image")
+}
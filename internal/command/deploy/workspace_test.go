@@ -0,0 +1,93 @@
+package deploy
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/superfly/flyctl/internal/appconfig"
+)
+
+func writeWorkspaceApp(t *testing.T, root, dir, name string) {
+	t.Helper()
+	require.NoError(t, os.MkdirAll(filepath.Join(root, dir), 0o755))
+	content := fmt.Sprintf("app = %q\n", name)
+	require.NoError(t, os.WriteFile(filepath.Join(root, dir, appconfig.DefaultConfigFileName), []byte(content), 0o644))
+}
+
+func workspaceAppNames(apps []*workspaceApp) []string {
+	return lo.Map(apps, func(app *workspaceApp, _ int) string { return app.name() })
+}
+
+func Test_loadWorkspace_file(t *testing.T) {
+	root := t.TempDir()
+	writeWorkspaceApp(t, root, "web", "my-web")
+	writeWorkspaceApp(t, root, "api", "my-api")
+	writeWorkspaceApp(t, root, "migrator", "my-migrator")
+	writeWorkspaceApp(t, root, "unlisted", "my-unlisted")
+	require.NoError(t, os.WriteFile(filepath.Join(root, WorkspaceFileName), []byte(`
+[[apps]]
+path = "web"
+depends_on = ["my-api"]
+
+[[apps]]
+path = "api"
+depends_on = ["my-migrator"]
+
+[[apps]]
+path = "migrator"
+`), 0o644))
+
+	apps, err := loadWorkspace(root, "")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"my-migrator", "my-api", "my-web"}, workspaceAppNames(apps))
+	assert.Equal(t, filepath.Join(root, "api"), apps[1].dir)
+	assert.Equal(t, filepath.Join(root, "api", appconfig.DefaultConfigFileName), apps[1].configPath)
+}
+
+func Test_loadWorkspace_discover(t *testing.T) {
+	root := t.TempDir()
+	writeWorkspaceApp(t, root, "services/b", "b")
+	writeWorkspaceApp(t, root, "services/a", "a")
+	writeWorkspaceApp(t, root, "node_modules/dep", "dep")
+	writeWorkspaceApp(t, root, ".git/hidden", "hidden")
+
+	apps, err := loadWorkspace(root, "")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a", "b"}, workspaceAppNames(apps))
+
+	_, err = loadWorkspace(t.TempDir(), "")
+	assert.ErrorContains(t, err, "no app config found")
+}
+
+func Test_orderWorkspaceApps(t *testing.T) {
+	app := func(name string, deps ...string) *workspaceApp {
+		return &workspaceApp{config: &appconfig.Config{AppName: name}, configPath: name + "/fly.toml", dependsOn: deps}
+	}
+
+	apps, err := orderWorkspaceApps([]*workspaceApp{app("web", "api", "auth"), app("api", "db"), app("auth"), app("db")})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"auth", "db", "api", "web"}, workspaceAppNames(apps))
+
+	_, err = orderWorkspaceApps([]*workspaceApp{app("web", "api"), app("api", "web"), app("db")})
+	assert.ErrorContains(t, err, "the dependencies between web, api form a cycle")
+
+	_, err = orderWorkspaceApps([]*workspaceApp{app("web", "api")})
+	assert.ErrorContains(t, err, "app web depends on api, which isn't part of the workspace")
+
+	_, err = orderWorkspaceApps([]*workspaceApp{app("web"), app("web")})
+	assert.ErrorContains(t, err, "app web is configured by both")
+}
+
+func Test_workspaceLog_tail(t *testing.T) {
+	log := &workspaceLog{}
+	for i := 1; i <= 5; i++ {
+		fmt.Fprintf(log, "line %d\n", i)
+	}
+	assert.Equal(t, "line 4\nline 5", log.tail(2))
+	assert.Equal(t, "line 1\nline 2\nline 3\nline 4\nline 5", log.tail(10))
+}
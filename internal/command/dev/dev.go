@@ -0,0 +1,23 @@
+package dev
+
+import (
+	"github.com/spf13/cobra"
+	"github.com/superfly/flyctl/internal/command"
+)
+
+func New() (cmd *cobra.Command) {
+	const (
+		short = "Tools for developing and testing flyctl"
+		long  = short + "\n"
+		usage = "dev <command>"
+	)
+
+	cmd = command.New(usage, short, long, nil)
+	cmd.Hidden = true
+
+	cmd.AddCommand(
+		newFlapsEmulator(),
+	)
+
+	return
+}
@@ -0,0 +1,73 @@
+package dev
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/superfly/flyctl/internal/command"
+	"github.com/superfly/flyctl/internal/flag"
+	"github.com/superfly/flyctl/internal/flapsemulator"
+	"github.com/superfly/flyctl/iostreams"
+)
+
+func newFlapsEmulator() *cobra.Command {
+	const (
+		short = "Run a local, in-memory stand-in for the Machines API"
+		long  = short + `
+
+The emulator serves the machine, lease and volume endpoints flyctl uses, so
+that commands can be tried without touching real machines. Machines change
+state as soon as they're asked to and never run anything. Everything is lost
+when the emulator stops.
+
+Point flyctl at it by setting FLY_FLAPS_BASE_URL to the address it listens on.`
+		usage = "flaps-emulator"
+	)
+
+	cmd := command.New(usage, short, long, runFlapsEmulator)
+	cmd.Args = cobra.NoArgs
+
+	flag.Add(cmd,
+		flag.String{
+			Name:        "listen",
+			Description: "The address to listen on",
+			Default:     "127.0.0.1:4280",
+		},
+	)
+
+	return cmd
+}
+
+func runFlapsEmulator(ctx context.Context) error {
+	io := iostreams.FromContext(ctx)
+
+	listener, err := net.Listen("tcp", flag.GetString(ctx, "listen"))
+	if err != nil {
+		return fmt.Errorf("could not listen: %w", err)
+	}
+
+	server := &http.Server{
+		Handler:           flapsemulator.New(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = server.Shutdown(shutdownCtx)
+	}()
+
+	addr := listener.Addr().String()
+	fmt.Fprintf(io.Out, "Machines API emulator listening on %s\n", addr)
+	fmt.Fprintf(io.Out, "Point flyctl at it with: export FLY_FLAPS_BASE_URL=http://%s\n", addr)
+
+	if err := server.Serve(listener); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package command
+
+// This source file contains the [[deploy.freeze]] check shared by `fly deploy`,
+// `fly scale count` and `fly machine update`
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/logrusorgru/aurora"
+	"github.com/superfly/flyctl/iostreams"
+
+	"github.com/superfly/flyctl/internal/appconfig"
+	"github.com/superfly/flyctl/internal/flag"
+	"github.com/superfly/flyctl/internal/flag/flagnames"
+	"github.com/superfly/flyctl/internal/flyerr"
+)
+
+// MachineConfigMetadataKeyFlyFreezeOverride is set on the machines changed
+// during a freeze window to the reason given with --override-freeze.
+const MachineConfigMetadataKeyFlyFreezeOverride = "fly_freeze_override"
+
+// CheckDeployFreeze fails when now falls in a [[deploy.freeze]] window of
+// appConfig, unless --override-freeze gives a reason to go ahead. It returns
+// that reason when a window is overridden. The reason is only recorded in the
+// fly_freeze_override metadata of the machines the command changes, releases
+// don't keep it.
+func CheckDeployFreeze(ctx context.Context, appConfig *appconfig.Config, now time.Time) (string, error) {
+	if appConfig == nil {
+		return "", nil
+	}
+
+	freeze, err := appConfig.ActiveDeployFreeze(now)
+	if err != nil || freeze == nil {
+		return "", err
+	}
+
+	reason := flag.GetOverrideFreeze(ctx)
+	if reason == "" {
+		return "", flyerr.GenericErr{
+			Err:      fmt.Sprintf("%s is in a deploy freeze window %s", appConfig.AppName, freeze),
+			Descript: "Deploys and scaling are refused during the [[deploy.freeze]] windows of fly.toml.",
+			Suggest:  fmt.Sprintf("If this can't wait, run the command again with --%s \"<reason>\"", flagnames.OverrideFreeze),
+		}
+	}
+
+	io := iostreams.FromContext(ctx)
+	fmt.Fprintf(io.ErrOut, "%s Overriding deploy freeze window %s: %s\n", aurora.Yellow("WARN"), freeze, reason)
+	return reason, nil
+}
@@ -0,0 +1,242 @@
+package machine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/samber/lo"
+	"github.com/sourcegraph/conc/pool"
+	"github.com/spf13/cobra"
+	fly "github.com/superfly/fly-go"
+	"github.com/superfly/fly-go/flaps"
+	"github.com/superfly/flyctl/internal/appconfig"
+	"github.com/superfly/flyctl/internal/command"
+	"github.com/superfly/flyctl/internal/flag"
+	mach "github.com/superfly/flyctl/internal/machine"
+	"github.com/superfly/flyctl/internal/prompt"
+	"github.com/superfly/flyctl/iostreams"
+)
+
+func newApply() *cobra.Command {
+	const (
+		short = "Create, update and destroy machines to match a manifest"
+		long  = short + `
+
+The manifest is a YAML, TOML or JSON file declaring named machine configs,
+along with the region they run in and how many of them to run, for workloads
+living outside of fly.toml such as scheduled jobs or singletons:
+
+  machines:
+    - name: cleanup
+      region: ord
+      count: 1
+      config:
+        image: registry.fly.io/my-app:cleanup
+        schedule: daily
+        guest:
+          cpu_kind: shared
+          cpus: 1
+          memory_mb: 256
+
+Config fields are named as in the Machines API. Machines are tracked through
+their "` + mach.ManifestNameKey + `" metadata: the missing ones are created, those whose
+config changed are updated, and with --prune, the ones no longer declared are
+destroyed. New machines are named after their entry, with a -1, -2... suffix
+for the replicas beyond the first one.`
+		usage = "apply -f <manifest>"
+	)
+
+	cmd := command.New(usage, short, long, runApply,
+		command.RequireSession,
+		command.RequireAppName,
+	)
+
+	cmd.Args = cobra.NoArgs
+
+	flag.Add(
+		cmd,
+		flag.App(),
+		flag.AppConfig(),
+		flag.Yes(),
+		concurrencyFlag,
+		flag.String{
+			Name:        "file",
+			Shorthand:   "f",
+			Description: "Path to the manifest to apply",
+		},
+		flag.Bool{
+			Name:        "prune",
+			Description: "Destroy the machines the manifest no longer declares",
+		},
+		flag.Bool{
+			Name:        "diff",
+			Description: "Show the changes to apply without applying them",
+		},
+	)
+
+	return cmd
+}
+
+func runApply(ctx context.Context) error {
+	var (
+		io       = iostreams.FromContext(ctx)
+		colorize = io.ColorScheme()
+		appName  = appconfig.NameFromContext(ctx)
+		path     = flag.GetString(ctx, "file")
+		prune    = flag.GetBool(ctx, "prune")
+	)
+
+	if path == "" {
+		return errors.New("a manifest must be specified with --file")
+	}
+	manifest, err := mach.LoadManifest(path)
+	if err != nil {
+		return err
+	}
+
+	ctx, err = buildContextFromAppName(ctx, appName)
+	if err != nil {
+		return err
+	}
+	machines, err := mach.ListActive(ctx)
+	if err != nil {
+		return fmt.Errorf("could not get a list of machines: %w", err)
+	}
+
+	changes := manifest.Plan(machines)
+	counts := lo.CountValuesBy(changes, func(c *mach.ManifestChange) mach.ManifestAction { return c.Action })
+	for _, c := range changes {
+		switch c.Action {
+		case mach.ManifestCreate:
+			fmt.Fprintf(io.Out, "%s create %s (%s) in %s\n", colorize.Green("+"), colorize.Bold(c.Entry.Name), c.Name, c.Entry.Region)
+		case mach.ManifestUpdate:
+			fmt.Fprintf(io.Out, "%s update %s (%s) in %s\n", colorize.Yellow("~"), colorize.Bold(c.Entry.Name), c.Machine.ID, c.Machine.Region)
+			if diff := mach.ConfigCompare(ctx, *c.Machine.Config, *c.Entry.MachineConfig()); diff != "" {
+				fmt.Fprintf(io.Out, "\n%s\n\n", diff)
+			}
+		case mach.ManifestOrphan:
+			name := c.Machine.Config.Metadata[mach.ManifestNameKey]
+			if prune {
+				fmt.Fprintf(io.Out, "%s destroy %s (%s) in %s\n", colorize.Red("-"), colorize.Bold(name), c.Machine.ID, c.Machine.Region)
+			} else {
+				fmt.Fprintf(io.Out, "%s orphaned %s (%s) in %s, use --prune to destroy it\n", colorize.Gray("!"), colorize.Bold(name), c.Machine.ID, c.Machine.Region)
+			}
+		}
+	}
+
+	orphans := counts[mach.ManifestOrphan]
+	if !prune {
+		orphans = 0
+	}
+	if counts[mach.ManifestCreate]+counts[mach.ManifestUpdate]+orphans == 0 {
+		fmt.Fprintf(io.Out, "Machines of %s match %s, nothing to do\n", appName, path)
+		return nil
+	}
+	fmt.Fprintf(io.Out, "\n%d to create, %d to update, %d to destroy, %d unchanged\n",
+		counts[mach.ManifestCreate], counts[mach.ManifestUpdate], orphans, counts[mach.ManifestUnchanged])
+
+	if flag.GetBool(ctx, "diff") {
+		return nil
+	}
+
+	if !flag.GetYes(ctx) {
+		switch confirmed, err := prompt.Confirmf(ctx, "Apply these changes to %s?", appName); {
+		case prompt.IsNonInteractive(err):
+			return prompt.NonInteractiveError("yes flag must be specified when not running interactively")
+		case err != nil:
+			return err
+		case !confirmed:
+			return nil
+		}
+	}
+
+	// Replacements come up before the machines they replace are destroyed
+	if err := forEachChange(ctx, changes, func(c *mach.ManifestChange) error {
+		switch c.Action {
+		case mach.ManifestCreate:
+			return applyCreate(ctx, c.Entry, c.Name)
+		case mach.ManifestUpdate:
+			return applyUpdate(ctx, c.Entry, c.Machine)
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	if !prune || counts[mach.ManifestOrphan] == 0 {
+		return nil
+	}
+
+	app, err := fly.ClientFromContext(ctx).GetAppCompact(ctx, appName)
+	if err != nil {
+		return fmt.Errorf("could not get app '%s': %w", appName, err)
+	}
+	return forEachChange(ctx, changes, func(c *mach.ManifestChange) error {
+		if c.Action != mach.ManifestOrphan {
+			return nil
+		}
+		machine, release, err := mach.AcquireLease(ctx, c.Machine)
+		defer release()
+		if err != nil {
+			return err
+		}
+		if err := Destroy(ctx, app, machine, true); err != nil {
+			return err
+		}
+		fmt.Fprintf(io.Out, "%s has been destroyed\n", machine.ID)
+		return nil
+	})
+}
+
+// forEachChange runs fn on the changes, --concurrency of them at a time.
+func forEachChange(ctx context.Context, changes []*mach.ManifestChange, fn func(*mach.ManifestChange) error) error {
+	p := pool.New().WithErrors().WithMaxGoroutines(max(flag.GetInt(ctx, concurrencyFlag.Name), 1))
+	for _, c := range changes {
+		c := c
+		p.Go(func() error { return fn(c) })
+	}
+	return p.Wait()
+}
+
+func applyCreate(ctx context.Context, entry *mach.ManifestMachine, name string) error {
+	var (
+		io          = iostreams.FromContext(ctx)
+		colorize    = io.ColorScheme()
+		flapsClient = flaps.FromContext(ctx)
+		config      = entry.MachineConfig()
+	)
+
+	input := fly.LaunchMachineInput{
+		Name:       name,
+		Region:     entry.Region,
+		Config:     config,
+		SkipLaunch: len(config.Standbys) > 0,
+	}
+	machine, err := flapsClient.Launch(ctx, input)
+	if err != nil {
+		return fmt.Errorf("could not create machine %s: %w", name, err)
+	}
+	fmt.Fprintf(io.Out, "Created machine %s (%s) in %s\n", colorize.Bold(machine.ID), name, entry.Region)
+
+	if input.SkipLaunch {
+		return nil
+	}
+	return mach.WaitForStartOrStop(ctx, machine, lo.Ternary(config.Schedule != "", "stop", "start"), 5*time.Minute)
+}
+
+func applyUpdate(ctx context.Context, entry *mach.ManifestMachine, machine *fly.Machine) error {
+	machine, release, err := mach.AcquireLease(ctx, machine)
+	defer release()
+	if err != nil {
+		return err
+	}
+
+	config := entry.MachineConfig()
+	return mach.Update(ctx, machine, &fly.LaunchMachineInput{
+		Name:       machine.Name,
+		Region:     machine.Region,
+		Config:     config,
+		SkipLaunch: len(config.Standbys) > 0,
+	})
+}
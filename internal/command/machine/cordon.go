@@ -5,6 +5,7 @@ import (
 	"fmt"
 
 	"github.com/spf13/cobra"
+	fly "github.com/superfly/fly-go"
 	"github.com/superfly/fly-go/flaps"
 	"github.com/superfly/flyctl/internal/command"
 	"github.com/superfly/flyctl/internal/flag"
@@ -29,6 +30,9 @@ func newMachineCordon() *cobra.Command {
 		flag.App(),
 		flag.AppConfig(),
 		selectFlag,
+		selectorFlag,
+		concurrencyFlag,
+		flag.Yes(),
 	)
 
 	cmd.Args = cobra.ArbitraryArgs
@@ -54,12 +58,11 @@ func runMachineCordon(ctx context.Context) (err error) {
 
 	flapsClient := flaps.FromContext(ctx)
 
-	for _, machine := range machines {
-		fmt.Fprintf(io.Out, "Activating cordon on machine %s...\n", machine.ID)
-		if err = flapsClient.Cordon(ctx, machine.ID, machine.LeaseNonce); err != nil {
+	return forEachMachine(ctx, machines, func(machine *fly.Machine) error {
+		if err := flapsClient.Cordon(ctx, machine.ID, machine.LeaseNonce); err != nil {
 			return err
 		}
-		fmt.Fprintf(io.Out, "done!\n")
-	}
-	return
+		fmt.Fprintf(io.Out, "Activated cordon on machine %s\n", machine.ID)
+		return nil
+	})
 }
@@ -35,6 +35,9 @@ This command requires a machine to be in a stopped state unless the force flag i
 		flag.App(),
 		flag.AppConfig(),
 		selectFlag,
+		selectorFlag,
+		concurrencyFlag,
+		flag.Yes(),
 		flag.Bool{
 			Name:        "force",
 			Shorthand:   "f",
@@ -48,7 +51,7 @@ This command requires a machine to be in a stopped state unless the force flag i
 }
 
 func runMachineDestroy(ctx context.Context) (err error) {
-	if len(flag.Args(ctx)) == 0 {
+	if len(flag.Args(ctx)) == 0 && flag.GetString(ctx, selectorFlag.Name) == "" {
 		machine, ctx, err := selectOneMachine(ctx, "", "", false)
 		if err != nil {
 			return err
@@ -75,13 +78,11 @@ func runMachineDestroy(ctx context.Context) (err error) {
 		}
 		defer release()
 
-		for _, machine := range machines {
-			err = singleDestroyRun(ctx, machine)
-			if err != nil {
-				return err
-			}
+		if err := forEachMachine(ctx, machines, func(machine *fly.Machine) error {
+			return singleDestroyRun(ctx, machine)
+		}); err != nil {
+			return err
 		}
-
 	}
 
 	return nil
@@ -0,0 +1,208 @@
+package machine
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/samber/lo"
+	"github.com/sourcegraph/conc/pool"
+	"github.com/spf13/cobra"
+	fly "github.com/superfly/fly-go"
+	"github.com/superfly/fly-go/flaps"
+	"github.com/superfly/flyctl/internal/appconfig"
+	"github.com/superfly/flyctl/internal/command"
+	"github.com/superfly/flyctl/internal/config"
+	"github.com/superfly/flyctl/internal/flag"
+	"github.com/superfly/flyctl/internal/flag/flagnames"
+	mach "github.com/superfly/flyctl/internal/machine"
+	"github.com/superfly/flyctl/internal/render"
+	"github.com/superfly/flyctl/iostreams"
+)
+
+func newEvents() *cobra.Command {
+	const (
+		short = "Show a timeline of the events of the machines of an app"
+		long  = short + `
+
+Events of all the machines, or of those of a process group, are merged in time
+order: launches, starts, exits with their exit code and whether the machine ran
+out of memory, restarts, updates and the last health check transitions. Exits
+of machines restarting over and over are flagged as crash loops.
+
+--since and --until take a duration back from now, like 30m, or an RFC 3339
+timestamp.`
+		usage = "events"
+	)
+
+	cmd := command.New(usage, short, long, runEvents,
+		command.RequireSession,
+		command.RequireAppName,
+	)
+
+	cmd.Args = cobra.NoArgs
+
+	flag.Add(
+		cmd,
+		flag.App(),
+		flag.AppConfig(),
+		flag.JSONOutput(),
+		flag.ProcessGroup("Only show the events of the machines of this process group"),
+		flag.String{
+			Name:        "since",
+			Description: "Only show the events since this time, like 1h or 2024-03-01T12:00:00Z",
+		},
+		flag.String{
+			Name:        "until",
+			Description: "Only show the events before this time, like 10m or 2024-03-01T13:00:00Z",
+		},
+	)
+
+	return cmd
+}
+
+func runEvents(ctx context.Context) error {
+	var (
+		io       = iostreams.FromContext(ctx)
+		colorize = io.ColorScheme()
+		appName  = appconfig.NameFromContext(ctx)
+		group    = flag.GetString(ctx, flagnames.ProcessGroup)
+		now      = time.Now()
+	)
+
+	since, err := parseEventTime(flag.GetString(ctx, "since"), now)
+	if err != nil {
+		return err
+	}
+	until, err := parseEventTime(flag.GetString(ctx, "until"), now)
+	if err != nil {
+		return err
+	}
+
+	ctx, err = buildContextFromAppName(ctx, appName)
+	if err != nil {
+		return err
+	}
+	machines, err := listMachinesWithEvents(ctx, group)
+	if err != nil {
+		return err
+	}
+
+	events := mach.Timeline(machines, since, until)
+	if config.FromContext(ctx).JSONOutput {
+		return render.JSON(io.Out, events)
+	}
+
+	if len(events) == 0 {
+		fmt.Fprintf(io.Out, "No events found for the machines of %s\n", appName)
+		return nil
+	}
+
+	rows := lo.Map(events, func(e *mach.TimelineEvent, _ int) []string {
+		return []string{
+			e.Time.Format(time.RFC3339),
+			e.MachineID,
+			e.Region,
+			e.ProcessGroup,
+			e.Type,
+			e.Status,
+			e.Source,
+			timelineEventInfo(e, colorize),
+		}
+	})
+	if err := render.Table(io.Out, "", rows, "Time", "Machine", "Region", "Process Group", "Event", "Status", "Source", "Info"); err != nil {
+		return err
+	}
+
+	for _, m := range machines {
+		if mach.IsConstantlyRestarting(m) {
+			fmt.Fprintf(io.Out, "%s machine %s in %s is crash looping, see its logs with 'fly logs -a %s -i %s'\n", colorize.WarningIcon(), m.ID, m.Region, appName, m.ID)
+		}
+	}
+	return nil
+}
+
+// listMachinesWithEvents gets the machines of group, or all of them, one by
+// one since listing them doesn't return their events.
+func listMachinesWithEvents(ctx context.Context, group string) ([]*fly.Machine, error) {
+	flapsClient := flaps.FromContext(ctx)
+
+	machines, err := mach.ListActive(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("could not get a list of machines: %w", err)
+	}
+	if group != "" {
+		machines = lo.Filter(machines, func(m *fly.Machine, _ int) bool {
+			return m.ProcessGroup() == group
+		})
+		if len(machines) == 0 {
+			return nil, fmt.Errorf("no machines of %s are in the process group '%s'", appconfig.NameFromContext(ctx), group)
+		}
+	}
+
+	p := pool.NewWithResults[*fly.Machine]().WithErrors().WithMaxGoroutines(8)
+	for _, m := range machines {
+		m := m
+		p.Go(func() (*fly.Machine, error) {
+			machine, err := flapsClient.Get(ctx, m.ID)
+			if err != nil {
+				return nil, fmt.Errorf("could not get machine %s: %w", m.ID, err)
+			}
+			return machine, nil
+		})
+	}
+	machines, err = p.Wait()
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(machines, func(i, j int) bool {
+		return machines[i].ID < machines[j].ID
+	})
+	return machines, nil
+}
+
+// parseEventTime reads a duration back from now or an RFC 3339 timestamp. An
+// empty string gives the zero time.
+func parseEventTime(s string, now time.Time) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		return now.Add(-d), nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid time '%s', expected a duration like 1h or an RFC 3339 timestamp", s)
+}
+
+func timelineEventInfo(e *mach.TimelineEvent, colorize *iostreams.ColorScheme) string {
+	var info []string
+	if e.Type == mach.TimelineCheckEvent {
+		info = append(info, e.Check)
+		if e.CheckOutput != "" {
+			info = append(info, strings.Join(strings.Fields(e.CheckOutput), " "))
+		}
+		return strings.Join(info, ": ")
+	}
+
+	if e.ExitCode != nil {
+		info = append(info, fmt.Sprintf("exit_code=%d", *e.ExitCode))
+	}
+	if e.OOMKilled {
+		info = append(info, "oom_killed=true")
+	}
+	if e.RequestedStop {
+		info = append(info, "requested_stop=true")
+	}
+	if e.RestartCount > 0 {
+		info = append(info, fmt.Sprintf("restart_count=%d", e.RestartCount))
+	}
+	s := strings.Join(info, ",")
+	if e.CrashLoop {
+		s = strings.TrimSpace(s + " " + colorize.Red("crash loop"))
+	}
+	return s
+}
@@ -1,15 +1,27 @@
 package machine
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
+	"github.com/samber/lo"
 	"github.com/spf13/cobra"
 	fly "github.com/superfly/fly-go"
 	"github.com/superfly/fly-go/flaps"
+	"github.com/superfly/flyctl/internal/appconfig"
 	"github.com/superfly/flyctl/internal/command"
+	"github.com/superfly/flyctl/internal/command/ssh"
 	"github.com/superfly/flyctl/internal/config"
 	"github.com/superfly/flyctl/internal/flag"
+	"github.com/superfly/flyctl/internal/flag/flagnames"
 	"github.com/superfly/flyctl/internal/render"
 	"github.com/superfly/flyctl/iostreams"
 )
@@ -17,9 +29,18 @@ import (
 func newMachineExec() *cobra.Command {
 
 	const (
-		short = "Execute a command on a machine"
-		long  = short + "\n"
-		usage = "exec [machine-id] <command>"
+		short = "Execute a command on machines"
+		long  = short + `
+
+The output of the command is streamed as it runs, over SSH through the
+WireGuard tunnel of the organization. When the tunnel can't be brought up or a
+machine can't be connected to, the command goes through the Machines API
+instead, which only shows its output once it exits and can't be given --stdin.
+
+The command runs on the machines given by ID, on those of --process-group or
+those --selector matches. With several machines, their output lines are prefixed
+with their ID and a summary of their exit codes is shown at the end.`
+		usage = "exec [machine-id...] <command>"
 	)
 
 	cmd := command.New(usage, short, long, runMachineExec,
@@ -33,68 +54,318 @@ func newMachineExec() *cobra.Command {
 		flag.AppConfig(),
 		flag.JSONOutput(),
 		selectFlag,
+		selectorFlag,
+		concurrencyFlag,
+		flag.Yes(),
+		flag.ProcessGroup("Run the command on the machines of this process group"),
 		flag.Int{
 			Name:        "timeout",
 			Description: "Timeout in seconds",
 		},
+		flag.Bool{
+			Name:        "stdin",
+			Shorthand:   "i",
+			Description: "Pass standard input to the command",
+		},
 	)
 
-	cmd.Args = cobra.RangeArgs(1, 2)
+	cmd.Args = cobra.MinimumNArgs(1)
 
 	return cmd
 }
 
+// machineExecResult is the outcome of the command on one of the machines.
+type machineExecResult struct {
+	MachineID string                   `json:"machine_id"`
+	Region    string                   `json:"region"`
+	Result    *fly.MachineExecResponse `json:"result,omitempty"`
+	Error     string                   `json:"error,omitempty"`
+}
+
 func runMachineExec(ctx context.Context) (err error) {
 	var (
-		args   = flag.Args(ctx)
-		io     = iostreams.FromContext(ctx)
-		config = config.FromContext(ctx)
-
-		machineID     string
-		haveMachineID bool
-		command       string
+		args       = flag.Args(ctx)
+		ios        = iostreams.FromContext(ctx)
+		machineIDs = args[:len(args)-1]
+		in         = &fly.MachineExecRequest{
+			Cmd:     args[len(args)-1],
+			Timeout: flag.GetInt(ctx, "timeout"),
+		}
+		// many is set when the command is meant for several machines, however
+		// many of them end up selected
+		many = len(machineIDs) > 1 || flag.GetString(ctx, selectorFlag.Name) != "" || flag.GetString(ctx, flagnames.ProcessGroup) != ""
 	)
 
-	if len(args) == 2 {
-		machineID = args[0]
-		haveMachineID = true
-		command = args[1]
-	} else {
-		command = args[0]
+	machines, ctx, err := selectExecMachines(ctx, machineIDs)
+	if err != nil {
+		return err
+	}
+
+	if config.FromContext(ctx).JSONOutput {
+		if flag.GetBool(ctx, "stdin") {
+			return errors.New("--stdin can't be used with --json")
+		}
+		return runMachineExecJSON(ctx, machines, in, many)
 	}
 
-	current, ctx, err := selectOneMachine(ctx, "", machineID, haveMachineID)
+	exec, err := newMachineExecFunc(ctx, in)
 	if err != nil {
 		return err
 	}
-	flapsClient := flaps.FromContext(ctx)
 
-	var timeout = flag.GetInt(ctx, "timeout")
+	// A single machine reads stdin as it comes, several get a copy of it each
+	stdin := func() io.Reader { return nil }
+	if flag.GetBool(ctx, "stdin") {
+		if many {
+			data, err := io.ReadAll(ios.In)
+			if err != nil {
+				return fmt.Errorf("failed to read stdin: %w", err)
+			}
+			stdin = func() io.Reader { return bytes.NewReader(data) }
+		} else {
+			stdin = func() io.Reader { return ios.In }
+		}
+	}
+
+	if !many {
+		m := machines[0]
+		exitCode, err := exec(ctx, m, stdin(), ios.Out, ios.ErrOut)
+		if err != nil {
+			return fmt.Errorf("could not exec command on machine %s: %w", m.ID, err)
+		}
+		if exitCode != 0 {
+			fmt.Fprintf(ios.Out, "Exit code: %d\n", exitCode)
+		}
+		return nil
+	}
+
+	var (
+		mu       sync.Mutex
+		results  = make([]*machineExecResult, len(machines))
+		colorize = ios.ColorScheme()
+	)
+	for i, m := range machines {
+		results[i] = &machineExecResult{MachineID: m.ID, Region: m.Region}
+	}
+	// Failures are reported with the output of the other machines
+	_ = forEachMachine(ctx, machines, func(m *fly.Machine) error {
+		r := results[slices.Index(machines, m)]
+		prefix := colorize.Magenta(m.ID) + " | "
+		stdout := &prefixWriter{w: ios.Out, mu: &mu, prefix: prefix}
+		stderr := &prefixWriter{w: ios.ErrOut, mu: &mu, prefix: prefix}
+
+		exitCode, err := exec(ctx, m, stdin(), stdout, stderr)
+		stdout.Flush()
+		stderr.Flush()
+		if err != nil {
+			r.Error = err.Error()
+		} else {
+			r.Result = &fly.MachineExecResponse{ExitCode: int32(exitCode)}
+		}
+		return nil
+	})
+
+	rows := lo.Map(results, func(r *machineExecResult, _ int) []string {
+		if r.Error != "" {
+			return []string{r.MachineID, r.Region, "", r.Error}
+		}
+		return []string{r.MachineID, r.Region, strconv.Itoa(int(r.Result.ExitCode)), ""}
+	})
+	fmt.Fprintln(ios.Out)
+	if err := render.Table(ios.Out, "", rows, "ID", "Region", "Exit Code", "Error"); err != nil {
+		return err
+	}
+	return execResultsError(results)
+}
+
+// execResultsError counts the machines the command couldn't run on or exited
+// with a non-zero code on.
+func execResultsError(results []*machineExecResult) error {
+	failed := lo.CountBy(results, func(r *machineExecResult) bool {
+		return r.Error != "" || r.Result == nil || r.Result.ExitCode != 0
+	})
+	if failed > 0 {
+		return fmt.Errorf("command failed on %d of %d machines", failed, len(results))
+	}
+	return nil
+}
+
+// selectExecMachines returns the machines given by ID, or those of
+// --process-group and --selector.
+func selectExecMachines(ctx context.Context, machineIDs []string) ([]*fly.Machine, context.Context, error) {
+	selector := flag.GetString(ctx, selectorFlag.Name)
+	if group := flag.GetString(ctx, flagnames.ProcessGroup); group != "" {
+		selector = strings.Join(lo.Compact([]string{selector, "process_group=" + group}), ",")
+	}
+
+	switch {
+	case selector != "":
+		appName := appconfig.NameFromContext(ctx)
+		if len(machineIDs) > 0 {
+			return nil, nil, errors.New("machine IDs can't be used with --selector or --process-group")
+		} else if appName == "" {
+			return nil, nil, errors.New("an app name must be specified to use --selector or --process-group")
+		}
+		ctx, err := buildContextFromAppName(ctx, appName)
+		if err != nil {
+			return nil, nil, err
+		}
+		machines, err := selectMatchingMachines(ctx, selector)
+		return machines, ctx, err
+	case len(machineIDs) > 1:
+		return selectManyMachines(ctx, machineIDs)
+	default:
+		machine, ctx, err := selectOneMachine(ctx, "", strings.Join(machineIDs, ""), len(machineIDs) == 1)
+		if err != nil {
+			return nil, nil, err
+		}
+		return []*fly.Machine{machine}, ctx, nil
+	}
+}
+
+// machineExecFunc runs a command on m, writes its output to stdout and
+// stderr, and returns its exit code.
+type machineExecFunc func(ctx context.Context, m *fly.Machine, stdin io.Reader, stdout, stderr io.Writer) (int, error)
+
+// newMachineExecFunc runs commands over SSH, to stream their output. The
+// Machines API only returns the output once commands exit, and can't pass
+// them stdin, so it's only relied on when the tunnel can't be brought up or a
+// machine can't be connected to.
+func newMachineExecFunc(ctx context.Context, in *fly.MachineExecRequest) (machineExecFunc, error) {
+	var (
+		ios     = iostreams.FromContext(ctx)
+		client  = fly.ClientFromContext(ctx)
+		appName = appconfig.NameFromContext(ctx)
+	)
 
-	in := &fly.MachineExecRequest{
-		Cmd:     command,
-		Timeout: timeout,
+	app, err := client.GetAppCompact(ctx, appName)
+	if err != nil {
+		return nil, fmt.Errorf("could not get app '%s': %w", appName, err)
 	}
 
-	out, err := flapsClient.Exec(ctx, current.ID, in)
+	_, dialer, err := ssh.BringUpAgent(ctx, client, app, false)
 	if err != nil {
-		return fmt.Errorf("could not exec command on machine %s: %w", current.ID, err)
+		if flag.GetBool(ctx, "stdin") {
+			return nil, fmt.Errorf("--stdin requires an SSH connection to the machines: %w", err)
+		}
+		fmt.Fprintf(ios.ErrOut, "WARN could not connect over SSH, output will show once the command exits: %v\n", err)
+		return apiMachineExecFunc(ctx, in), nil
+	}
+
+	apiExec := apiMachineExecFunc(ctx, in)
+	return func(ctx context.Context, m *fly.Machine, stdin io.Reader, stdout, stderr io.Writer) (int, error) {
+		sshCtx := ctx
+		if in.Timeout > 0 {
+			var cancel context.CancelFunc
+			sshCtx, cancel = context.WithTimeout(ctx, time.Duration(in.Timeout)*time.Second)
+			defer cancel()
+		}
+
+		sshClient, err := ssh.Connect(&ssh.ConnectParams{
+			Ctx:            sshCtx,
+			Org:            app.Organization,
+			Username:       ssh.DefaultSshUsername,
+			Dialer:         dialer,
+			DisableSpinner: true,
+			AppNames:       []string{app.Name},
+		}, m.PrivateIP)
+		if err != nil {
+			if stdin != nil {
+				return 0, fmt.Errorf("--stdin requires an SSH connection to the machine: %w", err)
+			}
+			fmt.Fprintf(stderr, "WARN could not connect over SSH, output will show once the command exits: %v\n", err)
+			return apiExec(ctx, m, nil, stdout, stderr)
+		}
+		defer sshClient.Close()
+
+		return sshClient.Exec(sshCtx, in.Cmd, stdin, stdout, stderr)
+	}, nil
+}
+
+func apiMachineExecFunc(ctx context.Context, in *fly.MachineExecRequest) machineExecFunc {
+	flapsClient := flaps.FromContext(ctx)
+	return func(ctx context.Context, m *fly.Machine, _ io.Reader, stdout, stderr io.Writer) (int, error) {
+		out, err := flapsClient.Exec(ctx, m.ID, in)
+		if err != nil {
+			return 0, err
+		}
+		fmt.Fprint(stdout, out.StdOut)
+		fmt.Fprint(stderr, out.StdErr)
+		return int(out.ExitCode), nil
+	}
+}
+
+// runMachineExecJSON runs the command through the Machines API, which
+// returns the whole output of the command at once.
+func runMachineExecJSON(ctx context.Context, machines []*fly.Machine, in *fly.MachineExecRequest, many bool) error {
+	var (
+		ios         = iostreams.FromContext(ctx)
+		flapsClient = flaps.FromContext(ctx)
+	)
+
+	if !many {
+		out, err := flapsClient.Exec(ctx, machines[0].ID, in)
+		if err != nil {
+			return fmt.Errorf("could not exec command on machine %s: %w", machines[0].ID, err)
+		}
+		return render.JSON(ios.Out, out)
 	}
 
-	if config.JSONOutput {
-		return render.JSON(io.Out, out)
+	results := make([]*machineExecResult, len(machines))
+	for i, m := range machines {
+		results[i] = &machineExecResult{MachineID: m.ID, Region: m.Region}
 	}
+	_ = forEachMachine(ctx, machines, func(m *fly.Machine) error {
+		r := results[slices.Index(machines, m)]
+		res, err := flapsClient.Exec(ctx, m.ID, in)
+		if err != nil {
+			r.Error = err.Error()
+		}
+		r.Result = res
+		return nil
+	})
 
-	if out.ExitCode != 0 {
-		fmt.Fprintf(io.Out, "Exit code: %d\n", out.ExitCode)
+	if err := render.JSON(ios.Out, results); err != nil {
+		return err
 	}
+	return execResultsError(results)
+}
+
+// prefixWriter prefixes the lines written to it, so that the output of
+// several machines can be told apart. Whole lines are written under mu.
+type prefixWriter struct {
+	w      io.Writer
+	mu     *sync.Mutex
+	prefix string
+	buf    []byte
+}
 
-	if out.StdOut != "" {
-		fmt.Fprint(io.Out, out.StdOut)
+func (p *prefixWriter) Write(b []byte) (int, error) {
+	p.buf = append(p.buf, b...)
+	for {
+		i := bytes.IndexByte(p.buf, '\n')
+		if i < 0 {
+			break
+		}
+		if err := p.writeLine(p.buf[:i+1]); err != nil {
+			return 0, err
+		}
+		p.buf = p.buf[i+1:]
 	}
-	if out.StdErr != "" {
-		fmt.Fprint(io.ErrOut, out.StdErr)
+	return len(b), nil
+}
+
+// Flush writes the last line when it isn't terminated.
+func (p *prefixWriter) Flush() {
+	if len(p.buf) > 0 {
+		_ = p.writeLine(append(p.buf, '\n'))
+		p.buf = nil
 	}
+}
 
-	return
+func (p *prefixWriter) writeLine(line []byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	_, err := fmt.Fprintf(p.w, "%s%s", p.prefix, line)
+	return err
 }
@@ -0,0 +1,159 @@
+package machine
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	fly "github.com/superfly/fly-go"
+	"github.com/superfly/fly-go/tokens"
+	"github.com/superfly/flyctl/internal/appconfig"
+	"github.com/superfly/flyctl/internal/config"
+	"github.com/superfly/flyctl/internal/flag"
+	"github.com/superfly/flyctl/internal/flapsemulator"
+	"github.com/superfly/flyctl/iostreams"
+)
+
+func TestPrefixWriter(t *testing.T) {
+	var (
+		out bytes.Buffer
+		mu  sync.Mutex
+	)
+	w := &prefixWriter{w: &out, mu: &mu, prefix: "m1 | "}
+
+	fmt.Fprint(w, "hel")
+	assert.Empty(t, out.String(), "partial lines are held back")
+	fmt.Fprint(w, "lo\nwor")
+	assert.Equal(t, "m1 | hello\n", out.String())
+	fmt.Fprint(w, "ld\nlast")
+	w.Flush()
+	w.Flush()
+	assert.Equal(t, "m1 | hello\nm1 | world\nm1 | last\n", out.String())
+}
+
+func TestPrefixWriterConcurrently(t *testing.T) {
+	var (
+		out bytes.Buffer
+		mu  sync.Mutex
+		wg  sync.WaitGroup
+	)
+	for _, id := range []string{"a", "b", "c"} {
+		wg.Add(1)
+		go func(id string) {
+			defer wg.Done()
+			w := &prefixWriter{w: &out, mu: &mu, prefix: id + " | "}
+			for i := 0; i < 100; i++ {
+				// Lines are written in pieces, like a command flushing its output
+				line := fmt.Sprintf("%s-%d\n", strings.Repeat(id, 10), i)
+				fmt.Fprint(w, line[:4])
+				fmt.Fprint(w, line[4:])
+			}
+			w.Flush()
+		}(id)
+	}
+	wg.Wait()
+
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	require.Len(t, lines, 300)
+	for _, line := range lines {
+		id := line[:1]
+		assert.Regexp(t, fmt.Sprintf(`^%s \| %s-\d+$`, id, strings.Repeat(id, 10)), line)
+	}
+}
+
+func TestExecResultsError(t *testing.T) {
+	results := []*machineExecResult{
+		{MachineID: "ok", Result: &fly.MachineExecResponse{ExitCode: 0}},
+		{MachineID: "exited", Result: &fly.MachineExecResponse{ExitCode: 2}},
+		{MachineID: "unreachable", Error: "connection refused"},
+	}
+	assert.EqualError(t, execResultsError(results), "command failed on 2 of 3 machines")
+	assert.NoError(t, execResultsError(results[:1]))
+}
+
+// execContext returns the context of `fly machine exec` run with args on
+// my-app, whose machines are served by the emulator.
+func execContext(t *testing.T, args ...string) (context.Context, *flapsemulator.Server) {
+	t.Helper()
+
+	emulator, _ := flapsemulator.NewTestClient(t, "my-app")
+
+	cmd := newMachineExec()
+	require.NoError(t, cmd.ParseFlags(args))
+
+	ios, _, _, _ := iostreams.Test()
+	ctx := iostreams.NewContext(context.Background(), ios)
+	ctx = config.NewContext(ctx, &config.Config{Tokens: tokens.Parse("x")})
+	ctx = flag.NewContext(ctx, cmd.Flags())
+	ctx = appconfig.WithName(ctx, "my-app")
+	return ctx, emulator
+}
+
+func execMachine(region, processGroup string) *fly.Machine {
+	return &fly.Machine{
+		Region: region,
+		Config: &fly.MachineConfig{
+			Image:    "nginx",
+			Metadata: map[string]string{fly.MachineConfigMetadataKeyFlyProcessGroup: processGroup},
+		},
+	}
+}
+
+func TestSelectExecMachines(t *testing.T) {
+	machineIDs := func(machines []*fly.Machine) []string {
+		return lo.Map(machines, func(m *fly.Machine, _ int) string { return m.ID })
+	}
+
+	t.Run("by ID", func(t *testing.T) {
+		ctx, emulator := execContext(t)
+		web := emulator.AddMachine("my-app", execMachine("fra", "app"))
+		worker := emulator.AddMachine("my-app", execMachine("fra", "worker"))
+		emulator.AddMachine("my-app", execMachine("ams", "app"))
+
+		machines, _, err := selectExecMachines(ctx, []string{web.ID})
+		require.NoError(t, err)
+		assert.Equal(t, []string{web.ID}, machineIDs(machines))
+
+		machines, _, err = selectExecMachines(ctx, []string{worker.ID, web.ID})
+		require.NoError(t, err)
+		assert.Equal(t, []string{worker.ID, web.ID}, machineIDs(machines))
+	})
+
+	t.Run("by process group", func(t *testing.T) {
+		ctx, emulator := execContext(t, "--process-group", "app", "--yes")
+		web := emulator.AddMachine("my-app", execMachine("fra", "app"))
+		emulator.AddMachine("my-app", execMachine("fra", "worker"))
+		other := emulator.AddMachine("my-app", execMachine("ams", "app"))
+
+		machines, _, err := selectExecMachines(ctx, nil)
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []string{web.ID, other.ID}, machineIDs(machines))
+	})
+
+	t.Run("by selector and process group", func(t *testing.T) {
+		ctx, emulator := execContext(t, "--selector", "region=fra", "--process-group", "app", "--yes")
+		web := emulator.AddMachine("my-app", execMachine("fra", "app"))
+		emulator.AddMachine("my-app", execMachine("fra", "worker"))
+		emulator.AddMachine("my-app", execMachine("ams", "app"))
+
+		machines, _, err := selectExecMachines(ctx, nil)
+		require.NoError(t, err)
+		assert.Equal(t, []string{web.ID}, machineIDs(machines))
+	})
+
+	t.Run("mixed", func(t *testing.T) {
+		for _, args := range [][]string{{"--selector", "region=fra"}, {"--process-group", "app"}} {
+			ctx, emulator := execContext(t, args...)
+			web := emulator.AddMachine("my-app", execMachine("fra", "app"))
+
+			_, _, err := selectExecMachines(ctx, []string{web.ID})
+			assert.EqualError(t, err, "machine IDs can't be used with --selector or --process-group")
+		}
+	})
+}
@@ -37,6 +37,8 @@ Machines REST fly.`
 		newMachineExec(),
 		newMachineCordon(),
 		newMachineUncordon(),
+		newApply(),
+		newEvents(),
 	)
 
 	return cmd
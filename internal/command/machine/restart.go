@@ -33,6 +33,9 @@ func newRestart() *cobra.Command {
 		flag.App(),
 		flag.AppConfig(),
 		selectFlag,
+		selectorFlag,
+		concurrencyFlag,
+		flag.Yes(),
 		flag.String{
 			Name:        "signal",
 			Shorthand:   "s",
@@ -84,11 +87,10 @@ func runMachineRestart(ctx context.Context) error {
 	}
 
 	// Restart each machine
-	for _, machine := range machines {
+	return forEachMachine(ctx, machines, func(machine *fly.Machine) error {
 		if err := mach.Restart(ctx, machine, input, machine.LeaseNonce); err != nil {
 			return fmt.Errorf("failed to restart machine %s: %w", machine.ID, err)
 		}
-	}
-
-	return nil
+		return nil
+	})
 }
@@ -7,12 +7,17 @@ import (
 	"sort"
 	"strings"
 
+	"github.com/samber/lo"
+	"github.com/sourcegraph/conc/pool"
 	fly "github.com/superfly/fly-go"
 	"github.com/superfly/fly-go/flaps"
 	"github.com/superfly/flyctl/internal/appconfig"
 	"github.com/superfly/flyctl/internal/flag"
+	"github.com/superfly/flyctl/internal/flag/flagnames"
 	"github.com/superfly/flyctl/internal/flapsutil"
+	mach "github.com/superfly/flyctl/internal/machine"
 	"github.com/superfly/flyctl/internal/prompt"
+	"github.com/superfly/flyctl/internal/render"
 	"github.com/superfly/flyctl/iostreams"
 )
 
@@ -24,6 +29,20 @@ var selectFlag = flag.Bool{
 	Hidden:      true,
 }
 
+// selectorFlag picks the machines bulk operations act on by their fields
+// rather than their IDs
+var selectorFlag = flag.String{
+	Name:        "selector",
+	Description: "Act on the machines matching comma separated key=value or key!=value terms, like process_group=worker,region=fra. Keys are " + strings.Join(mach.SelectorKeys, ", ") + " and " + mach.SelectorMetadataPrefix + "<key>",
+}
+
+// concurrencyFlag bounds how many machines bulk operations act on at once
+var concurrencyFlag = flag.Int{
+	Name:        "concurrency",
+	Description: "Number of machines to act on at the same time. Machines given by ID are acted on one at a time unless this is set",
+	Default:     4,
+}
+
 func selectOneMachine(ctx context.Context, appName string, machineID string, haveMachineID bool) (*fly.Machine, context.Context, error) {
 	if err := checkSelectConditions(ctx, haveMachineID); err != nil {
 		return nil, nil, err
@@ -74,6 +93,11 @@ func selectManyMachines(ctx context.Context, machineIDs []string) ([]*fly.Machin
 		if err != nil {
 			return nil, nil, err
 		}
+	} else if selector := flag.GetString(ctx, selectorFlag.Name); selector != "" {
+		machines, err = selectMatchingMachines(ctx, selector)
+		if err != nil {
+			return nil, nil, err
+		}
 	} else {
 		flapsClient := flaps.FromContext(ctx)
 		for _, machineID := range machineIDs {
@@ -114,6 +138,90 @@ func selectManyMachineIDs(ctx context.Context, machineIDs []string) ([]string, c
 	return machineIDs, ctx, nil
 }
 
+// selectMatchingMachines previews the machines selector matches and asks
+// for confirmation before acting on them.
+func selectMatchingMachines(ctx context.Context, selector string) ([]*fly.Machine, error) {
+	machines, err := matchMachines(ctx, selector)
+	if err != nil {
+		return nil, err
+	}
+	if err := confirmMachines(ctx, machines); err != nil {
+		return nil, err
+	}
+	return machines, nil
+}
+
+// matchMachines returns the machines selector matches, once listed on stderr.
+func matchMachines(ctx context.Context, selector string) ([]*fly.Machine, error) {
+	io := iostreams.FromContext(ctx)
+	appName := appconfig.NameFromContext(ctx)
+
+	sel, err := mach.ParseSelector(selector)
+	if err != nil {
+		return nil, err
+	}
+	machines, err := mach.ListActive(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("could not get a list of machines: %w", err)
+	}
+	machines = sel.Filter(machines)
+	if len(machines) == 0 {
+		return nil, fmt.Errorf("no machines of %s match %s", appName, sel)
+	}
+	sort.Slice(machines, func(i, j int) bool {
+		return machines[i].ID < machines[j].ID
+	})
+
+	// The preview goes to stderr to keep the output of the command clean
+	rows := lo.Map(machines, func(m *fly.Machine, _ int) []string {
+		return []string{m.ID, m.Name, m.ProcessGroup(), m.Region, m.State, m.ImageRefWithVersion()}
+	})
+	if err := render.Table(io.ErrOut, fmt.Sprintf("Machines of %s matching %s", appName, sel), rows, "ID", "Name", "Process Group", "Region", "State", "Image"); err != nil {
+		return nil, err
+	}
+	return machines, nil
+}
+
+// confirmMachines asks whether to go ahead with the matched machines, unless
+// --yes was given.
+func confirmMachines(ctx context.Context, machines []*fly.Machine) error {
+	if flag.GetYes(ctx) {
+		return nil
+	}
+	confirmed, err := prompt.Confirmf(ctx, "Continue with these %d machine(s)?", len(machines))
+	switch {
+	case prompt.IsNonInteractive(err):
+		return prompt.NonInteractiveError("--yes must be specified to act on the selected machines when not running interactively")
+	case err != nil:
+		return err
+	case !confirmed:
+		return errors.New("no machines selected")
+	}
+	return nil
+}
+
+// forEachMachine runs fn on the machines, --concurrency of them at a time, and
+// returns the errors of all of them.
+func forEachMachine(ctx context.Context, machines []*fly.Machine, fn func(*fly.Machine) error) error {
+	p := pool.New().WithErrors().WithMaxGoroutines(machineConcurrency(ctx))
+	for _, m := range machines {
+		m := m
+		p.Go(func() error { return fn(m) })
+	}
+	return p.Wait()
+}
+
+// machineConcurrency is --concurrency for the machines matched by --selector or
+// --process-group. Machines given by ID have always been acted on one at a
+// time, so they only are in parallel when --concurrency is set.
+func machineConcurrency(ctx context.Context) int {
+	bulk := flag.GetString(ctx, selectorFlag.Name) != "" || flag.GetString(ctx, flagnames.ProcessGroup) != ""
+	if !bulk && !flag.IsSpecified(ctx, concurrencyFlag.Name) {
+		return 1
+	}
+	return max(flag.GetInt(ctx, concurrencyFlag.Name), 1)
+}
+
 func buildContextFromAppName(ctx context.Context, appName string) (context.Context, error) {
 	flapsClient, err := flapsutil.NewClientWithOptions(ctx, flaps.NewClientOpts{
 		AppName: appName,
@@ -248,12 +356,17 @@ func rewriteMachineNotFoundErrors(ctx context.Context, err error, machineID stri
 
 func checkSelectConditions(ctx context.Context, haveMachineIDs bool) error {
 	haveSelectFlag := flag.GetBool(ctx, "select")
+	haveSelector := flag.GetString(ctx, selectorFlag.Name) != ""
 	appName := appconfig.NameFromContext(ctx)
 	switch {
 	case haveSelectFlag && haveMachineIDs:
 		return errors.New("machine IDs can't be used with --select")
+	case haveSelector && haveMachineIDs:
+		return errors.New("machine IDs can't be used with --selector")
 	case haveSelectFlag && appName == "":
 		return errors.New("an app name must be specified to use --select")
+	case haveSelector && appName == "":
+		return errors.New("an app name must be specified to use --selector")
 	case !haveMachineIDs && appName == "":
 		return errors.New("a machine ID or an app name is required")
 	case shouldPrompt(ctx, haveMachineIDs) && !iostreams.FromContext(ctx).IsInteractive():
@@ -264,5 +377,5 @@ func checkSelectConditions(ctx context.Context, haveMachineIDs bool) error {
 }
 
 func shouldPrompt(ctx context.Context, haveMachineIDs bool) bool {
-	return flag.GetBool(ctx, "select") || !haveMachineIDs
+	return flag.GetBool(ctx, "select") || (!haveMachineIDs && flag.GetString(ctx, selectorFlag.Name) == "")
 }
@@ -0,0 +1,28 @@
+package machine
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/superfly/flyctl/internal/flag"
+)
+
+func TestMachineConcurrency(t *testing.T) {
+	for _, tc := range []struct {
+		args []string
+		want int
+	}{
+		{args: nil, want: 1},
+		{args: []string{"--concurrency", "3"}, want: 3},
+		{args: []string{"--selector", "region=fra"}, want: 4},
+		{args: []string{"--process-group", "worker", "--concurrency", "2"}, want: 2},
+		{args: []string{"--selector", "region=fra", "--concurrency", "0"}, want: 1},
+	} {
+		cmd := newMachineExec()
+		require.NoError(t, cmd.ParseFlags(tc.args))
+		ctx := flag.NewContext(context.Background(), cmd.Flags())
+		assert.Equal(t, tc.want, machineConcurrency(ctx), tc.args)
+	}
+}
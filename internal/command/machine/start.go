@@ -35,6 +35,9 @@ func newStart() *cobra.Command {
 		flag.App(),
 		flag.AppConfig(),
 		selectFlag,
+		selectorFlag,
+		concurrencyFlag,
+		flag.Yes(),
 	)
 
 	return cmd
@@ -57,13 +60,13 @@ func runMachineStart(ctx context.Context) (err error) {
 	}
 	defer release()
 
-	for _, machine := range machines {
-		if err = Start(ctx, machine); err != nil {
-			return
+	return forEachMachine(ctx, machines, func(machine *fly.Machine) error {
+		if err := Start(ctx, machine); err != nil {
+			return err
 		}
 		fmt.Fprintf(io.Out, "%s has been started\n", machine.ID)
-	}
-	return
+		return nil
+	})
 }
 
 func Start(ctx context.Context, machine *fly.Machine) (err error) {
@@ -35,6 +35,9 @@ func newStop() *cobra.Command {
 		flag.App(),
 		flag.AppConfig(),
 		selectFlag,
+		selectorFlag,
+		concurrencyFlag,
+		flag.Yes(),
 		flag.String{
 			Name:        "signal",
 			Shorthand:   "s",
@@ -74,15 +77,15 @@ func runMachineStop(ctx context.Context) (err error) {
 	}
 	defer release()
 
-	for _, machine := range machines {
+	return forEachMachine(ctx, machines, func(machine *fly.Machine) error {
 		fmt.Fprintf(io.Out, "Sending kill signal to machine %s...\n", machine.ID)
 
-		if err = Stop(ctx, machine, signal, timeout); err != nil {
-			return
+		if err := Stop(ctx, machine, signal, timeout); err != nil {
+			return err
 		}
 		fmt.Fprintf(io.Out, "%s has been successfully stopped\n", machine.ID)
-	}
-	return
+		return nil
+	})
 }
 
 func Stop(ctx context.Context, machine *fly.Machine, signal string, timeout int) (err error) {
@@ -3,8 +3,11 @@ package machine
 import (
 	"context"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/pkg/errors"
+	"github.com/samber/lo"
 	"github.com/spf13/cobra"
 
 	fly "github.com/superfly/fly-go"
@@ -13,6 +16,7 @@ import (
 	"github.com/superfly/flyctl/internal/appconfig"
 	"github.com/superfly/flyctl/internal/command"
 	"github.com/superfly/flyctl/internal/flag"
+	"github.com/superfly/flyctl/internal/flag/flagnames"
 	"github.com/superfly/flyctl/internal/flyerr"
 	mach "github.com/superfly/flyctl/internal/machine"
 	"github.com/superfly/flyctl/internal/watch"
@@ -21,7 +25,12 @@ import (
 func newUpdate() *cobra.Command {
 	const (
 		short = "Update a machine"
-		long  = short + "\n"
+		long  = short + `
+
+Fly Launch machines can't be updated during the [[deploy.freeze]] windows of
+the deployed fly.toml unless --override-freeze gives a reason. The reason is
+recorded on the updated machine, in its fly_freeze_override metadata.
+`
 
 		usage = "update [machine_id]"
 	)
@@ -36,7 +45,10 @@ func newUpdate() *cobra.Command {
 		flag.Image(),
 		sharedFlags,
 		flag.Yes(),
+		flag.OverrideFreeze(),
 		selectFlag,
+		selectorFlag,
+		concurrencyFlag,
 		flag.Bool{
 			Name:        "skip-start",
 			Description: "Updates machine without starting it.",
@@ -69,24 +81,99 @@ func newUpdate() *cobra.Command {
 }
 
 func runUpdate(ctx context.Context) (err error) {
+	if flag.GetString(ctx, selectorFlag.Name) != "" {
+		return runUpdateSelected(ctx)
+	}
+
+	machineID := flag.FirstArg(ctx)
+	haveMachineID := len(flag.Args(ctx)) > 0
+	machine, ctx, err := selectOneMachine(ctx, "", machineID, haveMachineID)
+	if err != nil {
+		return err
+	}
+	return updateMachine(ctx, machine, !flag.GetBool(ctx, "yes"))
+}
+
+// runUpdateSelected applies the same changes to every machine --selector
+// matches. The changes are shown for each machine, once for all the machines
+// getting the same ones, and confirmed once for all of them.
+func runUpdateSelected(ctx context.Context) error {
+	if flag.GetString(ctx, flag.Dockerfile().Name) != "" {
+		return errors.New("--dockerfile can't be used with --selector, build the image first and pass it with --image")
+	}
+	if err := checkSelectConditions(ctx, false); err != nil {
+		return err
+	}
+
+	ctx, err := buildContextFromAppName(ctx, appconfig.NameFromContext(ctx))
+	if err != nil {
+		return err
+	}
+	machines, err := matchMachines(ctx, flag.GetString(ctx, selectorFlag.Name))
+	if err != nil {
+		return err
+	}
+	if err := previewMachineUpdates(ctx, machines); err != nil {
+		return err
+	}
+	if err := confirmMachines(ctx, machines); err != nil {
+		return err
+	}
+
+	return forEachMachine(ctx, machines, func(machine *fly.Machine) error {
+		if err := updateMachine(ctx, machine, false); err != nil {
+			return fmt.Errorf("failed to update machine %s: %w", machine.ID, err)
+		}
+		return nil
+	})
+}
+
+// previewMachineUpdates shows the config changes the update makes to each of
+// the machines, grouping the machines getting the same changes.
+func previewMachineUpdates(ctx context.Context, machines []*fly.Machine) error {
+	var (
+		io    = iostreams.FromContext(ctx)
+		diffs []string
+		ids   = map[string][]string{}
+	)
+	for _, machine := range machines {
+		machineConf, err := updatedMachineConfig(ctx, machine)
+		if err != nil {
+			return fmt.Errorf("failed to determine the changes to machine %s: %w", machine.ID, err)
+		}
+		diff := mach.ConfigCompare(ctx, *machine.Config, *machineConf)
+		if _, ok := ids[diff]; !ok {
+			diffs = append(diffs, diff)
+		}
+		ids[diff] = append(ids[diff], machine.ID)
+	}
+
+	for _, diff := range diffs {
+		if diff == "" {
+			fmt.Fprintf(io.ErrOut, "\nNo configuration changes for machine(s) %s\n", strings.Join(ids[diff], ", "))
+			continue
+		}
+		fmt.Fprintf(io.ErrOut, "\nConfiguration changes to be applied to machine(s) %s:\n\n%s\n", strings.Join(ids[diff], ", "), diff)
+	}
+	return nil
+}
+
+// updateMachine applies the changes the flags ask for to machine, once
+// they're confirmed when confirm is set.
+func updateMachine(ctx context.Context, machine *fly.Machine, confirm bool) (err error) {
 	var (
 		io       = iostreams.FromContext(ctx)
 		colorize = io.ColorScheme()
 
-		autoConfirm      = flag.GetBool(ctx, "yes")
 		skipHealthChecks = flag.GetBool(ctx, "skip-health-checks")
 		skipStart        = flag.GetBool(ctx, "skip-start")
-		image            = flag.GetString(ctx, "image")
-		dockerfile       = flag.GetString(ctx, flag.Dockerfile().Name)
 	)
+	appName := appconfig.NameFromContext(ctx)
 
-	machineID := flag.FirstArg(ctx)
-	haveMachineID := len(flag.Args(ctx)) > 0
-	machine, ctx, err := selectOneMachine(ctx, "", machineID, haveMachineID)
+	freezeOverride, err := checkMachineDeployFreeze(ctx, machine, appName)
 	if err != nil {
 		return err
 	}
-	appName := appconfig.NameFromContext(ctx)
 
 	// Acquire lease
 	machine, releaseLeaseFunc, err := mach.AcquireLease(ctx, machine)
@@ -95,34 +182,19 @@ func runUpdate(ctx context.Context) (err error) {
 		return err
 	}
 
-	var imageOrPath string
-	if image != "" {
-		imageOrPath = image
-	} else if dockerfile != "" {
-		imageOrPath = "."
-	}
-
-	// Identify configuration changes
-	machineConf, err := determineMachineConfig(ctx, &determineMachineConfigInput{
-		initialMachineConf: *machine.Config,
-		appName:            appName,
-		imageOrPath:        imageOrPath,
-		region:             machine.Region,
-		updating:           true,
-	})
+	machineConf, err := updatedMachineConfig(ctx, machine)
 	if err != nil {
 		return err
 	}
 
-	if mp := flag.GetString(ctx, "mount-point"); mp != "" {
-		if len(machineConf.Mounts) != 1 {
-			return fmt.Errorf("Machine doesn't have a volume attached")
-		}
-		machineConf.Mounts[0].Path = mp
+	if freezeOverride != "" {
+		machineConf.Metadata = lo.Assign(machineConf.Metadata, map[string]string{
+			command.MachineConfigMetadataKeyFlyFreezeOverride: freezeOverride,
+		})
 	}
 
 	// Prompt user to confirm changes
-	if !autoConfirm {
+	if confirm {
 		confirmed, err := mach.ConfirmConfigChanges(ctx, machine, *machineConf, "")
 		if err != nil {
 			return err
@@ -168,3 +240,61 @@ func runUpdate(ctx context.Context) (err error) {
 
 	return nil
 }
+
+// updatedMachineConfig is the config of machine with the changes the flags
+// ask for.
+func updatedMachineConfig(ctx context.Context, machine *fly.Machine) (*fly.MachineConfig, error) {
+	var (
+		image      = flag.GetString(ctx, "image")
+		dockerfile = flag.GetString(ctx, flag.Dockerfile().Name)
+	)
+
+	var imageOrPath string
+	if image != "" {
+		imageOrPath = image
+	} else if dockerfile != "" {
+		imageOrPath = "."
+	}
+
+	// Identify configuration changes
+	machineConf, err := determineMachineConfig(ctx, &determineMachineConfigInput{
+		initialMachineConf: *machine.Config,
+		appName:            appconfig.NameFromContext(ctx),
+		imageOrPath:        imageOrPath,
+		region:             machine.Region,
+		updating:           true,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if mp := flag.GetString(ctx, "mount-point"); mp != "" {
+		if len(machineConf.Mounts) != 1 {
+			return nil, fmt.Errorf("Machine doesn't have a volume attached")
+		}
+		machineConf.Mounts[0].Path = mp
+	}
+	return machineConf, nil
+}
+
+// checkMachineDeployFreeze applies the [[deploy.freeze]] windows of the
+// deployed fly.toml to the Fly Launch machines, the others having none. The
+// update is refused when the config can't be loaded, since its windows can't
+// be checked, unless --override-freeze gives a reason to go ahead anyway.
+func checkMachineDeployFreeze(ctx context.Context, machine *fly.Machine, appName string) (string, error) {
+	if !machine.IsFlyAppsPlatform() {
+		return "", nil
+	}
+
+	appConfig, err := appconfig.FromRemoteApp(ctx, appName)
+	if err != nil {
+		reason := flag.GetOverrideFreeze(ctx)
+		if reason == "" {
+			return "", fmt.Errorf("failed to get the deploy freeze windows of %s, run the command again with --%s \"<reason>\" to update the machine anyway: %w", appName, flagnames.OverrideFreeze, err)
+		}
+		io := iostreams.FromContext(ctx)
+		fmt.Fprintf(io.ErrOut, "%s failed to get the deploy freeze windows of %s, going ahead: %s: %s\n", io.ColorScheme().WarningIcon(), appName, reason, err)
+		return reason, nil
+	}
+	return command.CheckDeployFreeze(ctx, appConfig, time.Now())
+}
@@ -11,6 +11,7 @@ import (
 	fly "github.com/superfly/fly-go"
 	"github.com/superfly/flyctl/internal/command"
 	"github.com/superfly/flyctl/internal/flag"
+	"github.com/superfly/flyctl/internal/pricing"
 	"github.com/superfly/flyctl/internal/render"
 	"github.com/superfly/flyctl/iostreams"
 )
@@ -18,6 +19,9 @@ import (
 func newVMSizes() (cmd *cobra.Command) {
 	const (
 		long = `View a list of VM sizes which can be used with the FLYCTL SCALE VM command
+
+Prices are estimates for a machine running the whole month in the cheapest
+regions, see https://fly.io/docs/about/pricing/ for those of each region.
 `
 		short = "List VM Sizes"
 	)
@@ -45,6 +49,7 @@ func runMachineVMSizes(ctx context.Context) error {
 			key,
 			cores(value.CPUs),
 			memory(value.MemoryMB),
+			pricing.FormatCost(pricing.MachineMonthly(value)),
 			value.GPUKind,
 		}
 		return preset{value, arr}
@@ -67,7 +72,7 @@ func runMachineVMSizes(ctx context.Context) error {
 	shared := lo.FilterMap(sortedPresets, func(p preset, _ int) ([]string, bool) {
 		return p.strings, p.guest.CPUKind == "shared" && p.guest.GPUKind == ""
 	})
-	if err := render.Table(out, "Machines platform", shared, "Name", "CPU Cores", "Memory"); err != nil {
+	if err := render.Table(out, "Machines platform", shared, "Name", "CPU Cores", "Memory", "Est. Price/Month"); err != nil {
 		return err
 	}
 
@@ -75,7 +80,7 @@ func runMachineVMSizes(ctx context.Context) error {
 	performance := lo.FilterMap(sortedPresets, func(p preset, _ int) ([]string, bool) {
 		return p.strings, p.guest.CPUKind == "performance" && p.guest.GPUKind == ""
 	})
-	if err := render.Table(out, "", performance, "Name", "CPU Cores", "Memory"); err != nil {
+	if err := render.Table(out, "", performance, "Name", "CPU Cores", "Memory", "Est. Price/Month"); err != nil {
 		return err
 	}
 
@@ -83,7 +88,7 @@ func runMachineVMSizes(ctx context.Context) error {
 	gpus := lo.FilterMap(sortedPresets, func(p preset, _ int) ([]string, bool) {
 		return p.strings, p.guest.GPUKind != ""
 	})
-	return render.Table(out, "", gpus, "Name", "CPU Cores", "Memory", "GPU model")
+	return render.Table(out, "", gpus, "Name", "CPU Cores", "Memory", "Est. Price/Month", "GPU model")
 }
 
 func cores(cores int) string {
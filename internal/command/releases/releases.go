@@ -8,5 +8,7 @@ import (
 
 // TODO: deprecate
 func New() *cobra.Command {
-	return apps.NewReleases()
+	cmd := apps.NewReleases()
+	cmd.AddCommand(newRollback())
+	return cmd
 }
@@ -0,0 +1,92 @@
+package releases
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/superfly/fly-go/flaps"
+	"github.com/superfly/flyctl/internal/appconfig"
+	"github.com/superfly/flyctl/internal/command"
+	"github.com/superfly/flyctl/internal/command/deploy"
+	"github.com/superfly/flyctl/internal/flag"
+	"github.com/superfly/flyctl/internal/flapsutil"
+	"github.com/superfly/flyctl/internal/prompt"
+	"github.com/superfly/flyctl/iostreams"
+)
+
+func newRollback() *cobra.Command {
+	const (
+		long = `Roll back the application to a previous release by redeploying the image
+and config that release was deployed with. The rollback is recorded as a
+new release. Releases can't carry metadata, so the version rolled back to
+is recorded in the metadata of the machines of the new release instead,
+under fly_rollback_of_version.
+`
+		short = "Roll back the app to a previous release"
+		usage = "rollback <version>"
+	)
+
+	cmd := command.New(usage, short, long, runRollback,
+		command.RequireSession,
+		command.RequireAppName,
+	)
+	cmd.Args = cobra.ExactArgs(1)
+
+	flag.Add(cmd,
+		flag.App(),
+		flag.AppConfig(),
+		deploy.RollbackFlags,
+	)
+
+	return cmd
+}
+
+func runRollback(ctx context.Context) error {
+	var (
+		appName  = appconfig.NameFromContext(ctx)
+		io       = iostreams.FromContext(ctx)
+		colorize = io.ColorScheme()
+	)
+
+	version, err := strconv.Atoi(strings.TrimPrefix(flag.FirstArg(ctx), "v"))
+	if err != nil || version < 1 {
+		return fmt.Errorf("invalid release version %q, expected a number like 12 or v12", flag.FirstArg(ctx))
+	}
+
+	flapsClient, err := flapsutil.NewClientWithOptions(ctx, flaps.NewClientOpts{
+		AppName: appName,
+	})
+	if err != nil {
+		return fmt.Errorf("could not create flaps client: %w", err)
+	}
+	ctx = flaps.NewContext(ctx, flapsClient)
+
+	release, err := appconfig.FromRelease(ctx, appName, version)
+	if err != nil {
+		return fmt.Errorf("failed to get the config of release v%d: %w", version, err)
+	}
+	// Deploy the image of the release as is, whatever it was built from
+	release.Config.Build = &appconfig.Build{Image: release.ImageRef}
+
+	fmt.Fprintf(io.ErrOut, "Rolling back %s to release %s with image %s\n",
+		colorize.Bold(appName), colorize.Bold(fmt.Sprintf("v%d", version)), release.ImageRef)
+
+	if !flag.GetYes(ctx) {
+		switch confirmed, err := prompt.Confirm(ctx, "Are you sure you want to roll back?"); {
+		case err == nil:
+			if !confirmed {
+				return nil
+			}
+		case prompt.IsNonInteractive(err):
+			return prompt.NonInteractiveError("yes flag must be specified when not running interactively")
+		default:
+			return err
+		}
+	}
+
+	ctx = deploy.WithRollbackOf(ctx, version)
+	return deploy.DeployWithConfig(ctx, release.Config, flag.GetYes(ctx))
+}
@@ -24,6 +24,7 @@ import (
 	"github.com/superfly/flyctl/internal/command/dashboard"
 	"github.com/superfly/flyctl/internal/command/deploy"
 	"github.com/superfly/flyctl/internal/command/destroy"
+	"github.com/superfly/flyctl/internal/command/dev"
 	"github.com/superfly/flyctl/internal/command/dig"
 	"github.com/superfly/flyctl/internal/command/dnsrecords"
 	"github.com/superfly/flyctl/internal/command/docs"
@@ -132,6 +133,7 @@ func New() *cobra.Command {
 		group(mysql.New(), "dbs_and_extensions"),
 		group(storage.New(), "dbs_and_extensions"),
 		metrics.New(),
+		dev.New(),
 		curl.New(),       // TODO: deprecate
 		domains.New(),    // TODO: deprecate
 		open.New(),       // TODO: deprecate
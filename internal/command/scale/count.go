@@ -6,6 +6,7 @@ import (
 	"slices"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/samber/lo"
 	"github.com/spf13/cobra"
@@ -35,6 +36,7 @@ For pricing, see https://fly.io/docs/about/pricing/`
 		flag.App(),
 		flag.AppConfig(),
 		flag.Yes(),
+		flag.OverrideFreeze(),
 		flag.ProcessGroup("The process group to scale"),
 		flag.Int{Name: "max-per-region", Description: "Max number of VMs per region", Default: -1},
 		flag.String{Name: "region", Shorthand: "r", Description: "Comma separated list of regions to act on. Defaults to all regions where there is at least one machine running for the app", CompletionFn: completion.CompleteRegions},
@@ -60,6 +62,11 @@ func runScaleCount(ctx context.Context) error {
 		return err
 	}
 
+	freezeOverride, err := command.CheckDeployFreeze(ctx, appConfig, time.Now())
+	if err != nil {
+		return err
+	}
+
 	args := flag.Args(ctx)
 
 	processNames := appConfig.ProcessNames()
@@ -89,7 +96,7 @@ func runScaleCount(ctx context.Context) error {
 
 	maxPerRegion := flag.GetInt(ctx, "max-per-region")
 
-	return runMachinesScaleCount(ctx, appName, appConfig, groups, maxPerRegion)
+	return runMachinesScaleCount(ctx, appName, appConfig, groups, maxPerRegion, freezeOverride)
 }
 
 func parseGroupCounts(args []string, defaultGroupName string) (map[string]int, error) {
@@ -14,13 +14,14 @@ import (
 	"github.com/superfly/flyctl/internal/appconfig"
 	"github.com/superfly/flyctl/internal/flag"
 	mach "github.com/superfly/flyctl/internal/machine"
+	"github.com/superfly/flyctl/internal/pricing"
 	"github.com/superfly/flyctl/internal/prompt"
 	"github.com/superfly/flyctl/iostreams"
 )
 
 const maxConcurrentActions = 5
 
-func runMachinesScaleCount(ctx context.Context, appName string, appConfig *appconfig.Config, expectedGroupCounts map[string]int, maxPerRegion int) error {
+func runMachinesScaleCount(ctx context.Context, appName string, appConfig *appconfig.Config, expectedGroupCounts map[string]int, maxPerRegion int, freezeOverride string) error {
 	io := iostreams.FromContext(ctx)
 	flapsClient := flaps.FromContext(ctx)
 	ctx = appconfig.WithConfig(ctx, appConfig)
@@ -64,6 +65,7 @@ func runMachinesScaleCount(ctx context.Context, appName string, appConfig *appco
 
 	defaults := newDefaults(appConfig, latestCompleteRelease, machines, volumes,
 		flag.GetString(ctx, "from-snapshot"), flag.GetBool(ctx, "with-new-volumes"), defaultGuest)
+	defaults.freezeOverride = freezeOverride
 
 	actions, err := computeActions(machines, expectedGroupCounts, regions, maxPerRegion, defaults)
 	if err != nil {
@@ -93,6 +95,13 @@ func runMachinesScaleCount(ctx context.Context, appName string, appConfig *appco
 		}
 	}
 
+	if estimate := estimateScaleCount(machines, volumes, actions); estimate.Changed() {
+		fmt.Fprintln(io.Out)
+		if err := estimate.Render(io.Out); err != nil {
+			return err
+		}
+	}
+
 	if !flag.GetYes(ctx) {
 		switch confirmed, err := prompt.Confirmf(ctx, "Scale app %s?", appName); {
 		case err == nil:
@@ -220,6 +229,39 @@ type planItem struct {
 	CreateVolumeRequest *fly.CreateVolumeRequest
 }
 
+// estimateScaleCount compares what the machines of the app use before and
+// after the scale plan. Destroyed machines leave their volumes behind, which
+// are still billed. Unattached volumes reused by new machines were billed
+// before as well, so only the volumes to create add to the cost.
+func estimateScaleCount(machines []*fly.Machine, volumes []fly.Volume, actions []*planItem) *pricing.Estimate {
+	estimate := pricing.NewEstimate()
+	destroyed := make(map[string]bool)
+	for _, action := range actions {
+		for i := 0; i > action.Delta; i-- {
+			destroyed[action.Machines[-i].ID] = true
+		}
+	}
+	for _, m := range machines {
+		addMachineUsage(estimate.Before(m.ProcessGroup()), m.Config.Guest, m, volumes)
+		if destroyed[m.ID] {
+			addVolumeUsage(estimate.After(m.ProcessGroup()), m, volumes)
+		} else {
+			addMachineUsage(estimate.After(m.ProcessGroup()), m.Config.Guest, m, volumes)
+		}
+	}
+
+	for _, action := range actions {
+		usage := estimate.After(action.GroupName)
+		for i := 0; i < action.Delta; i++ {
+			usage.AddMachine(action.LaunchMachineInput.Config.Guest)
+			if i >= len(action.Volumes) && action.CreateVolumeRequest != nil && action.CreateVolumeRequest.SizeGb != nil {
+				usage.AddVolume(*action.CreateVolumeRequest.SizeGb)
+			}
+		}
+	}
+	return estimate
+}
+
 func (pi *planItem) VolumesDelta() int {
 	if pi.CreateVolumeRequest == nil {
 		return 0
@@ -4,6 +4,7 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	fly "github.com/superfly/fly-go"
 )
 
 func Test_convergeGroupCounts(t *testing.T) {
@@ -137,3 +138,36 @@ func Test_convergeGroupCounts_maxPerRegion(t *testing.T) {
 		})
 	}
 }
+
+func Test_estimateScaleCount(t *testing.T) {
+	guest := fly.MachinePresets["shared-cpu-1x"]
+	newMachine := func(id string) *fly.Machine {
+		return &fly.Machine{ID: id, Config: &fly.MachineConfig{
+			Guest:    guest,
+			Metadata: map[string]string{fly.MachineConfigMetadataKeyFlyProcessGroup: "app"},
+			Mounts:   []fly.MachineMount{{Volume: "vol_" + id, Name: "data", SizeGb: 1}},
+		}}
+	}
+	machines := []*fly.Machine{newMachine("m1"), newMachine("m2")}
+	volumes := []fly.Volume{{ID: "vol_m1", SizeGb: 10}, {ID: "vol_m2", SizeGb: 10}, {ID: "vol_free", SizeGb: 5}}
+
+	estimate := estimateScaleCount(machines, volumes, []*planItem{
+		{GroupName: "app", Region: "scl", Delta: -1, Machines: machines[1:]},
+		{
+			GroupName:           "app",
+			Region:              "ord",
+			Delta:               2,
+			LaunchMachineInput:  &fly.LaunchMachineInput{Config: machines[0].Config},
+			Volumes:             []*fly.Volume{&volumes[2]},
+			CreateVolumeRequest: &fly.CreateVolumeRequest{SizeGb: fly.Pointer(1)},
+		},
+	})
+
+	app := estimate.Changes()[0]
+	assert.Equal(t, 2, app.Before.Machines)
+	assert.Equal(t, 20, app.Before.VolumeGB)
+	assert.Equal(t, 3, app.After.Machines)
+	// The volume of m2 is kept, vol_free was already there, one is created
+	assert.Equal(t, 21, app.After.VolumeGB)
+	assert.InDelta(t, 1.94+0.15, estimate.MonthlyDelta(), 0.001)
+}
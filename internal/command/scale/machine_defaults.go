@@ -7,6 +7,7 @@ import (
 	fly "github.com/superfly/fly-go"
 	"github.com/superfly/flyctl/internal/appconfig"
 	"github.com/superfly/flyctl/internal/buildinfo"
+	"github.com/superfly/flyctl/internal/command"
 )
 
 type defaultValues struct {
@@ -20,6 +21,7 @@ type defaultValues struct {
 	appConfig       *appconfig.Config
 	existingVolumes map[string]map[string][]*fly.Volume
 	snapshotID      *string
+	freezeOverride  string
 }
 
 func newDefaults(appConfig *appconfig.Config, latest fly.Release, machines []*fly.Machine, volumes []fly.Volume, snapshotID string, withNewVolumes bool, fallbackGuest *fly.MachineGuest) *defaultValues {
@@ -101,6 +103,9 @@ func (d *defaultValues) ToMachineConfig(groupName string) (*fly.MachineConfig, e
 	mc.Metadata[fly.MachineConfigMetadataKeyFlyReleaseId] = d.releaseId
 	mc.Metadata[fly.MachineConfigMetadataKeyFlyReleaseVersion] = d.releaseVersion
 	mc.Metadata[fly.MachineConfigMetadataKeyFlyctlVersion] = buildinfo.Version().String()
+	if d.freezeOverride != "" {
+		mc.Metadata[command.MachineConfigMetadataKeyFlyFreezeOverride] = d.freezeOverride
+	}
 
 	return mc, nil
 }
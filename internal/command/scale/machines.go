@@ -10,6 +10,8 @@ import (
 	"github.com/superfly/flyctl/internal/appconfig"
 	"github.com/superfly/flyctl/internal/flapsutil"
 	mach "github.com/superfly/flyctl/internal/machine"
+	"github.com/superfly/flyctl/internal/pricing"
+	"github.com/superfly/flyctl/iostreams"
 )
 
 func v2ScaleVM(ctx context.Context, appName, group, sizeName string, memoryMB int) (*fly.VMSize, error) {
@@ -45,6 +47,23 @@ func v2ScaleVM(ctx context.Context, appName, group, sizeName string, memoryMB in
 		return nil, fmt.Errorf("No active machines in process group '%s', check `fly status` output", group)
 	}
 
+	volumes, err := flapsClient.GetVolumes(ctx)
+	if err != nil {
+		return nil, err
+	}
+	estimate := pricing.NewEstimate()
+	for _, machine := range machines {
+		addMachineUsage(estimate.Before(group), machine.Config.Guest, machine, volumes)
+		addMachineUsage(estimate.After(group), scaledGuest(machine.Config.Guest, sizeName, memoryMB), machine, volumes)
+	}
+	if estimate.Changed() {
+		io := iostreams.FromContext(ctx)
+		if err := estimate.Render(io.Out); err != nil {
+			return nil, err
+		}
+		fmt.Fprintln(io.Out)
+	}
+
 	machines, releaseFunc, err := mach.AcquireLeases(ctx, machines)
 	defer releaseFunc()
 	if err != nil {
@@ -52,12 +71,7 @@ func v2ScaleVM(ctx context.Context, appName, group, sizeName string, memoryMB in
 	}
 
 	for _, machine := range machines {
-		if sizeName != "" {
-			machine.Config.Guest.SetSize(sizeName)
-		}
-		if memoryMB > 0 {
-			machine.Config.Guest.MemoryMB = memoryMB
-		}
+		machine.Config.Guest = scaledGuest(machine.Config.Guest, sizeName, memoryMB)
 
 		input := &fly.LaunchMachineInput{
 			Name:   machine.Name,
@@ -79,6 +93,35 @@ func v2ScaleVM(ctx context.Context, appName, group, sizeName string, memoryMB in
 	return size, nil
 }
 
+// scaledGuest returns a copy of guest set to sizeName and memoryMB when given
+func scaledGuest(guest *fly.MachineGuest, sizeName string, memoryMB int) *fly.MachineGuest {
+	scaled := *guest
+	if sizeName != "" {
+		scaled.SetSize(sizeName)
+	}
+	if memoryMB > 0 {
+		scaled.MemoryMB = memoryMB
+	}
+	return &scaled
+}
+
+// addMachineUsage accounts in usage for machine m with the given guest, and
+// for the volume it mounts.
+func addMachineUsage(usage *pricing.Usage, guest *fly.MachineGuest, m *fly.Machine, volumes []fly.Volume) {
+	usage.AddMachine(guest)
+	addVolumeUsage(usage, m, volumes)
+}
+
+// addVolumeUsage counts the volume m mounts, if any.
+func addVolumeUsage(usage *pricing.Usage, m *fly.Machine, volumes []fly.Volume) {
+	if len(m.Config.Mounts) == 0 {
+		return
+	}
+	mount := m.Config.Mounts[0]
+	vol, ok := lo.Find(volumes, func(v fly.Volume) bool { return v.ID == mount.Volume })
+	usage.AddVolume(lo.Ternary(ok, vol.SizeGb, mount.SizeGb))
+}
+
 func listMachinesWithGroup(ctx context.Context, group string) ([]*fly.Machine, error) {
 	machines, err := mach.ListActive(ctx)
 	if err != nil {
@@ -0,0 +1,122 @@
+// Package deployevents streams the progress of a deployment as JSON lines so
+// that scripts don't have to parse the human output.
+package deployevents
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	BuildStarted          = "build_started"
+	BuildFinished         = "build_finished"
+	ImagePushed           = "image_pushed"
+	ReleaseCommandStarted = "release_command_started"
+	ReleaseCommandExited  = "release_command_exited"
+	MachineLeased         = "machine_leased"
+	MachineUpdated        = "machine_updated"
+	MachineStarted        = "machine_started"
+	MachineHealthy        = "machine_healthy"
+	MachineFailed         = "machine_failed"
+	DeployFinished        = "deploy_finished"
+)
+
+// Event is a single step of a deployment. Only the fields relevant to its
+// type are set.
+type Event struct {
+	Type       string    `json:"type"`
+	Time       time.Time `json:"time"`
+	App        string    `json:"app,omitempty"`
+	MachineID  string    `json:"machine_id,omitempty"`
+	Region     string    `json:"region,omitempty"`
+	Strategy   string    `json:"strategy,omitempty"`
+	Image      string    `json:"image,omitempty"`
+	DurationMs int64     `json:"duration_ms,omitempty"`
+	ExitCode   *int      `json:"exit_code,omitempty"`
+	Version    int       `json:"version,omitempty"`
+	Status     string    `json:"status,omitempty"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// Writer writes events as JSON lines, it's safe for concurrent use.
+type Writer struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+	app string
+	// finished is set once a deploy_finished event was written
+	finished atomic.Bool
+}
+
+// NewWriter returns a Writer that sets App on the events that don't have it.
+func NewWriter(w io.Writer, app string) *Writer {
+	return &Writer{enc: json.NewEncoder(w), app: app}
+}
+
+// Emit writes ev to w. It's a no-op on a nil Writer.
+func (w *Writer) Emit(ev Event) {
+	if w == nil {
+		return
+	}
+	if ev.Time.IsZero() {
+		ev.Time = time.Now().UTC()
+	}
+	if ev.App == "" {
+		ev.App = w.app
+	}
+	if ev.Type == DeployFinished {
+		w.finished.Store(true)
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	// Events are best effort, a failed write must not fail the deployment
+	_ = w.enc.Encode(ev)
+}
+
+// Finished reports whether a deploy_finished event was written. It's false
+// on a nil Writer.
+func (w *Writer) Finished() bool {
+	return w != nil && w.finished.Load()
+}
+
+type contextKey struct{}
+
+// NewContext derives a Context that carries w from ctx.
+func NewContext(ctx context.Context, w *Writer) context.Context {
+	return context.WithValue(ctx, contextKey{}, w)
+}
+
+// FromContext returns the Writer ctx carries, or nil.
+func FromContext(ctx context.Context) *Writer {
+	w, _ := ctx.Value(contextKey{}).(*Writer)
+	return w
+}
+
+// Emit writes ev to the Writer ctx carries, if any.
+func Emit(ctx context.Context, ev Event) {
+	FromContext(ctx).Emit(ev)
+}
+
+// EmitFailure writes a failed deploy_finished event for err, unless one was
+// written already. It covers the deployments failing before their machines
+// are deployed, like failed builds, so that the stream always ends with
+// deploy_finished.
+func EmitFailure(ctx context.Context, err error) {
+	w := FromContext(ctx)
+	if err == nil || w.Finished() {
+		return
+	}
+	w.Emit(Event{Type: DeployFinished, Status: "failed", Error: err.Error()})
+}
+
+// ErrorString is a shorthand for the Error field of failure events.
+func ErrorString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
@@ -0,0 +1,71 @@
+package deployevents
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEmit(t *testing.T) {
+	var buf bytes.Buffer
+	ctx := NewContext(context.Background(), NewWriter(&buf, "my-app"))
+
+	Emit(ctx, Event{Type: MachineUpdated, MachineID: "m1"})
+	Emit(ctx, Event{Type: DeployFinished, App: "other", Version: 3, Time: time.Unix(0, 0).UTC()})
+	Emit(ctx, Event{Type: MachineFailed, MachineID: "m2", Error: ErrorString(errors.New("boom"))})
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 3)
+
+	var ev Event
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &ev))
+	assert.Equal(t, MachineUpdated, ev.Type)
+	assert.Equal(t, "my-app", ev.App)
+	assert.Equal(t, "m1", ev.MachineID)
+	assert.False(t, ev.Time.IsZero())
+
+	assert.Equal(t, `{"type":"deploy_finished","time":"1970-01-01T00:00:00Z","app":"other","version":3}`, lines[1])
+	assert.Contains(t, lines[2], `"error":"boom"`)
+}
+
+func TestEmitWithoutWriter(t *testing.T) {
+	assert.Nil(t, FromContext(context.Background()))
+	assert.NotPanics(t, func() {
+		Emit(context.Background(), Event{Type: BuildStarted})
+	})
+	assert.Empty(t, ErrorString(nil))
+}
+
+func TestEmitFailure(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf, "my-app")
+	ctx := NewContext(context.Background(), w)
+
+	EmitFailure(ctx, nil)
+	assert.Empty(t, buf.String())
+	assert.False(t, w.Finished())
+
+	EmitFailure(ctx, errors.New("failed to build the image"))
+	var ev Event
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &ev))
+	assert.Equal(t, DeployFinished, ev.Type)
+	assert.Equal(t, "failed", ev.Status)
+	assert.Equal(t, "failed to build the image", ev.Error)
+	assert.True(t, w.Finished())
+
+	// The outcome was written already
+	buf.Reset()
+	EmitFailure(ctx, errors.New("health checks failed"))
+	assert.Empty(t, buf.String())
+
+	assert.NotPanics(t, func() {
+		EmitFailure(context.Background(), errors.New("boom"))
+	})
+}
@@ -0,0 +1,267 @@
+// Package deploynotify posts the stages of a deployment to the webhooks of
+// [deploy.notify] and --notify, such as chat incoming webhooks.
+package deploynotify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os/exec"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"text/template"
+	"time"
+
+	"github.com/superfly/flyctl/internal/appconfig"
+	"github.com/superfly/flyctl/internal/env"
+)
+
+// DefaultTimeout bounds every webhook request unless [deploy.notify] sets one
+const DefaultTimeout = 10 * time.Second
+
+// Payload is what a webhook is told about a stage of a deployment. Custom
+// templates get it as their data.
+type Payload struct {
+	Stage      string    `json:"stage"`
+	App        string    `json:"app"`
+	Version    int       `json:"version,omitempty"`
+	Image      string    `json:"image,omitempty"`
+	GitSHA     string    `json:"git_sha,omitempty"`
+	User       string    `json:"user,omitempty"`
+	RollbackOf int       `json:"rollback_of,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	Time       time.Time `json:"time"`
+	// Text sums the stage up in a sentence, which chat webhooks show as is
+	Text string `json:"text"`
+}
+
+// Notifier posts payloads to webhooks. Failing to reach them only prints a
+// warning, notifications never fail a deployment.
+type Notifier struct {
+	urls    []string
+	events  []string
+	headers map[string]string
+	tmpl    *template.Template
+	client  *http.Client
+	warn    io.Writer
+	base    Payload
+	// finished is set once the outcome of the deployment was notified
+	finished atomic.Bool
+}
+
+// New returns a Notifier for the webhooks of cfg and the extra urls, or nil
+// when there are none. base holds the fields every payload shares.
+func New(cfg *appconfig.DeployNotify, urls []string, base Payload, warn io.Writer) (*Notifier, error) {
+	if cfg == nil {
+		cfg = &appconfig.DeployNotify{}
+	}
+	n := &Notifier{
+		urls:    append(slices.Clone(cfg.URLs), urls...),
+		events:  cfg.Events,
+		headers: cfg.Headers,
+		client:  &http.Client{Timeout: DefaultTimeout},
+		warn:    warn,
+		base:    base,
+	}
+	if len(n.urls) == 0 {
+		return nil, nil
+	}
+
+	if cfg.Template != "" {
+		tmpl, err := appconfig.ParseDeployNotifyTemplate(cfg.Template)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse the notify template: %w", err)
+		}
+		n.tmpl = tmpl
+	}
+	if cfg.Timeout != nil {
+		n.client.Timeout = cfg.Timeout.Duration
+	}
+	return n, nil
+}
+
+// Notify posts p to every webhook, unless its stage isn't one they want. It's
+// a no-op on a nil Notifier.
+func (n *Notifier) Notify(ctx context.Context, p Payload) {
+	if n == nil {
+		return
+	}
+	if p.Stage == appconfig.DeployNotifySucceeded || p.Stage == appconfig.DeployNotifyFailed {
+		n.finished.Store(true)
+	}
+	if len(n.events) > 0 && !slices.Contains(n.events, p.Stage) {
+		return
+	}
+
+	// Interrupted deployments are worth notifying too, the client timeout bounds the requests
+	ctx = context.WithoutCancel(ctx)
+	p = n.complete(p)
+	body, err := n.render(p)
+	if err != nil {
+		fmt.Fprintf(n.warn, "WARN failed to render the %s deployment notification: %v\n", p.Stage, err)
+		return
+	}
+
+	var wg sync.WaitGroup
+	for _, u := range n.urls {
+		u := u
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := n.post(ctx, u, body); err != nil {
+				fmt.Fprintf(n.warn, "WARN failed to notify %s of the %s deployment: %v\n", redactURL(u), p.Stage, err)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// Finished reports whether the deployment was notified as succeeded or
+// failed. It's false on a nil Notifier.
+func (n *Notifier) Finished() bool {
+	return n != nil && n.finished.Load()
+}
+
+func (n *Notifier) complete(p Payload) Payload {
+	if p.App == "" {
+		p.App = n.base.App
+	}
+	if p.GitSHA == "" {
+		p.GitSHA = n.base.GitSHA
+	}
+	if p.User == "" {
+		p.User = n.base.User
+	}
+	if p.RollbackOf == 0 {
+		p.RollbackOf = n.base.RollbackOf
+	}
+	if p.Time.IsZero() {
+		p.Time = time.Now().UTC()
+	}
+	if p.Text == "" {
+		p.Text = p.summary()
+	}
+	return p
+}
+
+func (n *Notifier) render(p Payload) ([]byte, error) {
+	if n.tmpl == nil {
+		return json.Marshal(p)
+	}
+	var buf bytes.Buffer
+	if err := n.tmpl.Execute(&buf, p); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (n *Notifier) post(ctx context.Context, u string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range n.headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close() // skipcq: GO-S2307
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("got status %s", resp.Status)
+	}
+	return nil
+}
+
+// summary is the default Text of p, like "Deployment of my-app v12 by
+// jane@example.com (1a2b3c4) succeeded".
+func (p Payload) summary() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Deployment of %s", p.App)
+	if p.Version > 0 {
+		fmt.Fprintf(&b, " v%d", p.Version)
+	}
+	if p.RollbackOf > 0 {
+		fmt.Fprintf(&b, " (rollback to v%d)", p.RollbackOf)
+	}
+	if p.User != "" {
+		fmt.Fprintf(&b, " by %s", p.User)
+	}
+	if p.GitSHA != "" {
+		fmt.Fprintf(&b, " (%s)", p.GitSHA[:min(len(p.GitSHA), 7)])
+	}
+
+	switch p.Stage {
+	case appconfig.DeployNotifyRolledBack:
+		b.WriteString(" was rolled back")
+	default:
+		fmt.Fprintf(&b, " %s", p.Stage)
+	}
+	if p.Error != "" {
+		fmt.Fprintf(&b, ": %s", p.Error)
+	}
+	return b.String()
+}
+
+// redactURL keeps webhook URLs, which often embed a token, out of warnings.
+func redactURL(u string) string {
+	parsed, err := url.Parse(u)
+	if err != nil || parsed.Host == "" {
+		return "webhook"
+	}
+	return parsed.Scheme + "://" + parsed.Host
+}
+
+// GitSHA returns the commit being deployed from dir, as given by CI or git
+// itself, or an empty string when it's not a git checkout.
+func GitSHA(ctx context.Context, dir string) string {
+	if sha := env.GitCommitSHA(); sha != "" {
+		return sha
+	}
+	cmd := exec.CommandContext(ctx, "git", "rev-parse", "HEAD")
+	cmd.Dir = dir
+	out, err := cmd.Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
+
+type contextKey struct{}
+
+// NewContext derives a Context that carries n from ctx.
+func NewContext(ctx context.Context, n *Notifier) context.Context {
+	return context.WithValue(ctx, contextKey{}, n)
+}
+
+// FromContext returns the Notifier ctx carries, or nil.
+func FromContext(ctx context.Context) *Notifier {
+	n, _ := ctx.Value(contextKey{}).(*Notifier)
+	return n
+}
+
+// Notify posts p with the Notifier ctx carries, if any.
+func Notify(ctx context.Context, p Payload) {
+	FromContext(ctx).Notify(ctx, p)
+}
+
+// NotifyFailure posts a failed stage for err with the Notifier ctx carries,
+// unless the outcome of the deployment was already notified. It covers the
+// deployments failing before their machines are deployed, like failed builds.
+func NotifyFailure(ctx context.Context, err error) {
+	if err == nil || FromContext(ctx).Finished() {
+		return
+	}
+	Notify(ctx, Payload{Stage: appconfig.DeployNotifyFailed, Error: err.Error()})
+}
@@ -0,0 +1,133 @@
+package deploynotify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	fly "github.com/superfly/fly-go"
+	"github.com/superfly/flyctl/internal/appconfig"
+)
+
+type recorder struct {
+	mu     sync.Mutex
+	bodies []string
+	auth   []string
+}
+
+func (r *recorder) server(t *testing.T, status int) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		r.mu.Lock()
+		r.bodies = append(r.bodies, string(body))
+		r.auth = append(r.auth, req.Header.Get("Authorization"))
+		r.mu.Unlock()
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestNotify(t *testing.T) {
+	var rec recorder
+	srv := rec.server(t, http.StatusOK)
+
+	var warn bytes.Buffer
+	n, err := New(nil, []string{srv.URL}, Payload{App: "my-app", User: "jane@example.com", GitSHA: "1a2b3c4d5e"}, &warn)
+	require.NoError(t, err)
+	ctx := NewContext(context.Background(), n)
+
+	Notify(ctx, Payload{Stage: appconfig.DeployNotifyStarted, Version: 12, Image: "registry.fly.io/my-app:v12"})
+	require.Len(t, rec.bodies, 1)
+
+	var p Payload
+	require.NoError(t, json.Unmarshal([]byte(rec.bodies[0]), &p))
+	assert.Equal(t, "started", p.Stage)
+	assert.Equal(t, "my-app", p.App)
+	assert.Equal(t, 12, p.Version)
+	assert.Equal(t, "1a2b3c4d5e", p.GitSHA)
+	assert.Equal(t, "Deployment of my-app v12 by jane@example.com (1a2b3c4) started", p.Text)
+	assert.False(t, p.Time.IsZero())
+	assert.Empty(t, warn.String())
+}
+
+func TestNotifyConfig(t *testing.T) {
+	var rec recorder
+	srv := rec.server(t, http.StatusOK)
+
+	n, err := New(&appconfig.DeployNotify{
+		URLs:     []string{srv.URL},
+		Events:   []string{appconfig.DeployNotifyFailed, appconfig.DeployNotifyRolledBack},
+		Template: `{"text": {{ json .Text }}, "sha": {{ json .GitSHA }}}`,
+		Headers:  map[string]string{"Authorization": "Bearer token"},
+		Timeout:  fly.MustParseDuration("2s"),
+	}, nil, Payload{App: "my-app"}, io.Discard)
+	require.NoError(t, err)
+
+	n.Notify(context.Background(), Payload{Stage: appconfig.DeployNotifyStarted})
+	n.Notify(context.Background(), Payload{Stage: appconfig.DeployNotifyFailed, Version: 3, Error: `health checks "failed"`})
+	n.Notify(context.Background(), Payload{Stage: appconfig.DeployNotifyRolledBack, Version: 3})
+
+	assert.Equal(t, []string{
+		`{"text": "Deployment of my-app v3 failed: health checks \"failed\"", "sha": ""}`,
+		`{"text": "Deployment of my-app v3 was rolled back", "sha": ""}`,
+	}, rec.bodies)
+	assert.Equal(t, []string{"Bearer token", "Bearer token"}, rec.auth)
+}
+
+func TestNotifyFailureWarns(t *testing.T) {
+	var rec recorder
+	srv := rec.server(t, http.StatusInternalServerError)
+
+	var warn bytes.Buffer
+	n, err := New(nil, []string{srv.URL + "/secret-token"}, Payload{App: "my-app"}, &warn)
+	require.NoError(t, err)
+
+	// A canceled deployment still gets its notification out
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	n.Notify(ctx, Payload{Stage: appconfig.DeployNotifyFailed})
+
+	assert.Len(t, rec.bodies, 1)
+	assert.Contains(t, warn.String(), "WARN failed to notify "+srv.URL+" of the failed deployment: got status 500")
+	assert.NotContains(t, warn.String(), "secret-token")
+}
+
+func TestNotifyFailureBeforeDeploying(t *testing.T) {
+	var rec recorder
+	srv := rec.server(t, http.StatusOK)
+
+	n, err := New(nil, []string{srv.URL}, Payload{App: "my-app"}, io.Discard)
+	require.NoError(t, err)
+	ctx := NewContext(context.Background(), n)
+
+	NotifyFailure(ctx, nil)
+	assert.Empty(t, rec.bodies)
+
+	// A failed build is the first and last stage notified
+	NotifyFailure(ctx, errors.New("failed to build the image"))
+	require.Len(t, rec.bodies, 1)
+	assert.Contains(t, rec.bodies[0], `"text":"Deployment of my-app failed: failed to build the image"`)
+	assert.True(t, n.Finished())
+
+	// Failed deployments notify their failure themselves
+	NotifyFailure(ctx, errors.New("health checks failed"))
+	assert.Len(t, rec.bodies, 1)
+}
+
+func TestNoWebhooks(t *testing.T) {
+	n, err := New(&appconfig.DeployNotify{Events: []string{"started"}}, nil, Payload{}, io.Discard)
+	require.NoError(t, err)
+	assert.Nil(t, n)
+	assert.NotPanics(t, func() {
+		Notify(NewContext(context.Background(), n), Payload{Stage: appconfig.DeployNotifyStarted})
+	})
+}
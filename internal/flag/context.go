@@ -136,6 +136,11 @@ func GetYes(ctx context.Context) bool {
 	return GetBool(ctx, flagnames.Yes)
 }
 
+// GetOverrideFreeze is shorthand for GetString(ctx, OverrideFreeze).
+func GetOverrideFreeze(ctx context.Context) string {
+	return GetString(ctx, flagnames.OverrideFreeze)
+}
+
 // GetApp is shorthand for GetString(ctx, App).
 func GetApp(ctx context.Context) string {
 	return GetString(ctx, flagnames.App)
@@ -150,6 +155,15 @@ func GetAppConfigFilePath(ctx context.Context) string {
 	}
 }
 
+// GetAppConfigEnv is shorthand for GetString(ctx, AppConfigEnv).
+func GetAppConfigEnv(ctx context.Context) string {
+	if env, err := FromContext(ctx).GetString(flagnames.AppConfigEnv); err != nil {
+		return ""
+	} else {
+		return env
+	}
+}
+
 // GetBindAddr is shorthand for GetString(ctx, BindAddr).
 func GetBindAddr(ctx context.Context) string {
 	return GetString(ctx, flagnames.BindAddr)
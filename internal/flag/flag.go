@@ -350,6 +350,14 @@ func AppConfig() String {
 	}
 }
 
+// AppConfigEnv returns a flag selecting the app configuration overlay to merge.
+func AppConfigEnv() String {
+	return String{
+		Name:        flagnames.AppConfigEnv,
+		Description: "Name of the environment overlay to merge on top of the application configuration file, e.g. 'production' for fly.production.toml",
+	}
+}
+
 // Image returns a Docker image config string flag.
 func Image() String {
 	return String{
@@ -359,6 +367,15 @@ func Image() String {
 	}
 }
 
+// OverrideFreeze returns a string flag to go ahead during a [[deploy.freeze]]
+// window, given the reason.
+func OverrideFreeze() String {
+	return String{
+		Name:        flagnames.OverrideFreeze,
+		Description: "Run during a deploy freeze window of fly.toml anyway, giving the reason",
+	}
+}
+
 // Now returns a boolean flag for deploying immediately
 func Now() Bool {
 	return Bool{
@@ -31,6 +31,9 @@ const (
 	// AppConfigFilePath denotes the name of the app config file path flag.
 	AppConfigFilePath = "config"
 
+	// AppConfigEnv denotes the name of the app config environment overlay flag.
+	AppConfigEnv = "config-env"
+
 	// Image denotes the name of the image flag.
 	Image = "image"
 
@@ -51,4 +54,7 @@ const (
 
 	// ProcessGroup denotes the name of the process group flag.
 	ProcessGroup = "process-group"
+
+	// OverrideFreeze denotes the name of the deploy freeze override flag.
+	OverrideFreeze = "override-freeze"
 )
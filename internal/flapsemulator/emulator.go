@@ -0,0 +1,213 @@
+// Package flapsemulator is an in-memory stand-in for the Machines API
+// (flaps), serving the endpoints flyctl uses so that commands and tests can
+// run without a Fly.io organization. Point flyctl at it with
+// FLY_FLAPS_BASE_URL.
+//
+// Machines change state as soon as they're asked to: there's no VM behind
+// them, so they never crash, run commands or report health checks.
+package flapsemulator
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	fly "github.com/superfly/fly-go"
+)
+
+// DefaultRegion is where machines and volumes go when they're not given a
+// region
+const DefaultRegion = "iad"
+
+// Server emulates the Machines API of any number of apps, which are created
+// as they are first used. It's safe for concurrent use.
+type Server struct {
+	mu   sync.Mutex
+	apps map[string]*app
+	// changed is closed and replaced whenever a machine changes, to wake up
+	// the requests waiting on one
+	changed chan struct{}
+	nextIP  int
+	now     func() time.Time
+}
+
+type app struct {
+	machines     map[string]*machine
+	machineOrder []string
+	volumes      map[string]*fly.Volume
+	volumeOrder  []string
+	snapshots    map[string][]fly.VolumeSnapshot
+}
+
+type machine struct {
+	*fly.Machine
+	lease *fly.MachineLeaseData
+}
+
+// New returns an emulator without any app.
+func New() *Server {
+	return &Server{
+		apps:    map[string]*app{},
+		changed: make(chan struct{}),
+		now:     time.Now,
+	}
+}
+
+// ServeHTTP handles the requests of a flaps client.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/v1"), "/"), "/")
+	if parts[0] != "apps" {
+		writeError(w, http.StatusNotFound, "no route for %s %s", r.Method, r.URL.Path)
+		return
+	}
+
+	switch {
+	case len(parts) == 1 && r.Method == http.MethodPost:
+		var in struct {
+			AppName string `json:"app_name"`
+		}
+		if !readJSON(w, r, &in) {
+			return
+		}
+		s.mu.Lock()
+		s.app(in.AppName)
+		s.mu.Unlock()
+		w.WriteHeader(http.StatusCreated)
+	case len(parts) == 2 && r.Method == http.MethodGet:
+		writeJSON(w, http.StatusOK, map[string]string{"name": parts[1]})
+	case len(parts) >= 3 && parts[2] == "machines":
+		s.serveMachines(w, r, parts[1], parts[3:])
+	case len(parts) >= 3 && parts[2] == "volumes":
+		s.serveVolumes(w, r, parts[1], parts[3:])
+	default:
+		writeError(w, http.StatusNotFound, "no route for %s %s", r.Method, r.URL.Path)
+	}
+}
+
+// Machines returns copies of the machines of appName that aren't destroyed,
+// in the order they were created.
+func (s *Server) Machines(appName string) []*fly.Machine {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	a := s.app(appName)
+	var machines []*fly.Machine
+	for _, id := range a.machineOrder {
+		if m := a.machines[id]; m.IsActive() {
+			machines = append(machines, clone(m.Machine))
+		}
+	}
+	return machines
+}
+
+// AddMachine adds m to appName as is, but for the ID, state, instance and
+// private IP it gets when it doesn't have them. It returns what was added.
+func (s *Server) AddMachine(appName string, m *fly.Machine) *fly.Machine {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m = clone(m)
+	if m.ID == "" {
+		m.ID = randomID(7)
+	}
+	if m.State == "" {
+		m.State = fly.MachineStateStarted
+	}
+	if m.Region == "" {
+		m.Region = DefaultRegion
+	}
+	if m.InstanceID == "" {
+		m.InstanceID = newInstanceID()
+		m.Version = m.InstanceID
+	}
+	if m.PrivateIP == "" {
+		m.PrivateIP = s.privateIP()
+	}
+	if m.Config != nil {
+		m.ImageRef = imageRef(m.Config.Image)
+	}
+
+	a := s.app(appName)
+	a.machines[m.ID] = &machine{Machine: m}
+	a.machineOrder = append(a.machineOrder, m.ID)
+	s.notify()
+	return clone(m)
+}
+
+// app returns the state of name, creating it on first use. s.mu must be held.
+func (s *Server) app(name string) *app {
+	a, ok := s.apps[name]
+	if !ok {
+		a = &app{
+			machines:  map[string]*machine{},
+			volumes:   map[string]*fly.Volume{},
+			snapshots: map[string][]fly.VolumeSnapshot{},
+		}
+		s.apps[name] = a
+	}
+	return a
+}
+
+// notify wakes up the requests waiting on machines. s.mu must be held.
+func (s *Server) notify() {
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+// privateIP hands out 6PN addresses. s.mu must be held.
+func (s *Server) privateIP() string {
+	s.nextIP++
+	return fmt.Sprintf("fdaa:0:1:a7b:1::%x", s.nextIP)
+}
+
+func randomID(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// imageRef splits image like registry.fly.io/my-app:deployment-1@sha256:...
+func imageRef(image string) fly.MachineImageRef {
+	var ref fly.MachineImageRef
+	image, ref.Digest, _ = strings.Cut(image, "@")
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		image, ref.Tag = image[:i], image[i+1:]
+	}
+	ref.Registry = "docker.io"
+	ref.Repository = image
+	if registry, repository, ok := strings.Cut(image, "/"); ok && strings.ContainsAny(registry, ".:") {
+		ref.Registry, ref.Repository = registry, repository
+	}
+	return ref
+}
+
+func clone[T any](v *T) *T {
+	data, _ := json.Marshal(v)
+	out := new(T)
+	_ = json.Unmarshal(data, out)
+	return out
+}
+
+func readJSON(w http.ResponseWriter, r *http.Request, v any) bool {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body: %v", err)
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// writeError answers like flaps does, with a message flaps clients surface
+func writeError(w http.ResponseWriter, status int, format string, args ...any) {
+	writeJSON(w, status, map[string]string{"error": fmt.Sprintf(format, args...)})
+}
@@ -0,0 +1,127 @@
+package flapsemulator
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	fly "github.com/superfly/fly-go"
+)
+
+func TestMachineLifecycle(t *testing.T) {
+	ctx := context.Background()
+	emulator, client := NewTestClient(t, "my-app")
+
+	m, err := client.Launch(ctx, fly.LaunchMachineInput{
+		Region: "fra",
+		Config: &fly.MachineConfig{Image: "registry.fly.io/my-app:deployment-1"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, fly.MachineStateStarted, m.State)
+	assert.Equal(t, "fra", m.Region)
+	assert.Equal(t, "deployment-1", m.ImageRef.Tag)
+	require.NoError(t, client.Wait(ctx, m, fly.MachineStateStarted, time.Second))
+
+	_, err = client.Launch(ctx, fly.LaunchMachineInput{Config: &fly.MachineConfig{}})
+	assert.ErrorContains(t, err, "an image is required")
+	_, err = client.Launch(ctx, fly.LaunchMachineInput{Name: m.Name, Config: &fly.MachineConfig{Image: "nginx"}})
+	assert.ErrorContains(t, err, "a machine named "+m.Name+" already exists")
+
+	lease, err := client.AcquireLease(ctx, m.ID, lo.ToPtr(10))
+	require.NoError(t, err)
+	_, err = client.AcquireLease(ctx, m.ID, nil)
+	assert.ErrorContains(t, err, "lease currently held")
+
+	update := fly.LaunchMachineInput{ID: m.ID, Config: &fly.MachineConfig{Image: "registry.fly.io/my-app:deployment-2"}}
+	_, err = client.Update(ctx, update, "")
+	assert.ErrorContains(t, err, "nonce is required")
+	updated, err := client.Update(ctx, update, lease.Data.Nonce)
+	require.NoError(t, err)
+	assert.Equal(t, "deployment-2", updated.ImageRef.Tag)
+	assert.NotEqual(t, m.InstanceID, updated.InstanceID)
+	require.NoError(t, client.ReleaseLease(ctx, m.ID, lease.Data.Nonce))
+
+	done := make(chan error, 1)
+	go func() {
+		done <- client.Wait(ctx, updated, fly.MachineStateStopped, 5*time.Second)
+	}()
+	require.NoError(t, client.Stop(ctx, fly.StopMachineInput{ID: m.ID}, ""))
+	require.NoError(t, <-done)
+
+	got, err := client.Get(ctx, m.ID)
+	require.NoError(t, err)
+	assert.Equal(t, fly.MachineStateStopped, got.State)
+	assert.Equal(t, []string{"exit", "stop", "start", "update", "start", "launch"}, lo.Map(got.Events, func(ev *fly.MachineEvent, _ int) string {
+		return ev.Type
+	}))
+
+	require.NoError(t, client.Destroy(ctx, fly.RemoveMachineInput{ID: m.ID}, ""))
+	assert.Empty(t, emulator.Machines("my-app"))
+	machines, err := client.ListActive(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, machines)
+}
+
+func TestDestroyStartedMachine(t *testing.T) {
+	ctx := context.Background()
+	emulator, client := NewTestClient(t, "my-app")
+
+	m := emulator.AddMachine("my-app", &fly.Machine{Config: &fly.MachineConfig{Image: "nginx"}})
+	assert.Equal(t, fly.MachineStateStarted, m.State)
+	assert.Equal(t, "nginx", m.ImageRef.Repository)
+
+	err := client.Destroy(ctx, fly.RemoveMachineInput{ID: m.ID}, "")
+	assert.ErrorContains(t, err, "not currently stopped")
+	require.NoError(t, client.Destroy(ctx, fly.RemoveMachineInput{ID: m.ID, Kill: true}, ""))
+
+	got, err := client.Get(ctx, m.ID)
+	require.NoError(t, err)
+	assert.Equal(t, fly.MachineStateDestroyed, got.State)
+}
+
+func TestVolumes(t *testing.T) {
+	ctx := context.Background()
+	emulator, client := NewTestClient(t, "my-app")
+
+	vol, err := client.CreateVolume(ctx, fly.CreateVolumeRequest{Name: "data", Region: "fra", SizeGb: lo.ToPtr(3)})
+	require.NoError(t, err)
+	assert.Equal(t, 3, vol.SizeGb)
+	assert.True(t, vol.Encrypted)
+
+	m, err := client.Launch(ctx, fly.LaunchMachineInput{
+		Region: "fra",
+		Config: &fly.MachineConfig{
+			Image:  "nginx",
+			Mounts: []fly.MachineMount{{Volume: vol.ID, Path: "/data"}},
+		},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, lo.ToPtr(m.ID), emulator.Volumes("my-app")[0].AttachedMachine)
+
+	_, err = client.Launch(ctx, fly.LaunchMachineInput{
+		Config: &fly.MachineConfig{
+			Image:  "nginx",
+			Mounts: []fly.MachineMount{{Volume: vol.ID, Path: "/data"}},
+		},
+	})
+	assert.ErrorContains(t, err, "is attached to machine "+m.ID)
+
+	extended, needsRestart, err := client.ExtendVolume(ctx, vol.ID, 5)
+	require.NoError(t, err)
+	assert.Equal(t, 5, extended.SizeGb)
+	assert.True(t, needsRestart)
+
+	_, err = client.DeleteVolume(ctx, vol.ID)
+	assert.ErrorContains(t, err, "is attached")
+
+	require.NoError(t, client.Destroy(ctx, fly.RemoveMachineInput{ID: m.ID, Kill: true}, ""))
+	_, err = client.DeleteVolume(ctx, vol.ID)
+	require.NoError(t, err)
+
+	volumes, err := client.GetVolumes(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, volumes)
+}
@@ -0,0 +1,453 @@
+package flapsemulator
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	fly "github.com/superfly/fly-go"
+	"github.com/superfly/fly-go/flaps"
+)
+
+// DefaultLeaseTTL is how long leases last when their TTL isn't given
+const DefaultLeaseTTL = 30 * time.Second
+
+func (s *Server) serveMachines(w http.ResponseWriter, r *http.Request, appName string, rest []string) {
+	switch {
+	case len(rest) == 0 && r.Method == http.MethodGet:
+		s.listMachines(w, appName)
+	case len(rest) == 0 && r.Method == http.MethodPost:
+		s.launchMachine(w, r, appName)
+	case len(rest) == 2 && rest[1] == "wait" && r.Method == http.MethodGet:
+		s.waitMachine(w, r, appName, rest[0])
+	case len(rest) >= 1:
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		m, ok := s.app(appName).machines[rest[0]]
+		if !ok {
+			writeError(w, http.StatusNotFound, "machine not found")
+			return
+		}
+		s.serveMachine(w, r, appName, m, rest[1:])
+	default:
+		writeError(w, http.StatusNotFound, "no route for %s %s", r.Method, r.URL.Path)
+	}
+}
+
+// serveMachine handles the requests on an existing machine. s.mu must be held.
+func (s *Server) serveMachine(w http.ResponseWriter, r *http.Request, appName string, m *machine, rest []string) {
+	action := ""
+	if len(rest) > 0 {
+		action = rest[0]
+	}
+
+	switch {
+	case action == "" && r.Method == http.MethodGet:
+		writeJSON(w, http.StatusOK, m.Machine)
+	case action == "lease":
+		s.serveLease(w, r, m)
+	case action == "metadata":
+		s.serveMetadata(w, r, m, rest[1:])
+	case action == "ps" && r.Method == http.MethodGet:
+		writeJSON(w, http.StatusOK, fly.MachinePsResponse{})
+	case action == "exec":
+		writeError(w, http.StatusNotImplemented, "exec isn't supported by the Machines API emulator")
+	case action == "signal" && r.Method == http.MethodPost:
+		m.State = fly.MachineStateStopped
+		s.addEvent(m, "exit", fly.MachineStateStopped, &fly.MachineRequest{
+			ExitEvent: &fly.MachineExitEvent{ExitCode: 137, GuestSignal: 9, RequestedStop: true, ExitedAt: s.now()},
+		})
+		s.notify()
+		w.WriteHeader(http.StatusOK)
+	case !s.checkLease(w, r, m):
+		return
+	case action == "" && r.Method == http.MethodPost:
+		s.updateMachine(w, r, appName, m)
+	case action == "" && r.Method == http.MethodDelete:
+		s.destroyMachine(w, r, appName, m)
+	case action == "start" && r.Method == http.MethodPost:
+		previous := m.State
+		if previous == fly.MachineStateDestroyed {
+			writeError(w, http.StatusPreconditionFailed, "unable to start machine, it's destroyed")
+			return
+		}
+		m.State = fly.MachineStateStarted
+		s.addEvent(m, "start", fly.MachineStateStarted, nil)
+		s.notify()
+		writeJSON(w, http.StatusOK, fly.MachineStartResponse{Status: "success", PreviousState: previous})
+	case action == "stop" && r.Method == http.MethodPost:
+		s.addEvent(m, "stop", "stopping", nil)
+		s.stop(m)
+		w.WriteHeader(http.StatusOK)
+	case action == "restart" && r.Method == http.MethodPost:
+		s.addEvent(m, "restart", "stopping", nil)
+		s.stop(m)
+		m.State = fly.MachineStateStarted
+		s.addEvent(m, "start", fly.MachineStateStarted, nil)
+		s.notify()
+		w.WriteHeader(http.StatusOK)
+	case (action == "cordon" || action == "uncordon") && r.Method == http.MethodPost:
+		w.WriteHeader(http.StatusOK)
+	default:
+		writeError(w, http.StatusNotFound, "no route for %s %s", r.Method, r.URL.Path)
+	}
+}
+
+func (s *Server) listMachines(w http.ResponseWriter, appName string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	a := s.app(appName)
+	machines := make([]*fly.Machine, 0, len(a.machineOrder))
+	for _, id := range a.machineOrder {
+		if m := a.machines[id]; m.IsActive() {
+			machines = append(machines, m.Machine)
+		}
+	}
+	writeJSON(w, http.StatusOK, machines)
+}
+
+func (s *Server) launchMachine(w http.ResponseWriter, r *http.Request, appName string) {
+	var in fly.LaunchMachineInput
+	if !readJSON(w, r, &in) {
+		return
+	}
+	if in.Config == nil || in.Config.Image == "" {
+		writeError(w, http.StatusBadRequest, "invalid config: an image is required")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now().UTC().Format(time.RFC3339)
+	id := randomID(7)
+	m := &machine{Machine: &fly.Machine{
+		ID:         id,
+		Name:       in.Name,
+		Region:     in.Region,
+		Config:     in.Config,
+		ImageRef:   imageRef(in.Config.Image),
+		InstanceID: newInstanceID(),
+		PrivateIP:  s.privateIP(),
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}}
+	m.Version = m.InstanceID
+	if m.Name == "" {
+		m.Name = "machine-" + id[:6]
+	}
+	if m.Region == "" {
+		m.Region = DefaultRegion
+	}
+
+	a := s.app(appName)
+	for _, other := range a.machines {
+		if other.IsActive() && other.Name == m.Name {
+			writeError(w, http.StatusConflict, "a machine named %s already exists", m.Name)
+			return
+		}
+	}
+	if err := s.attachVolumes(a, m); err != "" {
+		writeError(w, http.StatusUnprocessableEntity, "%s", err)
+		return
+	}
+
+	m.State = fly.MachineStateCreated
+	s.addEvent(m, "launch", fly.MachineStateCreated, nil)
+	if !in.SkipLaunch {
+		m.State = fly.MachineStateStarted
+		s.addEvent(m, "start", fly.MachineStateStarted, nil)
+	}
+	a.machines[id] = m
+	a.machineOrder = append(a.machineOrder, id)
+
+	out := clone(m.Machine)
+	if in.LeaseTTL > 0 {
+		out.LeaseNonce = s.acquireLease(m, time.Duration(in.LeaseTTL)*time.Second).Nonce
+	}
+	s.notify()
+	writeJSON(w, http.StatusOK, out)
+}
+
+// updateMachine replaces the config of m. s.mu must be held.
+func (s *Server) updateMachine(w http.ResponseWriter, r *http.Request, appName string, m *machine) {
+	var in fly.LaunchMachineInput
+	if !readJSON(w, r, &in) {
+		return
+	}
+	if in.Config == nil || in.Config.Image == "" {
+		writeError(w, http.StatusBadRequest, "invalid config: an image is required")
+		return
+	}
+	if m.State == fly.MachineStateDestroyed {
+		writeError(w, http.StatusPreconditionFailed, "unable to update machine, it's destroyed")
+		return
+	}
+
+	a := s.app(appName)
+	previous := m.Config
+	m.Config = in.Config
+	if err := s.attachVolumes(a, m); err != "" {
+		m.Config = previous
+		writeError(w, http.StatusUnprocessableEntity, "%s", err)
+		return
+	}
+	s.detachVolumes(a, m, previous)
+
+	if in.Name != "" {
+		m.Name = in.Name
+	}
+	m.ImageRef = imageRef(m.Config.Image)
+	m.InstanceID = newInstanceID()
+	m.Version = m.InstanceID
+	m.UpdatedAt = s.now().UTC().Format(time.RFC3339)
+
+	s.addEvent(m, "update", "replacing", nil)
+	if in.SkipLaunch {
+		s.stop(m)
+	} else {
+		m.State = fly.MachineStateStarted
+		s.addEvent(m, "start", fly.MachineStateStarted, nil)
+	}
+	s.notify()
+	writeJSON(w, http.StatusOK, m.Machine)
+}
+
+// destroyMachine marks m destroyed, which keeps it around for Get and wait
+// requests. s.mu must be held.
+func (s *Server) destroyMachine(w http.ResponseWriter, r *http.Request, appName string, m *machine) {
+	kill, _ := strconv.ParseBool(r.URL.Query().Get("kill"))
+	switch {
+	case m.State == fly.MachineStateDestroyed:
+		writeError(w, http.StatusPreconditionFailed, "machine is already destroyed")
+		return
+	case m.State == fly.MachineStateStarted && !kill:
+		writeError(w, http.StatusPreconditionFailed, "unable to destroy machine, not currently stopped")
+		return
+	}
+
+	m.State = fly.MachineStateDestroyed
+	s.detachVolumes(s.app(appName), m, m.Config)
+	m.lease = nil
+	s.addEvent(m, "destroy", fly.MachineStateDestroyed, nil)
+	s.notify()
+	w.WriteHeader(http.StatusOK)
+}
+
+// waitMachine answers once the machine is in the state asked for, or with a
+// 408 once the timeout is reached, as flaps does.
+func (s *Server) waitMachine(w http.ResponseWriter, r *http.Request, appName, id string) {
+	state := r.URL.Query().Get("state")
+	if state == "" {
+		state = fly.MachineStateStarted
+	}
+	timeout := 60 * time.Second
+	if seconds, err := strconv.Atoi(r.URL.Query().Get("timeout")); err == nil && seconds > 0 {
+		timeout = time.Duration(seconds) * time.Second
+	}
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+
+	for {
+		s.mu.Lock()
+		m, ok := s.app(appName).machines[id]
+		current, changed := "", s.changed
+		if ok {
+			current = m.State
+		}
+		s.mu.Unlock()
+
+		switch {
+		case !ok:
+			writeError(w, http.StatusNotFound, "machine not found")
+			return
+		case current == state:
+			writeJSON(w, http.StatusOK, map[string]bool{"ok": true})
+			return
+		}
+
+		select {
+		case <-changed:
+		case <-deadline.C:
+			writeError(w, http.StatusRequestTimeout, "deadline_exceeded: machine didn't reach the %s state", state)
+			return
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// serveLease finds, acquires, refreshes and releases leases. s.mu must be
+// held.
+func (s *Server) serveLease(w http.ResponseWriter, r *http.Request, m *machine) {
+	held := m.lease != nil && time.Unix(m.lease.ExpiresAt, 0).After(s.now())
+	nonce := r.Header.Get(flaps.NonceHeader)
+
+	switch r.Method {
+	case http.MethodGet:
+		if !held {
+			writeError(w, http.StatusNotFound, "lease not found")
+			return
+		}
+		writeJSON(w, http.StatusOK, &fly.MachineLease{Status: "success", Data: m.lease})
+	case http.MethodPost:
+		if held && nonce != m.lease.Nonce {
+			writeError(w, http.StatusConflict, "lease currently held by %s", m.lease.Owner)
+			return
+		}
+		ttl := DefaultLeaseTTL
+		if seconds, err := strconv.Atoi(r.URL.Query().Get("ttl")); err == nil && seconds > 0 {
+			ttl = time.Duration(seconds) * time.Second
+		}
+		var lease *fly.MachineLeaseData
+		if held {
+			m.lease.ExpiresAt = s.now().Add(ttl).Unix()
+			lease = m.lease
+		} else {
+			lease = s.acquireLease(m, ttl)
+		}
+		writeJSON(w, http.StatusOK, &fly.MachineLease{Status: "success", Data: lease})
+	case http.MethodDelete:
+		if held && nonce != m.lease.Nonce {
+			writeError(w, http.StatusConflict, "lease currently held by %s", m.lease.Owner)
+			return
+		}
+		m.lease = nil
+		w.WriteHeader(http.StatusOK)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// checkLease refuses changes to machines leased to others, answering with a
+// 409 when it does. s.mu must be held.
+func (s *Server) checkLease(w http.ResponseWriter, r *http.Request, m *machine) bool {
+	if m.lease == nil || !time.Unix(m.lease.ExpiresAt, 0).After(s.now()) {
+		return true
+	}
+	if r.Header.Get(flaps.NonceHeader) == m.lease.Nonce {
+		return true
+	}
+	writeError(w, http.StatusConflict, "machine %s is leased, the lease nonce is required", m.ID)
+	return false
+}
+
+func (s *Server) acquireLease(m *machine, ttl time.Duration) *fly.MachineLeaseData {
+	m.lease = &fly.MachineLeaseData{
+		Nonce:     randomID(8),
+		ExpiresAt: s.now().Add(ttl).Unix(),
+		Owner:     "flaps-emulator",
+		Version:   m.Version,
+	}
+	return m.lease
+}
+
+// serveMetadata edits the config metadata of m. s.mu must be held.
+func (s *Server) serveMetadata(w http.ResponseWriter, r *http.Request, m *machine, rest []string) {
+	if m.Config == nil {
+		m.Config = &fly.MachineConfig{}
+	}
+	if m.Config.Metadata == nil {
+		m.Config.Metadata = map[string]string{}
+	}
+
+	switch {
+	case len(rest) == 0 && r.Method == http.MethodGet:
+		writeJSON(w, http.StatusOK, m.Config.Metadata)
+	case len(rest) == 1 && r.Method == http.MethodPost:
+		var in struct {
+			Value string `json:"value"`
+		}
+		if !readJSON(w, r, &in) {
+			return
+		}
+		m.Config.Metadata[rest[0]] = in.Value
+		w.WriteHeader(http.StatusNoContent)
+	case len(rest) == 1 && r.Method == http.MethodDelete:
+		delete(m.Config.Metadata, rest[0])
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusNotFound, "no route for %s %s", r.Method, r.URL.Path)
+	}
+}
+
+// stop stops m as if it was asked to. s.mu must be held.
+func (s *Server) stop(m *machine) {
+	m.State = fly.MachineStateStopped
+	s.addEvent(m, "exit", fly.MachineStateStopped, &fly.MachineRequest{
+		ExitEvent: &fly.MachineExitEvent{RequestedStop: true, ExitedAt: s.now()},
+	})
+	s.notify()
+}
+
+// addEvent records an event on m, newest first as flaps lists them.
+func (s *Server) addEvent(m *machine, typ, status string, request *fly.MachineRequest) {
+	ev := &fly.MachineEvent{
+		Type:      typ,
+		Status:    status,
+		Source:    "flyd",
+		Timestamp: s.now().UnixMilli(),
+		Request:   request,
+	}
+	m.Events = append([]*fly.MachineEvent{ev}, m.Events...)
+}
+
+// attachVolumes attaches the volumes m mounts, unless they're attached to
+// other machines. It returns what's wrong otherwise. s.mu must be held.
+func (s *Server) attachVolumes(a *app, m *machine) string {
+	for _, mount := range m.Config.Mounts {
+		if mount.Volume == "" {
+			continue
+		}
+		vol, ok := a.volumes[mount.Volume]
+		if !ok {
+			return "volume " + mount.Volume + " not found"
+		}
+		if vol.AttachedMachine != nil && *vol.AttachedMachine != m.ID {
+			return "volume " + mount.Volume + " is attached to machine " + *vol.AttachedMachine
+		}
+	}
+	for _, mount := range m.Config.Mounts {
+		if vol, ok := a.volumes[mount.Volume]; ok {
+			id := m.ID
+			vol.AttachedMachine = &id
+		}
+	}
+	return ""
+}
+
+// detachVolumes detaches the volumes of config that m no longer mounts, all
+// of them once m is destroyed. s.mu must be held.
+func (s *Server) detachVolumes(a *app, m *machine, config *fly.MachineConfig) {
+	if config == nil {
+		return
+	}
+	for _, mount := range config.Mounts {
+		vol, ok := a.volumes[mount.Volume]
+		if !ok || vol.AttachedMachine == nil || *vol.AttachedMachine != m.ID {
+			continue
+		}
+		if m.State != fly.MachineStateDestroyed && mounts(m.Config, mount.Volume) {
+			continue
+		}
+		vol.AttachedMachine = nil
+	}
+}
+
+func mounts(config *fly.MachineConfig, volume string) bool {
+	if config == nil {
+		return false
+	}
+	for _, mount := range config.Mounts {
+		if mount.Volume == volume {
+			return true
+		}
+	}
+	return false
+}
+
+func newInstanceID() string {
+	return "01" + randomID(12)
+}
@@ -0,0 +1,31 @@
+package flapsemulator
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/superfly/fly-go/flaps"
+	"github.com/superfly/fly-go/tokens"
+)
+
+// NewTestClient serves a new emulator for the duration of t and returns it
+// with a Machines API client of appName talking to it. FLY_FLAPS_BASE_URL
+// points at the emulator too, for the clients the code under test creates.
+func NewTestClient(t testing.TB, appName string) (*Server, *flaps.Client) {
+	t.Helper()
+
+	emulator := New()
+	srv := httptest.NewServer(emulator)
+	t.Cleanup(srv.Close)
+	t.Setenv("FLY_FLAPS_BASE_URL", srv.URL)
+
+	client, err := flaps.NewWithOptions(context.Background(), flaps.NewClientOpts{
+		AppName: appName,
+		Tokens:  tokens.Parse("x"),
+	})
+	if err != nil {
+		t.Fatalf("failed to create a client of the emulator: %v", err)
+	}
+	return emulator, client
+}
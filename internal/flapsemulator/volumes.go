@@ -0,0 +1,203 @@
+package flapsemulator
+
+import (
+	"net/http"
+
+	fly "github.com/superfly/fly-go"
+	"github.com/superfly/fly-go/flaps"
+)
+
+// Volumes returns copies of the volumes of appName, in the order they were
+// created.
+func (s *Server) Volumes(appName string) []fly.Volume {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	a := s.app(appName)
+	volumes := make([]fly.Volume, 0, len(a.volumeOrder))
+	for _, id := range a.volumeOrder {
+		volumes = append(volumes, *clone(a.volumes[id]))
+	}
+	return volumes
+}
+
+// AddVolume adds vol to appName as is, but for the ID, state, region and size
+// it gets when it doesn't have them. It returns what was added.
+func (s *Server) AddVolume(appName string, vol fly.Volume) fly.Volume {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	v := clone(&vol)
+	s.addVolume(s.app(appName), v)
+	return *clone(v)
+}
+
+// addVolume fills in what v is missing and adds it to a. s.mu must be held.
+func (s *Server) addVolume(a *app, v *fly.Volume) {
+	if v.ID == "" {
+		v.ID = "vol_" + randomID(8)
+	}
+	if v.State == "" {
+		v.State = "created"
+	}
+	if v.Region == "" {
+		v.Region = DefaultRegion
+	}
+	if v.SizeGb == 0 {
+		v.SizeGb = 1
+	}
+	if v.Zone == "" {
+		v.Zone = randomID(2)
+	}
+	if v.CreatedAt.IsZero() {
+		v.CreatedAt = s.now().UTC()
+	}
+	a.volumes[v.ID] = v
+	a.volumeOrder = append(a.volumeOrder, v.ID)
+}
+
+func (s *Server) serveVolumes(w http.ResponseWriter, r *http.Request, appName string, rest []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	a := s.app(appName)
+	if len(rest) == 0 {
+		switch r.Method {
+		case http.MethodGet:
+			volumes := make([]*fly.Volume, 0, len(a.volumeOrder))
+			for _, id := range a.volumeOrder {
+				volumes = append(volumes, a.volumes[id])
+			}
+			writeJSON(w, http.StatusOK, volumes)
+		case http.MethodPost:
+			s.createVolume(w, r, a)
+		default:
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		}
+		return
+	}
+
+	vol, ok := a.volumes[rest[0]]
+	if !ok {
+		writeError(w, http.StatusNotFound, "volume not found")
+		return
+	}
+
+	switch action := rest[1:]; {
+	case len(action) == 0 && r.Method == http.MethodGet:
+		writeJSON(w, http.StatusOK, vol)
+	case len(action) == 0 && r.Method == http.MethodPut:
+		var in fly.UpdateVolumeRequest
+		if !readJSON(w, r, &in) {
+			return
+		}
+		if in.SnapshotRetention != nil {
+			vol.SnapshotRetention = *in.SnapshotRetention
+		}
+		if in.AutoBackupEnabled != nil {
+			vol.AutoBackupEnabled = *in.AutoBackupEnabled
+		}
+		writeJSON(w, http.StatusOK, vol)
+	case len(action) == 0 && r.Method == http.MethodDelete:
+		if vol.AttachedMachine != nil {
+			if m, ok := a.machines[*vol.AttachedMachine]; ok && m.IsActive() {
+				writeError(w, http.StatusPreconditionFailed, "volume %s is attached to machine %s", vol.ID, m.ID)
+				return
+			}
+		}
+		delete(a.volumes, vol.ID)
+		delete(a.snapshots, vol.ID)
+		for i, id := range a.volumeOrder {
+			if id == vol.ID {
+				a.volumeOrder = append(a.volumeOrder[:i], a.volumeOrder[i+1:]...)
+				break
+			}
+		}
+		vol.State = "destroyed"
+		writeJSON(w, http.StatusOK, vol)
+	case len(action) == 1 && action[0] == "extend" && r.Method == http.MethodPut:
+		var in flaps.ExtendVolumeRequest
+		if !readJSON(w, r, &in) {
+			return
+		}
+		if in.SizeGB <= vol.SizeGb {
+			writeError(w, http.StatusBadRequest, "volumes can only grow, %s is already %dGB", vol.ID, vol.SizeGb)
+			return
+		}
+		vol.SizeGb = in.SizeGB
+		writeJSON(w, http.StatusOK, &flaps.ExtendVolumeResponse{Volume: vol, NeedsRestart: vol.AttachedMachine != nil})
+	case len(action) == 1 && action[0] == "snapshots" && r.Method == http.MethodGet:
+		snapshots := a.snapshots[vol.ID]
+		if snapshots == nil {
+			snapshots = []fly.VolumeSnapshot{}
+		}
+		writeJSON(w, http.StatusOK, snapshots)
+	case len(action) == 1 && action[0] == "snapshots" && r.Method == http.MethodPost:
+		a.snapshots[vol.ID] = append(a.snapshots[vol.ID], fly.VolumeSnapshot{
+			ID:        "vs_" + randomID(8),
+			Size:      vol.SizeGb << 30,
+			Digest:    randomID(16),
+			CreatedAt: s.now().UTC(),
+			Status:    "created",
+		})
+		w.WriteHeader(http.StatusOK)
+	default:
+		writeError(w, http.StatusNotFound, "no route for %s %s", r.Method, r.URL.Path)
+	}
+}
+
+// createVolume creates a volume, from a snapshot or another volume when
+// asked to. s.mu must be held.
+func (s *Server) createVolume(w http.ResponseWriter, r *http.Request, a *app) {
+	var in fly.CreateVolumeRequest
+	if !readJSON(w, r, &in) {
+		return
+	}
+	if in.Name == "" || in.Region == "" {
+		writeError(w, http.StatusBadRequest, "a volume needs a name and a region")
+		return
+	}
+
+	v := &fly.Volume{
+		Name:      in.Name,
+		Region:    in.Region,
+		Encrypted: in.Encrypted == nil || *in.Encrypted,
+	}
+	if in.SizeGb != nil {
+		v.SizeGb = *in.SizeGb
+	}
+	if in.SnapshotRetention != nil {
+		v.SnapshotRetention = *in.SnapshotRetention
+	}
+	if in.AutoBackupEnabled != nil {
+		v.AutoBackupEnabled = *in.AutoBackupEnabled
+	}
+	if in.SourceVolumeID != nil {
+		source, ok := a.volumes[*in.SourceVolumeID]
+		if !ok {
+			writeError(w, http.StatusNotFound, "source volume %s not found", *in.SourceVolumeID)
+			return
+		}
+		if v.SizeGb < source.SizeGb {
+			v.SizeGb = source.SizeGb
+		}
+	}
+	if in.SnapshotID != nil && !s.hasSnapshot(a, *in.SnapshotID) {
+		writeError(w, http.StatusNotFound, "snapshot %s not found", *in.SnapshotID)
+		return
+	}
+
+	s.addVolume(a, v)
+	writeJSON(w, http.StatusOK, v)
+}
+
+func (s *Server) hasSnapshot(a *app, id string) bool {
+	for _, snapshots := range a.snapshots {
+		for _, snapshot := range snapshots {
+			if snapshot.ID == id {
+				return true
+			}
+		}
+	}
+	return false
+}
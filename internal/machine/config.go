@@ -27,7 +27,7 @@ func ConfirmConfigChanges(ctx context.Context, machine *fly.Machine, targetConfi
 		colorize = io.ColorScheme()
 	)
 
-	diff := configCompare(ctx, *machine.Config, targetConfig)
+	diff := ConfigCompare(ctx, *machine.Config, targetConfig)
 	if diff == "" {
 		return false, &ErrNoConfigChangesFound{}
 	}
@@ -73,7 +73,9 @@ var cmpOptions = cmp.Options{
 			})),
 }
 
-func configCompare(ctx context.Context, original fly.MachineConfig, new fly.MachineConfig) string {
+// ConfigCompare returns a colorized diff between two machine configs, or an
+// empty string if they are the same.
+func ConfigCompare(ctx context.Context, original fly.MachineConfig, new fly.MachineConfig) string {
 	io := iostreams.FromContext(ctx)
 	colorize := io.ColorScheme()
 
@@ -0,0 +1,15 @@
+package machine
+
+import (
+	fly "github.com/superfly/fly-go"
+)
+
+// DeployHookProcessGroup is the process group of the ephemeral machines
+// running the commands of the [deploy] hooks. They get their own so that they
+// aren't mistaken for the release command.
+const DeployHookProcessGroup = "fly_app_deploy_hook"
+
+// IsDeployHookMachine reports whether m runs the command of a deploy hook.
+func IsDeployHookMachine(m *fly.Machine) bool {
+	return m.HasProcessGroup(DeployHookProcessGroup)
+}
@@ -0,0 +1,313 @@
+package machine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/samber/lo"
+	fly "github.com/superfly/fly-go"
+	"github.com/superfly/fly-go/flaps"
+	"github.com/superfly/flyctl/iostreams"
+)
+
+const (
+	// DeployLockProcessGroup is the process group of the sentinel machine
+	// that holds the deploy lock of an app. The sentinel is never started.
+	DeployLockProcessGroup = "fly_app_deploy_lock"
+
+	// deployLockMachineName is the name of the sentinel. Machine names are
+	// unique within an app, so only one of the deploys racing to create the
+	// sentinel gets to.
+	deployLockMachineName = "fly-deploy-lock"
+
+	deployLockHolderKey = "fly_deploy_lock_holder"
+	deployLockSinceKey  = "fly_deploy_lock_since"
+	deployLockReasonKey = "fly_deploy_lock_reason"
+	deployLockManualKey = "fly_deploy_lock_manual"
+)
+
+// DeployLock describes who holds the deploy lock of an app.
+type DeployLock struct {
+	Holder string    `json:"holder"`
+	Reason string    `json:"reason,omitempty"`
+	Since  time.Time `json:"since,omitempty"`
+	// Manual is set on the locks taken with `fly deploy lock`, which are kept
+	// until `fly deploy unlock` rather than for the length of a deployment.
+	Manual bool `json:"manual"`
+}
+
+func (l *DeployLock) String() string {
+	s := "held by " + l.Holder
+	if !l.Since.IsZero() {
+		s += fmt.Sprintf(" since %s (%s)", l.Since.Format(time.RFC3339), humanize.Time(l.Since))
+	}
+	if l.Reason != "" {
+		s += ": " + l.Reason
+	}
+	return s
+}
+
+func (l *DeployLock) metadata() map[string]string {
+	return map[string]string{
+		deployLockHolderKey: l.Holder,
+		deployLockSinceKey:  l.Since.UTC().Format(time.RFC3339),
+		deployLockReasonKey: l.Reason,
+		deployLockManualKey: strconv.FormatBool(l.Manual),
+	}
+}
+
+func deployLockFromMetadata(metadata map[string]string) *DeployLock {
+	holder := metadata[deployLockHolderKey]
+	if holder == "" {
+		return nil
+	}
+	since, _ := time.Parse(time.RFC3339, metadata[deployLockSinceKey])
+	manual, _ := strconv.ParseBool(metadata[deployLockManualKey])
+	return &DeployLock{
+		Holder: holder,
+		Reason: metadata[deployLockReasonKey],
+		Since:  since,
+		Manual: manual,
+	}
+}
+
+// DeployLockedError is returned when someone else holds the deploy lock.
+type DeployLockedError struct {
+	Lock *DeployLock
+}
+
+func (e *DeployLockedError) Error() string {
+	msg := "deploys are locked, " + e.Lock.String()
+	if e.Lock.Manual {
+		msg += "\nRun `fly deploy unlock` once deploys may resume."
+	}
+	return msg
+}
+
+// IsDeployLockMachine reports whether m is the sentinel of the deploy lock.
+func IsDeployLockMachine(m *fly.Machine) bool {
+	return m.HasProcessGroup(DeployLockProcessGroup)
+}
+
+// findDeployLockMachine returns the sentinel of the app, or nil if it has
+// none. Should racing deploys have created several, the oldest one wins.
+func findDeployLockMachine(ctx context.Context, flapsClient *flaps.Client) (*fly.Machine, error) {
+	machines, err := flapsClient.List(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+	sentinels := lo.Filter(machines, func(m *fly.Machine, _ int) bool {
+		return m.IsActive() && IsDeployLockMachine(m)
+	})
+	if len(sentinels) == 0 {
+		return nil, nil
+	}
+	return lo.MinBy(sentinels, func(a, b *fly.Machine) bool {
+		// CreatedAt is RFC 3339 in UTC, the ID breaks ties within a second
+		if a.CreatedAt != b.CreatedAt {
+			return a.CreatedAt < b.CreatedAt
+		}
+		return a.ID < b.ID
+	}), nil
+}
+
+// ensureDeployLockMachine returns the sentinel of the app, creating it with
+// image in region if the app doesn't have one yet. The sentinel isn't part
+// of Fly Launch, so deployments and scaling leave it alone.
+func ensureDeployLockMachine(ctx context.Context, flapsClient *flaps.Client, image, region string) (*fly.Machine, error) {
+	m, err := findDeployLockMachine(ctx, flapsClient)
+	if err != nil || m != nil {
+		return m, err
+	}
+
+	m, err = flapsClient.Launch(ctx, fly.LaunchMachineInput{
+		Name:       deployLockMachineName,
+		Region:     region,
+		SkipLaunch: true,
+		Config: &fly.MachineConfig{
+			Image: image,
+			Metadata: map[string]string{
+				fly.MachineConfigMetadataKeyFlyProcessGroup: DeployLockProcessGroup,
+			},
+			Restart: fly.MachineRestart{Policy: fly.MachineRestartPolicyNo},
+		},
+	})
+	if err != nil {
+		// Another deploy created the sentinel first, taking its name
+		if winner, findErr := findDeployLockMachine(ctx, flapsClient); findErr == nil && winner != nil {
+			return winner, nil
+		}
+		return nil, fmt.Errorf("failed to create the deploy lock machine: %w", err)
+	}
+
+	// Sentinels created before they were named don't hold the name, so
+	// check no other one came up meanwhile, and destroy ours if we lost
+	winner, err := findDeployLockMachine(ctx, flapsClient)
+	if err != nil {
+		return nil, err
+	}
+	if winner != nil && winner.ID != m.ID {
+		_ = flapsClient.Destroy(ctx, fly.RemoveMachineInput{ID: m.ID, Kill: true}, "")
+		return winner, nil
+	}
+	return m, nil
+}
+
+// GetDeployLock returns the deploy lock of the app flapsClient is bound to,
+// or nil if deploys are unlocked.
+func GetDeployLock(ctx context.Context, flapsClient *flaps.Client) (*DeployLock, error) {
+	m, err := findDeployLockMachine(ctx, flapsClient)
+	if err != nil || m == nil {
+		return nil, err
+	}
+	return readDeployLock(ctx, flapsClient, m)
+}
+
+func readDeployLock(ctx context.Context, flapsClient *flaps.Client, m *fly.Machine) (*DeployLock, error) {
+	metadata, err := flapsClient.GetMetadata(ctx, m.ID)
+	if err != nil {
+		return nil, err
+	}
+	lock := deployLockFromMetadata(metadata)
+	if lock != nil && lock.Manual {
+		return lock, nil
+	}
+
+	// Deployments hold a lease on the sentinel, their lock is stale once the
+	// lease expired
+	lease, err := flapsClient.FindLease(ctx, m.ID)
+	switch {
+	case errors.Is(err, flaps.FlapsErrorNotFound):
+		return nil, nil
+	case err != nil:
+		return nil, err
+	case lease.Data == nil || time.Unix(lease.Data.ExpiresAt, 0).Before(time.Now()):
+		return nil, nil
+	case lock == nil:
+		return &DeployLock{Holder: lease.Data.Owner}, nil
+	}
+	return lock, nil
+}
+
+func writeDeployLock(ctx context.Context, flapsClient *flaps.Client, m *fly.Machine, lock *DeployLock) error {
+	for key, value := range lock.metadata() {
+		if err := flapsClient.SetMetadata(ctx, m.ID, key, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func clearDeployLock(ctx context.Context, flapsClient *flaps.Client, m *fly.Machine) error {
+	for key := range (&DeployLock{}).metadata() {
+		if err := flapsClient.DeleteMetadata(ctx, m.ID, key); err != nil && !errors.Is(err, flaps.FlapsErrorNotFound) {
+			return err
+		}
+	}
+	return nil
+}
+
+// lockedError explains why the lease on the sentinel couldn't be acquired.
+func lockedError(ctx context.Context, flapsClient *flaps.Client, m *fly.Machine, leaseErr error) error {
+	if held, err := readDeployLock(ctx, flapsClient, m); err == nil && held != nil {
+		return &DeployLockedError{Lock: held}
+	}
+	return fmt.Errorf("failed to acquire the deploy lock: %w", leaseErr)
+}
+
+// AcquireDeployLock takes the deploy lock of the app for the length of a
+// deployment. The lock is a lease on the sentinel machine, refreshed in the
+// background until the returned function releases it.
+func AcquireDeployLock(ctx context.Context, lock *DeployLock, image, region string, leaseTimeout time.Duration) (func(), error) {
+	flapsClient := flaps.FromContext(ctx)
+
+	m, err := ensureDeployLockMachine(ctx, flapsClient, image, region)
+	if err != nil {
+		return nil, err
+	}
+
+	lm := NewLeasableMachine(flapsClient, iostreams.FromContext(ctx), m)
+	if err := lm.AcquireLease(ctx, leaseTimeout); err != nil {
+		return nil, lockedError(ctx, flapsClient, m, err)
+	}
+
+	err = func() error {
+		metadata, err := flapsClient.GetMetadata(ctx, m.ID)
+		if err != nil {
+			return err
+		}
+		if held := deployLockFromMetadata(metadata); held != nil && held.Manual {
+			return &DeployLockedError{Lock: held}
+		}
+		return writeDeployLock(ctx, flapsClient, m, lock)
+	}()
+	if err != nil {
+		_ = lm.ReleaseLease(ctx)
+		return nil, err
+	}
+
+	lm.StartBackgroundLeaseRefresh(ctx, leaseTimeout, (leaseTimeout-time.Second)/3)
+	return func() {
+		_ = clearDeployLock(ctx, flapsClient, m)
+		_ = lm.ReleaseLease(ctx)
+	}, nil
+}
+
+// LockDeploys takes the deploy lock of the app until UnlockDeploys, to freeze
+// deploys during an incident.
+func LockDeploys(ctx context.Context, lock *DeployLock, image, region string) error {
+	flapsClient := flaps.FromContext(ctx)
+
+	m, err := ensureDeployLockMachine(ctx, flapsClient, image, region)
+	if err != nil {
+		return err
+	}
+
+	_, release, err := AcquireLease(ctx, m)
+	defer release()
+	if err != nil {
+		return lockedError(ctx, flapsClient, m, err)
+	}
+
+	metadata, err := flapsClient.GetMetadata(ctx, m.ID)
+	if err != nil {
+		return err
+	}
+	if held := deployLockFromMetadata(metadata); held != nil && held.Manual {
+		return &DeployLockedError{Lock: held}
+	}
+
+	lock.Manual = true
+	return writeDeployLock(ctx, flapsClient, m, lock)
+}
+
+// UnlockDeploys releases a lock taken with LockDeploys and returns it, or nil
+// if deploys weren't locked. It fails while a deployment holds the lock.
+func UnlockDeploys(ctx context.Context) (*DeployLock, error) {
+	flapsClient := flaps.FromContext(ctx)
+
+	m, err := findDeployLockMachine(ctx, flapsClient)
+	if err != nil || m == nil {
+		return nil, err
+	}
+
+	_, release, err := AcquireLease(ctx, m)
+	defer release()
+	if err != nil {
+		return nil, lockedError(ctx, flapsClient, m, err)
+	}
+
+	metadata, err := flapsClient.GetMetadata(ctx, m.ID)
+	if err != nil {
+		return nil, err
+	}
+	held := deployLockFromMetadata(metadata)
+	if held == nil {
+		return nil, nil
+	}
+	return held, clearDeployLock(ctx, flapsClient, m)
+}
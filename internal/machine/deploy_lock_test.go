@@ -0,0 +1,95 @@
+package machine
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	fly "github.com/superfly/fly-go"
+	"github.com/superfly/flyctl/internal/flapsemulator"
+)
+
+func TestDeployLockMetadata(t *testing.T) {
+	since := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	lock := &DeployLock{Holder: "alice@example.com", Reason: "incident 42", Since: since, Manual: true}
+
+	assert.Equal(t, lock, deployLockFromMetadata(lock.metadata()))
+	assert.Nil(t, deployLockFromMetadata(map[string]string{"fly_process_group": DeployLockProcessGroup}))
+
+	assert.Equal(t, "held by bob@example.com", (&DeployLock{Holder: "bob@example.com"}).String())
+	assert.Contains(t, lock.String(), "held by alice@example.com since 2024-03-01T12:00:00Z (")
+	assert.Contains(t, lock.String(), "): incident 42")
+
+	err := &DeployLockedError{Lock: lock}
+	assert.Contains(t, err.Error(), "deploys are locked, held by alice@example.com")
+	assert.Contains(t, err.Error(), "fly deploy unlock")
+}
+
+func TestIsDeployLockMachine(t *testing.T) {
+	sentinel := &fly.Machine{Config: &fly.MachineConfig{Metadata: map[string]string{
+		fly.MachineConfigMetadataKeyFlyProcessGroup: DeployLockProcessGroup,
+	}}}
+	app := &fly.Machine{Config: &fly.MachineConfig{Metadata: map[string]string{
+		fly.MachineConfigMetadataKeyFlyProcessGroup: "app",
+	}}}
+
+	assert.True(t, IsDeployLockMachine(sentinel))
+	assert.False(t, IsDeployLockMachine(app))
+	assert.False(t, IsDeployLockMachine(&fly.Machine{}))
+}
+
+func TestEnsureDeployLockMachineConcurrently(t *testing.T) {
+	ctx := context.Background()
+	emulator, client := flapsemulator.NewTestClient(t, "my-app")
+
+	var (
+		wg  sync.WaitGroup
+		ids = make([]string, 5)
+	)
+	for i := range ids {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			m, err := ensureDeployLockMachine(ctx, client, "nginx", "fra")
+			if assert.NoError(t, err) {
+				ids[i] = m.ID
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	sentinels := lo.Filter(emulator.Machines("my-app"), func(m *fly.Machine, _ int) bool {
+		return m.IsActive() && IsDeployLockMachine(m)
+	})
+	require.Len(t, sentinels, 1)
+	assert.Equal(t, []string{sentinels[0].ID}, lo.Uniq(ids))
+	assert.Equal(t, deployLockMachineName, sentinels[0].Name)
+}
+
+func TestFindDeployLockMachineKeepsOldest(t *testing.T) {
+	ctx := context.Background()
+	emulator, client := flapsemulator.NewTestClient(t, "my-app")
+
+	sentinel := func(id, createdAt string) *fly.Machine {
+		return &fly.Machine{
+			ID:        id,
+			State:     fly.MachineStateCreated,
+			CreatedAt: createdAt,
+			Config: &fly.MachineConfig{Image: "nginx", Metadata: map[string]string{
+				fly.MachineConfigMetadataKeyFlyProcessGroup: DeployLockProcessGroup,
+			}},
+		}
+	}
+	emulator.AddMachine("my-app", sentinel("c", "2024-03-01T12:00:01Z"))
+	emulator.AddMachine("my-app", sentinel("b", "2024-03-01T12:00:00Z"))
+	emulator.AddMachine("my-app", sentinel("a", "2024-03-01T12:00:00Z"))
+
+	m, err := ensureDeployLockMachine(ctx, client, "nginx", "fra")
+	require.NoError(t, err)
+	assert.Equal(t, "a", m.ID)
+	assert.Len(t, emulator.Machines("my-app"), 3)
+}
@@ -11,6 +11,7 @@ import (
 	fly "github.com/superfly/fly-go"
 	"github.com/superfly/fly-go/flaps"
 	"github.com/superfly/flyctl/internal/ctrlc"
+	"github.com/superfly/flyctl/internal/deployevents"
 	"github.com/superfly/flyctl/internal/statuslogger"
 	"github.com/superfly/flyctl/iostreams"
 	"github.com/superfly/flyctl/terminal"
@@ -116,7 +117,7 @@ func (lm *leasableMachine) FormattedMachineId() string {
 		return res
 	}
 	procGroup := lm.Machine().ProcessGroup()
-	if procGroup == "" || lm.Machine().IsFlyAppsReleaseCommand() || lm.Machine().IsFlyAppsConsole() {
+	if procGroup == "" || lm.Machine().IsFlyAppsReleaseCommand() || lm.Machine().IsFlyAppsConsole() || IsDeployHookMachine(lm.Machine()) {
 		return res
 	}
 	return fmt.Sprintf("%s [%s]", res, procGroup)
@@ -223,26 +224,6 @@ func (lm *leasableMachine) WaitForState(ctx context.Context, desiredState string
 	}
 }
 
-func (lm *leasableMachine) isConstantlyRestarting(machine *fly.Machine) bool {
-	var ev *fly.MachineEvent
-
-	for _, mev := range machine.Events {
-		if mev.Type == "exit" {
-			ev = mev
-			break
-		}
-	}
-
-	if ev == nil {
-		return false
-	}
-
-	return !ev.Request.ExitEvent.RequestedStop &&
-		ev.Request.ExitEvent.Restarting &&
-		ev.Request.RestartCount > 1 &&
-		ev.Request.ExitEvent.ExitCode != 0
-}
-
 func (lm *leasableMachine) WaitForSmokeChecksToPass(ctx context.Context) error {
 	waitCtx, cancel := ctrlc.HookCancelableContext(context.WithTimeout(ctx, 10*time.Second))
 	defer cancel()
@@ -264,7 +245,7 @@ func (lm *leasableMachine) WaitForSmokeChecksToPass(ctx context.Context) error {
 			uptime = time.Since(startedAt)
 		}
 		switch {
-		case uptime > 10*time.Second && !lm.isConstantlyRestarting(machine):
+		case uptime > 10*time.Second && !IsConstantlyRestarting(machine):
 			return nil
 		case errors.Is(waitCtx.Err(), context.Canceled):
 			return err
@@ -275,7 +256,7 @@ func (lm *leasableMachine) WaitForSmokeChecksToPass(ctx context.Context) error {
 		}
 
 		switch {
-		case lm.isConstantlyRestarting(machine):
+		case IsConstantlyRestarting(machine):
 			return fmt.Errorf("the app appears to be crashing")
 		default:
 			select {
@@ -398,6 +379,11 @@ func (lm *leasableMachine) AcquireLease(ctx context.Context, duration time.Durat
 	}
 	terminal.Debugf("got lease on machine %s: %v\n", lm.machine.ID, lease)
 	lm.leaseNonce = lease.Data.Nonce
+	deployevents.Emit(ctx, deployevents.Event{
+		Type:      deployevents.MachineLeased,
+		MachineID: lm.machine.ID,
+		Region:    lm.machine.Region,
+	})
 	return nil
 }
 
@@ -0,0 +1,246 @@
+package machine
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+	"github.com/samber/lo"
+	fly "github.com/superfly/fly-go"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// ManifestNameKey is the metadata key naming the manifest entry a machine
+	// was created for by `fly machine apply`
+	ManifestNameKey = "fly_manifest"
+	// ManifestHashKey is the metadata key holding the hash of the entry config
+	// a machine was last applied with
+	ManifestHashKey = "fly_manifest_hash"
+)
+
+// Manifest declares machines living outside of fly.toml, such as scheduled
+// jobs or singletons, for `fly machine apply` to reconcile.
+type Manifest struct {
+	Machines []*ManifestMachine `json:"machines"`
+}
+
+// ManifestMachine is a named machine config to run Count times in Region.
+type ManifestMachine struct {
+	Name   string             `json:"name"`
+	Region string             `json:"region"`
+	Count  *int               `json:"count,omitempty"`
+	Config *fly.MachineConfig `json:"config"`
+}
+
+// LoadManifest reads a manifest from a YAML, TOML or JSON file, as told by
+// its extension. Config fields are named as in the Machines API either way.
+func LoadManifest(path string) (*Manifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// YAML and TOML go through a generic map so that fly.MachineConfig's
+	// JSON field names apply to all formats
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		var raw map[string]any
+		if err := yaml.Unmarshal(data, &raw); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+		}
+		if data, err = json.Marshal(raw); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+		}
+	case ".toml":
+		var raw map[string]any
+		if err := toml.Unmarshal(data, &raw); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+		}
+		if data, err = json.Marshal(raw); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+		}
+	}
+
+	var manifest Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	if err := manifest.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid manifest %s: %w", path, err)
+	}
+	return &manifest, nil
+}
+
+// Validate checks that every entry is named uniquely and has a region, an
+// image and a sensible count.
+func (m *Manifest) Validate() error {
+	if len(m.Machines) == 0 {
+		return fmt.Errorf("no machines declared")
+	}
+
+	seen := map[string]bool{}
+	for i, entry := range m.Machines {
+		switch {
+		case entry == nil:
+			return fmt.Errorf("machine #%d is empty", i+1)
+		case entry.Name == "":
+			return fmt.Errorf("machine #%d has no name", i+1)
+		case seen[entry.Name]:
+			return fmt.Errorf("machine '%s' is declared more than once", entry.Name)
+		case entry.Region == "":
+			return fmt.Errorf("machine '%s' has no region", entry.Name)
+		case entry.Count != nil && *entry.Count < 0:
+			return fmt.Errorf("machine '%s' has a negative count", entry.Name)
+		case entry.Config == nil || entry.Config.Image == "":
+			return fmt.Errorf("machine '%s' has no image", entry.Name)
+		}
+		seen[entry.Name] = true
+	}
+	return nil
+}
+
+// Replicas is the number of machines to run for the entry, 1 unless set.
+func (e *ManifestMachine) Replicas() int {
+	if e.Count == nil {
+		return 1
+	}
+	return *e.Count
+}
+
+// MachineName is the name of the replica i of the entry: the name of the
+// entry for the first one, suffixed with i for the others since machine
+// names are unique within an app.
+func (e *ManifestMachine) MachineName(i int) string {
+	if i == 0 {
+		return e.Name
+	}
+	return fmt.Sprintf("%s-%d", e.Name, i)
+}
+
+// Hash identifies the config of the entry, to tell whether machines run it
+// without comparing against configs the platform has filled in defaults of.
+func (e *ManifestMachine) Hash() string {
+	config := CloneConfig(e.Config)
+	delete(config.Metadata, ManifestNameKey)
+	delete(config.Metadata, ManifestHashKey)
+	data, _ := json.Marshal(config)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8])
+}
+
+// MachineConfig is the config machines of the entry are launched or updated
+// with, tagged so that they can be found again.
+func (e *ManifestMachine) MachineConfig() *fly.MachineConfig {
+	config := CloneConfig(e.Config)
+	if config.Metadata == nil {
+		config.Metadata = map[string]string{}
+	}
+	config.Metadata[ManifestNameKey] = e.Name
+	config.Metadata[ManifestHashKey] = e.Hash()
+	return config
+}
+
+type ManifestAction string
+
+const (
+	ManifestCreate    ManifestAction = "create"
+	ManifestUpdate    ManifestAction = "update"
+	ManifestUnchanged ManifestAction = "unchanged"
+	// ManifestOrphan is a machine the manifest no longer declares, that
+	// `fly machine apply --prune` destroys
+	ManifestOrphan ManifestAction = "orphan"
+)
+
+// ManifestChange is what applying a manifest does to one machine.
+type ManifestChange struct {
+	Action ManifestAction
+	// Entry is nil for orphans whose entry was removed from the manifest
+	Entry *ManifestMachine
+	// Machine is nil for machines to create
+	Machine *fly.Machine
+	// Name is the name of the machine to create, one no machine of the app
+	// has yet
+	Name string
+}
+
+// Plan compares the manifest against the machines of an app and returns the
+// changes that reconcile them. Only the machines tagged with ManifestNameKey
+// are considered. Machines of an entry beyond its count or outside of its
+// region are orphans, and replacements are created for them.
+func (m *Manifest) Plan(machines []*fly.Machine) []*ManifestChange {
+	// Orphans are only destroyed once their replacements are up, so their
+	// names are taken too
+	taken := lo.SliceToMap(machines, func(mach *fly.Machine) (string, bool) {
+		return mach.Name, true
+	})
+
+	byName := lo.GroupBy(lo.Filter(machines, func(mach *fly.Machine, _ int) bool {
+		return mach.Config != nil && mach.Config.Metadata[ManifestNameKey] != ""
+	}), func(mach *fly.Machine) string {
+		return mach.Config.Metadata[ManifestNameKey]
+	})
+
+	var changes []*ManifestChange
+	for _, entry := range m.Machines {
+		hash := entry.Hash()
+		existing := byName[entry.Name]
+		delete(byName, entry.Name)
+
+		// Keep the machines already up to date first, so that scaling down
+		// doesn't update some only to destroy others
+		var inRegion, elsewhere []*fly.Machine
+		for _, mach := range existing {
+			if mach.Region == entry.Region {
+				inRegion = append(inRegion, mach)
+			} else {
+				elsewhere = append(elsewhere, mach)
+			}
+		}
+		sort.SliceStable(inRegion, func(i, j int) bool {
+			iCurrent, jCurrent := inRegion[i].Config.Metadata[ManifestHashKey] == hash, inRegion[j].Config.Metadata[ManifestHashKey] == hash
+			if iCurrent != jCurrent {
+				return iCurrent
+			}
+			return inRegion[i].ID < inRegion[j].ID
+		})
+
+		for i, mach := range inRegion {
+			action := ManifestUnchanged
+			switch {
+			case i >= entry.Replicas():
+				action = ManifestOrphan
+			case mach.Config.Metadata[ManifestHashKey] != hash:
+				action = ManifestUpdate
+			}
+			changes = append(changes, &ManifestChange{Action: action, Entry: entry, Machine: mach})
+		}
+		for _, mach := range elsewhere {
+			changes = append(changes, &ManifestChange{Action: ManifestOrphan, Entry: entry, Machine: mach})
+		}
+		for i, replica := len(inRegion), 0; i < entry.Replicas(); i++ {
+			for taken[entry.MachineName(replica)] {
+				replica++
+			}
+			name := entry.MachineName(replica)
+			taken[name] = true
+			changes = append(changes, &ManifestChange{Action: ManifestCreate, Entry: entry, Name: name})
+		}
+	}
+
+	names := lo.Keys(byName)
+	slices.Sort(names)
+	for _, name := range names {
+		for _, mach := range byName[name] {
+			changes = append(changes, &ManifestChange{Action: ManifestOrphan, Machine: mach})
+		}
+	}
+	return changes
+}
@@ -0,0 +1,140 @@
+package machine
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	fly "github.com/superfly/fly-go"
+)
+
+func TestLoadManifest(t *testing.T) {
+	files := map[string]string{
+		"machines.yaml": `
+machines:
+  - name: cron
+    region: ord
+    config:
+      image: registry.fly.io/my-app:cron
+      schedule: daily
+      guest:
+        cpu_kind: shared
+        cpus: 1
+        memory_mb: 256
+`,
+		"machines.toml": `
+[[machines]]
+name = "cron"
+region = "ord"
+
+[machines.config]
+image = "registry.fly.io/my-app:cron"
+schedule = "daily"
+
+[machines.config.guest]
+cpu_kind = "shared"
+cpus = 1
+memory_mb = 256
+`,
+		"machines.json": `{"machines": [{"name": "cron", "region": "ord", "config": {
+			"image": "registry.fly.io/my-app:cron",
+			"schedule": "daily",
+			"guest": {"cpu_kind": "shared", "cpus": 1, "memory_mb": 256}
+		}}]}`,
+	}
+
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+
+		manifest, err := LoadManifest(path)
+		require.NoError(t, err, name)
+		require.Len(t, manifest.Machines, 1, name)
+		entry := manifest.Machines[0]
+		assert.Equal(t, "cron", entry.Name, name)
+		assert.Equal(t, "ord", entry.Region, name)
+		assert.Equal(t, 1, entry.Replicas(), name)
+		assert.Equal(t, &fly.MachineConfig{
+			Image:    "registry.fly.io/my-app:cron",
+			Schedule: "daily",
+			Guest:    &fly.MachineGuest{CPUKind: "shared", CPUs: 1, MemoryMB: 256},
+		}, entry.Config, name)
+	}
+}
+
+func TestManifestValidate(t *testing.T) {
+	config := &fly.MachineConfig{Image: "nginx"}
+	cases := map[string]*Manifest{
+		"no machines declared":             {},
+		"machine #1 has no name":           {Machines: []*ManifestMachine{{Region: "ord", Config: config}}},
+		"machine 'a' has no region":        {Machines: []*ManifestMachine{{Name: "a", Config: config}}},
+		"machine 'a' has no image":         {Machines: []*ManifestMachine{{Name: "a", Region: "ord"}}},
+		"machine 'a' has a negative count": {Machines: []*ManifestMachine{{Name: "a", Region: "ord", Count: lo.ToPtr(-1), Config: config}}},
+		"'a' is declared more than once":   {Machines: []*ManifestMachine{{Name: "a", Region: "ord", Config: config}, {Name: "a", Region: "fra", Config: config}}},
+	}
+	for msg, manifest := range cases {
+		assert.ErrorContains(t, manifest.Validate(), msg)
+	}
+}
+
+func TestManifestPlan(t *testing.T) {
+	cron := &ManifestMachine{Name: "cron", Region: "ord", Config: &fly.MachineConfig{Image: "cron:2"}}
+	web := &ManifestMachine{Name: "web", Region: "fra", Count: lo.ToPtr(2), Config: &fly.MachineConfig{Image: "web:1"}}
+	worker := &ManifestMachine{Name: "worker", Region: "fra", Count: lo.ToPtr(3), Config: &fly.MachineConfig{Image: "worker:1"}}
+	manifest := &Manifest{Machines: []*ManifestMachine{cron, web, worker}}
+
+	newMachine := func(id, region string, config *fly.MachineConfig) *fly.Machine {
+		name := id
+		if entry := config.Metadata[ManifestNameKey]; entry != "" {
+			name = entry
+		}
+		return &fly.Machine{ID: id, Name: name, Region: region, Config: config}
+	}
+	staleCron := cron.MachineConfig()
+	staleCron.Metadata[ManifestHashKey] = "stale"
+	gone := &ManifestMachine{Name: "gone", Region: "ord", Config: &fly.MachineConfig{Image: "gone"}}
+
+	machines := []*fly.Machine{
+		newMachine("m1", "ord", staleCron),
+		newMachine("m2", "fra", web.MachineConfig()),
+		newMachine("m3", "ams", web.MachineConfig()),
+		newMachine("worker-1", "ord", &fly.MachineConfig{Image: "unmanaged"}),
+		newMachine("m4", "ord", gone.MachineConfig()),
+		newMachine("m5", "ord", &fly.MachineConfig{Image: "unmanaged"}),
+	}
+
+	changes := manifest.Plan(machines)
+	summary := lo.Map(changes, func(c *ManifestChange, _ int) []string {
+		entry, id := "", ""
+		if c.Entry != nil {
+			entry = c.Entry.Name
+		}
+		if c.Machine != nil {
+			id = c.Machine.ID
+		}
+		return []string{string(c.Action), entry, id, c.Name}
+	})
+	assert.Equal(t, [][]string{
+		{"update", "cron", "m1", ""},
+		{"unchanged", "web", "m2", ""},
+		{"orphan", "web", "m3", ""},
+		{"create", "web", "", "web-1"},
+		{"create", "worker", "", "worker"},
+		{"create", "worker", "", "worker-2"},
+		{"create", "worker", "", "worker-3"},
+		{"orphan", "", "m4", ""},
+	}, summary)
+
+	config := web.MachineConfig()
+	assert.Equal(t, "web", config.Metadata[ManifestNameKey])
+	assert.Equal(t, web.Hash(), config.Metadata[ManifestHashKey])
+	assert.Nil(t, web.Config.Metadata, "the entry config is left alone")
+
+	// Hashes don't depend on the tracking metadata
+	tagged := &ManifestMachine{Name: "web", Config: config}
+	assert.Equal(t, web.Hash(), tagged.Hash())
+}
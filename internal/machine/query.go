@@ -17,7 +17,7 @@ func ListActive(ctx context.Context) ([]*fly.Machine, error) {
 	}
 
 	machines = lo.Filter(machines, func(m *fly.Machine, _ int) bool {
-		return m.Config != nil && m.IsActive() && !m.IsReleaseCommandMachine() && !m.IsFlyAppsConsole()
+		return m.Config != nil && m.IsActive() && !m.IsReleaseCommandMachine() && !m.IsFlyAppsConsole() && !IsDeployLockMachine(m) && !IsDeployHookMachine(m)
 	})
 
 	return machines, nil
@@ -0,0 +1,120 @@
+package machine
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/samber/lo"
+	fly "github.com/superfly/fly-go"
+)
+
+// SelectorMetadataPrefix selects machines on a metadata key, as in metadata.role=primary
+const SelectorMetadataPrefix = "metadata."
+
+// SelectorKeys are the machine fields a Selector can match on, besides metadata keys
+var SelectorKeys = []string{"id", "name", "process_group", "region", "state", "image"}
+
+// Selector matches machines on comma separated key=value or key!=value
+// terms, all of which must hold. Values can list alternatives separated by
+// '|', like region=fra|ams.
+type Selector []SelectorTerm
+
+type SelectorTerm struct {
+	Key    string
+	Values []string
+	Negate bool
+}
+
+// ParseSelector reads a selector like "process_group=worker,region=fra".
+func ParseSelector(s string) (Selector, error) {
+	var sel Selector
+	for _, part := range strings.Split(s, ",") {
+		if part = strings.TrimSpace(part); part == "" {
+			continue
+		}
+
+		key, value, ok := strings.Cut(part, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid selector '%s', expected key=value", part)
+		}
+		term := SelectorTerm{Key: strings.TrimSpace(key)}
+		term.Key, term.Negate = strings.CutSuffix(term.Key, "!")
+		if !slices.Contains(SelectorKeys, term.Key) && (!strings.HasPrefix(term.Key, SelectorMetadataPrefix) || term.Key == SelectorMetadataPrefix) {
+			return nil, fmt.Errorf("unknown selector key '%s', use one of %s or %s<key>", term.Key, strings.Join(SelectorKeys, ", "), SelectorMetadataPrefix)
+		}
+		for _, v := range strings.Split(value, "|") {
+			term.Values = append(term.Values, strings.TrimSpace(v))
+		}
+		sel = append(sel, term)
+	}
+
+	if len(sel) == 0 {
+		return nil, fmt.Errorf("empty selector, expected key=value terms like process_group=worker,region=fra")
+	}
+	return sel, nil
+}
+
+// Matches tells whether m satisfies every term of s.
+func (s Selector) Matches(m *fly.Machine) bool {
+	return lo.EveryBy(s, func(t SelectorTerm) bool {
+		return t.matches(m)
+	})
+}
+
+// Filter returns the machines s matches.
+func (s Selector) Filter(machines []*fly.Machine) []*fly.Machine {
+	return lo.Filter(machines, func(m *fly.Machine, _ int) bool {
+		return s.Matches(m)
+	})
+}
+
+func (s Selector) String() string {
+	return strings.Join(lo.Map(s, func(t SelectorTerm, _ int) string {
+		return t.String()
+	}), ",")
+}
+
+func (t SelectorTerm) String() string {
+	return t.Key + lo.Ternary(t.Negate, "!=", "=") + strings.Join(t.Values, "|")
+}
+
+func (t SelectorTerm) matches(m *fly.Machine) bool {
+	fields := t.fields(m)
+	found := lo.SomeBy(t.Values, func(v string) bool {
+		return slices.Contains(fields, v)
+	})
+	return found != t.Negate
+}
+
+// fields are the values of m the term compares against. Images match on
+// their tag or full reference.
+func (t SelectorTerm) fields(m *fly.Machine) []string {
+	switch t.Key {
+	case "id":
+		return []string{m.ID}
+	case "name":
+		return []string{m.Name}
+	case "process_group":
+		return []string{m.ProcessGroup()}
+	case "region":
+		return []string{m.Region}
+	case "state":
+		return []string{m.State}
+	case "image":
+		fields := []string{m.ImageRef.Tag, m.FullImageRef()}
+		if m.Config != nil {
+			fields = append(fields, m.Config.Image)
+		}
+		return lo.Compact(fields)
+	}
+
+	key := strings.TrimPrefix(t.Key, SelectorMetadataPrefix)
+	if m.Config == nil {
+		return nil
+	}
+	if v, ok := m.Config.Metadata[key]; ok {
+		return []string{v}
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package machine
+
+import (
+	"testing"
+
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	fly "github.com/superfly/fly-go"
+)
+
+func TestParseSelector(t *testing.T) {
+	sel, err := ParseSelector(" process_group=worker, region!=fra|ams ,metadata.role=primary")
+	require.NoError(t, err)
+	assert.Equal(t, Selector{
+		{Key: "process_group", Values: []string{"worker"}},
+		{Key: "region", Values: []string{"fra", "ams"}, Negate: true},
+		{Key: "metadata.role", Values: []string{"primary"}},
+	}, sel)
+	assert.Equal(t, "process_group=worker,region!=fra|ams,metadata.role=primary", sel.String())
+
+	for _, s := range []string{"", " , ", "region", "zone=fra", "metadata.=x"} {
+		_, err := ParseSelector(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestSelectorFilter(t *testing.T) {
+	newMachine := func(id, group, region, state, tag string, metadata map[string]string) *fly.Machine {
+		metadata = lo.Assign(metadata, map[string]string{fly.MachineConfigMetadataKeyFlyProcessGroup: group})
+		return &fly.Machine{
+			ID:       id,
+			Region:   region,
+			State:    state,
+			ImageRef: fly.MachineImageRef{Registry: "registry.fly.io", Repository: "my-app", Tag: tag},
+			Config:   &fly.MachineConfig{Metadata: metadata},
+		}
+	}
+	machines := []*fly.Machine{
+		newMachine("m1", "app", "fra", "started", "deployment-1", nil),
+		newMachine("m2", "worker", "fra", "started", "deployment-2", map[string]string{"role": "primary"}),
+		newMachine("m3", "worker", "ams", "stopped", "deployment-2", nil),
+		newMachine("m4", "worker", "ord", "started", "deployment-2", nil),
+	}
+
+	ids := func(selector string) []string {
+		sel, err := ParseSelector(selector)
+		require.NoError(t, err)
+		return lo.Map(sel.Filter(machines), func(m *fly.Machine, _ int) string { return m.ID })
+	}
+
+	assert.Equal(t, []string{"m2"}, ids("process_group=worker,region=fra"))
+	assert.Equal(t, []string{"m2", "m3"}, ids("process_group=worker,region=fra|ams"))
+	assert.Equal(t, []string{"m1", "m2", "m4"}, ids("state!=stopped"))
+	assert.Equal(t, []string{"m1"}, ids("image=deployment-1"))
+	assert.Equal(t, []string{"m2", "m3", "m4"}, ids("image=registry.fly.io/my-app:deployment-2"))
+	assert.Equal(t, []string{"m2"}, ids("metadata.role=primary"))
+	assert.Equal(t, []string{"m1", "m3", "m4"}, ids("metadata.role!=primary"))
+	assert.Empty(t, ids("region=syd"))
+}
@@ -0,0 +1,124 @@
+package machine
+
+import (
+	"sort"
+	"time"
+
+	fly "github.com/superfly/fly-go"
+)
+
+// IsConstantlyRestarting tells whether the last exit of machine is a crash it
+// keeps restarting from.
+func IsConstantlyRestarting(machine *fly.Machine) bool {
+	if machine == nil {
+		return false
+	}
+	// Events come newest first
+	for _, ev := range machine.Events {
+		if ev.Type == "exit" {
+			return IsCrashLoopExit(ev)
+		}
+	}
+	return false
+}
+
+// IsCrashLoopExit tells whether ev is a failed exit that wasn't asked for,
+// after which the machine restarts once more despite having restarted already.
+func IsCrashLoopExit(ev *fly.MachineEvent) bool {
+	if ev == nil || ev.Type != "exit" || ev.Request == nil || ev.Request.ExitEvent == nil {
+		return false
+	}
+	exit := ev.Request.ExitEvent
+	return !exit.RequestedStop &&
+		exit.Restarting &&
+		ev.Request.RestartCount > 1 &&
+		exit.ExitCode != 0
+}
+
+// TimelineCheckEvent is the type of the TimelineEvents reporting the status
+// of a health check. Machines only tell when their checks last changed, so
+// older transitions don't show.
+const TimelineCheckEvent = "check"
+
+// TimelineEvent is something that happened to one of the machines of an app.
+type TimelineEvent struct {
+	Time          time.Time `json:"time"`
+	MachineID     string    `json:"machine_id"`
+	Region        string    `json:"region"`
+	ProcessGroup  string    `json:"process_group,omitempty"`
+	Type          string    `json:"type"`
+	Status        string    `json:"status,omitempty"`
+	Source        string    `json:"source,omitempty"`
+	ExitCode      *int      `json:"exit_code,omitempty"`
+	OOMKilled     bool      `json:"oom_killed,omitempty"`
+	RequestedStop bool      `json:"requested_stop,omitempty"`
+	RestartCount  int       `json:"restart_count,omitempty"`
+	Check         string    `json:"check,omitempty"`
+	CheckOutput   string    `json:"check_output,omitempty"`
+	// CrashLoop flags the exits IsCrashLoopExit holds for
+	CrashLoop bool `json:"crash_loop,omitempty"`
+}
+
+// Timeline merges the events and health check statuses of machines in time
+// order, keeping those in [since, until). Zero times leave the window open.
+func Timeline(machines []*fly.Machine, since, until time.Time) []*TimelineEvent {
+	var events []*TimelineEvent
+	keep := func(t time.Time) bool {
+		return (since.IsZero() || !t.Before(since)) && (until.IsZero() || t.Before(until))
+	}
+
+	for _, m := range machines {
+		// Events come newest first, which would reverse those of the same time
+		for i := len(m.Events) - 1; i >= 0; i-- {
+			ev := m.Events[i]
+			if !keep(ev.Time()) {
+				continue
+			}
+			e := &TimelineEvent{
+				Time:         ev.Time().UTC(),
+				MachineID:    m.ID,
+				Region:       m.Region,
+				ProcessGroup: m.ProcessGroup(),
+				Type:         ev.Type,
+				Status:       ev.Status,
+				Source:       ev.Source,
+				CrashLoop:    IsCrashLoopExit(ev),
+			}
+			if ev.Request != nil {
+				e.RestartCount = ev.Request.RestartCount
+				if exitCode, err := ev.Request.GetExitCode(); err == nil {
+					e.ExitCode = &exitCode
+				}
+				if exit := ev.Request.ExitEvent; exit != nil {
+					e.OOMKilled = exit.OOMKilled
+					e.RequestedStop = exit.RequestedStop
+				}
+			}
+			events = append(events, e)
+		}
+
+		for _, check := range m.Checks {
+			if check.UpdatedAt == nil || !keep(*check.UpdatedAt) {
+				continue
+			}
+			events = append(events, &TimelineEvent{
+				Time:         check.UpdatedAt.UTC(),
+				MachineID:    m.ID,
+				Region:       m.Region,
+				ProcessGroup: m.ProcessGroup(),
+				Type:         TimelineCheckEvent,
+				Status:       string(check.Status),
+				Check:        check.Name,
+				CheckOutput:  check.Output,
+			})
+		}
+	}
+
+	sort.SliceStable(events, func(i, j int) bool {
+		if !events[i].Time.Equal(events[j].Time) {
+			return events[i].Time.Before(events[j].Time)
+		}
+		return events[i].MachineID < events[j].MachineID
+	})
+	return events
+}
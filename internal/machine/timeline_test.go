@@ -0,0 +1,91 @@
+package machine
+
+import (
+	"testing"
+	"time"
+
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	fly "github.com/superfly/fly-go"
+)
+
+func exitEvent(at time.Time, exitCode, restarts int, oom bool) *fly.MachineEvent {
+	return &fly.MachineEvent{
+		Type:      "exit",
+		Status:    "stopped",
+		Source:    "flyd",
+		Timestamp: at.UnixMilli(),
+		Request: &fly.MachineRequest{
+			RestartCount: restarts,
+			ExitEvent:    &fly.MachineExitEvent{ExitCode: exitCode, OOMKilled: oom, Restarting: exitCode != 0},
+		},
+	}
+}
+
+func TestIsConstantlyRestarting(t *testing.T) {
+	now := time.Now()
+	crashing := &fly.Machine{Events: []*fly.MachineEvent{
+		{Type: "start", Timestamp: now.UnixMilli()},
+		exitEvent(now.Add(-time.Second), 137, 3, true),
+	}}
+	assert.True(t, IsConstantlyRestarting(crashing))
+
+	recovered := &fly.Machine{Events: []*fly.MachineEvent{
+		exitEvent(now, 0, 3, false),
+		exitEvent(now.Add(-time.Second), 1, 2, false),
+	}}
+	assert.False(t, IsConstantlyRestarting(recovered))
+
+	assert.False(t, IsConstantlyRestarting(&fly.Machine{Events: []*fly.MachineEvent{{Type: "exit"}}}))
+	assert.False(t, IsConstantlyRestarting(nil))
+}
+
+func TestTimeline(t *testing.T) {
+	base := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	at := func(minutes int) time.Time { return base.Add(time.Duration(minutes) * time.Minute) }
+	checkTime := at(4)
+
+	machines := []*fly.Machine{
+		{
+			ID:     "m1",
+			Region: "fra",
+			Config: &fly.MachineConfig{Metadata: map[string]string{fly.MachineConfigMetadataKeyFlyProcessGroup: "app"}},
+			Events: []*fly.MachineEvent{
+				exitEvent(at(3), 137, 2, true),
+				{Type: "start", Status: "started", Timestamp: at(1).UnixMilli()},
+			},
+			Checks: []*fly.MachineCheckStatus{{Name: "http", Status: fly.Critical, Output: "connection refused", UpdatedAt: &checkTime}},
+		},
+		{
+			ID:     "m2",
+			Region: "ams",
+			Events: []*fly.MachineEvent{
+				{Type: "update", Status: "replacing", Timestamp: at(2).UnixMilli()},
+				{Type: "launch", Status: "created", Timestamp: at(0).UnixMilli()},
+			},
+		},
+	}
+
+	summary := func(events []*TimelineEvent) []string {
+		return lo.Map(events, func(e *TimelineEvent, _ int) string { return e.MachineID + " " + e.Type })
+	}
+
+	events := Timeline(machines, time.Time{}, time.Time{})
+	assert.Equal(t, []string{"m2 launch", "m1 start", "m2 update", "m1 exit", "m1 check"}, summary(events))
+
+	exit := events[3]
+	assert.Equal(t, at(3), exit.Time)
+	assert.Equal(t, "app", exit.ProcessGroup)
+	assert.Equal(t, lo.ToPtr(137), exit.ExitCode)
+	assert.True(t, exit.OOMKilled)
+	assert.True(t, exit.CrashLoop)
+	assert.Equal(t, 2, exit.RestartCount)
+
+	check := events[4]
+	assert.Equal(t, "http", check.Check)
+	assert.Equal(t, "critical", check.Status)
+	assert.Equal(t, "connection refused", check.CheckOutput)
+
+	assert.Equal(t, []string{"m1 start", "m2 update"}, summary(Timeline(machines, at(1), at(3))))
+	assert.Equal(t, []string{"m1 exit", "m1 check"}, summary(Timeline(machines, at(3), time.Time{})))
+}
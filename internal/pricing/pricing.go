@@ -0,0 +1,207 @@
+// Package pricing estimates what the machines and volumes of an app cost, to
+// show how a deploy or a scale changes the bill before it happens.
+package pricing
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/samber/lo"
+	fly "github.com/superfly/fly-go"
+	"github.com/superfly/flyctl/internal/render"
+	"golang.org/x/exp/maps"
+)
+
+// Monthly prices in USD of a machine running the whole month, each CPU
+// with its minimum memory and any memory above it charged per GB. The VM size
+// presets flyctl knows carry no prices, so these are copied from the
+// cheapest regions of https://fly.io/docs/about/pricing/ as of October 2026.
+// Other regions cost more, so they are only estimates. Update them, and
+// gpuHourly, whenever that page changes.
+const (
+	SharedCPUMonthly      = 1.94
+	PerformanceCPUMonthly = 31.00
+	MemoryGBMonthly       = 5.00
+	VolumeGBMonthly       = 0.15
+
+	hoursPerMonth = 730
+)
+
+// gpuHourly are the hourly prices in USD of the GPU kinds, from the same page
+// and date as the prices above
+var gpuHourly = map[string]float64{
+	"a10":            1.50,
+	"l40s":           2.50,
+	"a100-pcie-40gb": 2.50,
+	"a100-sxm4-80gb": 3.50,
+}
+
+// MachineMonthly estimates what a machine of the given guest costs running
+// the whole month.
+func MachineMonthly(guest *fly.MachineGuest) float64 {
+	if guest == nil {
+		guest = fly.MachinePresets[fly.DefaultVMSize]
+	}
+
+	cpuPrice, includedMB := SharedCPUMonthly, fly.MIN_MEMORY_MB_PER_SHARED_CPU
+	if guest.CPUKind == "performance" {
+		cpuPrice, includedMB = PerformanceCPUMonthly, fly.MIN_MEMORY_MB_PER_CPU
+	}
+
+	cost := cpuPrice * float64(guest.CPUs)
+	if extraMB := guest.MemoryMB - includedMB*guest.CPUs; extraMB > 0 {
+		cost += MemoryGBMonthly * float64(extraMB) / 1024
+	}
+	cost += gpuHourly[guest.GPUKind] * hoursPerMonth * float64(guest.GPUs)
+	return cost
+}
+
+// VolumeMonthly estimates what a volume of sizeGB costs for a month.
+func VolumeMonthly(sizeGB int) float64 {
+	return VolumeGBMonthly * float64(sizeGB)
+}
+
+// Usage is what the machines of a process group use and cost.
+type Usage struct {
+	CPUKind  string  `json:"cpu_kind"`
+	CPUs     int     `json:"cpus"`
+	MemoryMB int     `json:"memory_mb"`
+	GPUs     int     `json:"gpus,omitempty"`
+	Machines int     `json:"machines"`
+	Volumes  int     `json:"volumes"`
+	VolumeGB int     `json:"volume_gb"`
+	Monthly  float64 `json:"monthly_cost"`
+}
+
+// AddMachine accounts for a machine of the given guest.
+func (u *Usage) AddMachine(guest *fly.MachineGuest) {
+	if guest == nil {
+		guest = fly.MachinePresets[fly.DefaultVMSize]
+	}
+
+	kinds := lo.Compact(strings.Split(u.CPUKind, ","))
+	if !slices.Contains(kinds, guest.CPUKind) {
+		u.CPUKind = strings.Join(append(kinds, guest.CPUKind), ",")
+	}
+	u.CPUs += guest.CPUs
+	u.MemoryMB += guest.MemoryMB
+	u.GPUs += guest.GPUs
+	u.Machines++
+	u.Monthly += MachineMonthly(guest)
+}
+
+// AddVolume accounts for a volume of sizeGB.
+func (u *Usage) AddVolume(sizeGB int) {
+	u.Volumes++
+	u.VolumeGB += sizeGB
+	u.Monthly += VolumeMonthly(sizeGB)
+}
+
+// Change is the usage of a process group before and after a deploy or a scale.
+type Change struct {
+	ProcessGroup string `json:"process_group"`
+	Before       Usage  `json:"before"`
+	After        Usage  `json:"after"`
+}
+
+// MonthlyDelta is how much the monthly cost of the group changes.
+func (c *Change) MonthlyDelta() float64 {
+	return c.After.Monthly - c.Before.Monthly
+}
+
+// Estimate collects the usage of each process group of an app before and
+// after a change.
+type Estimate struct {
+	groups map[string]*Change
+}
+
+func NewEstimate() *Estimate {
+	return &Estimate{groups: make(map[string]*Change)}
+}
+
+func (e *Estimate) group(name string) *Change {
+	c, ok := e.groups[name]
+	if !ok {
+		c = &Change{ProcessGroup: name}
+		e.groups[name] = c
+	}
+	return c
+}
+
+// Before returns the usage of the group before the change.
+func (e *Estimate) Before(group string) *Usage {
+	return &e.group(group).Before
+}
+
+// After returns the usage of the group after the change.
+func (e *Estimate) After(group string) *Usage {
+	return &e.group(group).After
+}
+
+// Changes returns the usage of every group, sorted by name.
+func (e *Estimate) Changes() []*Change {
+	names := maps.Keys(e.groups)
+	slices.Sort(names)
+	return lo.Map(names, func(name string, _ int) *Change { return e.groups[name] })
+}
+
+// Changed reports whether the usage of any group changes.
+func (e *Estimate) Changed() bool {
+	return lo.SomeBy(maps.Values(e.groups), func(c *Change) bool { return c.Before != c.After })
+}
+
+// MonthlyDelta is how much the monthly cost of the app changes.
+func (e *Estimate) MonthlyDelta() float64 {
+	return lo.SumBy(maps.Values(e.groups), func(c *Change) float64 { return c.MonthlyDelta() })
+}
+
+// Render prints the usage of each group before and after the change, and
+// the estimated monthly cost delta.
+func (e *Estimate) Render(w io.Writer) error {
+	rows := lo.Map(e.Changes(), func(c *Change, _ int) []string {
+		return []string{
+			c.ProcessGroup,
+			beforeAfter(c.Before.CPUKind, c.After.CPUKind),
+			beforeAfter(fmt.Sprint(c.Before.CPUs), fmt.Sprint(c.After.CPUs)),
+			beforeAfter(FormatMemory(c.Before.MemoryMB), FormatMemory(c.After.MemoryMB)),
+			beforeAfter(fmt.Sprint(c.Before.Machines), fmt.Sprint(c.After.Machines)),
+			beforeAfter(fmt.Sprintf("%d (%dGB)", c.Before.Volumes, c.Before.VolumeGB), fmt.Sprintf("%d (%dGB)", c.After.Volumes, c.After.VolumeGB)),
+			beforeAfter(FormatCost(c.Before.Monthly), FormatCost(c.After.Monthly)),
+		}
+	})
+	if err := render.Table(w, "Resources", rows, "Process Group", "CPU Kind", "CPUs", "Memory", "Machines", "Volumes", "Est. Monthly"); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "Estimated monthly cost change: %s\n", FormatCostDelta(e.MonthlyDelta()))
+	fmt.Fprintln(w, "(estimated from the prices of the cheapest regions for machines running all month, excluding bandwidth, IPs and discounts)")
+	return nil
+}
+
+func beforeAfter(before, after string) string {
+	if before == after {
+		return after
+	}
+	return fmt.Sprintf("%s -> %s", lo.Ternary(before != "", before, "-"), lo.Ternary(after != "", after, "-"))
+}
+
+// FormatMemory prints sizeMB in GB once it's a round number of them.
+func FormatMemory(sizeMB int) string {
+	if sizeMB >= 1024 && sizeMB%1024 == 0 {
+		return fmt.Sprintf("%dGB", sizeMB/1024)
+	}
+	return fmt.Sprintf("%dMB", sizeMB)
+}
+
+func FormatCost(cost float64) string {
+	return fmt.Sprintf("$%.2f", cost)
+}
+
+func FormatCostDelta(delta float64) string {
+	if delta < 0 {
+		return "-" + FormatCost(-delta)
+	}
+	return "+" + FormatCost(delta)
+}
@@ -0,0 +1,64 @@
+package pricing
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	fly "github.com/superfly/fly-go"
+)
+
+func TestMachineMonthly(t *testing.T) {
+	assert.InDelta(t, 1.94, MachineMonthly(fly.MachinePresets["shared-cpu-1x"]), 0.001)
+	assert.InDelta(t, 1.94, MachineMonthly(nil), 0.001)
+	assert.InDelta(t, 62.00, MachineMonthly(fly.MachinePresets["performance-2x"]), 0.001)
+	// 768MB above the 256MB coming with the shared CPU
+	assert.InDelta(t, 1.94+3.75, MachineMonthly(&fly.MachineGuest{CPUKind: "shared", CPUs: 1, MemoryMB: 1024}), 0.001)
+	assert.InDelta(t, 8*31.00+2.50*730, MachineMonthly(&fly.MachineGuest{CPUKind: "performance", CPUs: 8, MemoryMB: 16384, GPUs: 1, GPUKind: "l40s"}), 0.001)
+}
+
+func TestEstimate(t *testing.T) {
+	small := fly.MachinePresets["shared-cpu-1x"]
+	big := &fly.MachineGuest{CPUKind: "shared", CPUs: 1, MemoryMB: 1024}
+
+	e := NewEstimate()
+	for i := 0; i < 2; i++ {
+		e.Before("app").AddMachine(small)
+		e.After("app").AddMachine(big)
+		e.Before("worker").AddMachine(small)
+		e.After("worker").AddMachine(small)
+	}
+	assert.Equal(t, e.Changes()[1].Before, e.Changes()[1].After)
+
+	e.Before("app").AddVolume(10)
+	e.After("app").AddVolume(10)
+	e.After("app").AddMachine(big)
+	e.After("app").AddVolume(20)
+
+	assert.True(t, e.Changed())
+	assert.InDelta(t, 3*5.69-2*1.94+20*0.15, e.MonthlyDelta(), 0.001)
+
+	app := e.Changes()[0]
+	assert.Equal(t, "app", app.ProcessGroup)
+	assert.Equal(t, Usage{CPUKind: "shared", CPUs: 3, MemoryMB: 3072, Machines: 3, Volumes: 2, VolumeGB: 30, Monthly: 3*5.69 + 30*0.15}, roundMonthly(app.After))
+
+	var buf bytes.Buffer
+	require.NoError(t, e.Render(&buf))
+	assert.Contains(t, buf.String(), "512MB -> 3GB")
+	assert.Contains(t, buf.String(), "1 (10GB) -> 2 (30GB)")
+	assert.Contains(t, buf.String(), "Estimated monthly cost change: +$16.19")
+}
+
+func TestFormat(t *testing.T) {
+	assert.Equal(t, "256MB", FormatMemory(256))
+	assert.Equal(t, "1536MB", FormatMemory(1536))
+	assert.Equal(t, "2GB", FormatMemory(2048))
+	assert.Equal(t, "+$1.50", FormatCostDelta(1.5))
+	assert.Equal(t, "-$0.25", FormatCostDelta(-0.25))
+}
+
+func roundMonthly(u Usage) Usage {
+	u.Monthly = float64(int(u.Monthly*100+0.5)) / 100
+	return u
+}
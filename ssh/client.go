@@ -3,6 +3,7 @@ package ssh
 import (
 	"context"
 	"errors"
+	"io"
 	"log"
 	"net"
 
@@ -118,3 +119,79 @@ func (c *Client) Shell(ctx context.Context, sessIO *SessionIO, cmd string) error
 
 	return sessIO.attach(ctx, sess, cmd)
 }
+
+// Exec runs cmd without a PTY, streaming its output to stdout and stderr, and
+// returns its exit code. Unlike Shell, it returns once all of the output is
+// copied. The command is killed when ctx is done. Stdin stops being read once
+// the command exits, and is closed then when it's an io.Closer, to let go of
+// a pending read.
+func (c *Client) Exec(ctx context.Context, cmd string, stdin io.Reader, stdout, stderr io.Writer) (int, error) {
+	if c.Client == nil {
+		if err := c.Connect(ctx); err != nil {
+			return 0, err
+		}
+	}
+
+	sess, err := c.Client.NewSession()
+	if err != nil {
+		return 0, err
+	}
+	defer sess.Close()
+
+	sess.Stdout = stdout
+	sess.Stderr = stderr
+	// Stdin is copied on the side, the session would wait on it otherwise
+	sessStdin, err := sess.StdinPipe()
+	if err != nil {
+		return 0, err
+	}
+	if err := sess.Start(cmd); err != nil {
+		return 0, err
+	}
+	exited := make(chan struct{})
+	defer func() {
+		close(exited)
+		if closer, ok := stdin.(io.Closer); ok {
+			_ = closer.Close()
+		}
+	}()
+	go func() {
+		defer sessStdin.Close()
+		if stdin != nil {
+			_, _ = io.Copy(sessStdin, &stoppableReader{r: stdin, stop: exited})
+		}
+	}()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- sess.Wait()
+	}()
+
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		_ = sess.Signal(ssh.SIGKILL)
+		return 0, ctx.Err()
+	}
+
+	var exitErr *ssh.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitStatus(), nil
+	}
+	return 0, err
+}
+
+// stoppableReader reads from r until stop is closed
+type stoppableReader struct {
+	r    io.Reader
+	stop <-chan struct{}
+}
+
+func (s *stoppableReader) Read(p []byte) (int, error) {
+	select {
+	case <-s.stop:
+		return 0, io.EOF
+	default:
+		return s.r.Read(p)
+	}
+}
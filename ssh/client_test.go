@@ -0,0 +1,117 @@
+package ssh
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+// newExecClient connects to a server running the exec requests it gets with
+// run, which returns the exit status of the command.
+func newExecClient(t *testing.T, run func(cmd string, ch ssh.Channel) uint32) *Client {
+	t.Helper()
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	hostKey, err := ssh.NewSignerFromKey(key)
+	require.NoError(t, err)
+	serverConfig := &ssh.ServerConfig{NoClientAuth: true}
+	serverConfig.AddHostKey(hostKey)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { l.Close() })
+
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		_, chans, reqs, err := ssh.NewServerConn(conn, serverConfig)
+		if err != nil {
+			return
+		}
+		go ssh.DiscardRequests(reqs)
+		for newChannel := range chans {
+			ch, requests, err := newChannel.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				for req := range requests {
+					if req.Type != "exec" {
+						_ = req.Reply(false, nil)
+						continue
+					}
+					var payload struct{ Command string }
+					_ = ssh.Unmarshal(req.Payload, &payload)
+					_ = req.Reply(true, nil)
+
+					status := run(payload.Command, ch)
+					_, _ = ch.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{status}))
+					ch.Close()
+				}
+			}()
+		}
+	}()
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	require.NoError(t, err)
+	sshConn, chans, reqs, err := ssh.NewClientConn(conn, l.Addr().String(), &ssh.ClientConfig{
+		User:            "root",
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+	})
+	require.NoError(t, err)
+	c := &Client{Client: ssh.NewClient(sshConn, chans, reqs), conn: sshConn}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func TestExec(t *testing.T) {
+	c := newExecClient(t, func(cmd string, ch ssh.Channel) uint32 {
+		in, _ := io.ReadAll(ch)
+		_, _ = io.WriteString(ch, cmd+" "+string(in))
+		_, _ = io.WriteString(ch.Stderr(), "oops")
+		return 3
+	})
+
+	var stdout, stderr bytes.Buffer
+	exitCode, err := c.Exec(context.Background(), "cat", strings.NewReader("hello"), &stdout, &stderr)
+	require.NoError(t, err)
+	assert.Equal(t, 3, exitCode)
+	assert.Equal(t, "cat hello", stdout.String())
+	assert.Equal(t, "oops", stderr.String())
+}
+
+func TestExecStopsReadingStdin(t *testing.T) {
+	c := newExecClient(t, func(cmd string, ch ssh.Channel) uint32 {
+		return 0
+	})
+
+	// Nothing is ever written to stdin, reading it blocks until it's closed
+	stdin, stdinWriter := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		_, err := c.Exec(context.Background(), "true", stdin, io.Discard, io.Discard)
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		require.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Exec didn't return once the command exited")
+	}
+	_, err := stdinWriter.Write([]byte("late"))
+	assert.ErrorIs(t, err, io.ErrClosedPipe)
+}